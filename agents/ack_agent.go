@@ -31,6 +31,7 @@ func (a *AckAgent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case i := <-incomingPackets:
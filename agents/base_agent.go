@@ -11,8 +11,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	. "github.com/QUIC-Tracker/quic-tracker"
+	"io"
 	"log"
 	"os"
+	"runtime/debug"
 	"strings"
 	"time"
 )
@@ -34,23 +36,40 @@ type RequestFrameArgs struct {
 
 // All agents should embed this structure
 type BaseAgent struct {
-	name   string
-	Logger *log.Logger
-	close  chan bool  // true if should restart, false otherwise
-	closed chan bool
+	name      string
+	Logger    *log.Logger
+	logOutput io.Writer
+	close     chan bool  // true if should restart, false otherwise
+	closed    chan bool
 }
 
 func (a *BaseAgent) Name() string { return a.name }
 
+// SetLogOutput sets the writer of the logs of the agent, os.Stderr by default. It must be called before Init().
+// ConnectionAgents sets it to the log output of their connection.
+func (a *BaseAgent) SetLogOutput(w io.Writer) { a.logOutput = w }
+
 // All agents that embed this structure must call Init() as soon as their Run() method is called
 func (a *BaseAgent) Init(name string, ODCID ConnectionID) {
 	a.name = name
-	a.Logger = log.New(os.Stderr, fmt.Sprintf("[%s/%s] ", hex.EncodeToString(ODCID), a.Name()), log.Lshortfile)
+	if a.logOutput == nil {
+		a.logOutput = os.Stderr
+	}
+	a.Logger = log.New(a.logOutput, fmt.Sprintf("[%s/%s] ", hex.EncodeToString(ODCID), a.Name()), log.Lshortfile)
 	a.Logger.Println("Agent started")
 	a.close = make(chan bool)
 	a.closed = make(chan bool)
 }
 
+// RecoverPanic must be deferred by the goroutines of the agent. It recovers a panic of the goroutine and reports it as
+// a crash of the connection, so that the other connections of the process are not affected.
+func (a *BaseAgent) RecoverPanic(conn *Connection) {
+	if r := recover(); r != nil {
+		a.Logger.Printf("Agent panicked: %v\n%s", r, debug.Stack())
+		conn.Crash(fmt.Sprintf("%s panicked: %v", a.Name(), r))
+	}
+}
+
 func (a *BaseAgent) Stop() {
 	select {
 	case <-a.close:
@@ -116,6 +135,12 @@ func AttachAgentsToConnection(conn *Connection, agents ...Agent) *ConnectionAgen
 	}
 
 	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				conn.Logger.Printf("Restarting the agents panicked: %v\n%s", r, debug.Stack())
+				conn.Crash(fmt.Sprintf("restarting the agents panicked: %v", r))
+			}
+		}()
 		for {
 			select {
 			case <-conn.ConnectionRestart:
@@ -140,6 +165,9 @@ func AttachAgentsToConnection(conn *Connection, agents ...Agent) *ConnectionAgen
 }
 
 func (c *ConnectionAgents) Add(agent Agent) {
+	if l, ok := agent.(interface{ SetLogOutput(io.Writer) }); ok {
+		l.SetLogOutput(c.conn.LogOutput)
+	}
 	agent.Run(c.conn)
 	c.agents[agent.Name()] = agent
 }
@@ -0,0 +1,28 @@
+package agents
+
+import (
+	. "github.com/QUIC-Tracker/quic-tracker"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestBaseAgent_RecoverPanic(t *testing.T) {
+	conn := &Connection{Crashed: make(chan bool)}
+	a := &BaseAgent{}
+	a.SetLogOutput(ioutil.Discard)
+	a.Init("TestAgent", ConnectionID{1, 2})
+
+	go func() {
+		defer a.RecoverPanic(conn)
+		panic("malformed packet")
+	}()
+	select {
+	case <-conn.Crashed:
+		if reason := conn.CrashReason(); reason != "TestAgent panicked: malformed packet" {
+			t.Errorf("unexpected crash reason %q", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the panic was not reported as a crash of the connection")
+	}
+}
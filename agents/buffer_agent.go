@@ -24,6 +24,7 @@ func (a *BufferAgent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case i := <-uPChan:
@@ -27,6 +27,7 @@ func (a *ClosingAgent) Run(conn *Connection) {  // TODO: Observe incoming CC and
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 
 		for {
 			select {
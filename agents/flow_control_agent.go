@@ -2,6 +2,7 @@ package agents
 
 import (
 	. "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
 	"math"
 )
 
@@ -98,6 +99,7 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case i := <-tpReceived:
@@ -121,6 +123,7 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 							}
 							a.RemoteFC.MaxData = ft.MaximumData
 							a.Logger.Printf("Maximum Data is now %d bytes\n", a.RemoteFC.MaxData)
+							a.qlogCreditUpdated("remote", qlog.FlowControlConnection, nil, a.RemoteFC.MaxData)
 						case *MaxStreamsFrame:
 							dest := &a.RemoteFC.StreamsBidi
 							blocked := &bidiStreamsBlocked
@@ -137,6 +140,11 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 							}
 							*dest = ft.MaximumStreams
 							a.Logger.Printf("Number of %s is now %d\n", ft.StreamsType.String(), ft.MaximumStreams)
+							if ft.StreamsType == UniStreams {
+								a.qlogCreditUpdated("remote", qlog.FlowControlUniStream, nil, ft.MaximumStreams)
+							} else {
+								a.qlogCreditUpdated("remote", qlog.FlowControlBidiStream, nil, ft.MaximumStreams)
+							}
 						case *MaxStreamDataFrame:
 							stream := conn.Streams.Get(ft.StreamId)
 							if IsUniServer(ft.StreamId) {
@@ -151,7 +159,8 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 								delete(blockedStreams, ft.StreamId)
 							}
 							stream.WriteLimit = ft.MaximumStreamData
-							a.Logger.Printf("Stream %d write limit is now %d bytes\n", stream.WriteLimit)
+							a.Logger.Printf("Stream %d write limit is now %d bytes\n", ft.StreamId, stream.WriteLimit)
+							a.qlogCreditUpdated("remote", qlog.FlowControlStream, &ft.StreamId, stream.WriteLimit)
 						case *StreamFrame:
 							stream := conn.Streams.Get(ft.StreamId)
 
@@ -244,10 +253,13 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 				if dataLimitsChanged {
 					allFrames = append(allFrames, &MaxDataFrame{a.LocalFC.MaxData})
 					dataLimitsChanged = false
+					a.qlogCreditUpdated("local", qlog.FlowControlConnection, nil, a.LocalFC.MaxData)
 				}
 				for streamId, limit := range streamsDataLimits {
 					allFrames = append(allFrames, &MaxStreamDataFrame{streamId, limit})
 					delete(streamsDataLimits, streamId)
+					id := streamId
+					a.qlogCreditUpdated("local", qlog.FlowControlStream, &id, limit)
 				}
 				if dataBlocked {
 					allFrames = append(allFrames, &DataBlockedFrame{a.RemoteFC.MaxData})
@@ -279,6 +291,11 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 	}()
 }
 
+// Records in the qlog a credit granted by the given owner.
+func (a *FlowControlAgent) qlogCreditUpdated(owner string, creditType string, streamId *uint64, limit uint64) {
+	a.conn.QLogEvents <- a.conn.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.FlowControlUpdated, &qlog.FlowControlUpdated{Owner: owner, Type: creditType, StreamID: streamId, Limit: limit})
+}
+
 func (a *FlowControlAgent) ReserveCredit(streamId uint64, amount uint64) uint64 {
 	select {
 	case a.reserveCredit <- reserveCreditArgs{streamId, amount, false}:
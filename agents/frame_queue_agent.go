@@ -114,12 +114,13 @@ func (a *FrameQueueAgent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case i := <-incFrames:
 				qf := i.(QueuedFrame)
 				heap.Push(frameBuffer[qf.EncryptionLevel], qf.Frame)
-				a.Logger.Printf("Received a 0x%02x frame for encryption level %s\n", qf.FrameType(), qf.EncryptionLevel)
+				a.Logger.Printf("Received a %s frame for encryption level %s\n", qf.FrameType(), qf.EncryptionLevel)
 				conn.PreparePacket.Submit(qf.EncryptionLevel)
 			case args := <-a.requestFrame:
 				var frames []Frame
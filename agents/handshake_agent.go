@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	. "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/metrics"
 	"strings"
 	"time"
 )
@@ -49,10 +50,12 @@ func (a *HandshakeAgent) Run(conn *Connection) {
 	tlsCompleted := false
 	pingTimer := time.NewTimer(0)
 	var tlsPacket Packet
+	start := time.Now()
 
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case <-a.sendInitial:
@@ -75,7 +78,7 @@ func (a *HandshakeAgent) Run(conn *Connection) {
 						conn.DestinationCID = p.Header().(*LongHeader).SourceCID
 						a.retrySource = p.Header().(*LongHeader).SourceCID
 						tlsTP, alpn := conn.TLSTPHandler, conn.ALPN
-						conn.TransitionTo(QuicVersion, alpn)
+						conn.TransitionTo(conn.Version, alpn)
 						conn.TLSTPHandler = tlsTP
 						conn.Token = p.RetryToken
 						close(conn.ConnectionRestart)
@@ -92,6 +95,7 @@ func (a *HandshakeAgent) Run(conn *Connection) {
 						a.Logger.Printf("Received first Initial packet from server, switching DCID to %s\n", hex.EncodeToString(conn.DestinationCID))
 					}
 					if p.Contains(HandshakeDoneType) {
+						metrics.HandshakeDuration.With(conn.ServerName).Observe(time.Now().Sub(start).Seconds())
 						a.HandshakeStatus.Submit(HandshakeStatus{true, tlsPacket, nil})
 						conn.IncomingPackets.Unregister(incPackets)
 						if !a.DontDropKeys {
@@ -113,6 +117,7 @@ func (a *HandshakeAgent) Run(conn *Connection) {
 					for _, f := range p.GetAll(CryptoType) {
 						cf := f.(*CryptoFrame)
 						if cf.CryptoData[0] == 0x14 { // TLS Finished
+							metrics.HandshakeDuration.With(conn.ServerName).Observe(time.Now().Sub(start).Seconds())
 							a.HandshakeStatus.Submit(HandshakeStatus{true, tlsPacket, nil})
 							conn.IncomingPackets.Unregister(incPackets)
 							conn.OutgoingPackets.Unregister(outPackets)
@@ -171,6 +176,7 @@ func (a *HandshakeAgent) Run(conn *Connection) {
 	status := a.HandshakeStatus.RegisterNewChan(1)
 
 	go func() {
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case i := <-status:
@@ -40,6 +40,7 @@ func (a *HTTP09Agent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		<-a.close
 	}()
 }
@@ -51,6 +52,7 @@ func (a *HTTP09Agent) SendRequest(path, method, authority string, headers map[st
 	responseChan := make(chan HTTPResponse, 1)
 
 	go func() {
+		defer a.RecoverPanic(a.conn)
 		response := HTTP09Response{streamID: streamID}
 		for i := range responseStream {
 			data := i.([]byte)
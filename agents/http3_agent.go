@@ -4,12 +4,40 @@ import (
 	"bytes"
 	. "github.com/QUIC-Tracker/quic-tracker"
 	"github.com/QUIC-Tracker/quic-tracker/http3"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
+	"io"
 	"math"
+	"strings"
+	"sync"
 )
 
+// An HTTP3Request is a request whose body is sent in DATA frames after its headers, and which can end with trailers.
+type HTTP3Request struct {
+	Method     string
+	Authority  string
+	Path       string
+	Headers    []HTTPHeader // Sent after the pseudo-headers, with a user-agent unless one is given
+	Body       []byte
+	BodyReader io.Reader    // Read until EOF after the Body is sent, each read being sent in its own DATA frame
+	Trailers   []HTTPHeader // Sent in a HEADERS frame after the body
+
+	DataBeforeHeaders bool // Sends the Body before the headers, which makes the request malformed, see RFC 9114 §4.1
+}
+
+// hasBody reports whether DATA frames follow the headers of the request.
+func (r *HTTP3Request) hasBody() bool {
+	return r.BodyReader != nil || (len(r.Body) > 0 && !r.DataBeforeHeaders)
+}
+
+// The maximum number of bytes read from the BodyReader of a request for each DATA frame.
+const http3BodyReadSize = 16384
+
 type HTTP3Response struct {
 	HTTP09Response
 	headers  []HTTPHeader
+	interim  [][]HTTPHeader
+	trailers []HTTPHeader
+	finalHeadersReceived bool
 
 	fin              bool
 	headersRemaining int
@@ -22,8 +50,46 @@ func (r HTTP3Response) Complete() bool {
 	return r.fin && r.totalReceived > 0 && r.totalProcessed == r.totalReceived && r.headersRemaining == 0
 }
 
+// Headers returns the headers of the final response, i.e. neither the ones of the interim responses nor the trailers.
 func (r HTTP3Response) Headers() []HTTPHeader { return r.headers }
 
+// InterimResponses returns the headers of the informational responses received before the final one, see RFC 9114 §4.1.
+func (r HTTP3Response) InterimResponses() [][]HTTPHeader { return r.interim }
+
+// Trailers returns the headers received after the body of the response.
+func (r HTTP3Response) Trailers() []HTTPHeader { return r.trailers }
+
+// Status returns the status code of the final response.
+func (r HTTP3Response) Status() string { return headerValue(r.headers, ":status") }
+
+func headerValue(headers []HTTPHeader, name string) string {
+	for _, h := range headers {
+		if h.Name == name {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// addHeaders records a block of headers received, which belongs to an interim response until the final headers are
+// received, and to the trailers afterwards.
+func (r *HTTP3Response) addHeaders(headers []HTTPHeader) {
+	if r.finalHeadersReceived {
+		r.trailers = append(r.trailers, headers...)
+	} else if isInterim(headers) {
+		r.interim = append(r.interim, headers)
+	} else {
+		r.headers = headers
+		r.finalHeadersReceived = true
+	}
+}
+
+// isInterim reports whether the headers are the ones of an informational response.
+func isInterim(headers []HTTPHeader) bool {
+	status := headerValue(headers, ":status")
+	return len(status) == 3 && strings.HasPrefix(status, "1")
+}
+
 type HTTP3FrameReceived struct {
 	StreamID uint64
 	Frame    http3.HTTPFrame
@@ -47,6 +113,8 @@ type HTTP3Agent struct {
 	streamData           chan streamData
 	streamDataBuffer     map[uint64]*bytes.Buffer
 	responseBuffer       map[uint64]*HTTP3Response
+	requests             map[uint64]*http3Request // The requests whose body or trailers remain to be sent
+	requestsLock         sync.Mutex
 	controlStreamID      uint64
 	peerControlStreamID  uint64
 	nextRequestStream    uint64
@@ -60,6 +128,7 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 	a.Init("HTTP3Agent", conn.OriginalDestinationCID)
 	a.conn = conn
 	a.QPACK = QPACKAgent{EncoderStreamID: 6, DecoderStreamID: 10, DisableStreams: a.DisableQPACKStreams}
+	a.QPACK.SetLogOutput(a.logOutput)
 	a.QPACK.Run(conn)
 
 	a.httpResponseReceived = NewBroadcaster(1000)
@@ -76,11 +145,15 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 	peerControlStream := make(chan interface{}, 1000)
 	peerControlStreamBuffer := new(bytes.Buffer)
 	a.conn.Streams.Send(a.controlStreamID, []byte{http3.StreamTypeControl}, false)
-	a.sendFrameOnStream(http3.NewSETTINGS(nil), a.controlStreamID, false)
+	a.qlogStreamTypeSet("local", a.controlStreamID, qlog.H3StreamTypeControl, http3.StreamTypeControl)
+	settings := http3.NewSETTINGS(nil)
+	a.sendFrameOnStream(settings, a.controlStreamID, false)
+	a.qlog(qlog.Categories.H3.ParametersSet, http3.QLogSettings(settings, "local"))
 
 	a.streamData = make(chan streamData)
 	a.streamDataBuffer = make(map[uint64]*bytes.Buffer)
 	a.responseBuffer = make(map[uint64]*HTTP3Response)
+	a.requests = make(map[uint64]*http3Request)
 
 	settingsHeaderTableSize := uint64(4096)
 	settingsQPACKBlockedStreams := uint64(100)
@@ -88,6 +161,7 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case i := <-incomingPackets:
@@ -111,8 +185,13 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 								}
 								conn.Streams.Get(s.StreamId).ReadChan.Register(peerControlStream)
 								a.Logger.Printf("Peer opened control stream on stream %d\n", s.StreamId)
-							} else {
+								a.qlogStreamTypeSet("remote", s.StreamId, qlog.H3StreamTypeControl, httpStreamType.Value)
+							} else if httpStreamType.Value == http3.StreamTypePush {
+								a.Logger.Printf("Peer opened push stream on stream %d, ignoring it\n", s.StreamId)
+								a.qlogStreamTypeSet("remote", s.StreamId, qlog.H3StreamTypePush, httpStreamType.Value)
+							} else if httpStreamType.Value != QPACKEncoderStreamValue && httpStreamType.Value != QPACKDecoderStreamValue {
 								a.Logger.Printf("Unknown stream type %d, ignoring it\n", httpStreamType.Value)
+								a.qlogStreamTypeSet("remote", s.StreamId, qlog.H3StreamTypeUnknown, httpStreamType.Value)
 							}
 						}
 					}
@@ -154,6 +233,7 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 						continue
 					}
 					a.ReceivedSettings = f
+					a.qlog(qlog.Categories.H3.ParametersSet, http3.QLogSettings(f, "remote"))
 					for _, s := range f.Settings {
 						if s.Identifier.Value == http3.SETTINGS_HEADER_TABLE_SIZE {
 							settingsHeaderTableSize = s.Value.Value
@@ -184,12 +264,10 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 					continue
 				}
 				response.headersRemaining--
-				response.headers = append(a.responseBuffer[dHdrs.StreamID].headers, dHdrs.Headers...)
+				response.addHeaders(dHdrs.Headers)
 				a.checkResponse(response)
 			case i := <-encodedHeaders:
-				eHdrs := i.(EncodedHeaders)
-				a.sendFrameOnStream(http3.NewHEADERS(eHdrs.Headers), eHdrs.StreamID, true)
-				a.Logger.Printf("Sent a %d-byte long block of headers on stream %d\n", len(eHdrs.Headers), eHdrs.StreamID)
+				a.sendHeaders(i.(EncodedHeaders))
 			case <-a.close:
 				return
 			}
@@ -200,6 +278,17 @@ func (a *HTTP3Agent) sendFrameOnStream(frame http3.HTTPFrame, streamID uint64, f
 	buf := new(bytes.Buffer)
 	frame.WriteTo(buf)
 	a.conn.Streams.Send(streamID, buf.Bytes(), fin)
+	a.qlog(qlog.Categories.H3.FrameCreated, http3.QLogFrameEvent(frame, streamID))
+}
+func (a *HTTP3Agent) qlog(eventType string, data interface{}) {
+	a.conn.QLogEvents <- a.conn.QLogTrace.NewEvent(qlog.Categories.H3.Category, eventType, data)
+}
+func (a *HTTP3Agent) qlogStreamTypeSet(owner string, streamID uint64, streamType string, value uint64) {
+	e := &qlog.H3StreamTypeSet{Owner: owner, StreamID: streamID, StreamType: streamType}
+	if streamType == qlog.H3StreamTypeUnknown {
+		e.UnknownType = &value
+	}
+	a.qlog(qlog.Categories.H3.StreamTypeSet, e)
 }
 func (a *HTTP3Agent) attemptDecoding(streamID uint64, buffer *bytes.Buffer) {
 	r := bytes.NewReader(buffer.Bytes())
@@ -210,6 +299,7 @@ func (a *HTTP3Agent) attemptDecoding(streamID uint64, buffer *bytes.Buffer) {
 		if buffer.Len() >= t.Length + l.Length + int(l.Value) {
 			r = bytes.NewReader(buffer.Next(t.Length + l.Length + int(l.Value)))
 			f := http3.ReadHTTPFrame(r)
+			a.qlog(qlog.Categories.H3.FrameParsed, (*qlog.H3FrameParsed)(http3.QLogFrameEvent(f, streamID)))
 			a.FrameReceived.Submit(HTTP3FrameReceived{streamID, f})
 			a.attemptDecoding(streamID, buffer)
 		} else {
@@ -225,22 +315,26 @@ func (a *HTTP3Agent) checkResponse(response *HTTP3Response) {
 	}
 }
 func (a *HTTP3Agent) SendRequest(path, method, authority string, headers map[string]string) chan HTTPResponse {
-	if headers == nil {
-		headers = make(map[string]string)
-	}
-
-	if _, ok := headers["user-agent"]; !ok {
-		headers["user-agent"] = "QUIC-Tracker/" + GitCommit()
+	var hdrs []HTTPHeader
+	for k, v := range headers {
+		hdrs = append(hdrs, HTTPHeader{k, v})
 	}
+	_, responseChan := a.SendHTTP3Request(&HTTP3Request{Method: method, Authority: authority, Path: path, Headers: hdrs})
+	return responseChan
+}
 
-	hdrs := []HTTPHeader{
-		{":method", method},
-		{":scheme", "https"},
-		{":authority", authority},
-		{":path", path},
+// SendHTTP3Request sends the request on the next request stream. It returns the ID of this stream and a channel
+// receiving its response.
+func (a *HTTP3Agent) SendHTTP3Request(request *HTTP3Request) (uint64, chan HTTPResponse) {
+	hdrs := []HTTPHeader{{":method", request.Method}}
+	if request.Method == "CONNECT" { // See RFC 9114 §4.4
+		hdrs = append(hdrs, HTTPHeader{":authority", request.Authority})
+	} else {
+		hdrs = append(hdrs, HTTPHeader{":scheme", "https"}, HTTPHeader{":authority", request.Authority}, HTTPHeader{":path", request.Path})
 	}
-	for k, v := range headers {
-		hdrs = append(hdrs, HTTPHeader{k, v})
+	hdrs = append(hdrs, request.Headers...)
+	if headerValue(request.Headers, "user-agent") == "" {
+		hdrs = append(hdrs, HTTPHeader{"user-agent", "QUIC-Tracker/" + GitCommit()})
 	}
 
 	streamID := a.nextRequestStream
@@ -249,8 +343,10 @@ func (a *HTTP3Agent) SendRequest(path, method, authority string, headers map[str
 	a.streamDataBuffer[streamID] = new(bytes.Buffer)
 	response := &HTTP3Response{HTTP09Response: HTTP09Response{streamID: streamID}, responseChan: make(chan HTTPResponse, 1)}
 	a.responseBuffer[streamID] = response
+	a.qlogStreamTypeSet("local", streamID, qlog.H3StreamTypeRequest, 0)
 
 	go func() { // Pipes the data from the response stream to the agent
+		defer a.RecoverPanic(a.conn)
 		defer func() {
 			if !stream.ReadChan.IsClosed() {
 				stream.ReadChan.Unregister(streamChan)
@@ -276,9 +372,75 @@ func (a *HTTP3Agent) SendRequest(path, method, authority string, headers map[str
 		}
 	}()
 
+	if request.hasBody() || len(request.Trailers) > 0 || request.DataBeforeHeaders {
+		a.requestsLock.Lock()
+		a.requests[streamID] = &http3Request{HTTP3Request: request}
+		a.requestsLock.Unlock()
+	}
+	if request.DataBeforeHeaders && len(request.Body) > 0 {
+		a.sendFrameOnStream(http3.NewDATA(request.Body), streamID, false)
+	}
 	a.QPACK.EncodeHeaders <- DecodedHeaders{streamID, hdrs}
 	a.nextRequestStream += 4
-	return response.responseChan
+	return streamID, response.responseChan
+}
+
+// http3Request tracks the sending of a request with a body or trailers.
+type http3Request struct {
+	*HTTP3Request
+	headersSent bool
+}
+
+// sendHeaders sends a block of headers encoded for a request stream, then the rest of the request.
+func (a *HTTP3Agent) sendHeaders(eHdrs EncodedHeaders) {
+	a.requestsLock.Lock()
+	request, ok := a.requests[eHdrs.StreamID]
+	fin := !ok || request.headersSent || (!request.hasBody() && len(request.Trailers) == 0)
+	if ok && (fin || len(request.Trailers) == 0) { // No other block of headers will be sent on the stream
+		delete(a.requests, eHdrs.StreamID)
+	}
+	a.requestsLock.Unlock()
+
+	a.sendFrameOnStream(http3.NewHEADERS(eHdrs.Headers), eHdrs.StreamID, fin)
+	a.Logger.Printf("Sent a %d-byte long block of headers on stream %d\n", len(eHdrs.Headers), eHdrs.StreamID)
+	if fin {
+		return
+	}
+	request.headersSent = true
+	if request.hasBody() {
+		go a.sendBody(eHdrs.StreamID, request.HTTP3Request)
+	} else {
+		a.QPACK.EncodeHeaders <- DecodedHeaders{eHdrs.StreamID, request.Trailers}
+	}
+}
+
+// sendBody sends the body of the request in DATA frames, then its trailers or the end of the stream.
+func (a *HTTP3Agent) sendBody(streamID uint64, request *HTTP3Request) {
+	defer a.RecoverPanic(a.conn)
+	if len(request.Body) > 0 && !request.DataBeforeHeaders {
+		a.sendFrameOnStream(http3.NewDATA(request.Body), streamID, false)
+	}
+	if request.BodyReader != nil {
+		buf := make([]byte, http3BodyReadSize)
+		for {
+			n, err := request.BodyReader.Read(buf)
+			if n > 0 {
+				a.sendFrameOnStream(http3.NewDATA(append([]byte(nil), buf[:n]...)), streamID, false)
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				a.Logger.Printf("Could not read the body of the request on stream %d: %s\n", streamID, err.Error())
+				a.conn.Streams.Reset(streamID, http3.H3_REQUEST_CANCELLED)
+				return
+			}
+		}
+	}
+	if len(request.Trailers) > 0 {
+		a.QPACK.EncodeHeaders <- DecodedHeaders{streamID, request.Trailers}
+	} else {
+		a.conn.Streams.Send(streamID, nil, true)
+	}
 }
 
 func (a *HTTP3Agent) HTTPResponseReceived() Broadcaster {
@@ -0,0 +1,107 @@
+package agents
+
+import (
+	. "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/http3"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTP3Response_AddHeaders(t *testing.T) {
+	earlyHints := []HTTPHeader{{":status", "103"}, {"link", "</style.css>; rel=preload"}}
+	final := []HTTPHeader{{":status", "200"}, {"content-type", "text/plain"}}
+	trailers := []HTTPHeader{{"x-checksum", "1234"}}
+
+	r := new(HTTP3Response)
+	r.addHeaders([]HTTPHeader{{":status", "100"}})
+	r.addHeaders(earlyHints)
+	r.addHeaders(final)
+	r.addHeaders(trailers)
+
+	if !reflect.DeepEqual(r.InterimResponses(), [][]HTTPHeader{{{":status", "100"}}, earlyHints}) {
+		t.Errorf("unexpected interim responses %v", r.InterimResponses())
+	}
+	if !reflect.DeepEqual(r.Headers(), final) || r.Status() != "200" {
+		t.Errorf("unexpected final headers %v", r.Headers())
+	}
+	if !reflect.DeepEqual(r.Trailers(), trailers) {
+		t.Errorf("unexpected trailers %v", r.Trailers())
+	}
+
+	for status, interim := range map[string]bool{"100": true, "199": true, "200": false, "1": false, "": false} {
+		if isInterim([]HTTPHeader{{":status", status}}) != interim {
+			t.Errorf("status %q interim: %t", status, !interim)
+		}
+	}
+}
+
+func TestHTTP3Agent_SendHeaders(t *testing.T) {
+	udpConn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4433})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udpConn.Close()
+	conn := NewConnection("localhost", QuicVersion, QuicALPNToken, []byte{1}, []byte{2}, udpConn, nil)
+	streamInputs := conn.StreamInput.RegisterNewChan(1000)
+
+	a := &HTTP3Agent{conn: conn, requests: make(map[uint64]*http3Request)}
+	a.SetLogOutput(ioutil.Discard)
+	a.Init("HTTP3Agent", conn.OriginalDestinationCID)
+	a.QPACK.EncodeHeaders = make(chan DecodedHeaders, 1)
+
+	// sent returns the frames sent on the stream, with the ones closing it marked
+	sent := func(count int) []string {
+		var frames []string
+		for i := 0; i < count; i++ {
+			select {
+			case in := <-streamInputs:
+				input := in.(StreamInput)
+				frame := "fin"
+				if len(input.Data) > 0 {
+					frame = map[byte]string{http3.FrameTypeDATA: "DATA", http3.FrameTypeHEADERS: "HEADERS"}[input.Data[0]]
+					if input.Close {
+						frame += "+fin"
+					}
+				}
+				frames = append(frames, frame)
+			case <-time.After(time.Second):
+				t.Fatalf("only %d frames were sent", i)
+			}
+		}
+		return frames
+	}
+
+	for _, c := range []struct {
+		request *HTTP3Request
+		frames  []string
+	}{
+		{&HTTP3Request{}, []string{"HEADERS+fin"}},
+		{&HTTP3Request{Body: []byte("body")}, []string{"HEADERS", "DATA", "fin"}},
+		{&HTTP3Request{BodyReader: strings.NewReader("body")}, []string{"HEADERS", "DATA", "fin"}},
+		{&HTTP3Request{Trailers: []HTTPHeader{{"x-checksum", "1234"}}}, []string{"HEADERS", "HEADERS+fin"}},
+		{&HTTP3Request{Body: []byte("body"), Trailers: []HTTPHeader{{"x-checksum", "1234"}}}, []string{"HEADERS", "DATA", "HEADERS+fin"}},
+	} {
+		a.requests[0] = &http3Request{HTTP3Request: c.request}
+		a.sendHeaders(EncodedHeaders{0, []byte{0, 0}})
+		frames := sent(len(c.frames) - 1)
+		if len(c.request.Trailers) > 0 {
+			select {
+			case trailers := <-a.QPACK.EncodeHeaders:
+				a.sendHeaders(EncodedHeaders{trailers.StreamID, []byte{0, 0}})
+			case <-time.After(time.Second):
+				t.Fatal("the trailers were not encoded")
+			}
+		}
+		frames = append(frames, sent(1)...)
+		if !reflect.DeepEqual(frames, c.frames) {
+			t.Errorf("expected frames %v, got %v", c.frames, frames)
+		}
+		if _, ok := a.requests[0]; ok {
+			t.Error("the request is still tracked once it was sent")
+		}
+	}
+}
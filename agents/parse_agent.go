@@ -23,6 +23,7 @@ func (a *ParsingAgent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 		packetSelect:
 			select {
@@ -1,12 +1,23 @@
 package agents
 
 import (
+	"bytes"
 	. "github.com/QUIC-Tracker/quic-tracker"
 	"github.com/QUIC-Tracker/quic-tracker/qlog"
 	"github.com/QUIC-Tracker/quic-tracker/qlog/qt2qlog"
 	"time"
 )
 
+var qlogKeyTypes = map[EncryptionLevel][]string{
+	EncryptionLevelInitial:   {qlog.KeyTypeClientInitial, qlog.KeyTypeServerInitial},
+	EncryptionLevel0RTT:      {qlog.KeyTypeClient0RTT},
+	EncryptionLevelHandshake: {qlog.KeyTypeClientHandshake, qlog.KeyTypeServerHandshake},
+	EncryptionLevel1RTT:      {qlog.KeyTypeClient1RTT, qlog.KeyTypeServer1RTT},
+}
+
+// The QLogAgent is responsible for recording the packets exchanged and the changes of the connection state in its
+// qlog. It reports the transport parameters, the keys discarded, the stream states, the destination connection IDs
+// used and the closing of the connection.
 type QLogAgent struct {
 	BaseAgent
 }
@@ -16,16 +27,26 @@ func (a *QLogAgent) Run(conn *Connection) {
 
 	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
 	outgoingPackets := conn.OutgoingPackets.RegisterNewChan(1000)
+	transportParameters := conn.TransportParameters.RegisterNewChan(10)
+	encryptionLevels := conn.EncryptionLevels.RegisterNewChan(10)
+
+	conn.StreamStateHandler = func(streamId uint64, side string, state string) {
+		conn.QLogEvents <- conn.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.StreamStateUpdated, qt2qlog.ConvertStreamState(streamId, side, state))
+	}
+
+	destinationCID := conn.DestinationCID
+	closed := make(map[string]bool)
 
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case i := <-incomingPackets:
 				p := i.(Packet)
 				jp := qt2qlog.ConvertPacket(p)
-				jp.Header.PacketSize = int(p.ReceiveContext().PacketSize)
+				jp.Raw.Length = int(p.ReceiveContext().PacketSize)
 				e := conn.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.PacketReceived, jp)
 				if !p.ReceiveContext().WasBuffered {
 					e.RelativeTime = uint64(p.ReceiveContext().Timestamp.Sub(conn.QLogTrace.ReferenceTime) / qlog.TimeUnits)
@@ -33,17 +54,59 @@ func (a *QLogAgent) Run(conn *Connection) {
 					e.RelativeTime = uint64(time.Now().Sub(conn.QLogTrace.ReferenceTime) / qlog.TimeUnits)
 				}
 				conn.QLogEvents <- e
+				a.recordFrames(conn, p, "remote", closed)
 			case i := <-outgoingPackets:
 				p := i.(Packet)
 				jp := qt2qlog.ConvertPacket(p)
-				jp.Header.PacketSize = int(i.(Packet).SendContext().PacketSize)
+				jp.Raw.Length = int(i.(Packet).SendContext().PacketSize)
 				e := conn.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.PacketSent, jp)
 				e.RelativeTime = uint64(p.SendContext().Timestamp.Sub(conn.QLogTrace.ReferenceTime) / qlog.TimeUnits)
 				conn.QLogEvents <- e
+				if h := p.Header(); h != nil && h.PacketType() != ZeroRTTProtected && !bytes.Equal(h.DestinationConnectionID(), destinationCID) {
+					conn.QLogEvents <- conn.QLogTrace.NewEvent(qlog.Categories.Connectivity.Category, qlog.Categories.Connectivity.ConnectionIDUpdated, &qlog.ConnectionIDUpdated{Owner: "remote", Old: destinationCID.String(), New: h.DestinationConnectionID().String()})
+					destinationCID = h.DestinationConnectionID()
+				}
+				a.recordFrames(conn, p, "local", closed)
+			case i := <-transportParameters:
+				tp := i.(QuicTransportParameters)
+				conn.QLogEvents <- conn.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.ParametersSet, tp.QLog("remote"))
+			case i := <-encryptionLevels:
+				dEL := i.(DirectionalEncryptionLevel)
+				if dEL.Available {
+					break
+				}
+				for _, keyType := range qlogKeyTypes[dEL.EncryptionLevel] {
+					conn.QLogEvents <- conn.QLogTrace.NewEvent(qlog.Categories.Security.Category, qlog.Categories.Security.KeyDiscarded, &qlog.KeyDiscarded{KeyType: keyType, Trigger: "tls"})
+				}
 			case <-a.close:
 				return
 			}
 		}
 	}()
+}
 
+// Records the changes of the connection state carried by the frames of a packet sent by the given owner.
+func (a *QLogAgent) recordFrames(conn *Connection, p Packet, owner string, closed map[string]bool) {
+	framer, ok := p.(Framer)
+	if !ok {
+		return
+	}
+	for _, f := range framer.GetFrames() {
+		switch frame := f.(type) {
+		case *ConnectionCloseFrame:
+			if !closed[owner] {
+				closed[owner] = true
+				conn.QLogEvents <- conn.QLogTrace.NewEvent(qlog.Categories.Connectivity.Category, qlog.Categories.Connectivity.ConnectionClosed, qt2qlog.ConvertConnectionClose(owner, frame.ErrorCode, false, frame.ReasonPhrase))
+			}
+		case *ApplicationCloseFrame:
+			if !closed[owner] {
+				closed[owner] = true
+				conn.QLogEvents <- conn.QLogTrace.NewEvent(qlog.Categories.Connectivity.Category, qlog.Categories.Connectivity.ConnectionClosed, qt2qlog.ConvertConnectionClose(owner, frame.ErrorCode, true, frame.ReasonPhrase))
+			}
+		case *ResetStream:
+			if owner == "remote" {
+				conn.QLogEvents <- conn.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.StreamStateUpdated, qt2qlog.ConvertStreamState(frame.StreamId, qlog.StreamSideReceiving, "reset_received"))
+			}
+		}
+	}
 }
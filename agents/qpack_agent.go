@@ -3,6 +3,8 @@ package agents
 import (
 	"bytes"
 	. "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/http3"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
 	"github.com/mpiraux/ls-qpack-go"
 	"math"
 )
@@ -33,6 +35,50 @@ type QPACKAgent struct {
 	EncodedHeaders  Broadcaster //type: EncodedHeaders
 	encoder         *ls_qpack_go.QPackEncoder
 	decoder         *ls_qpack_go.QPackDecoder
+	conn            *Connection
+	encoderState    qpackState // The state of our encoder
+	decoderState    qpackState // The state of the peer encoder, as known by our decoder
+}
+
+// A qpackState follows the dynamic table of an encoder from the instructions exchanged on the QPACK streams.
+type qpackState struct {
+	maxTableCapacity     uint64
+	capacity             uint64
+	insertCount          uint64
+	knownReceivedCount   uint64
+	requiredInsertCounts map[uint64]uint64 // The Required Insert Count of the field sections pending acknowledgement
+}
+
+func (s *qpackState) headerBlock(streamID uint64, prefix *qlog.QPACKHeaderBlockPrefix) {
+	if prefix != nil && prefix.RequiredInsertCount > 0 {
+		s.requiredInsertCounts[streamID] = http3.DecodeRequiredInsertCount(prefix.RequiredInsertCount, s.maxTableCapacity, s.insertCount)
+	}
+}
+
+// update applies an instruction to the state and reports whether it changed.
+func (s *qpackState) update(i *http3.QPACKInstruction) bool {
+	switch i.Type {
+	case qlog.QPACKSetDynamicTableCapacity:
+		s.capacity = i.Capacity
+	case qlog.QPACKInsertWithNameReference, qlog.QPACKInsertWithoutNameReference, qlog.QPACKDuplicate:
+		s.insertCount++
+	case qlog.QPACKInsertCountIncrement:
+		s.knownReceivedCount += i.Increment
+	case qlog.QPACKSectionAcknowledgement:
+		if ric, ok := s.requiredInsertCounts[i.StreamID]; ok && ric > s.knownReceivedCount {
+			s.knownReceivedCount = ric
+		}
+		delete(s.requiredInsertCounts, i.StreamID)
+	case qlog.QPACKStreamCancellation:
+		delete(s.requiredInsertCounts, i.StreamID)
+		return false
+	}
+	return true
+}
+
+func (s *qpackState) QLog(owner string) *qlog.QPACKStateUpdated {
+	capacity, knownReceivedCount, insertCount := s.capacity, s.knownReceivedCount, s.insertCount
+	return &qlog.QPACKStateUpdated{Owner: owner, DynamicTableCapacity: &capacity, KnownReceivedCount: &knownReceivedCount, CurrentInsertCount: &insertCount}
 }
 
 const (
@@ -41,8 +87,18 @@ const (
 	QPACKDecoderStreamValue = 0x3
 )
 
+// readUniStreamType returns the type of the unidirectional stream and the data received after it.
+func readUniStreamType(stream *Stream) (VarInt, []byte, error) {
+	streamType, err := ReadVarInt(bytes.NewReader(stream.ReadData))
+	if err != nil {
+		return streamType, nil, err
+	}
+	return streamType, stream.ReadData[streamType.Length:], nil
+}
+
 func (a *QPACKAgent) Run(conn *Connection) {
 	a.Init("QPACKAgent", conn.OriginalDestinationCID)
+	a.conn = conn
 	a.DecodedHeaders = NewBroadcaster(1000)
 	a.EncodedHeaders = NewBroadcaster(1000)
 	a.DecodeHeaders = make(chan EncodedHeaders, 1000)
@@ -57,11 +113,16 @@ func (a *QPACKAgent) Run(conn *Connection) {
 
 	a.encoder = ls_qpack_go.NewQPackEncoder(false)
 	a.decoder = ls_qpack_go.NewQPackDecoder(dynamicTableSize, 100)
+	a.encoderState.requiredInsertCounts = make(map[uint64]uint64)
+	a.decoderState = qpackState{maxTableCapacity: uint64(dynamicTableSize), requiredInsertCounts: make(map[uint64]uint64)}
 
 	peerEncoderStreamId := QPACKNoStream
 	peerDecoderStreamId := QPACKNoStream
 	peerEncoderStream := make(chan interface{}, 1000)
 	peerDecoderStream := make(chan interface{}, 1000)
+	peerEncoderStreamBuffer := new(bytes.Buffer)
+	peerDecoderStreamBuffer := new(bytes.Buffer)
+	decodedPrefixes := make(map[uint64]*qlog.QPACKHeaderBlockPrefix)
 
 	checkForDecodedHeaders := func() {
 		for _, dhb := range a.decoder.DecodedHeaderBlocks() {
@@ -71,8 +132,11 @@ func (a *QPACKAgent) Run(conn *Connection) {
 					headers[i] = HTTPHeader{h.Name, h.Value}
 				}
 				a.DecodedHeaders.Submit(DecodedHeaders{dhb.StreamID, headers})
+				a.qlog(qlog.Categories.QPACK.HeadersDecoded, &qlog.QPACKHeadersDecoded{StreamID: dhb.StreamID, Headers: qlogHeaders(headers), BlockPrefix: decodedPrefixes[dhb.StreamID]})
+				delete(decodedPrefixes, dhb.StreamID)
 				if len(dhb.DecoderStream()) > 0 {
 					conn.Streams.Send(a.DecoderStreamID, dhb.DecoderStream(), false)
+					a.qlogInstructions(dhb.DecoderStream(), false, qlog.Categories.QPACK.InstructionCreated, &a.decoderState, "remote")
 				}
 				a.Logger.Printf("Submitted %d decoded headers on stream %d\n", len(headers), dhb.StreamID)
 			}
@@ -82,6 +146,7 @@ func (a *QPACKAgent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case i := <-incomingPackets:
@@ -90,8 +155,7 @@ func (a *QPACKAgent) Run(conn *Connection) {
 					for _, f := range p.(Framer).GetAll(StreamType) {
 						s := f.(*StreamFrame)
 						if s.Offset < 4 && IsUni(s.StreamId) && s.StreamId != peerEncoderStreamId && s.StreamId != peerDecoderStreamId {
-							stream := conn.Streams.Get(s.StreamId)
-							qpackStreamType, err := ReadVarInt(bytes.NewReader(stream.ReadData))
+							qpackStreamType, initialData, err := readUniStreamType(conn.Streams.Get(s.StreamId))
 							if err != nil {
 								a.Logger.Printf("Error when parsing stream type: %s\n", err.Error())
 							} else if qpackStreamType.Value == QPACKEncoderStreamValue {
@@ -102,8 +166,9 @@ func (a *QPACKAgent) Run(conn *Connection) {
 								peerEncoderStreamId = s.StreamId
 
 								a.Logger.Printf("Peer opened encoder stream on stream %d\n", s.StreamId)
-								if len(stream.ReadData) > qpackStreamType.Length {
-									peerEncoderStream <- stream.ReadData[qpackStreamType.Length:]
+								a.qlogStreamTypeSet("remote", s.StreamId, qlog.H3StreamTypeQPACKEncoder)
+								if len(initialData) > 0 {
+									peerEncoderStream <- initialData
 								}
 								conn.Streams.Get(s.StreamId).ReadChan.Register(peerEncoderStream)
 							} else if qpackStreamType.Value == QPACKDecoderStreamValue {
@@ -112,10 +177,10 @@ func (a *QPACKAgent) Run(conn *Connection) {
 									continue
 								}
 								peerDecoderStreamId = s.StreamId
-								stream := conn.Streams.Get(peerEncoderStreamId)
 								a.Logger.Printf("Peer opened decoder stream on stream %d\n", s.StreamId)
-								if len(stream.ReadData) > qpackStreamType.Length {
-									peerDecoderStream <- stream.ReadData[qpackStreamType.Length:]
+								a.qlogStreamTypeSet("remote", s.StreamId, qlog.H3StreamTypeQPACKDecoder)
+								if len(initialData) > 0 {
+									peerDecoderStream <- initialData
 								}
 								conn.Streams.Get(s.StreamId).ReadChan.Register(peerDecoderStream)
 							} else {
@@ -131,6 +196,8 @@ func (a *QPACKAgent) Run(conn *Connection) {
 					return
 				}
 				a.Logger.Printf("Fed %d bytes from the encoder stream to the decoder\n", len(data))
+				peerEncoderStreamBuffer.Write(data)
+				peerEncoderStreamBuffer.Next(a.qlogInstructions(peerEncoderStreamBuffer.Bytes(), true, qlog.Categories.QPACK.InstructionParsed, &a.decoderState, "remote"))
 				checkForDecodedHeaders()
 			case i := <-peerDecoderStream:
 				data := i.([]byte)
@@ -139,6 +206,8 @@ func (a *QPACKAgent) Run(conn *Connection) {
 					return
 				}
 				a.Logger.Printf("Fed %d bytes from the decoder stream to the encoder\n", len(data))
+				peerDecoderStreamBuffer.Write(data)
+				peerDecoderStreamBuffer.Next(a.qlogInstructions(peerDecoderStreamBuffer.Bytes(), false, qlog.Categories.QPACK.InstructionParsed, &a.encoderState, "local"))
 				checkForDecodedHeaders()
 			case e := <-a.EncodeHeaders:
 				if a.encoder.StartHeaderBlock(e.StreamID, /*TODO*/ 0) {
@@ -154,6 +223,12 @@ func (a *QPACKAgent) Run(conn *Connection) {
 				}
 				hdp := a.encoder.EndHeaderBlock()
 				payload := append(hdp, encHeaders...)
+				if len(encStream) > 0 {
+					a.qlogInstructions(encStream, true, qlog.Categories.QPACK.InstructionCreated, &a.encoderState, "local")
+				}
+				prefix, _ := http3.ReadQPACKHeaderBlockPrefix(payload)
+				a.encoderState.headerBlock(e.StreamID, prefix)
+				a.qlog(qlog.Categories.QPACK.HeadersEncoded, &qlog.QPACKHeadersEncoded{StreamID: e.StreamID, Headers: qlogHeaders(e.Headers), BlockPrefix: prefix, Length: uint64(len(payload)), Raw: qlog.RawInfo{Length: len(payload)}})
 				a.EncodedHeaders.Submit(EncodedHeaders{e.StreamID, payload})
 				a.Logger.Printf("Encoded %d headers in %d bytes, with %d additional bytes on the encoder stream\n", len(e.Headers), len(payload), len(encStream))
 				if len(encStream) > 0 {
@@ -161,6 +236,10 @@ func (a *QPACKAgent) Run(conn *Connection) {
 					a.Logger.Printf("Enqueued %d bytes on the encoder stream\n", len(encStream))
 				}
 			case d := <-a.DecodeHeaders:
+				if prefix, err := http3.ReadQPACKHeaderBlockPrefix(d.Headers); err == nil {
+					decodedPrefixes[d.StreamID] = prefix
+					a.decoderState.headerBlock(d.StreamID, prefix)
+				}
 				ret := a.decoder.HeaderIn(d.Headers, d.StreamID)
 				if ret < len(d.Headers) {
 					a.Logger.Printf("Decoder is blocked and waiting for encoder input before decoding the %d bytes remaining on stream %d\n", len(d.Headers) - ret, d.StreamID)
@@ -175,9 +254,41 @@ func (a *QPACKAgent) Run(conn *Connection) {
 	if !a.DisableStreams {
 		conn.Streams.Send(a.EncoderStreamID, []byte{QPACKEncoderStreamValue}, false)
 		conn.Streams.Send(a.DecoderStreamID, []byte{QPACKDecoderStreamValue}, false)
+		a.qlogStreamTypeSet("local", a.EncoderStreamID, qlog.H3StreamTypeQPACKEncoder)
+		a.qlogStreamTypeSet("local", a.DecoderStreamID, qlog.H3StreamTypeQPACKDecoder)
+	}
+}
+func (a *QPACKAgent) qlog(eventType string, data interface{}) {
+	a.conn.QLogEvents <- a.conn.QLogTrace.NewEvent(qlog.Categories.QPACK.Category, eventType, data)
+}
+func (a *QPACKAgent) qlogStreamTypeSet(owner string, streamID uint64, streamType string) {
+	a.conn.QLogEvents <- a.conn.QLogTrace.NewEvent(qlog.Categories.H3.Category, qlog.Categories.H3.StreamTypeSet, &qlog.H3StreamTypeSet{Owner: owner, StreamID: streamID, StreamType: streamType})
+}
+// qlogInstructions records the instructions contained in data and the changes they make to the given encoder
+// state. It returns the number of bytes holding complete instructions.
+func (a *QPACKAgent) qlogInstructions(data []byte, encoderStream bool, eventType string, state *qpackState, owner string) int {
+	instructions, lengths, consumed, err := http3.ReadQPACKInstructions(data, encoderStream)
+	if err != nil {
+		a.Logger.Printf("Error when parsing QPACK instructions: %s\n", err.Error())
+		consumed = len(data)
+	}
+	for n, i := range instructions {
+		a.qlog(eventType, &qlog.QPACKInstructionCreated{Instruction: i.QLog(), Raw: qlog.RawInfo{Length: lengths[n]}})
+		if state.update(i) {
+			a.qlog(qlog.Categories.QPACK.StateUpdated, state.QLog(owner))
+		}
+	}
+	return consumed
+}
+func qlogHeaders(headers []HTTPHeader) []qlog.H3HTTPField {
+	fields := make([]qlog.H3HTTPField, len(headers))
+	for i, h := range headers {
+		fields[i] = qlog.H3HTTPField{Name: h.Name, Value: h.Value}
 	}
+	return fields
 }
 func (a *QPACKAgent) InitEncoder(headerTableSize uint, dynamicTablesize uint, maxRiskedStreams uint, opts uint32) {
 	a.encoder.Init(headerTableSize, dynamicTablesize, maxRiskedStreams, opts)
+	a.encoderState.maxTableCapacity = uint64(headerTableSize)
 	a.Logger.Printf("Encoder initialized with HTS=%d, DTS=%d, MRS=%d and opts=%d\n", headerTableSize, dynamicTablesize, maxRiskedStreams, opts)
 }
\ No newline at end of file
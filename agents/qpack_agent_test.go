@@ -0,0 +1,26 @@
+package agents
+
+import (
+	"bytes"
+	. "github.com/QUIC-Tracker/quic-tracker"
+	"testing"
+)
+
+func TestReadUniStreamType(t *testing.T) {
+	encoderStream := &Stream{ReadData: []byte{QPACKEncoderStreamValue, 0x3f, 0xe1, 0x1f}}
+	decoderStream := &Stream{ReadData: []byte{QPACKDecoderStreamValue, 0x81}}
+
+	for _, c := range []struct {
+		stream     *Stream
+		streamType uint64
+		data       []byte
+	}{{encoderStream, QPACKEncoderStreamValue, []byte{0x3f, 0xe1, 0x1f}}, {decoderStream, QPACKDecoderStreamValue, []byte{0x81}}} {
+		streamType, data, err := readUniStreamType(c.stream)
+		if err != nil || streamType.Value != c.streamType || !bytes.Equal(data, c.data) {
+			t.Errorf("read stream type %d and data %x, expected %d and %x: %v", streamType.Value, data, c.streamType, c.data, err)
+		}
+	}
+	if _, _, err := readUniStreamType(&Stream{}); err == nil {
+		t.Errorf("no error on an empty stream")
+	}
+}
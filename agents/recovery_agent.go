@@ -2,6 +2,7 @@ package agents
 
 import (
 	. "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/metrics"
 	"github.com/QUIC-Tracker/quic-tracker/qlog"
 	"github.com/QUIC-Tracker/quic-tracker/qlog/qt2qlog"
 	"time"
@@ -40,6 +41,7 @@ func (a *RecoveryAgent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case <-retransmissionTicker.C:
@@ -172,6 +174,7 @@ func (a *RecoveryAgent) ProcessAck(ack *AckFrame, space PNSpace) RetransmitBatch
 func (a *RecoveryAgent) RetransmitBatch(batch RetransmitBatch) {
 	if len(batch) > 0 {
 		a.Logger.Printf("Retransmitting %d batches of %d frames total\n", len(batch), batch.NFrames())
+		metrics.Retransmissions.With(a.conn.ServerName).Add(float64(len(batch)))
 	}
 	for _, b := range batch {
 		if b.Level == EncryptionLevelInitial && (len(b.Frames) > 200 || b.Frames[0].FrameType() == StreamType) { // Simple heuristic to detect first Initial packet
@@ -2,6 +2,7 @@ package agents
 
 import (
 	. "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/metrics"
 	"github.com/QUIC-Tracker/quic-tracker/qlog"
 	"time"
 	"math"
@@ -44,6 +45,7 @@ func (a *RTTAgent) Run(conn *Connection) {
 	go func() { // TODO: Support ACK_ECN
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 
 		for {
 			select {
@@ -114,12 +116,17 @@ func (a *RTTAgent) UpdateRTT(ackDelay uint64, ackOnly bool) { // TODO: https://t
 	a.conn.SmoothedRTT = a.SmoothedRTT
 	a.conn.RTTVar = a.RTTVar
 
+	metrics.RTT.With(a.conn.ServerName, "latest").Set(float64(a.LatestRTT) / 1e6)
+	metrics.RTT.With(a.conn.ServerName, "min").Set(float64(a.MinRTT) / 1e6)
+	metrics.RTT.With(a.conn.ServerName, "smoothed").Set(float64(a.SmoothedRTT) / 1e6)
+	metrics.RTT.With(a.conn.ServerName, "variance").Set(float64(a.RTTVar) / 1e6)
+
 	a.conn.QLogEvents <- a.conn.QLogTrace.NewEvent(qlog.Categories.Recovery.Category, qlog.Categories.Recovery.MetricsUpdated, qlog.MetricUpdate{
-		LatestRTT: a.LatestRTT / 1000,
-		MaxAckDelay: a.MaxAckDelay / 1000,
-		SmoothedRTT: a.conn.SmoothedRTT / 1000,
-		RTTVariance: a.conn.RTTVar / 1000,
-		MinRTT: a.conn.MinRTT / 1000,
+		LatestRTT: float64(a.LatestRTT) / 1000,
+		MaxAckDelay: float64(a.MaxAckDelay) / 1000,
+		SmoothedRTT: float64(a.conn.SmoothedRTT) / 1000,
+		RTTVariance: float64(a.conn.RTTVar) / 1000,
+		MinRTT: float64(a.conn.MinRTT) / 1000,
 	})
 
 	a.Logger.Printf("LatestRTT = %d, MinRTT = %d, SmoothedRTT = %d, RTTVar = %d", a.LatestRTT, a.MinRTT, a.SmoothedRTT, a.RTTVar)
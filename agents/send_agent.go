@@ -90,6 +90,7 @@ func (a *SendingAgent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case i := <-preparePacket:
@@ -180,6 +181,9 @@ func (a *SendingAgent) Run(conn *Connection) {
 							initial.PadTo(initialLength - len(zpBytes))
 							coalescedPackets := append(conn.EncodeAndEncrypt(initial, EncryptionLevelInitial), zpBytes...)
 							conn.UdpConnection.Write(coalescedPackets)
+							if conn.SentDatagramHandler != nil {
+								conn.SentDatagramHandler(coalescedPackets, conn.UdpConnection.LocalAddr(), conn.UdpConnection.RemoteAddr())
+							}
 							conn.PacketWasSent(initial)
 							conn.PacketWasSent(zp)
 							continue
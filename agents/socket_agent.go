@@ -28,6 +28,7 @@ func (a *SocketAgent) Run(conn *Connection) {
 	recChan := make(chan IncomingPayload)
 
 	go func() {
+		defer a.RecoverPanic(conn)
 		for {
 			recBuf := make([]byte, MaxTheoreticUDPPayloadSize)
 			oob := make([]byte, 128) // Find a reasonable upper-bound
@@ -51,6 +52,9 @@ func (a *SocketAgent) Run(conn *Connection) {
 			copy(sm.Payload, recBuf[:i])
 			sm.RemoteAddr = addr
 			sm.DatagramSize = uint16(len(sm.Payload))
+			if conn.ReceivedDatagramHandler != nil {
+				conn.ReceivedDatagramHandler(sm.Payload, addr, conn.UdpConnection.LocalAddr())
+			}
 
 			if a.ecn {
 				ecn, err := findECNValue(oob[:oobn])
@@ -77,6 +81,7 @@ func (a *SocketAgent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case p, open := <-recChan:
@@ -3,6 +3,7 @@ package agents
 import (
 	"errors"
 	. "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
 )
 
 type StreamAgent struct {
@@ -25,6 +26,7 @@ func (a *StreamAgent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 		for {
 			select {
 			case i := <-a.input:
@@ -83,6 +85,7 @@ func (a *StreamAgent) close(streamId uint64) error {
 		}
 		s.WriteCloseOffset = s.WriteOffset
 		a.conn.FrameQueue.Submit(QueuedFrame{NewStreamFrame(streamId, s.WriteOffset, nil, true), EncryptionLevelBestAppData})
+		s.UpdateState(qlog.StreamSideSending, "data_sent")
 		return nil
 	}
 	return errors.New("cannot close server uni stream")
@@ -97,6 +100,7 @@ func (a *StreamAgent) reset(streamId uint64, appErrorCode uint64) error {
 		s.WriteCloseOffset = s.WriteOffset
 		s.WriteClosed = true
 		a.conn.FrameQueue.Submit(QueuedFrame{&ResetStream{streamId, appErrorCode, s.WriteOffset}, EncryptionLevelBestAppData})
+		s.UpdateState(qlog.StreamSideSending, "reset_sent")
 		return nil
 	}
 	return errors.New("cannot reset server uni stream")
@@ -127,6 +131,7 @@ func (a *StreamAgent) send(streamId uint64, data []byte, close bool) error {
 	a.streamBuffers[streamId] = append(a.streamBuffers[streamId], data...)
 	if close {
 		a.streamClosing[streamId] = true
+		s.UpdateState(qlog.StreamSideSending, "data_sent")
 	}
 	a.conn.PreparePacket.Submit(EncryptionLevelBestAppData)
 	return nil
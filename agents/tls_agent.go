@@ -3,6 +3,7 @@ package agents
 import (
 	"encoding/hex"
 	. "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
 )
 
 type TLSStatus struct {
@@ -49,6 +50,7 @@ func (a *TLSAgent) Run(conn *Connection) {
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
+		defer a.RecoverPanic(conn)
 
 		for {
 			select {
@@ -92,10 +94,14 @@ func (a *TLSAgent) Run(conn *Connection) {
 							if conn.CryptoStates[EncryptionLevelHandshake].HeaderRead == nil && len(conn.Tls.HandshakeReadSecret()) > 0 {
 								a.Logger.Printf("Installing handshake read crypto with secret %s\n", hex.EncodeToString(conn.Tls.HandshakeReadSecret()))
 								conn.CryptoStates[EncryptionLevelHandshake].InitRead(conn.Tls, conn.Tls.HandshakeReadSecret())
+								conn.LogSecret(KeyLogServerHandshakeTrafficSecret, conn.Tls.HandshakeReadSecret())
+								conn.QLogKeyUpdated(qlog.KeyTypeServerHandshake, conn.Tls.HandshakeReadSecret(), "tls")
 							}
 							if conn.CryptoStates[EncryptionLevelHandshake].HeaderWrite == nil && len(conn.Tls.HandshakeWriteSecret()) > 0 {
 								a.Logger.Printf("Installing handshake write crypto with secret %s\n", hex.EncodeToString(conn.Tls.HandshakeWriteSecret()))
 								conn.CryptoStates[EncryptionLevelHandshake].InitWrite(conn.Tls, conn.Tls.HandshakeWriteSecret())
+								conn.LogSecret(KeyLogClientHandshakeTrafficSecret, conn.Tls.HandshakeWriteSecret())
+								conn.QLogKeyUpdated(qlog.KeyTypeClientHandshake, conn.Tls.HandshakeWriteSecret(), "tls")
 							}
 						}
 
@@ -108,6 +114,10 @@ func (a *TLSAgent) Run(conn *Connection) {
 						if !notCompleted && conn.CryptoStates[EncryptionLevel1RTT] == nil {
 							a.Logger.Printf("Handshake has completed, installing protected crypto {read=%s, write=%s}\n", hex.EncodeToString(conn.Tls.ProtectedReadSecret()), hex.EncodeToString(conn.Tls.ProtectedWriteSecret()))
 							conn.CryptoStates[EncryptionLevel1RTT] = NewProtectedCryptoState(conn.Tls, conn.Tls.ProtectedReadSecret(), conn.Tls.ProtectedWriteSecret())
+							conn.LogSecret(KeyLogClientTrafficSecret0, conn.Tls.ProtectedWriteSecret())
+							conn.LogSecret(KeyLogServerTrafficSecret0, conn.Tls.ProtectedReadSecret())
+							conn.QLogKeyUpdated(qlog.KeyTypeClient1RTT, conn.Tls.ProtectedWriteSecret(), "tls")
+							conn.QLogKeyUpdated(qlog.KeyTypeServer1RTT, conn.Tls.ProtectedReadSecret(), "tls")
 
 							// TODO: Check negotiated ALPN ?
 
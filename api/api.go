@@ -0,0 +1,326 @@
+// Package api exposes the test suite over HTTP, so that dashboards and bots can start runs of scenarios, follow their
+// progress and browse their results.
+//
+// The API is rooted at /api and exchanges JSON:
+//
+//	GET    /api/scenarios               The catalog of the scenarios
+//	GET    /api/hosts                   The hosts of the inventory of the server
+//	GET    /api/runs                    The runs, the most recent first
+//	POST   /api/runs                    Starts a run described by a RunRequest
+//	GET    /api/runs/<id>               A run and the traces it produced so far
+//	DELETE /api/runs/<id>               Cancels the scenarios of a run that have not started yet
+//	GET    /api/runs/<id>/events        Streams the progress of a run as server-sent events
+//	GET    /api/traces                  Queries the store, using the host, scenario, commit, outcome, since, until and last parameters
+//	GET    /api/traces/<id>             A trace
+//	GET    /api/traces/<id>/qlog        The qlog of a trace
+//	GET    /api/traces/<id>/pcap        The packet capture of a trace
+//
+// The traces are kept in a results store, as the ones of the qtdb tool.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/QUIC-Tracker/quic-tracker/hosts"
+	"github.com/QUIC-Tracker/quic-tracker/scenarii"
+	"github.com/QUIC-Tracker/quic-tracker/store"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Server serves the API. Its runs are kept in a directory, along with the store of their traces.
+type Server struct {
+	Timeout   time.Duration // The time allowed to each scenario when a run does not set it
+	Interface string        // When set, the packets are captured on this interface using tcpdump
+	LogOutput io.Writer     // The writer of the logs of the server, the logs of the scenarios are written to the directory of their run
+
+	directory string
+	inventory []*hosts.Host
+	store     *store.Store
+	semaphore chan bool
+	mutex     sync.Mutex
+	runs      map[string]*run
+}
+
+// NewServer returns a server keeping its runs and traces in the given directory. The hosts of the inventory can be
+// designated by their name or their tags in run requests. At most maxInstances scenarios are run at the same time.
+func NewServer(directory string, inventory []*hosts.Host, maxInstances int) (*Server, error) {
+	if maxInstances < 1 {
+		return nil, fmt.Errorf("invalid number of instances %d", maxInstances)
+	}
+	if err := os.MkdirAll(filepath.Join(directory, "runs"), 0755); err != nil {
+		return nil, err
+	}
+	s, err := store.Open(filepath.Join(directory, "store"))
+	if err != nil {
+		return nil, err
+	}
+	server := &Server{
+		Timeout:   10 * time.Second,
+		LogOutput: os.Stderr,
+		directory: directory,
+		inventory: inventory,
+		store:     s,
+		semaphore: make(chan bool, maxInstances),
+		runs:      make(map[string]*run),
+	}
+	for i := 0; i < maxInstances; i++ {
+		server.semaphore <- true
+	}
+	if err := server.loadRuns(); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.URL.Path, "/api/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/api/"), "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "scenarios":
+		if allow(w, req, "GET") {
+			writeJSON(w, http.StatusOK, scenarii.Catalog())
+		}
+	case len(parts) == 1 && parts[0] == "hosts":
+		if allow(w, req, "GET") {
+			inventory := s.inventory
+			if inventory == nil {
+				inventory = []*hosts.Host{}
+			}
+			writeJSON(w, http.StatusOK, inventory)
+		}
+	case len(parts) == 1 && parts[0] == "runs":
+		if !allow(w, req, "GET", "POST") {
+			return
+		}
+		if req.Method == "POST" {
+			s.createRun(w, req)
+		} else {
+			s.listRuns(w)
+		}
+	case len(parts) == 2 && parts[0] == "runs":
+		if !allow(w, req, "GET", "DELETE") {
+			return
+		}
+		if r := s.getRun(w, parts[1]); r != nil && req.Method == "DELETE" {
+			s.cancelRun(w, r)
+		} else if r != nil {
+			snapshot, _ := r.snapshot()
+			writeJSON(w, http.StatusOK, snapshot)
+		}
+	case len(parts) == 3 && parts[0] == "runs" && parts[2] == "events":
+		if !allow(w, req, "GET") {
+			return
+		}
+		if r := s.getRun(w, parts[1]); r != nil {
+			streamRun(w, req, r)
+		}
+	case len(parts) == 1 && parts[0] == "traces":
+		if allow(w, req, "GET") {
+			s.queryTraces(w, req)
+		}
+	case len(parts) == 2 && parts[0] == "traces":
+		if allow(w, req, "GET") {
+			s.getTrace(w, parts[1], "")
+		}
+	case len(parts) == 3 && parts[0] == "traces":
+		if allow(w, req, "GET") {
+			s.getTrace(w, parts[1], parts[2])
+		}
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// allow reports whether the method of the request is one of the given ones, and answers it otherwise.
+func allow(w http.ResponseWriter, req *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if req.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method "+req.Method+" not allowed")
+	return false
+}
+
+func (s *Server) createRun(w http.ResponseWriter, req *http.Request) {
+	var request RunRequest
+	decoder := json.NewDecoder(req.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid run request: "+err.Error())
+		return
+	}
+	r, err := s.start(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	snapshot, _ := r.snapshot()
+	w.Header().Set("Location", "/api/runs/"+r.ID)
+	writeJSON(w, http.StatusCreated, snapshot)
+}
+
+func (s *Server) listRuns(w http.ResponseWriter) {
+	s.mutex.Lock()
+	runs := make([]Run, 0, len(s.runs))
+	for _, r := range s.runs {
+		snapshot, _ := r.snapshot()
+		snapshot.Traces = nil
+		runs = append(runs, snapshot)
+	}
+	s.mutex.Unlock()
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreatedAt > runs[j].CreatedAt || runs[i].CreatedAt == runs[j].CreatedAt && runs[i].ID > runs[j].ID
+	})
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (s *Server) getRun(w http.ResponseWriter, id string) *run {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r, ok := s.runs[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "no run "+id)
+	}
+	return r
+}
+
+func (s *Server) cancelRun(w http.ResponseWriter, r *run) {
+	r.mutex.Lock()
+	running := r.Status == RunRunning
+	r.cancelled = r.cancelled || running
+	r.mutex.Unlock()
+	if !running {
+		writeError(w, http.StatusConflict, "run "+r.ID+" is not running")
+		return
+	}
+	snapshot, _ := r.snapshot()
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// streamRun sends a trace event for each trace of the run and a progress event after each of its updates, until it
+// is over or the client goes away.
+func streamRun(w http.ResponseWriter, req *http.Request, r *run) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	sent := 0
+	for {
+		snapshot, updated := r.snapshot()
+		for ; sent < len(snapshot.Traces); sent++ {
+			writeEvent(w, "trace", snapshot.Traces[sent])
+		}
+		snapshot.Traces = nil
+		writeEvent(w, "progress", snapshot)
+		flusher.Flush()
+		if snapshot.Status != RunRunning {
+			return
+		}
+		select {
+		case <-updated:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event string, v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+func (s *Server) queryTraces(w http.ResponseWriter, req *http.Request) {
+	values := req.URL.Query()
+	q := store.Query{Host: values.Get("host"), Scenario: values.Get("scenario"), Commit: values.Get("commit"), Outcome: values.Get("outcome")}
+	var err error
+	for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := values.Get(name); v != "" {
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid "+name+" time "+v)
+				return
+			}
+		}
+	}
+	if v := values.Get("last"); v != "" {
+		if q.Last, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid last "+v)
+			return
+		}
+	}
+	entries := s.store.Query(q)
+	if entries == nil {
+		entries = []store.Entry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) getTrace(w http.ResponseWriter, id string, part string) {
+	e, err := s.store.Get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	t, err := s.store.Trace(e)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	switch part {
+	case "":
+		writeJSON(w, http.StatusOK, t)
+	case "qlog":
+		if t.QLog == nil {
+			writeError(w, http.StatusNotFound, "the qlog of trace "+e.ID+" was not kept")
+			return
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+e.ID+".qlog\"")
+		writeJSON(w, http.StatusOK, t.QLog)
+	case "pcap":
+		if len(t.Pcap) == 0 {
+			writeError(w, http.StatusNotFound, "the packet capture of trace "+e.ID+" was not kept")
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+filepath.Base(e.Pcap)+"\"")
+		w.Write(t.Pcap)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(content, '\n'))
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	content, _ := json.Marshal(map[string]string{"error": message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(content, '\n'))
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quic_tracker_api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewServer(dir, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := &qt.Trace{Host: "quic.example.com:443", Scenario: "handshake", StartedAt: time.Now().Unix(), Results: map[string]interface{}{}, Pcap: []byte{0x0a, 0x0d, 0x0d, 0x0a}}
+	if _, err := s.store.Add([]*qt.Trace{trace}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	request := func(method, path, body string) (int, []byte) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		content, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, content
+	}
+
+	if status, content := request("GET", "/api/scenarios", ""); status != http.StatusOK || !strings.Contains(string(content), `"name":"zero_rtt"`) {
+		t.Errorf("unexpected catalog %d %s", status, content)
+	}
+
+	for _, body := range []string{`{"hosts": ["quic.example.com"], "unknown": 1}`, `{"hosts": ["quic.example.com"], "scenarios": "tag:"}`,
+		`{"scenarios": "handshake"}`, `{"hosts": [{"name": "quic.example.com", "hq_port": 70000}]}`} {
+		if status, content := request("POST", "/api/runs", body); status != http.StatusBadRequest {
+			t.Errorf("%s was answered with %d %s", body, status, content)
+		}
+	}
+
+	status, content := request("GET", "/api/traces?scenario=handshake&last=1", "")
+	var entries []struct{ ID string }
+	if err := json.Unmarshal(content, &entries); status != http.StatusOK || err != nil || len(entries) != 1 {
+		t.Fatalf("unexpected traces %d %s", status, content)
+	}
+	if status, content := request("GET", "/api/traces/"+entries[0].ID+"/pcap", ""); status != http.StatusOK || len(content) != 4 {
+		t.Errorf("unexpected pcap %d %v", status, content)
+	}
+	if status, _ := request("GET", "/api/traces/"+entries[0].ID+"/qlog", ""); status != http.StatusNotFound {
+		t.Errorf("a missing qlog was answered with %d", status)
+	}
+
+	if status, _ := request("DELETE", "/api/scenarios", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("a method not allowed was answered with %d", status)
+	}
+	if status, _ := request("GET", "/api/runs/unknown", ""); status != http.StatusNotFound {
+		t.Errorf("an unknown run was answered with %d", status)
+	}
+	if status, content := request("GET", "/api/runs", ""); status != http.StatusOK || string(content) != "[]\n" {
+		t.Errorf("unexpected runs %d %s", status, content)
+	}
+}
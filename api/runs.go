@@ -0,0 +1,328 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/hosts"
+	"github.com/QUIC-Tracker/quic-tracker/metrics"
+	"github.com/QUIC-Tracker/quic-tracker/results"
+	"github.com/QUIC-Tracker/quic-tracker/scenarii"
+	"github.com/QUIC-Tracker/quic-tracker/store"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The status of a run.
+const (
+	RunRunning     = "running"
+	RunCompleted   = "completed"
+	RunCancelled   = "cancelled"
+	RunInterrupted = "interrupted" // The server stopped before the run completed
+)
+
+// A RunRequest describes the scenarios to run and the hosts to run them against.
+type RunRequest struct {
+	Hosts     []json.RawMessage `json:"hosts"`     // Either names of hosts of the inventory, host:port or hosts described as in an inventory
+	HostTags  []string          `json:"host_tags"` // Adds the hosts of the inventory having one of these tags
+	Scenarios string            `json:"scenarios"` // A selection of scenarios, e.g. tag:http3,!slow, all of them when empty
+	Repeat    int               `json:"repeat"`    // The number of times each scenario is run against each host, 1 by default
+	Retries   int               `json:"retries"`   // The number of times a scenario that fails is run again, unless overridden for the host
+	Timeout   int               `json:"timeout"`   // The time allowed to each scenario in seconds, the default timeout of the server when 0
+}
+
+// A Run of scenarios against hosts and its progress.
+type Run struct {
+	ID         string         `json:"id"`
+	Status     string         `json:"status"`
+	Scenarios  []string       `json:"scenarios"`
+	Hosts      []string       `json:"hosts"`
+	CreatedAt  int64          `json:"created_at"`
+	FinishedAt int64          `json:"finished_at,omitempty"`
+	Total      int            `json:"total"`  // The number of scenarios to run against a host
+	Done       int            `json:"done"`   // The number of them that completed, with all their attempts
+	Counts     map[string]int `json:"counts"` // The number of traces of each outcome
+	Traces     []store.Entry  `json:"traces"` // The entries of the traces of the run in the store
+}
+
+type run struct {
+	Run
+	mutex     sync.Mutex
+	updated   chan struct{} // Closed and replaced when the run is updated
+	cancelled bool
+	saving    sync.Mutex
+}
+
+type job struct {
+	scenario string
+	host     *hosts.Host
+}
+
+// snapshot returns a copy of the run and a channel that is closed when it is updated.
+func (r *run) snapshot() (Run, <-chan struct{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	s := r.Run
+	s.Counts = make(map[string]int)
+	for outcome, count := range r.Counts {
+		s.Counts[outcome] = count
+	}
+	s.Traces = append([]store.Entry{}, r.Traces...)
+	return s, r.updated
+}
+
+func (r *run) update(f func(r *Run)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	f(&r.Run)
+	close(r.updated)
+	r.updated = make(chan struct{})
+}
+
+func (r *run) isCancelled() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.cancelled
+}
+
+// resolveHosts returns the hosts a run request designates.
+func (s *Server) resolveHosts(request RunRequest) ([]*hosts.Host, error) {
+	var selected []*hosts.Host
+	var described []json.RawMessage
+	for _, h := range request.Hosts {
+		var name string
+		if json.Unmarshal(h, &name) != nil {
+			described = append(described, h)
+			continue
+		}
+		found := false
+		for _, i := range s.inventory {
+			if i.Name == name {
+				selected = append(selected, i)
+				found = true
+			}
+		}
+		if !found {
+			h := map[string]interface{}{"name": name}
+			if host, port, err := net.SplitHostPort(name); err == nil {
+				if p, err := strconv.Atoi(port); err == nil {
+					h["name"], h["hq_port"] = host, p
+				}
+			}
+			content, _ := json.Marshal(h)
+			described = append(described, content)
+		}
+	}
+	if len(described) > 0 {
+		content, err := json.Marshal(described)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := hosts.Parse(content)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, parsed...)
+	}
+	if len(request.HostTags) > 0 {
+		for _, h := range s.inventory {
+			if h.HasTag(request.HostTags...) {
+				selected = append(selected, h)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// start creates a run from the request and runs it in the background.
+func (s *Server) start(request RunRequest) (*run, error) {
+	if request.Repeat == 0 {
+		request.Repeat = 1
+	}
+	if request.Repeat < 0 || request.Retries < 0 || request.Timeout < 0 {
+		return nil, fmt.Errorf("repeat, retries and timeout cannot be negative")
+	}
+	scenarios, err := scenarii.Select(request.Scenarios)
+	if err != nil {
+		return nil, err
+	}
+	selectedHosts, err := s.resolveHosts(request)
+	if err != nil {
+		return nil, err
+	}
+	if len(selectedHosts) == 0 {
+		return nil, fmt.Errorf("no hosts were selected")
+	}
+
+	var jobs []job
+	for _, scenario := range scenarios {
+		for _, h := range selectedHosts {
+			if !h.Skips(scenario) {
+				jobs = append(jobs, job{scenario, h})
+			}
+		}
+	}
+
+	r := &run{updated: make(chan struct{})}
+	r.Status, r.Scenarios, r.CreatedAt, r.Total, r.Counts = RunRunning, scenarios, time.Now().Unix(), len(jobs), make(map[string]int)
+	for _, h := range selectedHosts {
+		r.Hosts = append(r.Hosts, h.Name)
+	}
+
+	s.mutex.Lock()
+	r.ID = time.Now().UTC().Format("20060102T150405")
+	for i := 2; s.runs[r.ID] != nil; i++ {
+		r.ID = fmt.Sprintf("%s-%d", time.Now().UTC().Format("20060102T150405"), i)
+	}
+	s.runs[r.ID] = r
+	s.mutex.Unlock()
+	if err := s.save(r); err != nil {
+		return nil, err
+	}
+
+	go s.execute(r, jobs, request)
+	return r, nil
+}
+
+// execute runs the jobs of a run, sharing the instances of the server with the other runs.
+func (s *Server) execute(r *run, jobs []job, request RunRequest) {
+	wg := &sync.WaitGroup{}
+	for _, j := range jobs {
+		<-s.semaphore
+		if r.isCancelled() {
+			s.semaphore <- true
+			break
+		}
+		wg.Add(1)
+		go func(j job) {
+			defer func() { s.semaphore <- true }()
+			defer wg.Done()
+			s.executeJob(r, j, request)
+			r.update(func(r *Run) { r.Done++ })
+			s.save(r)
+		}(j)
+	}
+	wg.Wait()
+
+	r.update(func(run *Run) {
+		run.Status = RunCompleted
+		if r.cancelled {
+			run.Status = RunCancelled
+		}
+		run.FinishedAt = time.Now().Unix()
+	})
+	if err := s.save(r); err != nil {
+		fmt.Fprintln(s.LogOutput, "could not save run", r.ID+":", err.Error())
+	}
+}
+
+// executeJob runs a scenario against a host, repeating it and retrying it as requested. scenarii.Run recovers the panics
+// of the scenario and of its agents into crash traces, so that they do not take down the server.
+func (s *Server) executeJob(r *run, j job, request RunRequest) {
+	scenario := scenarii.GetScenario(j.scenario)
+	target := j.host.Target(j.scenario, scenario.HTTP3(), scenario.IPv6())
+	options := scenarii.RunOptions{
+		Address:     target.Address,
+		ServerName:  target.ServerName,
+		Path:        target.Path,
+		ContentHash: target.ContentHash,
+		ALPN:        target.ALPN,
+		Version:     target.Version,
+		Timeout:     s.Timeout,
+		Interface:   s.Interface,
+	}
+	if request.Timeout != 0 {
+		options.Timeout = time.Duration(request.Timeout) * time.Second
+	}
+	if target.Timeout != 0 {
+		options.Timeout = target.Timeout
+	}
+	retries := target.Retries
+	if retries < 0 {
+		retries = request.Retries
+	}
+
+	logDirectory := filepath.Join(s.directory, "runs", r.ID, j.scenario)
+	os.MkdirAll(logDirectory, 0755)
+	scenarii.RunAttempts(request.Repeat, retries, func(attempt int) *qt.Trace {
+		if r.isCancelled() {
+			return nil
+		}
+		logFilename := filepath.Join(logDirectory, target.Host)
+		if attempt > 1 {
+			logFilename += fmt.Sprintf(".%d", attempt)
+		}
+		logFile, err := os.Create(logFilename)
+		if err != nil {
+			fmt.Fprintln(s.LogOutput, err.Error())
+			return nil
+		}
+		defer logFile.Close()
+		options.LogOutput = logFile
+		return scenarii.Run(scenarii.GetScenario(j.scenario), target.Host, options)
+	}, func(trace *qt.Trace) { s.record(r, trace) })
+}
+
+// record adds a trace to the store and to its run.
+func (s *Server) record(r *run, trace *qt.Trace) {
+	id, err := store.TraceID(trace)
+	if err == nil {
+		_, err = s.store.Add([]*qt.Trace{trace})
+	}
+	var entry store.Entry
+	if err == nil {
+		entry, err = s.store.Get(id)
+	}
+	if err != nil {
+		fmt.Fprintln(s.LogOutput, "could not store the trace of", trace.Scenario, "against", trace.Host+":", err.Error())
+		return
+	}
+	metrics.ObserveTrace(trace)
+	r.update(func(r *Run) {
+		r.Traces = append(r.Traces, entry)
+		r.Counts[results.OutcomeOf(trace)]++
+	})
+}
+
+// save writes the run to its file.
+func (s *Server) save(r *run) error {
+	r.saving.Lock()
+	defer r.saving.Unlock()
+	snapshot, _ := r.snapshot()
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(s.directory, "runs", r.ID+".json"), content, 0644)
+}
+
+// loadRuns reads the runs saved by previous instances of the server.
+func (s *Server) loadRuns() error {
+	files, err := filepath.Glob(filepath.Join(s.directory, "runs", "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		r := &run{updated: make(chan struct{})}
+		if err := json.Unmarshal(content, &r.Run); err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error())
+		}
+		s.runs[r.ID] = r
+		if r.Status == RunRunning {
+			r.Status = RunInterrupted
+			if err := s.save(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
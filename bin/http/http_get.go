@@ -6,63 +6,189 @@ import (
 	"fmt"
 	qt "github.com/QUIC-Tracker/quic-tracker"
 	"github.com/QUIC-Tracker/quic-tracker/agents"
-	"github.com/davecgh/go-spew/spew"
+	"github.com/QUIC-Tracker/quic-tracker/download"
+	"github.com/QUIC-Tracker/quic-tracker/metrics"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
 func main() {
+	http.Handle("/metrics", metrics.Handler())
 	go func() {
 		log.Println(http.ListenAndServe("localhost:6060", nil))
 	}()
 
-	address := flag.String("address", "", "The address to connect to")
+	address := flag.String("address", "", "The address to connect to, when no URLs are given as arguments")
 	useIPv6 := flag.Bool("6", false, "Use IPV6")
-	path := flag.String("path", "/index.html", "The path to request")
+	path := flag.String("path", "/index.html", "The path to request, when no URLs are given as arguments")
 	alpn := flag.String("alpn", "hq", "The ALPN prefix to use when connecting ot the endpoint.")
-	qlog := flag.String("qlog", "", "The file to write the qlog output to.")
-	netInterface := flag.String("interface", "", "The interface to listen to when capturing pcap")
+	qlog := flag.String("qlog", "", "The file to write the qlog output to. The index of the connection is added to its name when there are several.")
+	qlogDir := flag.String("qlog-dir", "", "The directory to stream the qlog events of the connection to, in a file named after its original destination connection ID.")
+	qlogLegacy := flag.Bool("qlog-legacy", false, "Emits the qlog in the legacy draft-01 format.")
+	netInterface := flag.String("interface", "", "The interface to listen to when capturing pcap. When set, tcpdump is used instead of the in-process pcapng capture")
 	timeout := flag.Int("timeout", 10, "The number of seconds after which the program will timeout")
 	h3 := flag.Bool("3", false, "Use HTTP/3 instead of HTTP/0.9")
+	output := flag.String("output", "", "The directory to save the bodies of the responses to")
+	connections := flag.Int("connections", 1, "The number of connections over which the requests are split")
+	resultsFile := flag.String("results", "", "The file to write the results of the downloads to in JSON")
 	flag.Parse()
 
-	t := time.NewTimer(time.Duration(*timeout) * time.Second)
-	conn, err := qt.NewDefaultConnection(*address, (*address)[:strings.LastIndex(*address, ":")], nil, *useIPv6, *alpn, *h3)
+	urls, err := requestedURLs(flag.Args(), *address, *path)
 	if err != nil {
-		panic(err)
+		log.Fatalln(err)
+	}
+	if *output != "" {
+		if err := os.MkdirAll(*output, os.ModePerm); err != nil {
+			log.Fatalln(err)
+		}
 	}
-	defer conn.Close()
-	conn.QLog.Title = fmt.Sprintf("QUIC-Tracker HTTP GET %s%s", *address, *path)
 
-	if *h3 {
-		conn.TLSTPHandler.MaxUniStreams = 3
+	g := &getter{useIPv6: *useIPv6, alpn: *alpn, h3: *h3, qlogDir: *qlogDir, qlogLegacy: *qlogLegacy, netInterface: *netInterface, output: *output}
+	groups := download.Split(urls, *connections)
+	traces := make([]qt.Trace, len(groups))
+	results := make([][]download.Result, len(groups))
+	deadline := time.Now().Add(time.Duration(*timeout) * time.Second)
+
+	var wg sync.WaitGroup
+	for i, group := range groups {
+		wg.Add(1)
+		go func(i int, group []*url.URL) {
+			defer wg.Done()
+			qlogFile := *qlog
+			if qlogFile != "" && len(groups) > 1 {
+				qlogFile = strings.TrimSuffix(qlogFile, filepath.Ext(qlogFile)) + fmt.Sprintf("_%d", i) + filepath.Ext(qlogFile)
+			}
+			trace, r := g.get(group, qlogFile, time.NewTimer(time.Until(deadline)).C)
+			for j := range r {
+				r[j].Connection = i
+			}
+			trace.Results["downloads"] = r
+			traces[i], results[i] = *trace, r
+		}(i, group)
+	}
+	wg.Wait()
+
+	var all []download.Result
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	download.WriteTable(os.Stdout, all)
+	if *resultsFile != "" {
+		content, err := json.Marshal(all)
+		if err == nil {
+			err = ioutil.WriteFile(*resultsFile, content, 0644)
+		}
+		if err != nil {
+			log.Println(err)
+		}
 	}
 
-	pcap, err := qt.StartPcapCapture(conn, *netInterface)
+	out, err := json.Marshal(traces)
 	if err != nil {
-		panic(err)
+		println(err)
 	}
+	println(string(out))
+}
 
-	trace := qt.NewTrace("http_get", 1, *address)
-	trace.AttachTo(conn)
-	defer func() {
-		trace.Complete(conn)
-		err = trace.AddPcap(conn, pcap)
+// requestedURLs returns the URLs given as arguments, or the one of the address and path.
+func requestedURLs(args []string, address, path string) ([]*url.URL, error) {
+	if len(args) == 0 {
+		if address == "" {
+			return nil, fmt.Errorf("an address or URLs must be given")
+		}
+		args = []string{"https://" + address + path}
+	}
+	var urls []*url.URL
+	for _, a := range args {
+		u, err := url.Parse(a)
 		if err != nil {
-			trace.Results["pcap_error"] = err.Error()
+			return nil, err
 		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("%s is not an absolute URL", a)
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
 
-		var t []qt.Trace
-		t = append(t, *trace)
-		out, err := json.Marshal(t)
+type getter struct {
+	useIPv6      bool
+	alpn         string
+	h3           bool
+	qlogDir      string
+	qlogLegacy   bool
+	netInterface string
+	output       string
+}
+
+// get downloads the URLs over a single connection to the host of the first one and returns its trace.
+func (g *getter) get(urls []*url.URL, qlogFile string, timeout <-chan time.Time) (*qt.Trace, []download.Result) {
+	address := urls[0].Host
+	if urls[0].Port() == "" {
+		address = net.JoinHostPort(urls[0].Hostname(), "443")
+	}
+	trace := qt.NewTrace("http_get", 1, address)
+	results := make([]download.Result, len(urls))
+	for i, u := range urls {
+		results[i].URL = u.String()
+	}
+	fail := func(err string) (*qt.Trace, []download.Result) {
+		for i := range results {
+			results[i].Error = err
+		}
+		return trace, results
+	}
+
+	conn, err := qt.NewDefaultConnection(address, urls[0].Hostname(), nil, g.useIPv6, g.alpn, g.h3)
+	if err != nil {
+		return fail(err.Error())
+	}
+	defer conn.Close()
+	conn.QLog.Title = fmt.Sprintf("QUIC-Tracker HTTP GET %s", urls[0].String())
+	conn.QLog.Legacy = g.qlogLegacy
+	if g.qlogDir != "" {
+		if err := conn.StreamQLog(g.qlogDir); err != nil {
+			return fail(err.Error())
+		}
+	}
+
+	if g.h3 {
+		conn.TLSTPHandler.MaxUniStreams = 3
+	}
+
+	var pcap *exec.Cmd
+	var pcapng *qt.PcapngCapture
+	if g.netInterface != "" {
+		pcap, err = qt.StartPcapCapture(conn, g.netInterface)
 		if err != nil {
-			println(err)
+			return fail(err.Error())
+		}
+	} else {
+		pcapng = qt.StartPcapngCapture(conn)
+	}
+
+	trace.AttachTo(conn)
+	defer func() {
+		trace.Complete(conn)
+		if pcap != nil {
+			err = trace.AddPcap(conn, pcap)
+			if err != nil {
+				trace.Results["pcap_error"] = err.Error()
+			}
+		} else {
+			trace.Pcap = pcapng.Stop()
 		}
-		println(string(out))
 	}()
 
 	Agents := agents.AttachAgentsToConnection(conn, agents.GetDefaultAgents()...)
@@ -79,18 +205,18 @@ func main() {
 		s := i.(agents.HandshakeStatus)
 		if !s.Completed {
 			Agents.StopAll()
-			return
+			return fail(s.Error.Error())
 		}
-	case <-t.C:
+	case <-timeout:
 		Agents.StopAll()
-		return
+		return fail("the handshake timed out")
 	}
 
 	defer func() {
 		conn.QLogTrace.Sort()
 		trace.QLog = conn.QLog
-		if *qlog != "" {
-			outFile, err := os.OpenFile(*qlog, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+		if qlogFile != "" {
+			outFile, err := os.OpenFile(qlogFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
 			if err == nil {
 				content, err := json.Marshal(conn.QLog)
 				if err == nil {
@@ -100,21 +226,15 @@ func main() {
 			}
 		}
 	}()
-	defer conn.CloseConnection(false, 0, "")
+	defer Agents.CloseConnection(false, 0, "")
 
 	var httpAgent agents.HTTPAgent
-
-	if !*h3 {
+	if !g.h3 {
 		httpAgent = &agents.HTTP09Agent{}
 	} else {
 		httpAgent = &agents.HTTP3Agent{}
 	}
 	Agents.Add(httpAgent)
 
-	select {
-	case r := <-httpAgent.SendRequest(*path, "GET", trace.Host, nil):
-		spew.Dump(r)
-	case <-t.C:
-		return
-	}
+	return trace, download.Fetch(conn, httpAgent, urls, g.output, timeout)
 }
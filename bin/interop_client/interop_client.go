@@ -0,0 +1,275 @@
+// interop_client is a client endpoint for the quic-interop-runner. It reads the testcase to run and the URLs to
+// download from the TESTCASE and REQUESTS environment variables and saves the files downloaded in DOWNLOADS. The TLS
+// secrets are written to SSLKEYLOGFILE and the qlogs of the connections to QLOGDIR, if set. It exits with 127 when the
+// testcase is not supported.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/agents"
+	"github.com/QUIC-Tracker/quic-tracker/download"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const unsupportedExitCode = 127
+
+// The testcases supported, indexed by their lowercase name. The ones missing, e.g. v2, chacha20 and ecn, require
+// features the client does not have.
+var testcases = map[string]func(c *client, urls []*url.URL) error{
+	"handshake":    (*client).fetch,
+	"transfer":     (*client).fetch,
+	"retry":        (*client).fetch,
+	"http3":        (*client).fetch,
+	"multiconnect": (*client).multiconnect,
+	"resumption":   (*client).resumption,
+	"zerortt":      (*client).zeroRTT,
+	"keyupdate":    (*client).keyUpdate,
+}
+
+func main() {
+	timeout := flag.Int("timeout", 60, "The number of seconds after which the testcase fails")
+	useIPv6 := flag.Bool("6", false, "Use IPV6")
+	flag.Parse()
+
+	testcase := strings.ToLower(os.Getenv("TESTCASE"))
+	run, ok := testcases[testcase]
+	if !ok {
+		log.Printf("Testcase %q is not supported\n", testcase)
+		os.Exit(unsupportedExitCode)
+	}
+
+	var urls []*url.URL
+	for _, r := range strings.Fields(os.Getenv("REQUESTS")) {
+		u, err := url.Parse(r)
+		if err != nil {
+			log.Fatalf("Invalid request %s: %s\n", r, err.Error())
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		log.Fatalln("No requests were given")
+	}
+
+	c := &client{
+		downloads: os.Getenv("DOWNLOADS"),
+		qlogDir:   os.Getenv("QLOGDIR"),
+		useIPv6:   *useIPv6,
+		http3:     testcase == "http3",
+		timeout:   time.After(time.Duration(*timeout) * time.Second),
+	}
+	if c.downloads == "" {
+		c.downloads = "/downloads"
+	}
+	if err := run(c, urls); err != nil {
+		log.Fatalf("Testcase %s failed: %s\n", testcase, err.Error())
+	}
+}
+
+type client struct {
+	downloads string
+	qlogDir   string
+	useIPv6   bool
+	http3     bool
+	timeout   <-chan time.Time
+}
+
+// A session is a connection of the client and its agents.
+type session struct {
+	conn      *qt.Connection
+	agents    *agents.ConnectionAgents
+	handshake *agents.HandshakeAgent
+	http      agents.HTTPAgent
+	tickets   chan interface{}
+}
+
+// dial creates a connection to the host of the URL, resuming a previous one if a ticket is given. The handshake is not
+// started.
+func (c *client) dial(u *url.URL, ticket []byte, token []byte) (*session, error) {
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "443")
+	}
+	conn, err := qt.NewDefaultConnection(address, u.Hostname(), ticket, c.useIPv6, "hq", c.http3)
+	if err != nil {
+		return nil, err
+	}
+	conn.Token = token
+	if c.http3 {
+		conn.TLSTPHandler.MaxUniStreams = 3
+	}
+	if c.qlogDir != "" {
+		if err := conn.StreamQLog(c.qlogDir); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	s := &session{conn: conn, agents: agents.AttachAgentsToConnection(conn, agents.GetDefaultAgents()...)}
+	tlsAgent := s.agents.Get("TLSAgent").(*agents.TLSAgent)
+	s.tickets = tlsAgent.ResumptionTicket.RegisterNewChan(10)
+	s.handshake = &agents.HandshakeAgent{TLSAgent: tlsAgent, SocketAgent: s.agents.Get("SocketAgent").(*agents.SocketAgent)}
+	s.agents.Add(s.handshake)
+	s.agents.Get("SendingAgent").(*agents.SendingAgent).FrameProducer = s.agents.GetFrameProducingAgents()
+	s.http = s.agents.AddHTTPAgent()
+	return s, nil
+}
+
+// completeHandshake starts the handshake of the session and waits for its completion.
+func (c *client) completeHandshake(s *session) error {
+	status := s.handshake.HandshakeStatus.RegisterNewChan(10)
+	s.handshake.InitiateHandshake()
+	select {
+	case i := <-status:
+		if status := i.(agents.HandshakeStatus); !status.Completed {
+			return status.Error
+		}
+		return nil
+	case <-s.conn.ConnectionClosed:
+		return errors.New("the connection was closed during the handshake")
+	case <-c.timeout:
+		return errors.New("the handshake timed out")
+	}
+}
+
+// download downloads the files over the session and saves them.
+func (c *client) download(s *session, urls []*url.URL) error {
+	for _, r := range download.Fetch(s.conn, s.http, urls, c.downloads, c.timeout) {
+		if r.Error != "" {
+			return fmt.Errorf("%s could not be downloaded: %s", r.URL, r.Error)
+		}
+		log.Printf("Downloaded %d bytes of %s to %s in %s\n", r.Size, r.URL, r.File, r.Duration)
+	}
+	return nil
+}
+
+// fetch downloads all the files over a single connection.
+func (c *client) fetch(urls []*url.URL) error {
+	s, err := c.dial(urls[0], nil, nil)
+	if err != nil {
+		return err
+	}
+	defer c.close(s)
+	if err := c.completeHandshake(s); err != nil {
+		return err
+	}
+	return c.download(s, urls)
+}
+
+// close closes the connection of the session and stops its agents.
+func (c *client) close(s *session) {
+	s.agents.CloseConnection(false, 0, "")
+	s.conn.Close()
+}
+
+// multiconnect downloads each file over its own connection.
+func (c *client) multiconnect(urls []*url.URL) error {
+	for _, u := range urls {
+		if err := c.fetch([]*url.URL{u}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstConnection downloads the first file and returns the resumption ticket and the token the host gave.
+func (c *client) firstConnection(u *url.URL) ([]byte, []byte, error) {
+	s, err := c.dial(u, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer c.close(s)
+	if err := c.completeHandshake(s); err != nil {
+		return nil, nil, err
+	}
+	if err := c.download(s, []*url.URL{u}); err != nil {
+		return nil, nil, err
+	}
+	if ticket := s.conn.Tls.ResumptionTicket(); len(ticket) > 0 {
+		return ticket, s.conn.Token, nil
+	}
+	select {
+	case i := <-s.tickets:
+		return i.([]byte), s.conn.Token, nil
+	case <-s.conn.ConnectionClosed:
+		return nil, nil, errors.New("the host did not provide a resumption ticket")
+	case <-c.timeout:
+		return nil, nil, errors.New("the host did not provide a resumption ticket in time")
+	}
+}
+
+// resumption downloads the first file, then the others over a connection resuming the first one.
+func (c *client) resumption(urls []*url.URL) error {
+	ticket, token, err := c.firstConnection(urls[0])
+	if err != nil || len(urls) == 1 {
+		return err
+	}
+	s, err := c.dial(urls[1], ticket, token)
+	if err != nil {
+		return err
+	}
+	defer c.close(s)
+	if err := c.completeHandshake(s); err != nil {
+		return err
+	}
+	return c.download(s, urls[1:])
+}
+
+// zeroRTT downloads the first file, then requests the others in 0-RTT packets over a connection resuming the first
+// one.
+func (c *client) zeroRTT(urls []*url.URL) error {
+	ticket, token, err := c.firstConnection(urls[0])
+	if err != nil || len(urls) == 1 {
+		return err
+	}
+	s, err := c.dial(urls[1], ticket, token)
+	if err != nil {
+		return err
+	}
+	defer c.close(s)
+	s.handshake.InitiateHandshake()
+	err = c.download(s, urls[1:])
+	if s.conn.CryptoState(qt.EncryptionLevel0RTT) == nil {
+		log.Println("0-RTT was not available when resuming the connection, the requests were sent in 1-RTT packets")
+	}
+	return err
+}
+
+// keyUpdate initiates a key update once the handshake is confirmed, then downloads the files.
+func (c *client) keyUpdate(urls []*url.URL) error {
+	s, err := c.dial(urls[0], nil, nil)
+	if err != nil {
+		return err
+	}
+	defer c.close(s)
+	acknowledged := s.conn.PacketAcknowledged.RegisterNewChan(1000)
+	if err := c.completeHandshake(s); err != nil {
+		return err
+	}
+
+	// An acknowledgement of a 1-RTT packet confirms the handshake, after which keys can be updated.
+	s.conn.FrameQueue.Submit(qt.QueuedFrame{Frame: new(qt.PingFrame), EncryptionLevel: qt.EncryptionLevel1RTT})
+waitForAck:
+	for {
+		select {
+		case i := <-acknowledged:
+			if a, ok := i.(qt.PacketAcknowledged); ok && a.PNSpace == qt.PNSpaceAppData {
+				s.conn.PacketAcknowledged.Unregister(acknowledged)
+				break waitForAck
+			}
+		case <-s.conn.ConnectionClosed:
+			return errors.New("the connection was closed before the handshake was confirmed")
+		case <-c.timeout:
+			return errors.New("the handshake was not confirmed in time")
+		}
+	}
+	s.conn.UpdateKeys()
+	return c.download(s, urls)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/qlog/qt2qlog"
+	"io/ioutil"
+	"net"
+	"os"
+)
+
+func main() {
+	pcapFile := flag.String("pcap", "", "The pcap or pcapng file to import.")
+	keyLogFile := flag.String("keylog", "", "The key log file containing the TLS secrets of the connection. When omitted, the secrets embedded in the pcapng file are used.")
+	client := flag.String("client", "", "Selects the connection of this client address, e.g. 192.0.2.1:51234. The port can be omitted.")
+	server := flag.String("server", "", "Selects the connection to this server address, e.g. 192.0.2.2:443. The port can be omitted.")
+	dcid := flag.String("dcid", "", "Selects the connection using this connection ID, in hexadecimal.")
+	host := flag.String("host", "", "The host name to record in the trace. It defaults to the server address.")
+	outputFile := flag.String("output", "", "The file to write the trace to. It defaults to the standard output.")
+	qlogFile := flag.String("qlog", "", "The file to write the qlog of the connection to.")
+	qlogDir := flag.String("qlog-dir", "", "The directory to write the qlog of the connection to, in a JSON-SEQ file named after its original destination connection ID.")
+	qlogLegacy := flag.Bool("qlog-legacy", false, "Emits the qlog in the legacy draft-01 format.")
+	noPcap := flag.Bool("nopcap", false, "Do not embed the capture file in the trace.")
+	flag.Parse()
+
+	if *pcapFile == "" {
+		println("Parameter pcap is required")
+		os.Exit(-1)
+	}
+
+	var filter qt.CaptureFilter
+	var err error
+	if filter.Client, err = parseAddress(*client); err != nil {
+		println("Invalid client address:", err.Error())
+		os.Exit(-1)
+	}
+	if filter.Server, err = parseAddress(*server); err != nil {
+		println("Invalid server address:", err.Error())
+		os.Exit(-1)
+	}
+	if filter.DCID, err = hex.DecodeString(*dcid); err != nil {
+		println("Invalid connection ID:", err.Error())
+		os.Exit(-1)
+	}
+
+	capture, err := ioutil.ReadFile(*pcapFile)
+	if err != nil {
+		println(err.Error())
+		os.Exit(-1)
+	}
+	datagrams, embeddedKeyLog, err := qt.ReadCapture(bytes.NewReader(capture))
+	if err != nil {
+		println("Could not read capture:", err.Error())
+		os.Exit(-1)
+	}
+
+	keyLog := embeddedKeyLog
+	if *keyLogFile != "" {
+		if keyLog, err = ioutil.ReadFile(*keyLogFile); err != nil {
+			println(err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	trace, err := qt.ImportCapture(datagrams, qt.ParseKeyLog(keyLog), filter)
+	if err != nil {
+		println(err.Error())
+		os.Exit(-1)
+	}
+	if *host != "" {
+		trace.Host = *host
+	}
+	if !*noPcap {
+		trace.Pcap = capture
+	}
+
+	packets := qt.NewTraceDecoder().DecodeAll(trace)
+	q := qt2qlog.ConvertTrace(trace, packets)
+	q.Legacy = *qlogLegacy
+	trace.QLog = q
+	fmt.Fprintf(os.Stderr, "Imported %d packets between %s and %s, %d could not be decrypted\n", len(trace.Stream), trace.Results["client"], trace.Results["server"], trace.Results["undecryptable_packets"])
+
+	if *qlogFile != "" {
+		writeJSON(*qlogFile, trace.QLog)
+	}
+	if *qlogDir != "" {
+		if err := q.WriteSeqFiles(*qlogDir); err != nil {
+			println(err.Error())
+		}
+	}
+	if *outputFile != "" {
+		writeJSON(*outputFile, trace)
+	} else {
+		out, _ := json.Marshal(trace)
+		os.Stdout.Write(out)
+	}
+}
+
+func parseAddress(address string) (*net.UDPAddr, error) {
+	if address == "" {
+		return nil, nil
+	}
+	if ip := net.ParseIP(address); ip != nil {
+		return &net.UDPAddr{IP: ip}, nil
+	}
+	return net.ResolveUDPAddr("udp", address)
+}
+
+func writeJSON(filename string, v interface{}) {
+	out, err := json.Marshal(v)
+	if err == nil {
+		err = ioutil.WriteFile(filename, out, 0644)
+	}
+	if err != nil {
+		println(err.Error())
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"github.com/QUIC-Tracker/quic-tracker/api"
+	"github.com/QUIC-Tracker/quic-tracker/hosts"
+	"github.com/QUIC-Tracker/quic-tracker/metrics"
+	"github.com/QUIC-Tracker/quic-tracker/scenarii"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	listen := flag.String("listen", "localhost:8080", "The address to serve the API on.")
+	directory := flag.String("data", "quic-tracker-server", "The directory to keep the runs and their traces in.")
+	hostsFilename := flag.String("hosts", "", "An inventory of the hosts that runs can designate by name or by tag.")
+	maxInstances := flag.Int("max-instances", 10, "The maximum number of scenarios run at the same time.")
+	timeout := flag.Int("timeout", 10, "The default amount of time to run each scenario before exiting.")
+	netInterface := flag.String("interface", "", "The interface to listen to when capturing pcaps. The packets are captured in-process if not set.")
+	scenarioFiles := flag.String("scenario-files", "", "A comma-separated list of YAML or JSON files describing additional scenarios, or of directories containing them.")
+	exposeMetrics := flag.Bool("metrics", false, "Serves the metrics of the runs on /metrics.")
+	flag.Parse()
+
+	if *scenarioFiles != "" {
+		if err := scenarii.LoadScenarioFiles(strings.Split(*scenarioFiles, ",")...); err != nil {
+			println(err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	var inventory []*hosts.Host
+	if *hostsFilename != "" {
+		var err error
+		inventory, err = hosts.Load(*hostsFilename)
+		if err != nil {
+			println("Could not load", *hostsFilename+":", err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	server, err := api.NewServer(*directory, inventory, *maxInstances)
+	if err != nil {
+		println(err.Error())
+		os.Exit(-1)
+	}
+	server.Timeout = time.Duration(*timeout) * time.Second
+	server.Interface = *netInterface
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", server)
+	if *exposeMetrics {
+		mux.Handle("/metrics", metrics.Handler())
+	}
+
+	log.Println("serving the API on", *listen)
+	log.Fatal(http.ListenAndServe(*listen, mux))
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/QUIC-Tracker/quic-tracker/results"
+	"github.com/QUIC-Tracker/quic-tracker/scenarii"
+	"github.com/QUIC-Tracker/quic-tracker/store"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `Usage: qtdb [-db directory] command [parameters]
+
+Commands:
+  add results.json...  Adds the traces of results files to the store
+  query                Lists the verdicts selected, e.g. query -host quic.example.com:443 -scenario key_update -last 10
+  failing              Lists the scenarios that started failing, e.g. failing -scenario zero_rtt -since 7d
+  show ID              Prints a trace and extracts its packet capture and qlog
+  prune                Applies a retention policy to the store, e.g. prune -max-age 365d -blob-max-age 30d
+
+Run qtdb command -h for the parameters of a command.
+`
+
+func main() {
+	db := flag.String("db", "quic-tracker-store", "The directory of the store.")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(-1)
+	}
+
+	s, err := store.Open(*db)
+	if err != nil {
+		println("Could not open", *db+":", err.Error())
+		os.Exit(-1)
+	}
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	switch command {
+	case "add":
+		err = add(s, args)
+	case "query":
+		err = query(s, args)
+	case "failing":
+		err = failing(s, args)
+	case "show":
+		err = show(s, args)
+	case "prune":
+		err = prune(s, args)
+	default:
+		err = fmt.Errorf("unknown command %s", command)
+	}
+	if err != nil {
+		println(err.Error())
+		os.Exit(-1)
+	}
+}
+
+func add(s *store.Store, args []string) error {
+	flags := flag.NewFlagSet("add", flag.ExitOnError)
+	flags.Parse(args)
+	for _, filename := range flags.Args() {
+		traces, err := results.Load(filename)
+		if err != nil {
+			return fmt.Errorf("could not load %s: %s", filename, err.Error())
+		}
+		added, err := s.Add(traces)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d trace(s) added, %d already stored\n", filename, added, len(traces)-added)
+	}
+	return nil
+}
+
+func query(s *store.Store, args []string) error {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	host := flags.String("host", "", "The hosts selected, in which * and ? can be used.")
+	scenario := flags.String("scenario", "", "The scenarios selected, in which * and ? can be used.")
+	commit := flags.String("commit", "", "A prefix of the commit selected.")
+	outcome := flags.String("outcome", "", "The outcome selected: passed, failed or error.")
+	errorCodes := flags.String("error-codes", "", "A comma-separated list of the error codes selected.")
+	since := flags.String("since", "", "The earliest start time selected, either a date, e.g. 2006-01-02, or an age, e.g. 7d or 12h.")
+	until := flags.String("until", "", "The start time before which the verdicts are selected, as for since.")
+	last := flags.Int("last", 0, "The number of most recent verdicts listed for each host and scenario, all of them if not set.")
+	asJSON := flags.Bool("json", false, "Prints the entries in JSON.")
+	flags.Parse(args)
+
+	q := store.Query{Host: *host, Scenario: *scenario, Commit: *commit, Outcome: *outcome, Last: *last}
+	var err error
+	if q.Since, err = parseTime(*since); err != nil {
+		return err
+	}
+	if q.Until, err = parseTime(*until); err != nil {
+		return err
+	}
+	for _, code := range strings.Split(*errorCodes, ",") {
+		if code = strings.TrimSpace(code); code == "" {
+			continue
+		}
+		c, err := strconv.ParseUint(code, 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid error code %s", code)
+		}
+		q.ErrorCodes = append(q.ErrorCodes, uint8(c))
+	}
+
+	entries := s.Query(q)
+	if *asJSON {
+		return printJSON(entries)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tHOST\tSCENARIO\tATTEMPT\tCOMMIT\tVERDICT\tID")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", formatTime(e), e.Host, e.Scenario, formatAttempt(e), shortCommit(e.Commit), formatVerdict(e), e.ID)
+	}
+	return w.Flush()
+}
+
+func failing(s *store.Store, args []string) error {
+	flags := flag.NewFlagSet("failing", flag.ExitOnError)
+	host := flags.String("host", "", "The hosts selected, in which * and ? can be used.")
+	scenario := flags.String("scenario", "", "The scenarios selected, in which * and ? can be used.")
+	since := flags.String("since", "7d", "The time since which the scenarios started failing, either a date, e.g. 2006-01-02, or an age, e.g. 7d or 12h.")
+	asJSON := flags.Bool("json", false, "Prints the scenarios in JSON.")
+	flags.Parse(args)
+
+	t, err := parseTime(*since)
+	if err != nil {
+		return err
+	}
+	transitions := s.StartedFailing(*host, *scenario, t)
+	if *asJSON {
+		return printJSON(transitions)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSCENARIO\tLAST PASSED\tFAILING SINCE\tLATEST VERDICT\tID")
+	for _, t := range transitions {
+		fmt.Fprintf(w, "%s\t%s\t%s (%s)\t%s (%s)\t%s\t%s\n", t.Host, t.Scenario, formatTime(t.LastPassed), shortCommit(t.LastPassed.Commit),
+			formatTime(t.FirstFailed), shortCommit(t.FirstFailed.Commit), formatVerdict(t.Latest), t.Latest.ID)
+	}
+	return w.Flush()
+}
+
+func show(s *store.Store, args []string) error {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	output := flags.String("output", "", "The file to write the trace to, the standard output by default.")
+	pcap := flags.String("pcap", "", "The file to write the packet capture of the trace to.")
+	qlog := flags.String("qlog", "", "The file to write the qlog of the trace to.")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("show requires the ID of a trace")
+	}
+	e, err := s.Get(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	t, err := s.Trace(e)
+	if err != nil {
+		return err
+	}
+
+	if *pcap != "" {
+		if len(t.Pcap) == 0 {
+			return fmt.Errorf("the packet capture of trace %s was not kept", e.ID)
+		}
+		if err := ioutil.WriteFile(*pcap, t.Pcap, 0644); err != nil {
+			return err
+		}
+	}
+	if *qlog != "" {
+		if t.QLog == nil {
+			return fmt.Errorf("the qlog of trace %s was not kept", e.ID)
+		}
+		content, err := json.Marshal(t.QLog)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*qlog, content, 0644); err != nil {
+			return err
+		}
+	}
+
+	content, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return ioutil.WriteFile(*output, content, 0644)
+	}
+	_, err = os.Stdout.Write(append(content, '\n'))
+	return err
+}
+
+func prune(s *store.Store, args []string) error {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	maxAge := flags.String("max-age", "", "The age after which the traces are removed, e.g. 365d.")
+	blobMaxAge := flags.String("blob-max-age", "", "The age after which the packet captures and qlog of the traces are removed, e.g. 30d.")
+	keepLast := flags.Int("keep-last", 1, "The number of most recent traces of each host and scenario that are never removed.")
+	flags.Parse(args)
+
+	r := store.Retention{KeepLast: *keepLast}
+	var err error
+	if r.MaxAge, err = parseAge(*maxAge); err != nil {
+		return err
+	}
+	if r.BlobMaxAge, err = parseAge(*blobMaxAge); err != nil {
+		return err
+	}
+	removed, err := s.Prune(r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d trace(s) removed\n", removed)
+	return nil
+}
+
+// parseAge reads a duration, which can also be expressed in days, e.g. 7d.
+func parseAge(age string) (time.Duration, error) {
+	if age == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+		if err == nil && days >= 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(age)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %s", age)
+	}
+	return d, nil
+}
+
+// parseTime reads either a date, a time in RFC 3339 format or an age relative to the current time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s", value)
+	}
+	return time.Now().Add(-age), nil
+}
+
+func formatTime(e store.Entry) string {
+	return e.Time().Format("2006-01-02 15:04:05")
+}
+
+func formatAttempt(e store.Entry) string {
+	if e.Attempt == 0 {
+		return "-"
+	}
+	return strconv.Itoa(e.Attempt)
+}
+
+func formatVerdict(e store.Entry) string {
+	return fmt.Sprintf("%s %d: %s", e.Outcome, e.ErrorCode, scenarii.ErrorCodeDescription(e.Scenario, e.ErrorCode))
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(out, '\n'))
+	return err
+}
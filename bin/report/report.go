@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/results"
+	"github.com/QUIC-Tracker/quic-tracker/scenarii"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	input := flag.String("input", "", "The results file to report.")
+	format := flag.String("format", "markdown", "The format of the report: markdown, html or csv.")
+	output := flag.String("output", "", "The file to write the report to, the standard output by default.")
+	title := flag.String("title", "QUIC-Tracker results", "The title of the report.")
+	tracesDir := flag.String("traces", "", "A directory to write each trace to, so that the report links to them.")
+	link := flag.String("link", "", "The location of the traces the report links to, in which {host}, {scenario} and {attempt} are replaced.")
+	flag.Parse()
+
+	if *input == "" {
+		println("Parameter input is required")
+		os.Exit(-1)
+	}
+
+	traces, err := results.Load(*input)
+	if err != nil {
+		println("Could not load", *input+":", err.Error())
+		os.Exit(-1)
+	}
+
+	var linkOf func(*qt.Trace) string
+	if *tracesDir != "" {
+		paths, err := results.SaveTraces(*tracesDir, traces)
+		if err != nil {
+			println(err.Error())
+			os.Exit(-1)
+		}
+		base := "."
+		if *output != "" {
+			base = filepath.Dir(*output)
+		}
+		linkOf = func(t *qt.Trace) string {
+			if rel, err := filepath.Rel(base, paths[t]); err == nil {
+				return filepath.ToSlash(rel)
+			}
+			return paths[t]
+		}
+	} else if *link != "" {
+		linkOf = func(t *qt.Trace) string {
+			attempt := t.Attempt
+			if attempt == 0 {
+				attempt = 1
+			}
+			return strings.NewReplacer("{host}", t.Host, "{scenario}", t.Scenario, "{attempt}", strconv.Itoa(attempt)).Replace(*link)
+		}
+	}
+
+	report := results.NewReport(*title, traces, scenarii.ErrorCodeDescription, linkOf)
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		outFile, err := os.Create(*output)
+		if err != nil {
+			println(err.Error())
+			os.Exit(-1)
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+
+	switch *format {
+	case "markdown":
+		err = report.WriteMarkdown(out)
+	case "html":
+		err = report.WriteHTML(out)
+	case "csv":
+		err = report.WriteCSV(out)
+	default:
+		println("Unknown format", *format)
+		os.Exit(-1)
+	}
+	if err != nil {
+		println(err.Error())
+		os.Exit(-1)
+	}
+}
@@ -3,24 +3,30 @@ package main
 import (
 	"encoding/json"
 	"flag"
-	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/hosts"
 	s "github.com/QUIC-Tracker/quic-tracker/scenarii"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 )
 
 func main() {
 	host := flag.String("host", "", "The host endpoint to run the test against.")
+	address := flag.String("address", "", "The address to connect to instead of resolving the host.")
+	sni := flag.String("sni", "", "The server name to use instead of the name of the host.")
+	version := flag.String("version", "", "The hexadecimal QUIC version to propose instead of the default one.")
 	path := flag.String("path", "/index.html", "The path to request when performing tests that needs data to be sent.")
+	contentHash := flag.String("content-hash", "", "The expected hash of the content of the path, e.g. sha256:<hex>, which the scenarios downloading it check.")
 	alpn := flag.String("alpn", "hq", "The ALPN prefix to use when connecting ot the endpoint.")
 	scenarioName := flag.String("scenario", "", "The particular scenario to run.")
+	scenarioFiles := flag.String("scenario-files", "", "A comma-separated list of YAML or JSON files describing additional scenarios, or of directories containing them.")
 	outputFile := flag.String("output", "", "The file to write the output to. Output to stdout if not set.")
 	qlog := flag.String("qlog", "", "The file to write the qlog output to.")
+	qlogDir := flag.String("qlog-dir", "", "The directory to stream the qlog events of each connection to, in files named after their original destination connection ID.")
+	qlogLegacy := flag.Bool("qlog-legacy", false, "Emits the qlog in the legacy draft-01 format.")
 	debug := flag.Bool("debug", false, "Enables debugging information to be printed.")
 	nopcap := flag.Bool("nopcap", false, "Disables the pcap capture.")
-	netInterface := flag.String("interface", "", "The interface to listen to when capturing pcap.")
+	netInterface := flag.String("interface", "", "The interface to listen to when capturing pcap. When set, tcpdump is used instead of the in-process pcapng capture.")
 	timeout := flag.Int("timeout", 10, "The amount of time in seconds spent when completing the test. Defaults to 10. When set to 0, the test ends as soon as possible.")
 	flag.Parse()
 
@@ -29,61 +35,53 @@ func main() {
 		os.Exit(-1)
 	}
 
-	scenario, ok := s.GetAllScenarii()[*scenarioName]
-	if !ok {
+	if *scenarioFiles != "" {
+		if err := s.LoadScenarioFiles(strings.Split(*scenarioFiles, ",")...); err != nil {
+			println(err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	scenario := s.GetScenario(*scenarioName)
+	if scenario == nil {
 		println("Unknown scenario", *scenarioName)
 		return
 	}
 
-	trace := qt.NewTrace(scenario.Name(), scenario.Version(), *host)
-
-	conn, err := qt.NewDefaultConnection(*host, strings.Split(*host, ":")[0], nil, scenario.IPv6(), *alpn, scenario.HTTP3()) // Raw IPv6 are not handled correctly
-
-	if err == nil {
-		conn.QLog.Title = "QUIC-Tracker scenario " + *scenarioName
-
-		var pcap *exec.Cmd
-		if !*nopcap {
-			pcap, err = qt.StartPcapCapture(conn, *netInterface)
-			if err != nil {
-				trace.Results["pcap_start_error"] = err.Error()
-			}
-		}
-
-		trace.AttachTo(conn)
-
-		start := time.Now()
-		scenario.SetTimer(time.Duration(*timeout) * time.Second)
-		scenario.Run(conn, trace, *path, *debug)
-		trace.Duration = uint64(time.Now().Sub(start).Seconds() * 1000)
-		ip := strings.Replace(conn.ConnectedIp().String(), "[", "", -1)
-		trace.Ip = ip[:strings.LastIndex(ip, ":")]
-		trace.StartedAt = start.Unix()
-
-		trace.Complete(conn)
-		conn.Close()
-		if pcap != nil {
-			err = trace.AddPcap(conn, pcap)
-		}
+	var quicVersion uint32
+	if *version != "" {
+		v, err := hosts.ParseVersion(*version)
 		if err != nil {
-			trace.Results["pcap_completed_error"] = err.Error()
+			println(err.Error())
+			os.Exit(-1)
 		}
+		quicVersion = v
+	}
+
+	trace := s.Run(scenario, *host, s.RunOptions{
+		Address:       *address,
+		ServerName:    *sni,
+		Version:       quicVersion,
+		Path:          *path,
+		ContentHash:   *contentHash,
+		ALPN:          *alpn,
+		Timeout:       time.Duration(*timeout) * time.Second,
+		Debug:         *debug,
+		QLogDirectory: *qlogDir,
+		QLogLegacy:    *qlogLegacy,
+		NoPcap:        *nopcap,
+		Interface:     *netInterface,
+	})
 
-		conn.QLogTrace.Sort()
-		trace.QLog = conn.QLog
-		if *qlog != "" {
-			outFile, err := os.OpenFile(*qlog, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if *qlog != "" && trace.QLog != nil {
+		outFile, err := os.OpenFile(*qlog, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+		if err == nil {
+			content, err := json.Marshal(trace.QLog)
 			if err == nil {
-				content, err := json.Marshal(conn.QLog)
-				if err == nil {
-					outFile.Write(content)
-					outFile.Close()
-				}
+				outFile.Write(content)
+				outFile.Close()
 			}
 		}
-	} else {
-		trace.ErrorCode = 255
-		trace.Results["udp_error"] = err.Error()
 	}
 
 	out, _ := json.Marshal(trace)
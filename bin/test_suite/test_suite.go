@@ -1,17 +1,21 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
 	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/hosts"
+	"github.com/QUIC-Tracker/quic-tracker/metrics"
+	r "github.com/QUIC-Tracker/quic-tracker/results"
 	"github.com/QUIC-Tracker/quic-tracker/scenarii"
+	"github.com/QUIC-Tracker/quic-tracker/store"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"os/exec"
 	p "path"
-	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -20,8 +24,15 @@ import (
 )
 
 func main() {
-	hostsFilename := flag.String("hosts", "", "A tab-separated file containing hosts, the paths used to request data to be sent and ports for negotiating h3.")
+	hostsFilename := flag.String("hosts", "", "A YAML or JSON inventory of the hosts, or a tab-separated file containing hosts, the paths used to request data to be sent, ports for negotiating h3 and ALPNs.")
+	hostTags := flag.String("host-tags", "", "A comma-separated list of tags, runs the scenarios only against the hosts having one of them.")
 	scenarioName := flag.String("scenario", "", "A particular scenario to run. Run all of them if the parameter is missing.")
+	scenarioSelection := flag.String("scenarios", "", "A comma-separated selection of scenarios to run, e.g. 'tag:http3,!slow' or 'http3_*'. A term selects the scenarios whose name matches it or that have it as tag, a term prefixed with ! excludes them.")
+	scenarioFiles := flag.String("scenario-files", "", "A comma-separated list of YAML or JSON files describing additional scenarios, or of directories containing them.")
+	list := flag.Bool("list", false, "Prints the catalog of the scenarios selected and exits.")
+	repeat := flag.Int("repeat", 1, "The number of times each scenario is run against each host.")
+	maxRetries := flag.Int("retries", 0, "The number of times a scenario that fails against a host is run again, unless overridden for the host.")
+	retrySelection := flag.String("retry-scenarios", "", "The selection of scenarios that are retried when they fail, all of them if not set. See -scenarios.")
 	outputFilename := flag.String("output", "", "The file to write the output to. Output to stdout if not set.")
 	logsDirectory := flag.String("logs-directory", "/tmp", "Location of the logs.")
 	netInterface := flag.String("interface", "", "The interface to listen to when capturing pcaps. Lets tcpdump decide if not set.")
@@ -31,46 +42,91 @@ func main() {
 	randomise := flag.Bool("randomise", false, "Randomise the execution order of scenarii")
 	timeout := flag.Int("timeout", 10, "The amount of time in seconds spent when completing a test. Defaults to 10. When set to 0, each test ends as soon as possible.")
 	debug := flag.Bool("debug", false, "Enables debugging information to be printed.")
+	qlogDir := flag.String("qlog-dir", "", "The directory to stream the qlog events of each connection to, in files named after their original destination connection ID.")
+	qlogLegacy := flag.Bool("qlog-legacy", false, "Emits the qlog of the traces in the legacy draft-01 format.")
+	junitFilename := flag.String("junit", "", "The file to write a JUnit XML report of the results to.")
+	storeDirectory := flag.String("store", "", "The directory of a results store to add the results to.")
+	metricsAddress := flag.String("metrics", "", "The address to serve the metrics of the run on, e.g. localhost:9090. Disabled if not set.")
+	subprocess := flag.Bool("subprocess", false, "Runs each scenario in a separate scenario_runner process instead of in-process. This isolates the runs from crashes of the agents.")
+	scenarioRunner := flag.String("scenario-runner", "", "The scenario_runner binary used with -subprocess. Defaults to the one next to this binary, or the one in the PATH.")
 	flag.Parse()
 
-	_, filename, _, ok := runtime.Caller(0)
-	if !ok {
-		println("No caller information")
-		os.Exit(-1)
+	if *subprocess && *scenarioRunner == "" {
+		*scenarioRunner = findScenarioRunner()
 	}
-	scenarioRunnerFilename := p.Join(p.Dir(filename), "scenario_runner.go")
 
-	if *hostsFilename == "" {
-		println("The hosts parameter is required")
-		os.Exit(-1)
+	if *scenarioFiles != "" {
+		if err := scenarii.LoadScenarioFiles(strings.Split(*scenarioFiles, ",")...); err != nil {
+			println(err.Error())
+			os.Exit(-1)
+		}
 	}
 
-	file, err := os.Open(*hostsFilename)
-	if err != nil {
-		panic(err)
+	var scenarioIds []string
+	if *scenarioName != "" {
+		scenario := scenarii.GetScenario(*scenarioName)
+		if scenario == nil {
+			println("Unknown scenario", *scenarioName)
+			os.Exit(-1)
+		}
+		scenarioIds = append(scenarioIds, scenario.Name())
+	} else {
+		var err error
+		scenarioIds, err = scenarii.Select(*scenarioSelection)
+		if err != nil {
+			println(err.Error())
+			os.Exit(-1)
+		}
+	}
+	if *randomise {
+		rand.Seed(time.Now().UnixNano())
+		rand.Shuffle(len(scenarioIds), func(i, j int) { scenarioIds[i], scenarioIds[j] = scenarioIds[j], scenarioIds[i] })
+	}
+
+	if *list {
+		printCatalog(scenarioIds)
+		return
 	}
-	defer file.Close()
 
-	scenariiInstances := scenarii.GetAllScenarii()
+	if *repeat < 1 {
+		println("The repeat parameter must be positive")
+		os.Exit(-1)
+	}
 
-	var scenarioIds []string
-	for scenarioId := range scenariiInstances {
-		scenarioIds = append(scenarioIds, scenarioId)
+	retried, err := scenarii.Select(*retrySelection)
+	if err != nil {
+		println(err.Error())
+		os.Exit(-1)
 	}
-	if !*randomise {
-		sort.Strings(scenarioIds)
+	retriedScenarios := make(map[string]bool)
+	for _, id := range retried {
+		retriedScenarios[id] = true
 	}
 
-	if *scenarioName != "" && scenariiInstances[*scenarioName] == nil {
-		println("Unknown scenario", *scenarioName)
+	if *hostsFilename == "" {
+		println("The hosts parameter is required")
+		os.Exit(-1)
+	}
+
+	hostsInventory, err := hosts.Load(*hostsFilename)
+	if err != nil {
+		println("Could not load", *hostsFilename+":", err.Error())
+		os.Exit(-1)
 	}
 
 	var results Results
 	result := make(chan *qt.Trace)
 	resultsAgg := make(chan bool)
 
+	if *metricsAddress != "" {
+		go func() {
+			println(fmt.Sprint(<-metrics.Serve(*metricsAddress)))
+		}()
+	}
+
 	go func() {
 		for t := range result {
+			metrics.ObserveTrace(t)
 			results = append(results, *t)
 		}
 		close(resultsAgg)
@@ -87,30 +143,20 @@ func main() {
 	wg := &sync.WaitGroup{}
 
 	for _, id := range scenarioIds {
-		if *scenarioName != "" && *scenarioName != id {
-			continue
-		}
-
 		scenarioId := id
-		scenario := scenariiInstances[scenarioId]
+		scenario := scenarii.GetScenario(scenarioId)
 
 		os.MkdirAll(p.Join(*logsDirectory, scenarioId), os.ModePerm)
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := strings.Split(scanner.Text(), "\t")
-			host, path := line[0], line[1]
-			h3port, err := strconv.Atoi(line[2])
-			if err != nil {
-				println(err)
+		for _, h := range hostsInventory {
+			if *hostTags != "" && !h.HasTag(strings.Split(*hostTags, ",")...) || h.Skips(scenarioId) {
 				continue
 			}
-			preferredALPN := line[3]
-
-			if scenario.HTTP3() {
-				split := strings.Split(host, ":")
-				host, _ = split[0], split[1]
-				host = fmt.Sprintf("%s:%d", host, h3port)
+			target := h.Target(scenarioId, scenario.HTTP3(), scenario.IPv6())
+			host := target.Host
+			scenarioTimeout := time.Duration(*timeout) * time.Second
+			if target.Timeout != 0 {
+				scenarioTimeout = target.Timeout
 			}
 
 			<-semaphore
@@ -119,63 +165,116 @@ func main() {
 				fmt.Println("starting", scenario.Name(), "against", host)
 			}
 
+			retries := target.Retries
+			if retries < 0 {
+				retries = 0
+				if retriedScenarios[scenarioId] {
+					retries = *maxRetries
+				}
+			}
+
 			go func() {
 				defer func() { semaphore <- true }()
 				defer wg.Done()
 
-				outputFile, err := ioutil.TempFile("", "quic_tracker")
-				if err != nil {
-					println(err.Error())
-					return
+				run := func(logFile io.Writer) *qt.Trace {
+					if !*subprocess {
+						return scenarii.Run(scenarii.GetScenario(scenarioId), host, scenarii.RunOptions{
+							Address:       target.Address,
+							ServerName:    target.ServerName,
+							Path:          target.Path,
+							ContentHash:   target.ContentHash,
+							ALPN:          target.ALPN,
+							Version:       target.Version,
+							Timeout:       scenarioTimeout,
+							Debug:         *debug,
+							QLogDirectory: *qlogDir,
+							QLogLegacy:    *qlogLegacy,
+							Interface:     *netInterface,
+							LogOutput:     logFile,
+						})
+					}
+
+					crashTrace := scenarii.NewCrashTrace(scenario, host) // Prepare one just in case
+					start := time.Now()
+
+					outputFile, err := ioutil.TempFile("", "quic_tracker")
+					if err != nil {
+						println(err.Error())
+						return crashTrace
+					}
+					outputFile.Close()
+					defer os.Remove(outputFile.Name())
+
+					args := []string{"-host", host, "-path", target.Path, "-alpn", target.ALPN, "-scenario", scenarioId, "-interface", *netInterface, "-output", outputFile.Name(), "-timeout", strconv.Itoa(int(scenarioTimeout / time.Second))}
+					if target.Address != "" {
+						args = append(args, "-address", target.Address)
+					}
+					if target.ServerName != "" {
+						args = append(args, "-sni", target.ServerName)
+					}
+					if target.Version != 0 {
+						args = append(args, "-version", fmt.Sprintf("%08x", target.Version))
+					}
+					if target.ContentHash != "" {
+						args = append(args, "-content-hash", target.ContentHash)
+					}
+					if *scenarioFiles != "" {
+						args = append(args, "-scenario-files", *scenarioFiles)
+					}
+					if *debug {
+						args = append(args, "-debug")
+					}
+					if *qlogDir != "" {
+						args = append(args, "-qlog-dir", *qlogDir)
+					}
+					if *qlogLegacy {
+						args = append(args, "-qlog-legacy")
+					}
+
+					c := exec.Command(*scenarioRunner, args...)
+					c.Stdout = logFile
+					c.Stderr = logFile
+					err = c.Run()
+					if err != nil {
+						println(err.Error())
+					}
+
+					var trace qt.Trace
+					outputFile, err = os.Open(outputFile.Name())
+					if err != nil {
+						println(err)
+					}
+					defer outputFile.Close()
+
+					err = json.NewDecoder(outputFile).Decode(&trace)
+					if err != nil {
+						println(err.Error())
+						crashTrace.StartedAt = start.Unix()
+						crashTrace.Duration = uint64(time.Now().Sub(start).Seconds() * 1000)
+						return crashTrace
+					}
+					return &trace
 				}
-				outputFile.Close()
 
-				logFile, err := os.Create(p.Join(*logsDirectory, scenarioId, host))
-				if err != nil {
-					println(err.Error())
-					return
-				}
-				defer logFile.Close()
-
-				crashTrace := GetCrashTrace(scenario, host) // Prepare one just in case
-				start := time.Now()
-
-				args := []string{"run", scenarioRunnerFilename, "-host", host, "-path", path, "-alpn", preferredALPN, "-scenario", scenarioId, "-interface", *netInterface, "-output", outputFile.Name(), "-timeout", strconv.Itoa(*timeout)}
-				if *debug {
-					args = append(args, "-debug")
-				}
-
-				c := exec.Command("go", args...)
-				c.Stdout = logFile
-				c.Stderr = logFile
-				err = c.Run()
-				if err != nil {
-					println(err.Error())
-				}
-
-				var trace qt.Trace
-				outputFile, err = os.Open(outputFile.Name())
-				if err != nil {
-					println(err)
-				}
-				defer outputFile.Close()
-				defer os.Remove(outputFile.Name())
-
-				err = json.NewDecoder(outputFile).Decode(&trace)
-				if err != nil {
-					println(err.Error())
-					crashTrace.StartedAt = start.Unix()
-					crashTrace.Duration = uint64(time.Now().Sub(start).Seconds() * 1000)
-					result <- crashTrace
-					return
-				}
-				result <- &trace
+				scenarii.RunAttempts(*repeat, retries, func(attempt int) *qt.Trace {
+					logFilename := p.Join(*logsDirectory, scenarioId, host)
+					if attempt > 1 {
+						logFilename += fmt.Sprintf(".%d", attempt)
+					}
+					logFile, err := os.Create(logFilename)
+					if err != nil {
+						println(err.Error())
+						return nil
+					}
+					defer logFile.Close()
+					return run(logFile)
+				}, func(trace *qt.Trace) { result <- trace })
 			}()
 		}
 		if !*parallelScenarios {
 			wg.Wait()
 		}
-		file.Seek(0, 0)
 	}
 
 	wg.Wait()
@@ -183,6 +282,33 @@ func main() {
 	<-resultsAgg
 
 	sort.Sort(results)
+
+	traces := make([]*qt.Trace, len(results))
+	for i := range results {
+		traces[i] = &results[i]
+	}
+
+	if *junitFilename != "" {
+		junitFile, err := os.Create(*junitFilename)
+		if err == nil {
+			err = r.WriteJUnit(junitFile, "quic-tracker", traces, scenarii.ErrorCodeDescription)
+			junitFile.Close()
+		}
+		if err != nil {
+			println(err.Error())
+		}
+	}
+
+	if *storeDirectory != "" {
+		s, err := store.Open(*storeDirectory)
+		if err == nil {
+			_, err = s.Add(traces)
+		}
+		if err != nil {
+			println(err.Error())
+		}
+	}
+
 	out, _ := json.Marshal(results)
 	if *outputFilename != "" {
 		outFile, err := os.Create(*outputFilename)
@@ -198,15 +324,47 @@ func main() {
 	println(string(out))
 }
 
-func GetCrashTrace(scenario scenarii.Scenario, host string) *qt.Trace {
-	trace := qt.NewTrace(scenario.Name(), scenario.Version(), host)
-	trace.ErrorCode = 254
-	return trace
+// printCatalog prints the metadata of the given scenarios.
+func printCatalog(names []string) {
+	for _, name := range names {
+		m := scenarii.GetScenario(name).Metadata()
+		fmt.Printf("%s (version %d) [%s]\n", m.Name, m.Version, strings.Join(m.Tags, ", "))
+		fmt.Printf("    %s\n", m.Description)
+		if len(m.RFCSections) > 0 {
+			fmt.Printf("    Covers %s\n", strings.Join(m.RFCSections, ", "))
+		}
+		var codes []int
+		for code := range m.ErrorCodes {
+			codes = append(codes, int(code))
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Printf("    %3d: %s\n", code, m.ErrorCodes[uint8(code)])
+		}
+	}
+}
+
+// findScenarioRunner returns the path of the scenario_runner binary located next to the current executable, or the
+// one found in the PATH.
+func findScenarioRunner() string {
+	if executable, err := os.Executable(); err == nil {
+		runner := p.Join(p.Dir(executable), "scenario_runner")
+		if _, err := os.Stat(runner); err == nil {
+			return runner
+		}
+	}
+	if runner, err := exec.LookPath("scenario_runner"); err == nil {
+		return runner
+	}
+	return "scenario_runner"
 }
 
 type Results []qt.Trace
 
 func (a Results) Less(i, j int) bool {
+	if a[i].Scenario == a[j].Scenario && a[i].Host == a[j].Host {
+		return a[i].Attempt < a[j].Attempt
+	}
 	if a[i].Scenario == a[j].Scenario {
 		return a[i].Host < a[j].Host
 	}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/QUIC-Tracker/quic-tracker/results"
+	"io/ioutil"
+	"os"
+)
+
+func main() {
+	oldFile := flag.String("old", "", "The results file of the reference run.")
+	newFile := flag.String("new", "", "The results file of the run to compare.")
+	jsonFile := flag.String("json", "", "The file to write the differences to in JSON, - for the standard output.")
+	text := flag.Bool("text", true, "Prints the differences in a human-readable form.")
+	resultValues := flag.Bool("result-values", false, "Reports the changes of the values of the scenario results, not only the results added or removed.")
+	timingThreshold := flag.Float64("timing-threshold", 0.5, "The relative change of the handshake duration above which it is reported.")
+	timingRegressions := flag.Bool("timing-regressions", false, "Considers the handshakes that got slower than the threshold as regressions.")
+	flag.Parse()
+
+	if *oldFile == "" || *newFile == "" {
+		println("Parameters old and new are required")
+		os.Exit(-1)
+	}
+
+	old, err := results.Load(*oldFile)
+	if err != nil {
+		println("Could not load", *oldFile+":", err.Error())
+		os.Exit(-1)
+	}
+	new, err := results.Load(*newFile)
+	if err != nil {
+		println("Could not load", *newFile+":", err.Error())
+		os.Exit(-1)
+	}
+
+	diff := results.Compare(old, new, results.DiffOptions{ResultValues: *resultValues, TimingThreshold: *timingThreshold, TimingRegressions: *timingRegressions})
+
+	if *text && *jsonFile != "-" {
+		diff.WriteText(os.Stdout)
+	}
+	if *jsonFile != "" {
+		out, err := json.MarshalIndent(diff, "", "    ")
+		if err != nil {
+			println(err.Error())
+			os.Exit(-1)
+		}
+		if *jsonFile == "-" {
+			os.Stdout.Write(append(out, '\n'))
+		} else if err := ioutil.WriteFile(*jsonFile, out, 0644); err != nil {
+			println(err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	if diff.Regressions > 0 {
+		os.Exit(1)
+	}
+}
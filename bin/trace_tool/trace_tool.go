@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
+	"github.com/QUIC-Tracker/quic-tracker/qlog/qt2qlog"
+	"github.com/QUIC-Tracker/quic-tracker/results"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func main() {
+	input := flag.String("input", "", "The trace file to load. It can contain a single trace or a list of traces as produced by the test suite.")
+	host := flag.String("host", "", "Only process the traces against this host.")
+	scenarioName := flag.String("scenario", "", "Only process the traces of this scenario.")
+	timeline := flag.Bool("timeline", true, "Prints the timeline of the packets of each trace.")
+	violations := flag.Bool("violations", true, "Prints the protocol violations found in each trace.")
+	qlogFile := flag.String("qlog", "", "The file to write the regenerated qlog to. When several traces are processed, only the last one is kept.")
+	qlogDir := flag.String("qlog-dir", "", "The directory to write the regenerated qlog of each trace to, in JSON-SEQ files named after their original destination connection ID.")
+	qlogLegacy := flag.Bool("qlog-legacy", false, "Emits the regenerated qlog in the legacy draft-01 format.")
+	outputFile := flag.String("output", "", "The file to write the traces with their regenerated qlog to.")
+	keyLogFile := flag.String("keylog", "", "The file to append the TLS secrets of the traces to, in the NSS key log format.")
+	compareFile := flag.String("compare", "", "A qlog file produced by the server for the same connections. It is validated and its packets are cross-checked with each trace.")
+	flag.Parse()
+
+	if *input == "" {
+		println("Parameter input is required")
+		os.Exit(-1)
+	}
+
+	content, err := ioutil.ReadFile(*input)
+	if err != nil {
+		println(err.Error())
+		os.Exit(-1)
+	}
+
+	traces, err := results.Parse(content)
+	if err != nil {
+		println("Could not parse traces:", err.Error())
+		os.Exit(-1)
+	}
+
+	var remote *qlog.QLog
+	if *compareFile != "" {
+		file, err := os.Open(*compareFile)
+		if err == nil {
+			remote, err = qlog.Parse(file)
+			file.Close()
+		}
+		if err != nil {
+			println("Could not parse qlog:", err.Error())
+			os.Exit(-1)
+		}
+		errs := remote.Validate()
+		fmt.Printf("qlog %s (version %s) contains %d trace(s), %d schema violation(s) found\n", *compareFile, remote.Version, len(remote.Traces), len(errs))
+		for _, e := range errs {
+			fmt.Println("  " + e.Error())
+		}
+		fmt.Println()
+	}
+
+	var processed []*qt.Trace
+	for _, trace := range traces {
+		if (*host != "" && trace.Host != *host) || (*scenarioName != "" && trace.Scenario != *scenarioName) {
+			continue
+		}
+
+		packets := qt.NewTraceDecoder().DecodeAll(trace)
+		q := qt2qlog.ConvertTrace(trace, packets)
+		q.Legacy = *qlogLegacy
+		trace.QLog = q
+		processed = append(processed, trace)
+
+		fmt.Printf("Trace of scenario %s (v%d) against %s, error code %d, %d packets\n", trace.Scenario, trace.ScenarioVersion, trace.Host, trace.ErrorCode, len(trace.Stream))
+		for _, c := range trace.Checks {
+			fmt.Printf("  %s %s", c.Status, c.Name)
+			if c.Message != "" {
+				fmt.Printf(": %s", c.Message)
+			}
+			if len(c.Evidence) > 0 {
+				fmt.Printf(" (packets %s)", strings.Trim(fmt.Sprint(c.Evidence), "[]"))
+			}
+			fmt.Println()
+		}
+		if *timeline {
+			printTimeline(packets)
+		}
+		if *violations {
+			vs := qt.CheckViolations(packets)
+			fmt.Printf("%d violation(s) found\n", len(vs))
+			for _, v := range vs {
+				fmt.Println("  " + v.String())
+			}
+		}
+		if remote != nil {
+			compareQLog(q.Traces[0], remote)
+		}
+		fmt.Println()
+
+		if *qlogFile != "" {
+			writeJSON(*qlogFile, q)
+		}
+		if *qlogDir != "" {
+			if err := q.WriteSeqFiles(*qlogDir); err != nil {
+				println(err.Error())
+			}
+		}
+		if *keyLogFile != "" {
+			if err := qt.AppendKeyLog(*keyLogFile, trace.KeyLog()); err != nil {
+				println(err.Error())
+			}
+		}
+	}
+
+	if *outputFile != "" {
+		if len(processed) == 1 {
+			writeJSON(*outputFile, processed[0])
+		} else {
+			writeJSON(*outputFile, processed)
+		}
+	}
+}
+
+// compareQLog cross-checks the packets of a trace with those of the trace of the remote qlog for the same connection.
+func compareQLog(local *qlog.Trace, remote *qlog.QLog) {
+	var matching *qlog.Trace
+	for _, t := range remote.Traces {
+		for _, field := range []string{"ODCID", "group_id"} {
+			if v, ok := t.CommonFields[field]; ok && v == local.CommonFields["ODCID"] {
+				matching = t
+			}
+		}
+	}
+	if matching == nil {
+		if len(remote.Traces) != 1 {
+			fmt.Println("No trace of the qlog matches this connection")
+			return
+		}
+		matching = remote.Traces[0]
+	}
+	fmt.Println("Local statistics: " + local.Statistics().String())
+	fmt.Println("Remote statistics: " + matching.Statistics().String())
+	c := qlog.CompareTraces(local, matching)
+	fmt.Printf("Packets not received by the server: %v\n", c.NotReceivedByRemote)
+	fmt.Printf("Packets not received by the client: %v\n", c.NotReceivedByLocal)
+	if !c.Consistent() {
+		fmt.Printf("Packets received by the server but never sent: %v\n", c.NotSentByLocal)
+		fmt.Printf("Packets received by the client but never sent: %v\n", c.NotSentByRemote)
+	}
+}
+
+func writeJSON(filename string, v interface{}) {
+	out, err := json.Marshal(v)
+	if err == nil {
+		err = ioutil.WriteFile(filename, out, 0644)
+	}
+	if err != nil {
+		println(err.Error())
+	}
+}
+
+func printTimeline(packets []qt.DecodedPacket) {
+	if len(packets) == 0 {
+		return
+	}
+	start := packets[0].Timestamp
+	for _, p := range packets {
+		arrow := "->"
+		if p.Direction == qt.ToClient {
+			arrow = "<-"
+		}
+		marker := " "
+		if p.IsOfInterest {
+			marker = "*"
+		}
+		prefix := fmt.Sprintf("%s %4d %+8dms %s", marker, p.Index, p.Timestamp.Sub(start).Nanoseconds()/1e6, arrow)
+		if p.Error != nil {
+			fmt.Printf("%s undecodable packet of %d bytes: %s\n", prefix, p.Length, p.Error.Error())
+			continue
+		}
+		fmt.Printf("%s %s (%d bytes)%s\n", prefix, describePacket(p.Packet), p.Length, describeFrames(p.Packet))
+	}
+}
+
+func describePacket(p qt.Packet) string {
+	switch packet := p.(type) {
+	case *qt.VersionNegotiationPacket:
+		return fmt.Sprintf("Version Negotiation %v", packet.SupportedVersions)
+	case *qt.RetryPacket:
+		return fmt.Sprintf("Retry token=%x", packet.RetryToken)
+	case *qt.StatelessResetPacket:
+		return fmt.Sprintf("Stateless Reset token=%x", packet.StatelessResetToken)
+	}
+	return fmt.Sprintf("%s #%d dcid=%s", p.Header().PacketType().String(), p.Header().PacketNumber(), p.Header().DestinationConnectionID().String())
+}
+
+func describeFrames(p qt.Packet) string {
+	framer, ok := p.(qt.Framer)
+	if !ok {
+		return ""
+	}
+	var descriptions []string
+	var padding int
+	for _, f := range framer.GetFrames() {
+		var d string
+		switch frame := f.(type) {
+		case *qt.PaddingFrame:
+			padding++
+			continue
+		case *qt.AckFrame:
+			d = fmt.Sprintf("ACK(largest=%d)", frame.LargestAcknowledged)
+		case *qt.AckECNFrame:
+			d = fmt.Sprintf("ACK_ECN(largest=%d)", frame.LargestAcknowledged)
+		case *qt.CryptoFrame:
+			d = fmt.Sprintf("CRYPTO(off=%d, len=%d)", frame.Offset, frame.Length)
+		case *qt.StreamFrame:
+			d = fmt.Sprintf("STREAM(id=%d, off=%d, len=%d, fin=%t)", frame.StreamId, frame.Offset, frame.Length, frame.FinBit)
+		case *qt.ConnectionCloseFrame:
+			d = fmt.Sprintf("CONNECTION_CLOSE(code=0x%x, reason=%q)", frame.ErrorCode, frame.ReasonPhrase)
+		case *qt.ApplicationCloseFrame:
+			d = fmt.Sprintf("APPLICATION_CLOSE(code=0x%x, reason=%q)", frame.ErrorCode, frame.ReasonPhrase)
+		default:
+			d = f.FrameType().String()
+		}
+		descriptions = append(descriptions, d)
+	}
+	if padding > 0 {
+		descriptions = append(descriptions, fmt.Sprintf("PADDING(%d)", padding))
+	}
+	if len(descriptions) == 0 {
+		return ""
+	}
+	return " " + strings.Join(descriptions, " ")
+}
@@ -0,0 +1,299 @@
+package quictracker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mpiraux/pigotls"
+	"net"
+	"time"
+)
+
+// A CaptureFilter selects the QUIC connection to import from a packet capture. Empty fields match any value and a
+// zero port matches any port. When no field is set, the first connection of the capture is selected.
+type CaptureFilter struct {
+	Client *net.UDPAddr
+	Server *net.UDPAddr
+	DCID   ConnectionID // A connection ID present in a long header of the connection
+}
+
+// The secrets of a single direction of an imported connection.
+type captureEndpoint struct {
+	conn      *Connection // The offline connection parsing the packets sent by this endpoint
+	appSecret []byte      // The current 1-RTT secret, used to follow key updates
+	keyPhase  KeyPhaseBit
+}
+
+// ImportCapture decrypts the packets of a QUIC connection found in the given datagrams and returns them as a Trace,
+// so that they can be analysed as the ones of a live connection. The connection starts with the first client
+// Initial packet matching the filter and is followed on its 4-tuple only. The Initial secrets are derived from the
+// connection IDs, the others are read from the key log using the client random of the ClientHello. The packets that
+// cannot be decrypted are skipped and counted in the results of the trace.
+// As picotls does not allow choosing the cipher suite of offline connections, only the connections that negotiated
+// its default one, TLS_AES_128_GCM_SHA256, can be decrypted. An error is returned for the others.
+func ImportCapture(datagrams []CapturedDatagram, keyLog KeyLog, filter CaptureFilter) (*Trace, error) {
+	client, server, odcid, err := selectCapturedConnection(datagrams, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	tls := pigotls.NewConnection("", "", nil)
+	decoder := NewTraceDecoder()
+	endpoints := map[Direction]*captureEndpoint{
+		ToServer: {conn: decoder.ServerView()},
+		ToClient: {conn: decoder.ClientView()},
+	}
+	installInitialSecrets := func(destinationCID ConnectionID) {
+		clientSecret, serverSecret := InitialSecrets(tls, destinationCID)
+		endpoints[ToServer].conn.CryptoStates[EncryptionLevelInitial] = NewProtectedCryptoState(tls, clientSecret, nil)
+		endpoints[ToClient].conn.CryptoStates[EncryptionLevelInitial] = NewProtectedCryptoState(tls, serverSecret, nil)
+	}
+	installInitialSecrets(odcid)
+
+	trace := NewTrace("capture_import", 1, server.String())
+	trace.Ip = server.IP.String()
+	trace.Results["client"] = client.String()
+	trace.Results["server"] = server.String()
+	trace.Results["original_destination_cid"] = odcid.String()
+
+	var undecryptable int
+	var first, last time.Time
+	for _, d := range datagrams {
+		var direction Direction
+		if udpAddrEqual(d.Source, client) && udpAddrEqual(d.Destination, server) {
+			direction = ToServer
+		} else if udpAddrEqual(d.Source, server) && udpAddrEqual(d.Destination, client) {
+			direction = ToClient
+		} else {
+			continue
+		}
+		if first.IsZero() {
+			first = d.Timestamp
+		}
+		last = d.Timestamp
+		ep := endpoints[direction]
+
+		for off := 0; off < len(d.Payload); {
+			ciphertext := d.Payload[off:]
+			cleartext, consumed, err := ep.unprotect(tls, ciphertext)
+			if err != nil {
+				undecryptable++
+				break
+			}
+			off += consumed
+
+			tp := TracePacket{Direction: direction, Timestamp: d.Timestamp.UnixNano() / int64(time.Millisecond), Data: cleartext}
+			packet, err := decoder.Decode(tp)
+			if err != nil {
+				undecryptable++
+				continue
+			}
+			trace.Stream = append(trace.Stream, tp)
+
+			switch p := packet.(type) {
+			case *RetryPacket:
+				installInitialSecrets(p.Header().(*LongHeader).SourceCID)
+			case *InitialPacket:
+				if direction == ToClient {
+					if suite, ok := serverHelloCipherSuite(p); ok && suite != tlsAES128GCMSHA256 {
+						return nil, fmt.Errorf("unsupported cipher suite 0x%04x, only TLS_AES_128_GCM_SHA256 can be decrypted", suite)
+					}
+				}
+				if direction == ToServer && len(trace.ClientRandom) == 0 {
+					if trace.ClientRandom = clientHelloRandom(p); trace.ClientRandom != nil {
+						installKeyLogSecrets(tls, trace, keyLog.Secrets(trace.ClientRandom), endpoints)
+					}
+				}
+			}
+		}
+	}
+
+	trace.StartedAt = first.Unix()
+	trace.Duration = uint64(last.Sub(first).Nanoseconds() / int64(time.Millisecond))
+	trace.Results["undecryptable_packets"] = undecryptable
+	if len(trace.Secrets) == 0 {
+		trace.Results["error"] = "no secrets were found in the key log for this connection"
+	}
+	return trace, nil
+}
+
+// Finds the client, the server and the original destination connection ID of the connection matching the filter.
+func selectCapturedConnection(datagrams []CapturedDatagram, filter CaptureFilter) (client *net.UDPAddr, server *net.UDPAddr, odcid ConnectionID, err error) {
+	var endpoints []*net.UDPAddr
+	if len(filter.DCID) > 0 {
+		for _, d := range datagrams {
+			if h := readCapturedLongHeader(d.Payload); h != nil && (bytes.Equal(h.DestinationCID, filter.DCID) || bytes.Equal(h.SourceCID, filter.DCID)) {
+				endpoints = []*net.UDPAddr{d.Source, d.Destination}
+				break
+			}
+		}
+		if endpoints == nil {
+			return nil, nil, nil, fmt.Errorf("connection ID %s was not found in the capture", filter.DCID.String())
+		}
+	}
+
+	for _, d := range datagrams {
+		h := readCapturedLongHeader(d.Payload)
+		if h == nil || h.PacketType() != Initial {
+			continue
+		}
+		if endpoints != nil && !(udpAddrEqual(d.Source, endpoints[0]) && udpAddrEqual(d.Destination, endpoints[1])) && !(udpAddrEqual(d.Source, endpoints[1]) && udpAddrEqual(d.Destination, endpoints[0])) {
+			continue
+		}
+		if (filter.Client != nil && !udpAddrMatches(d.Source, filter.Client)) || (filter.Server != nil && !udpAddrMatches(d.Destination, filter.Server)) {
+			continue
+		}
+		return d.Source, d.Destination, h.DestinationCID, nil
+	}
+	return nil, nil, nil, errors.New("no QUIC connection matching the filter was found in the capture")
+}
+
+// Reads the unprotected part of a long header, it returns nil for other packets.
+func readCapturedLongHeader(payload []byte) (h *LongHeader) {
+	if len(payload) < 7 || payload[0]&0x80 == 0 || bytes.Equal(payload[1:5], []byte{0, 0, 0, 0}) {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			h = nil
+		}
+	}()
+	return ReadLongHeader(bytes.NewReader(payload), newOfflineConnection())
+}
+
+func udpAddrEqual(a, b *net.UDPAddr) bool {
+	return a.IP.Equal(b.IP) && a.Port == b.Port
+}
+
+func udpAddrMatches(addr, filter *net.UDPAddr) bool {
+	return (filter.IP == nil || filter.IP.IsUnspecified() || addr.IP.Equal(filter.IP)) && (filter.Port == 0 || addr.Port == filter.Port)
+}
+
+// Returns the random of the ClientHello carried by the given Initial packet, if it starts the crypto stream.
+func clientHelloRandom(packet *InitialPacket) []byte {
+	for _, f := range packet.GetFrames() {
+		if frame, ok := f.(*CryptoFrame); ok && frame.Offset == 0 && len(frame.CryptoData) >= 38 && frame.CryptoData[0] == 1 {
+			return append([]byte{}, frame.CryptoData[6:38]...) // Type, length and legacy version precede the random
+		}
+	}
+	return nil
+}
+
+// The cipher suite of the AEAD used by the offline connections of picotls.
+const tlsAES128GCMSHA256 = 0x1301
+
+// Returns the cipher suite selected by the ServerHello carried in the packet, if any.
+func serverHelloCipherSuite(packet *InitialPacket) (uint16, bool) {
+	for _, f := range packet.GetFrames() {
+		if frame, ok := f.(*CryptoFrame); ok && frame.Offset == 0 && len(frame.CryptoData) >= 39 && frame.CryptoData[0] == 2 {
+			offset := 39 + int(frame.CryptoData[38]) // Type, length, legacy version, random and session ID precede it
+			if len(frame.CryptoData) < offset+2 {
+				return 0, false
+			}
+			return uint16(frame.CryptoData[offset])<<8 | uint16(frame.CryptoData[offset+1]), true
+		}
+	}
+	return 0, false
+}
+
+// Installs the read crypto states of both endpoints from the secrets of the key log and records them in the trace.
+func installKeyLogSecrets(tls *pigotls.Connection, trace *Trace, secrets map[string][]byte, endpoints map[Direction]*captureEndpoint) {
+	if secrets == nil {
+		return
+	}
+	trace.Secrets = make(map[pigotls.Epoch]Secrets)
+	install := func(direction Direction, level EncryptionLevel, secret []byte) {
+		if len(secret) > 0 {
+			endpoints[direction].conn.CryptoStates[level] = NewProtectedCryptoState(tls, secret, nil)
+		}
+	}
+
+	if secret := secrets[KeyLogClientEarlyTrafficSecret]; len(secret) > 0 {
+		install(ToServer, EncryptionLevel0RTT, secret)
+		trace.Secrets[pigotls.Epoch0RTT] = Secrets{Epoch: pigotls.Epoch0RTT, Write: secret}
+	}
+	clientHandshake, serverHandshake := secrets[KeyLogClientHandshakeTrafficSecret], secrets[KeyLogServerHandshakeTrafficSecret]
+	if len(clientHandshake) > 0 || len(serverHandshake) > 0 {
+		install(ToServer, EncryptionLevelHandshake, clientHandshake)
+		install(ToClient, EncryptionLevelHandshake, serverHandshake)
+		trace.Secrets[pigotls.EpochHandshake] = Secrets{Epoch: pigotls.EpochHandshake, Read: serverHandshake, Write: clientHandshake}
+	}
+	clientTraffic, serverTraffic := secrets[KeyLogClientTrafficSecret0], secrets[KeyLogServerTrafficSecret0]
+	if len(clientTraffic) > 0 || len(serverTraffic) > 0 {
+		install(ToServer, EncryptionLevel1RTT, clientTraffic)
+		install(ToClient, EncryptionLevel1RTT, serverTraffic)
+		endpoints[ToServer].appSecret, endpoints[ToClient].appSecret = clientTraffic, serverTraffic
+		trace.Secrets[pigotls.Epoch1RTT] = Secrets{Epoch: pigotls.Epoch1RTT, Read: serverTraffic, Write: clientTraffic}
+	}
+}
+
+// Removes the header and payload protection of the packet starting the given buffer, in the same way as the
+// ParsingAgent does. It returns the clear-text packet and the number of bytes it occupies in the datagram. Version
+// Negotiation and Retry packets are returned as is. When the key phase of a short header packet changes, the keys of
+// the next phase are tried and kept if they succeed.
+func (e *captureEndpoint) unprotect(tls *pigotls.Connection, buffer []byte) (cleartext []byte, consumed int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			cleartext, consumed, err = nil, 0, fmt.Errorf("could not parse packet: %v", r)
+		}
+	}()
+
+	if len(buffer) >= 5 && buffer[0]&0x80 == 0x80 && bytes.Equal(buffer[1:5], []byte{0, 0, 0, 0}) {
+		return buffer, len(buffer), nil
+	}
+	ciphertext := append([]byte{}, buffer...)
+
+	header := ReadHeader(bytes.NewReader(ciphertext), e.conn)
+	if header.PacketType() == Retry {
+		return ciphertext, len(ciphertext), nil
+	}
+	cryptoState := e.conn.CryptoStates[header.EncryptionLevel()]
+	if cryptoState == nil || cryptoState.HeaderRead == nil || cryptoState.Read == nil {
+		return nil, 0, fmt.Errorf("no secret is available for %s packets", header.PacketType().String())
+	}
+
+	firstByteMask := byte(0x1F)
+	if ciphertext[0]&0x80 == 0x80 {
+		firstByteMask = 0x0F
+	}
+	sample, pnOffset := GetPacketSample(header, ciphertext)
+	if sample == nil {
+		return nil, 0, errors.New("packet is too short for header protection")
+	}
+	mask := cryptoState.HeaderRead.Encrypt(sample, make([]byte, 5, 5))
+	ciphertext[0] ^= mask[0] & firstByteMask
+	pnLength := int(ciphertext[0]&0x3) + 1
+	for i := 0; i < pnLength; i++ {
+		ciphertext[pnOffset+i] ^= mask[1+i]
+	}
+	header = ReadHeader(bytes.NewReader(ciphertext), e.conn) // Update PN
+
+	hLen := header.HeaderLength()
+	end := len(ciphertext)
+	if lHeader, ok := header.(*LongHeader); ok {
+		end = hLen + int(lHeader.Length.Value) - header.TruncatedPN().Length
+		if end > len(ciphertext) {
+			return nil, 0, fmt.Errorf("payload length %d is past the %d bytes of the datagram", end, len(ciphertext))
+		}
+	}
+
+	aead := cryptoState.Read
+	var nextState *CryptoState
+	var nextSecret []byte
+	if sHeader, ok := header.(*ShortHeader); ok && sHeader.KeyPhase != e.keyPhase && len(e.appSecret) > 0 {
+		nextSecret = NextKeyPhaseSecret(tls, e.appSecret)
+		nextState = NewProtectedCryptoState(tls, nextSecret, nil)
+		nextState.HeaderRead = cryptoState.HeaderRead
+		aead = nextState.Read
+	}
+
+	payload := aead.Decrypt(ciphertext[hLen:end], uint64(header.PacketNumber()), ciphertext[:hLen])
+	if payload == nil {
+		return nil, 0, fmt.Errorf("could not decrypt %s packet %d", header.PacketType().String(), header.PacketNumber())
+	}
+	if nextState != nil {
+		e.conn.CryptoStates[EncryptionLevel1RTT] = nextState
+		e.appSecret, e.keyPhase = nextSecret, !e.keyPhase
+	}
+	return append(ciphertext[:hLen:hLen], payload...), end, nil
+}
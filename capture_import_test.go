@@ -0,0 +1,138 @@
+package quictracker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"testing"
+)
+
+func TestImportCapture_KeyUpdate(t *testing.T) {
+	udpConn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4433})
+	if err != nil {
+		t.Skip("Could not create a UDP socket:", err.Error())
+	}
+	defer udpConn.Close()
+	clientAddr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1).To4(), Port: 51000}
+	serverAddr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2).To4(), Port: 443}
+
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rand.Read(b)
+		return b
+	}
+	clientRandom := random(32)
+	client := NewConnection("localhost", QuicVersion, QuicALPNToken, random(8), random(8), udpConn, nil)
+	capture := StartPcapngCapture(client)
+
+	serverCID := ConnectionID(random(8))
+	server := newOfflineConnection()
+	server.Version, server.SourceCID, server.DestinationCID = client.Version, serverCID, client.SourceCID
+
+	// The secrets of the server are the ones of the client, with read and write swapped
+	tls := client.Tls
+	clientInitial, serverInitial := InitialSecrets(tls, client.DestinationCID)
+	server.CryptoStates[EncryptionLevelInitial] = NewProtectedCryptoState(tls, clientInitial, serverInitial)
+	secrets := map[string][]byte{
+		KeyLogClientHandshakeTrafficSecret: random(32),
+		KeyLogServerHandshakeTrafficSecret: random(32),
+		KeyLogClientTrafficSecret0:         random(32),
+		KeyLogServerTrafficSecret0:         random(32),
+	}
+	for label, secret := range secrets {
+		client.KeyLogHandler([]byte(KeyLogLine(label, clientRandom, secret)))
+	}
+	install := func(level EncryptionLevel, clientSecret, serverSecret []byte) {
+		client.CryptoStates[level] = NewProtectedCryptoState(tls, serverSecret, clientSecret)
+		server.CryptoStates[level] = NewProtectedCryptoState(tls, clientSecret, serverSecret)
+	}
+	install(EncryptionLevelHandshake, secrets[KeyLogClientHandshakeTrafficSecret], secrets[KeyLogServerHandshakeTrafficSecret])
+	install(EncryptionLevel1RTT, secrets[KeyLogClientTrafficSecret0], secrets[KeyLogServerTrafficSecret0])
+
+	send := func(sender *Connection, packet Packet, frame Frame) {
+		packet.(Framer).AddFrame(frame)
+		payload := sender.EncodeAndEncrypt(packet, packet.EncryptionLevel())
+		if sender == client {
+			client.SentDatagramHandler(payload, clientAddr, serverAddr)
+		} else {
+			client.ReceivedDatagramHandler(payload, serverAddr, clientAddr)
+		}
+	}
+	clientHello := append([]byte{1, 0, 0, 38, 3, 3}, clientRandom...)
+	serverHello := append(append([]byte{2, 0, 0, 42, 3, 3}, random(32)...), 0, 0x13, 0x01, 0)
+	streamData := []byte("GET /index.html\r\n")
+
+	send(client, NewInitialPacket(client), &CryptoFrame{CryptoData: clientHello, Length: uint64(len(clientHello))})
+	send(server, NewInitialPacket(server), &CryptoFrame{CryptoData: serverHello, Length: uint64(len(serverHello))})
+	client.DestinationCID = serverCID
+	send(server, NewHandshakePacket(server), &CryptoFrame{CryptoData: random(64), Length: 64})
+	send(client, NewHandshakePacket(client), &CryptoFrame{CryptoData: random(36), Length: 36})
+	send(server, NewProtectedPacket(server), NewStreamFrame(3, 0, random(16), false))
+	send(client, NewProtectedPacket(client), NewStreamFrame(0, 0, streamData, false))
+
+	// The header protection keys are kept across key updates
+	clientHP, serverHP := client.CryptoStates[EncryptionLevel1RTT], server.CryptoStates[EncryptionLevel1RTT]
+	install(EncryptionLevel1RTT, NextKeyPhaseSecret(tls, secrets[KeyLogClientTrafficSecret0]), NextKeyPhaseSecret(tls, secrets[KeyLogServerTrafficSecret0]))
+	client.CryptoStates[EncryptionLevel1RTT].HeaderRead, client.CryptoStates[EncryptionLevel1RTT].HeaderWrite = clientHP.HeaderRead, clientHP.HeaderWrite
+	server.CryptoStates[EncryptionLevel1RTT].HeaderRead, server.CryptoStates[EncryptionLevel1RTT].HeaderWrite = serverHP.HeaderRead, serverHP.HeaderWrite
+	client.KeyPhaseIndex++
+	server.KeyPhaseIndex++
+	send(client, NewProtectedPacket(client), NewStreamFrame(0, uint64(len(streamData)), streamData, true))
+	send(server, NewProtectedPacket(server), NewStreamFrame(3, 16, random(16), true))
+
+	datagrams, keyLog, err := ReadCapture(bytes.NewReader(capture.Stop()))
+	if err != nil {
+		t.Fatal("Could not read the capture:", err.Error())
+	}
+	trace, err := ImportCapture(datagrams, ParseKeyLog(keyLog), CaptureFilter{})
+	if err != nil {
+		t.Fatal("Could not import the capture:", err.Error())
+	}
+	if trace.Results["undecryptable_packets"] != 0 {
+		t.Error("Expected all packets to be decrypted, got", trace.Results["undecryptable_packets"], "undecryptable packets")
+	}
+	if !bytes.Equal(trace.ClientRandom, clientRandom) {
+		t.Error("Expected client random", clientRandom, "got", trace.ClientRandom)
+	}
+
+	expected := []struct {
+		direction  Direction
+		packetType PacketType
+		keyPhase   KeyPhaseBit
+	}{
+		{ToServer, Initial, KeyPhaseZero},
+		{ToClient, Initial, KeyPhaseZero},
+		{ToClient, Handshake, KeyPhaseZero},
+		{ToServer, Handshake, KeyPhaseZero},
+		{ToClient, ShortHeaderPacket, KeyPhaseZero},
+		{ToServer, ShortHeaderPacket, KeyPhaseZero},
+		{ToServer, ShortHeaderPacket, KeyPhaseOne},
+		{ToClient, ShortHeaderPacket, KeyPhaseOne},
+	}
+	packets := NewTraceDecoder().DecodeAll(trace)
+	if len(packets) != len(expected) {
+		t.Fatal("Expected", len(expected), "packets, got", len(packets))
+	}
+	var received []byte
+	for i, p := range packets {
+		if p.Error != nil {
+			t.Fatalf("Could not decode packet %d: %s", i, p.Error.Error())
+		}
+		if p.Direction != expected[i].direction || p.Packet.Header().PacketType() != expected[i].packetType {
+			t.Errorf("Expected packet %d to be a %s packet %s, got a %s packet %s", i, expected[i].packetType.String(), expected[i].direction, p.Packet.Header().PacketType().String(), p.Direction)
+		}
+		if h, ok := p.Packet.Header().(*ShortHeader); ok {
+			if h.KeyPhase != expected[i].keyPhase {
+				t.Errorf("Expected packet %d to have key phase %v, got %v", i, expected[i].keyPhase, h.KeyPhase)
+			}
+			for _, f := range p.Packet.(Framer).GetFrames() {
+				if s, ok := f.(*StreamFrame); ok && p.Direction == ToServer {
+					received = append(received, s.StreamData...)
+				}
+			}
+		}
+	}
+	if !bytes.Equal(received, append(streamData, streamData...)) {
+		t.Errorf("Expected stream data %q, got %q", append(streamData, streamData...), received)
+	}
+}
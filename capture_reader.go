@@ -0,0 +1,268 @@
+package quictracker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// A CapturedDatagram is a UDP datagram read from or written to a packet capture.
+type CapturedDatagram struct {
+	Timestamp   time.Time
+	Source      *net.UDPAddr
+	Destination *net.UDPAddr
+	Payload     []byte
+}
+
+const (
+	pcapMagicMicroseconds       = 0xa1b2c3d4
+	pcapMagicNanoseconds        = 0xa1b23c4d
+	pcapngSimplePacketBlockType = 0x00000003
+
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLoop     = 108
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+)
+
+// ReadCapture reads the UDP datagrams contained in a pcap or pcapng file. The TLS key log embedded in the Decryption
+// Secrets Blocks of a pcapng file is also returned.
+func ReadCapture(r io.Reader) (datagrams []CapturedDatagram, keyLog []byte, err error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(content) < 24 {
+		return nil, nil, errors.New("capture file is too short")
+	}
+
+	if binary.LittleEndian.Uint32(content) == pcapngSectionHeaderBlockType {
+		return readPcapng(content)
+	}
+	datagrams, err = readPcap(content)
+	return datagrams, nil, err
+}
+
+func readPcap(content []byte) ([]CapturedDatagram, error) {
+	var order binary.ByteOrder
+	var nanoseconds bool
+	switch {
+	case binary.LittleEndian.Uint32(content) == pcapMagicMicroseconds:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(content) == pcapMagicMicroseconds:
+		order = binary.BigEndian
+	case binary.LittleEndian.Uint32(content) == pcapMagicNanoseconds:
+		order, nanoseconds = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(content) == pcapMagicNanoseconds:
+		order, nanoseconds = binary.BigEndian, true
+	default:
+		return nil, errors.New("unknown capture file format")
+	}
+	linkType := order.Uint32(content[20:])
+
+	var datagrams []CapturedDatagram
+	content = content[24:]
+	for len(content) >= 16 {
+		seconds, fraction := int64(order.Uint32(content)), int64(order.Uint32(content[4:]))
+		capturedLength := int(order.Uint32(content[8:]))
+		if 16+capturedLength > len(content) {
+			return datagrams, errors.New("truncated packet record")
+		}
+		if !nanoseconds {
+			fraction *= int64(time.Microsecond)
+		}
+		if d, ok := decodeLinkLayer(linkType, content[16:16+capturedLength]); ok {
+			d.Timestamp = time.Unix(seconds, fraction)
+			datagrams = append(datagrams, d)
+		}
+		content = content[16+capturedLength:]
+	}
+	return datagrams, nil
+}
+
+func readPcapng(content []byte) ([]CapturedDatagram, []byte, error) {
+	type pcapngInterface struct {
+		linkType   uint32
+		resolution time.Duration
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	var interfaces []pcapngInterface
+	var datagrams []CapturedDatagram
+	var keyLog []byte
+
+	for len(content) >= 12 {
+		blockType := order.Uint32(content)
+		if blockType == pcapngSectionHeaderBlockType {
+			if binary.LittleEndian.Uint32(content[8:]) == pcapngByteOrderMagic {
+				order = binary.LittleEndian
+			} else {
+				order = binary.BigEndian
+			}
+			interfaces = nil
+		}
+		length := int(order.Uint32(content[4:]))
+		if length < 12 || length > len(content) {
+			return datagrams, keyLog, fmt.Errorf("invalid block length %d", length)
+		}
+		body := content[8 : length-4]
+
+		switch blockType {
+		case pcapngInterfaceDescriptionType:
+			if len(body) < 8 {
+				break
+			}
+			itf := pcapngInterface{linkType: uint32(order.Uint16(body)), resolution: time.Microsecond}
+			options := body[8:]
+			for len(options) >= 4 {
+				code, optionLength := order.Uint16(options), int(order.Uint16(options[2:]))
+				if code == pcapngOptionEnd || 4+optionLength > len(options) {
+					break
+				}
+				if code == pcapngOptionTimestampResolution && optionLength >= 1 {
+					itf.resolution = pcapngResolution(options[4])
+				}
+				options = options[4+(optionLength+3)/4*4:]
+			}
+			interfaces = append(interfaces, itf)
+		case pcapngEnhancedPacketBlockType:
+			if len(body) < 20 {
+				break
+			}
+			interfaceID := int(order.Uint32(body))
+			capturedLength := int(order.Uint32(body[12:]))
+			if interfaceID >= len(interfaces) || 20+capturedLength > len(body) {
+				break
+			}
+			itf := interfaces[interfaceID]
+			if d, ok := decodeLinkLayer(itf.linkType, body[20:20+capturedLength]); ok {
+				timestamp := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+				d.Timestamp = time.Unix(0, 0).Add(time.Duration(timestamp) * itf.resolution)
+				datagrams = append(datagrams, d)
+			}
+		case pcapngSimplePacketBlockType:
+			if len(interfaces) == 0 || len(body) < 4 {
+				break
+			}
+			if d, ok := decodeLinkLayer(interfaces[0].linkType, body[4:]); ok {
+				datagrams = append(datagrams, d)
+			}
+		case pcapngDecryptionSecretsBlockType:
+			if len(body) < 8 || order.Uint32(body) != pcapngTLSKeyLogSecretsType {
+				break
+			}
+			secretsLength := int(order.Uint32(body[4:]))
+			if 8+secretsLength <= len(body) {
+				keyLog = append(keyLog, body[8:8+secretsLength]...)
+			}
+		}
+		content = content[length:]
+	}
+	return datagrams, keyLog, nil
+}
+
+// Returns the duration of a timestamp unit, as encoded in the if_tsresol option.
+func pcapngResolution(value byte) time.Duration {
+	var units float64 = 1
+	for i := 0; i < int(value&0x7f); i++ {
+		if value&0x80 == 0x80 {
+			units /= 2
+		} else {
+			units /= 10
+		}
+	}
+	if d := time.Duration(units * float64(time.Second)); d > 0 {
+		return d
+	}
+	return time.Nanosecond
+}
+
+func decodeLinkLayer(linkType uint32, frame []byte) (CapturedDatagram, bool) {
+	switch linkType {
+	case linkTypeEthernet:
+		if len(frame) < 14 {
+			return CapturedDatagram{}, false
+		}
+		etherType, offset := binary.BigEndian.Uint16(frame[12:]), 14
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(frame) >= offset+4 {
+			etherType, offset = binary.BigEndian.Uint16(frame[offset+2:]), offset+4
+		}
+		if etherType != 0x0800 && etherType != 0x86dd {
+			return CapturedDatagram{}, false
+		}
+		return decodeIP(frame[offset:])
+	case linkTypeLinuxSLL:
+		if len(frame) < 16 {
+			return CapturedDatagram{}, false
+		}
+		return decodeIP(frame[16:])
+	case linkTypeNull, linkTypeLoop:
+		if len(frame) < 4 {
+			return CapturedDatagram{}, false
+		}
+		return decodeIP(frame[4:])
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+		return decodeIP(frame)
+	}
+	return CapturedDatagram{}, false
+}
+
+func decodeIP(packet []byte) (CapturedDatagram, bool) {
+	var d CapturedDatagram
+	var segment []byte
+	if len(packet) < 1 {
+		return d, false
+	}
+	switch packet[0] >> 4 {
+	case 4:
+		headerLength := int(packet[0]&0x0f) * 4
+		if len(packet) < 20 || headerLength < 20 || len(packet) < headerLength || packet[9] != 17 {
+			return d, false
+		}
+		if binary.BigEndian.Uint16(packet[6:])&0x3fff != 0 {
+			return d, false // Fragments are not reassembled
+		}
+		d.Source = &net.UDPAddr{IP: net.IP(append([]byte{}, packet[12:16]...))}
+		d.Destination = &net.UDPAddr{IP: net.IP(append([]byte{}, packet[16:20]...))}
+		segment = packet[headerLength:]
+		if totalLength := int(binary.BigEndian.Uint16(packet[2:])); totalLength >= headerLength && totalLength <= len(packet) {
+			segment = packet[headerLength:totalLength]
+		}
+	case 6:
+		if len(packet) < 40 {
+			return d, false
+		}
+		d.Source = &net.UDPAddr{IP: net.IP(append([]byte{}, packet[8:24]...))}
+		d.Destination = &net.UDPAddr{IP: net.IP(append([]byte{}, packet[24:40]...))}
+		nextHeader, offset := packet[6], 40
+		for nextHeader == 0 || nextHeader == 43 || nextHeader == 60 { // Hop-by-hop, routing and destination options
+			if len(packet) < offset+8 {
+				return d, false
+			}
+			nextHeader, offset = packet[offset], offset+8+int(packet[offset+1])*8
+		}
+		if nextHeader != 17 || len(packet) < offset {
+			return d, false
+		}
+		segment = packet[offset:]
+	default:
+		return d, false
+	}
+
+	if len(segment) < 8 {
+		return d, false
+	}
+	d.Source.Port = int(binary.BigEndian.Uint16(segment))
+	d.Destination.Port = int(binary.BigEndian.Uint16(segment[2:]))
+	if length := int(binary.BigEndian.Uint16(segment[4:])); length >= 8 && length <= len(segment) {
+		segment = segment[:length]
+	}
+	d.Payload = append([]byte{}, segment[8:]...)
+	return d, true
+}
@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"github.com/QUIC-Tracker/quic-tracker/qlog"
 	"github.com/mpiraux/pigotls"
+	"io"
 	"log"
 	"net"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -26,6 +28,7 @@ type Connection struct {
 
 	Tls           *pigotls.Connection
 	TLSTPHandler  *TLSTransportParameterHandler
+	KeyLogFile    string // The file to which TLS secrets are appended in the NSS key log format. Defaults to SSLKEYLOGFILE
 
 	KeyPhaseIndex  uint
 	SpinBit   	   SpinBit
@@ -34,8 +37,12 @@ type Connection struct {
 	CryptoStateLock sync.Locker
 	CryptoStates   map[EncryptionLevel]*CryptoState
 
-	ReceivedPacketHandler func([]byte, unsafe.Pointer)
-	SentPacketHandler     func([]byte, unsafe.Pointer)
+	ReceivedPacketHandler   func([]byte, unsafe.Pointer)
+	SentPacketHandler       func([]byte, unsafe.Pointer)
+	ReceivedDatagramHandler func([]byte, net.Addr, net.Addr) // Called with each UDP payload read from the socket, its source and destination
+	SentDatagramHandler     func([]byte, net.Addr, net.Addr) // Called with each UDP payload written to the socket, its source and destination
+	KeyLogHandler           func([]byte)                     // Called with each TLS secret formatted as a key log line
+	StreamStateHandler      StreamStateHandler               // Called when a side of a stream changes state
 
 	CryptoStreams       CryptoStreams  // TODO: It should be a parent class without closing states
 	Streams             Streams
@@ -77,9 +84,36 @@ type Connection struct {
 
 	AckQueue             map[PNSpace][]PacketNumber // Stores the packet numbers to be acked TODO: This should be a channel actually
 	Logger               *log.Logger
+	LogOutput            io.Writer // The writer of the logs of the connection and its agents, os.Stderr by default
 	QLog 				 qlog.QLog
 	QLogTrace			 *qlog.Trace
 	QLogEvents			 chan *qlog.Event
+	QLogDirectory        string // The directory in which the qlog events are streamed, if any
+	qlogWriter           *qlog.SeqWriter
+	qlogWriterLock       sync.Mutex
+
+	Crashed              chan bool // Closed when a goroutine working on the connection panicked
+	crashReason          string
+	crashOnce            sync.Once
+}
+// Crash records that a goroutine working on the connection panicked for the given reason and closes Crashed. Only the
+// first crash is recorded.
+func (c *Connection) Crash(reason string) {
+	c.crashOnce.Do(func() {
+		c.crashReason = reason
+		if c.Crashed != nil {
+			close(c.Crashed)
+		}
+	})
+}
+// CrashReason returns the reason of the crash of the connection, once Crashed is closed.
+func (c *Connection) CrashReason() string {
+	return c.crashReason
+}
+// SetLogOutput redirects the logs of the connection and of the agents attached to it afterwards.
+func (c *Connection) SetLogOutput(w io.Writer) {
+	c.LogOutput = w
+	c.Logger.SetOutput(w)
 }
 func (c *Connection) ConnectedIp() net.Addr {
 	return c.UdpConnection.RemoteAddr()
@@ -151,6 +185,9 @@ func (c *Connection) DoSendPacket(packet Packet, level EncryptionLevel) {
 
 		packetBytes := c.EncodeAndEncrypt(packet, level)
 		c.UdpConnection.Write(packetBytes)
+		if c.SentDatagramHandler != nil {
+			c.SentDatagramHandler(packetBytes, c.UdpConnection.LocalAddr(), c.UdpConnection.RemoteAddr())
+		}
 		packet.SetSendContext(PacketContext{Timestamp: time.Now(), RemoteAddr: c.UdpConnection.RemoteAddr(), DatagramSize: uint16(len(packetBytes)), PacketSize: uint16(len(packetBytes))})
 
 		c.PacketWasSent(packet)
@@ -165,6 +202,7 @@ func (c *Connection) GetInitialPacket() *InitialPacket {
 		return nil
 	}
 	c.Tls.SetQUICTransportParameters(extensionData)
+	c.QLogEvents <- c.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.ParametersSet, c.TLSTPHandler.QuicTransportParameters.QLog("local"))
 
 	tlsOutput, notComplete, err := c.Tls.HandleMessage(nil, pigotls.EpochInitial)
 	if err != nil || !notComplete {
@@ -179,6 +217,8 @@ func (c *Connection) GetInitialPacket() *InitialPacket {
 		c.CryptoStateLock.Lock()
 		c.CryptoStates[EncryptionLevel0RTT] = NewProtectedCryptoState(c.Tls, nil, c.Tls.ZeroRTTSecret())
 		c.CryptoStateLock.Unlock()
+		c.LogSecret(KeyLogClientEarlyTrafficSecret, c.Tls.ZeroRTTSecret())
+		c.QLogKeyUpdated(qlog.KeyTypeClient0RTT, c.Tls.ZeroRTTSecret(), "tls")
 		c.EncryptionLevels.Submit(DirectionalEncryptionLevel{EncryptionLevel: EncryptionLevel0RTT, Read: false, Available: true})
 	}
 
@@ -207,10 +247,8 @@ func (c *Connection) ProcessVersionNegotation(vn *VersionNegotiationPacket) erro
 		c.Logger.Printf("Versions received: %v\n", vn.SupportedVersions)
 		return errors.New("no appropriate version found")
 	}
-	QuicVersion = version
-	QuicALPNToken = fmt.Sprintf("%s-%02d", strings.Split(c.ALPN, "-")[0], version & 0xff)
 	_, err := rand.Read(c.DestinationCID)
-	c.TransitionTo(QuicVersion, QuicALPNToken)
+	c.TransitionTo(version, fmt.Sprintf("%s-%02d", strings.Split(c.ALPN, "-")[0], version & 0xff))
 	return err
 }
 func (c *Connection) GetAckFrame(space PNSpace) *AckFrame { // Returns an ack frame based on the packet numbers received
@@ -271,9 +309,36 @@ func (c *Connection) TransitionTo(version uint32, ALPN string) {
 	c.CryptoStateLock.Lock()
 	c.CryptoStates = make(map[EncryptionLevel]*CryptoState)
 	c.CryptoStreams = make(map[PNSpace]*Stream)
-	c.CryptoStates[EncryptionLevelInitial] = NewInitialPacketProtection(c)
+	clientSecret, serverSecret := InitialSecrets(c.Tls, c.DestinationCID)
+	c.CryptoStates[EncryptionLevelInitial] = NewProtectedCryptoState(c.Tls, serverSecret, clientSecret)
+	c.CryptoStateLock.Unlock()
+	c.QLogKeyUpdated(qlog.KeyTypeClientInitial, clientSecret, "tls")
+	c.QLogKeyUpdated(qlog.KeyTypeServerInitial, serverSecret, "tls")
+	c.Streams = Streams{streams: make(map[uint64]*Stream), lock: &sync.Mutex{}, input: &c.StreamInput, stateHandler: &c.StreamStateHandler}
+}
+// QLogKeyUpdated records in the qlog of the connection that a new secret of the given type is in use.
+func (c *Connection) QLogKeyUpdated(keyType string, secret []byte, trigger string) {
+	e := &qlog.KeyUpdated{KeyType: keyType, New: hex.EncodeToString(secret), Trigger: trigger}
+	if keyType == qlog.KeyTypeClient1RTT || keyType == qlog.KeyTypeServer1RTT {
+		e.Generation = uint64(c.KeyPhaseIndex)
+	}
+	c.QLogEvents <- c.QLogTrace.NewEvent(qlog.Categories.Security.Category, qlog.Categories.Security.KeyUpdated, e)
+}
+// UpdateKeys initiates a key update, i.e. installs the next 1-RTT secrets and flips the key phase of the packets sent
+// afterwards. The header protection keys are kept.
+func (c *Connection) UpdateKeys() {
+	readSecret := NextKeyPhaseSecret(c.Tls, c.Tls.ProtectedReadSecret())
+	writeSecret := NextKeyPhaseSecret(c.Tls, c.Tls.ProtectedWriteSecret())
+
+	c.CryptoStateLock.Lock()
+	oldState := c.CryptoStates[EncryptionLevel1RTT]
+	c.CryptoStates[EncryptionLevel1RTT] = NewProtectedCryptoState(c.Tls, readSecret, writeSecret)
+	c.CryptoStates[EncryptionLevel1RTT].HeaderRead = oldState.HeaderRead
+	c.CryptoStates[EncryptionLevel1RTT].HeaderWrite = oldState.HeaderWrite
+	c.KeyPhaseIndex++
 	c.CryptoStateLock.Unlock()
-	c.Streams = Streams{streams: make(map[uint64]*Stream), lock: &sync.Mutex{}, input: &c.StreamInput}
+	c.QLogKeyUpdated(qlog.KeyTypeClient1RTT, writeSecret, "local_update")
+	c.QLogKeyUpdated(qlog.KeyTypeServer1RTT, readSecret, "local_update")
 }
 func (c *Connection) CloseConnection(quicLayer bool, errCode uint64, reasonPhrase string) {
 	if quicLayer {
@@ -288,6 +353,38 @@ func (c *Connection) SendHTTP09GETRequest(path string, streamID uint64) {
 func (c *Connection) Close() {
 	c.Tls.Close()
 	c.UdpConnection.Close()
+	c.qlogWriterLock.Lock()
+	if c.qlogWriter != nil {
+		c.qlogWriter.Close()
+	}
+	c.qlogWriterLock.Unlock()
+}
+// StreamQLog writes the qlog events of the connection to a JSON-SEQ file named after its original destination
+// connection ID in the given directory, as they are produced. The events already recorded are written first.
+func (c *Connection) StreamQLog(directory string) error {
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(filepath.Join(directory, hex.EncodeToString(c.OriginalDestinationCID)+".sqlog"))
+	if err != nil {
+		return err
+	}
+	writer, err := qlog.NewSeqWriter(file, &c.QLog, c.QLogTrace)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	c.qlogWriterLock.Lock()
+	defer c.qlogWriterLock.Unlock()
+	for _, e := range c.QLogTrace.Events {
+		if err := writer.WriteEvent(e); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	c.QLogDirectory = directory
+	c.qlogWriter = writer
+	return nil
 }
 func EstablishUDPConnection(addr *net.UDPAddr) (*net.UDPConn, error) {
 	udpConn, err := net.DialUDP(addr.Network(), nil, addr)
@@ -322,8 +419,7 @@ func NewDefaultConnection(address string, serverName string, resumptionTicket []
 	if negotiateHTTP3 {
 		c = NewConnection(serverName, QuicVersion, QuicH3ALPNToken, scid, dcid, udpConn, resumptionTicket)
 	} else {
-		QuicALPNToken = fmt.Sprintf("%s-%02d", preferredALPN, QuicVersion & 0xff)
-		c = NewConnection(serverName, QuicVersion, QuicALPNToken, scid, dcid, udpConn, resumptionTicket)
+		c = NewConnection(serverName, QuicVersion, fmt.Sprintf("%s-%02d", preferredALPN, QuicVersion & 0xff), scid, dcid, udpConn, resumptionTicket)
 	}
 
 	var headerOverhead = 8
@@ -371,6 +467,7 @@ func NewConnection(serverName string, version uint32, ALPN string, SCID []byte,
 	c.OriginalDestinationCID = DCID
 
 	c.ResumptionTicket = resumptionTicket
+	c.KeyLogFile = os.Getenv("SSLKEYLOGFILE")
 
 	c.IncomingPackets = NewBroadcaster(1000)
 	c.OutgoingPackets = NewBroadcaster(1000)
@@ -380,6 +477,7 @@ func NewConnection(serverName string, version uint32, ALPN string, SCID []byte,
 	c.FrameQueue = NewBroadcaster(1000)
 	c.TransportParameters = NewBroadcaster(10)
 	c.ConnectionClosed = make(chan bool, 1)
+	c.Crashed = make(chan bool)
 	c.ConnectionRestart = make(chan bool, 1)
 	c.ConnectionRestarted = make(chan bool, 1)
 	c.PreparePacket = NewBroadcaster(1000)
@@ -387,7 +485,6 @@ func NewConnection(serverName string, version uint32, ALPN string, SCID []byte,
 	c.StreamInput = NewBroadcaster(1000)
 	c.PacketAcknowledged = NewBroadcaster(1000)
 
-	c.QLog.Version = "draft-01"
 	c.QLog.Description = "QUIC-Tracker"
 	if len(GitCommit()) > 0 {
 		c.QLog.Description += " commit " + GitCommit()
@@ -399,22 +496,25 @@ func NewConnection(serverName string, version uint32, ALPN string, SCID []byte,
 	c.QLogTrace.VantagePoint.Type = "client"
 	c.QLogTrace.Description = fmt.Sprintf("Connection to %s (%s), using version %08x and alpn %s", serverName, udpConn.RemoteAddr().String(), version, ALPN)
 	c.QLogTrace.ReferenceTime = time.Now()
-	c.QLogTrace.Configuration.TimeUnits = qlog.TimeUnitsString
 
 	c.QLogTrace.CommonFields = make(map[string]interface{})
 	c.QLogTrace.CommonFields["ODCID"] = hex.EncodeToString(c.OriginalDestinationCID)
 	c.QLogTrace.CommonFields["group_id"] = c.QLogTrace.CommonFields["ODCID"]
-	c.QLogTrace.CommonFields["reference_time"] = c.QLogTrace.ReferenceTime.UnixNano() / int64(qlog.TimeUnits)
-	c.QLogTrace.EventFields = qlog.DefaultEventFields()
 	c.QLogEvents = make(chan *qlog.Event, 1000)
 
 	go func() {
 		for e := range c.QLogEvents {
+			c.qlogWriterLock.Lock()
 			c.QLogTrace.Add(e)
+			if c.qlogWriter != nil {
+				c.qlogWriter.WriteEvent(e)
+			}
+			c.qlogWriterLock.Unlock()
 		}
 	}()
 
-	c.Logger = log.New(os.Stderr, fmt.Sprintf("[CID %s] ", hex.EncodeToString(c.OriginalDestinationCID)), log.Lshortfile)
+	c.LogOutput = os.Stderr
+	c.Logger = log.New(c.LogOutput, fmt.Sprintf("[CID %s] ", hex.EncodeToString(c.OriginalDestinationCID)), log.Lshortfile)
 
 	c.TransitionTo(version, ALPN)
 
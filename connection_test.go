@@ -0,0 +1,33 @@
+package quictracker
+
+import (
+	"bytes"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConnection_StreamQLog(t *testing.T) {
+	directory, err := ioutil.TempDir("", "sqlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	c := &Connection{OriginalDestinationCID: ConnectionID{1, 2}, QLogTrace: &qlog.Trace{CommonFields: map[string]interface{}{}}}
+	c.QLogTrace.Add(c.QLogTrace.NewEvent(qlog.Categories.Security.Category, qlog.Categories.Security.KeyUpdated, &qlog.KeyUpdated{KeyType: qlog.KeyTypeClientInitial, Trigger: "tls"}))
+	if err := c.StreamQLog(directory); err != nil {
+		t.Fatal(err)
+	}
+	c.qlogWriter.Close()
+
+	content, err := ioutil.ReadFile(filepath.Join(directory, "0102.sqlog"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(content, []byte("key_updated")) {
+		t.Errorf("the events recorded before streaming were not written: %s", content)
+	}
+}
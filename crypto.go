@@ -119,12 +119,24 @@ func (s *CryptoState) InitWrite(tls *pigotls.Connection, writeSecret []byte) {
 }
 
 func NewInitialPacketProtection(conn *Connection) *CryptoState {
-	initialSecret := conn.Tls.HkdfExtract(quicVersionSalt, conn.DestinationCID)
-	readSecret := conn.Tls.HkdfExpandLabel(initialSecret, serverInitialLabel, nil, conn.Tls.HashDigestSize(), pigotls.BaseLabel)
-	writeSecret := conn.Tls.HkdfExpandLabel(initialSecret, clientInitialLabel, nil, conn.Tls.HashDigestSize(), pigotls.BaseLabel)
+	writeSecret, readSecret := InitialSecrets(conn.Tls, conn.DestinationCID)
 	return NewProtectedCryptoState(conn.Tls, readSecret, writeSecret)
 }
 
+// InitialSecrets derives the client and server Initial secrets from the Destination Connection ID of the first
+// Initial packet.
+func InitialSecrets(tls *pigotls.Connection, destinationCID ConnectionID) (clientSecret []byte, serverSecret []byte) {
+	initialSecret := tls.HkdfExtract(quicVersionSalt, destinationCID)
+	clientSecret = tls.HkdfExpandLabel(initialSecret, clientInitialLabel, nil, tls.HashDigestSize(), pigotls.BaseLabel)
+	serverSecret = tls.HkdfExpandLabel(initialSecret, serverInitialLabel, nil, tls.HashDigestSize(), pigotls.BaseLabel)
+	return
+}
+
+// NextKeyPhaseSecret derives the 1-RTT secret used after a key update from the current one.
+func NextKeyPhaseSecret(tls *pigotls.Connection, secret []byte) []byte {
+	return tls.HkdfExpandLabel(secret, "ku", nil, tls.HashDigestSize(), pigotls.QuicBaseLabel)
+}
+
 func NewProtectedCryptoState(tls *pigotls.Connection, readSecret []byte, writeSecret []byte) *CryptoState {
 	s := new(CryptoState)
 	if len(readSecret) > 0 {
@@ -0,0 +1,207 @@
+// Package download fetches files concurrently over the request streams of a connection, using HTTP/0.9 or HTTP/3,
+// and measures each download.
+//
+//	results := download.Fetch(conn, connAgents.AddHTTPAgent(), urls, "downloads", time.After(time.Minute))
+//	download.WriteTable(os.Stdout, results)
+package download
+
+import (
+	"errors"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/agents"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	ErrConnectionClosed = errors.New("the connection was closed before the response was complete")
+	ErrTimeout          = errors.New("the response was not complete in time")
+)
+
+// A Result reports the download of a file.
+type Result struct {
+	URL             string        `json:"url"`
+	File            string        `json:"file,omitempty"` // The file to which the body was saved, if any
+	Connection      int           `json:"connection"`     // The index of the connection used when several are
+	StreamID        uint64        `json:"stream_id"`
+	Size            int           `json:"size"`
+	TimeToFirstByte time.Duration `json:"time_to_first_byte"` // In nanoseconds, from the sending of the request
+	Duration        time.Duration `json:"duration"`           // In nanoseconds, from the sending of the request
+	Error           string        `json:"error,omitempty"`
+}
+
+// Goodput returns the rate at which the body was received in bits per second.
+func (r Result) Goodput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Size*8) / r.Duration.Seconds()
+}
+
+// Fetch sends a GET request for each of the URLs on the connection, then waits for the responses until the connection
+// is closed or the timeout fires. When a directory is given, the bodies are saved in files named after the last
+// element of the paths of the URLs. The handshake of the connection must be complete, or have started for requests
+// sent in 0-RTT packets.
+func Fetch(conn *qt.Connection, httpAgent agents.HTTPAgent, urls []*url.URL, directory string, timeout <-chan time.Time) []Result {
+	firstBytes := recordFirstBytes(conn)
+	defer firstBytes.stop()
+
+	type completion struct {
+		index    int
+		response agents.HTTPResponse
+		at       time.Time
+	}
+	completions := make(chan completion, len(urls))
+	done := make(chan struct{})
+	defer close(done)
+
+	results := make([]Result, len(urls))
+	complete := make([]bool, len(urls))
+	start := time.Now()
+	for i, u := range urls {
+		results[i].URL = u.String()
+		responseChan := httpAgent.SendRequest(u.RequestURI(), "GET", u.Host, nil)
+		go func(i int) {
+			select {
+			case r := <-responseChan:
+				completions <- completion{i, r, time.Now()}
+			case <-done:
+			}
+		}(i)
+	}
+
+	for pending := len(urls); pending > 0; {
+		var c completion
+		select {
+		case i := <-firstBytes.packets:
+			firstBytes.record(i, time.Now())
+			continue
+		case c = <-completions:
+			pending--
+		case <-conn.ConnectionClosed:
+			return failPending(results, complete, ErrConnectionClosed)
+		case <-timeout:
+			return failPending(results, complete, ErrTimeout)
+		}
+		complete[c.index] = true
+		r := &results[c.index]
+		r.StreamID = c.response.StreamID()
+		r.Size = len(c.response.Body())
+		r.Duration = c.at.Sub(start)
+		if at, ok := firstBytes.get(r.StreamID); ok {
+			r.TimeToFirstByte = at.Sub(start)
+		}
+		if directory != "" {
+			r.File = filepath.Join(directory, FileName(urls[c.index]))
+			if err := ioutil.WriteFile(r.File, c.response.Body(), 0644); err != nil {
+				r.Error = err.Error()
+			}
+		}
+	}
+	return results
+}
+
+// failPending marks the results of the responses that were not received with the error.
+func failPending(results []Result, complete []bool, err error) []Result {
+	for i := range results {
+		if !complete[i] {
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+// FileName returns the name of the file in which the body of the URL is saved.
+func FileName(u *url.URL) string {
+	if name := path.Base(u.Path); name != "/" && name != "." {
+		return name
+	}
+	return "index.html"
+}
+
+// Split distributes the URLs over at most n connections in turn.
+func Split(urls []*url.URL, n int) [][]*url.URL {
+	if n > len(urls) {
+		n = len(urls)
+	}
+	if n < 1 {
+		n = 1
+	}
+	groups := make([][]*url.URL, n)
+	for i, u := range urls {
+		groups[i%n] = append(groups[i%n], u)
+	}
+	return groups
+}
+
+// WriteTable writes the results as a table, followed by their total.
+func WriteTable(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "URL\tCONNECTION\tSTREAM\tSIZE\tTTFB\tDURATION\tGOODPUT\tERROR")
+	var total Result
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", r.URL, r.Connection, r.StreamID, r.Size, r.TimeToFirstByte, r.Duration, formatGoodput(r.Goodput()), r.Error)
+		total.Size += r.Size
+		if r.Duration > total.Duration {
+			total.Duration = r.Duration
+		}
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t\t%d\t\t%s\t%s\t\n", total.Size, total.Duration, formatGoodput(total.Goodput()))
+	return tw.Flush()
+}
+
+func formatGoodput(bps float64) string {
+	switch {
+	case bps >= 1e9:
+		return fmt.Sprintf("%.2f Gbit/s", bps/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.2f Mbit/s", bps/1e6)
+	case bps >= 1e3:
+		return fmt.Sprintf("%.2f kbit/s", bps/1e3)
+	}
+	return fmt.Sprintf("%.0f bit/s", bps)
+}
+
+// firstByteRecorder records the time at which the first STREAM frame of each stream was received.
+type firstByteRecorder struct {
+	conn     *qt.Connection
+	packets  chan interface{}
+	received map[uint64]time.Time
+}
+
+func recordFirstBytes(conn *qt.Connection) *firstByteRecorder {
+	return &firstByteRecorder{conn: conn, packets: conn.IncomingPackets.RegisterNewChan(1000), received: make(map[uint64]time.Time)}
+}
+
+func (r *firstByteRecorder) record(i interface{}, at time.Time) {
+	framer, ok := i.(qt.Framer)
+	if !ok {
+		return
+	}
+	for _, f := range framer.GetAll(qt.StreamType) {
+		if s := f.(*qt.StreamFrame); r.received[s.StreamId].IsZero() {
+			r.received[s.StreamId] = at
+		}
+	}
+}
+
+// get returns the time at which the first byte of the stream was received, after recording the packets pending.
+func (r *firstByteRecorder) get(streamID uint64) (time.Time, bool) {
+	for len(r.packets) > 0 {
+		r.record(<-r.packets, time.Now())
+	}
+	at, ok := r.received[streamID]
+	return at, ok
+}
+
+func (r *firstByteRecorder) stop() {
+	if !r.conn.IncomingPackets.IsClosed() {
+		r.conn.IncomingPackets.Unregister(r.packets)
+	}
+}
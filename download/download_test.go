@@ -0,0 +1,85 @@
+package download
+
+import (
+	"bytes"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/agents"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type response struct {
+	streamID uint64
+	body     []byte
+}
+
+func (r *response) StreamID() uint64             { return r.streamID }
+func (r *response) Headers() []agents.HTTPHeader { return nil }
+func (r *response) Body() []byte                 { return r.body }
+
+// httpAgent answers the requests for the paths it knows on successive request streams.
+type httpAgent struct {
+	agents.HTTPAgent
+	bodies     map[string]string
+	nextStream uint64
+}
+
+func (a *httpAgent) SendRequest(path, method, authority string, headers map[string]string) chan agents.HTTPResponse {
+	responseChan := make(chan agents.HTTPResponse, 1)
+	if body, ok := a.bodies[path]; ok {
+		responseChan <- &response{a.nextStream, []byte(body)}
+	}
+	a.nextStream += 4
+	return responseChan
+}
+
+func TestFetch(t *testing.T) {
+	directory, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	var urls []*url.URL
+	for _, u := range []string{"https://quic.example.com/a.txt", "https://quic.example.com/", "https://quic.example.com/missing"} {
+		parsed, _ := url.Parse(u)
+		urls = append(urls, parsed)
+	}
+	conn := &qt.Connection{IncomingPackets: qt.NewBroadcaster(10), ConnectionClosed: make(chan bool, 1)}
+	agent := &httpAgent{bodies: map[string]string{"/a.txt": "first", "/": "<html></html>"}}
+
+	results := Fetch(conn, agent, urls, directory, time.After(100*time.Millisecond))
+	if results[0].Size != 5 || results[0].StreamID != 0 || results[0].Error != "" || results[1].StreamID != 4 || results[2].Error != ErrTimeout.Error() {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(directory, "index.html")); err != nil || string(content) != "<html></html>" {
+		t.Errorf("the body of %s was not saved: %v", urls[1], err)
+	}
+
+	var table bytes.Buffer
+	if err := WriteTable(&table, results); err != nil || !strings.Contains(table.String(), "TOTAL") {
+		t.Errorf("unexpected table %s", table.String())
+	}
+}
+
+func TestSplit(t *testing.T) {
+	var urls []*url.URL
+	for i := 0; i < 5; i++ {
+		urls = append(urls, &url.URL{Scheme: "https", Host: "quic.example.com", Path: "/" + string('a'+rune(i))})
+	}
+	groups := Split(urls, 2)
+	if len(groups) != 2 || len(groups[0]) != 3 || len(groups[1]) != 2 || groups[1][0] != urls[1] {
+		t.Errorf("unexpected groups %v", groups)
+	}
+	if groups := Split(urls[:1], 4); len(groups) != 1 {
+		t.Errorf("%d groups for a single URL", len(groups))
+	}
+	if goodput := (Result{Size: 1000, Duration: time.Second}).Goodput(); goodput != 8000 {
+		t.Errorf("goodput of %f bit/s", goodput)
+	}
+}
@@ -107,6 +107,40 @@ const (
 	HandshakeDoneType				 = 0x1e
 )
 
+var frameTypeToString = map[FrameType]string{
+	PaddingFrameType:       "PADDING",
+	PingType:               "PING",
+	AckType:                "ACK",
+	AckECNType:             "ACK_ECN",
+	ResetStreamType:        "RESET_STREAM",
+	StopSendingType:        "STOP_SENDING",
+	CryptoType:             "CRYPTO",
+	NewTokenType:           "NEW_TOKEN",
+	StreamType:             "STREAM",
+	MaxDataType:            "MAX_DATA",
+	MaxStreamDataType:      "MAX_STREAM_DATA",
+	MaxStreamsType:         "MAX_STREAMS",
+	MaxStreamsType + 1:     "MAX_STREAMS",
+	DataBlockedType:        "DATA_BLOCKED",
+	StreamDataBlockedType:  "STREAM_DATA_BLOCKED",
+	StreamsBlockedType:     "STREAMS_BLOCKED",
+	StreamsBlockedType + 1: "STREAMS_BLOCKED",
+	NewConnectionIdType:    "NEW_CONNECTION_ID",
+	RetireConnectionIdType: "RETIRE_CONNECTION_ID",
+	PathChallengeType:      "PATH_CHALLENGE",
+	PathResponseType:       "PATH_RESPONSE",
+	ConnectionCloseType:    "CONNECTION_CLOSE",
+	ApplicationCloseType:   "APPLICATION_CLOSE",
+	HandshakeDoneType:      "HANDSHAKE_DONE",
+}
+
+func (t FrameType) String() string {
+	if s, ok := frameTypeToString[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("UNKNOWN(0x%x)", uint64(t))
+}
+
 type PaddingFrame byte
 
 func (frame *PaddingFrame) FrameType() FrameType { return PaddingFrameType }
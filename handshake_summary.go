@@ -0,0 +1,108 @@
+package quictracker
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The TLS codepoints needed to read the EncryptedExtensions sent by a server.
+const (
+	tlsEncryptedExtensions               = 8
+	tlsExtensionALPN                     = 16
+	tlsExtensionQuicTransportParams      = 0x39   // The codepoint of RFC 9001
+	tlsExtensionQuicTransportParamsDraft = 0xffa5 // The codepoint used by the drafts
+)
+
+// A HandshakeSummary describes the handshake recorded in a trace, as recovered from its packets. It allows comparing
+// the handshakes of several runs against the same host.
+type HandshakeSummary struct {
+	ClientVersion       string                 `json:"client_version,omitempty"`     // The version of the first Initial packet sent
+	NegotiatedVersion   string                 `json:"negotiated_version,omitempty"` // The version of the long header packets of the server
+	ALPN                string                 `json:"alpn,omitempty"`
+	TransportParameters map[string]interface{} `json:"transport_parameters,omitempty"` // The parameters sent by the server
+	FirstResponse       int64                  `json:"first_response"`                 // The time between the first packet sent and the first packet received, in milliseconds
+	HandshakeDuration   int64                  `json:"handshake_duration"`             // The time until the handshake was confirmed, in milliseconds, or -1
+}
+
+// SummarizeHandshake decodes the packets of the trace and summarises its handshake. The handshake is considered
+// confirmed when a HANDSHAKE_DONE frame or a 1-RTT packet is received.
+func SummarizeHandshake(trace *Trace) *HandshakeSummary {
+	s := &HandshakeSummary{FirstResponse: -1, HandshakeDuration: -1}
+	decoder := NewTraceDecoder()
+	packets := decoder.DecodeAll(trace)
+	if len(packets) == 0 {
+		return s
+	}
+	start := packets[0].Timestamp
+	elapsed := func(p DecodedPacket) int64 { return p.Timestamp.Sub(start).Nanoseconds() / 1e6 }
+
+	for _, p := range packets {
+		if p.Packet == nil {
+			continue
+		}
+		if h, ok := p.Packet.Header().(*LongHeader); ok && h.PacketType() != Retry {
+			if p.Direction == ToServer && s.ClientVersion == "" {
+				s.ClientVersion = fmt.Sprintf("%08x", h.Version)
+			} else if p.Direction == ToClient && s.NegotiatedVersion == "" && h.PacketType() != ZeroRTTProtected {
+				s.NegotiatedVersion = fmt.Sprintf("%08x", h.Version)
+			}
+		}
+		if p.Direction != ToClient {
+			continue
+		}
+		if s.FirstResponse < 0 {
+			s.FirstResponse = elapsed(p)
+		}
+		if s.HandshakeDuration < 0 {
+			framer, ok := p.Packet.(Framer)
+			if _, short := p.Packet.Header().(*ShortHeader); short || ok && framer.Contains(HandshakeDoneType) {
+				s.HandshakeDuration = elapsed(p)
+			}
+		}
+	}
+
+	if stream, ok := decoder.ClientView().CryptoStreams[PNSpaceHandshake]; ok {
+		s.readEncryptedExtensions(stream.ReadData)
+	}
+	return s
+}
+
+// readEncryptedExtensions looks for the EncryptedExtensions message in the TLS handshake messages sent by the server
+// and reads the ALPN and transport parameters it contains.
+func (s *HandshakeSummary) readEncryptedExtensions(messages []byte) {
+	for len(messages) >= 4 {
+		msgType, length := messages[0], int(messages[1])<<16|int(messages[2])<<8|int(messages[3])
+		if len(messages) < 4+length {
+			return
+		}
+		body := messages[4 : 4+length]
+		messages = messages[4+length:]
+		if msgType != tlsEncryptedExtensions || len(body) < 2 {
+			continue
+		}
+		extensions := body[2:]
+		if l := int(binary.BigEndian.Uint16(body)); l < len(extensions) {
+			extensions = extensions[:l]
+		}
+		for len(extensions) >= 4 {
+			extType, extLength := binary.BigEndian.Uint16(extensions), int(binary.BigEndian.Uint16(extensions[2:]))
+			if len(extensions) < 4+extLength {
+				return
+			}
+			data := extensions[4 : 4+extLength]
+			extensions = extensions[4+extLength:]
+			switch extType {
+			case tlsExtensionALPN:
+				if len(data) >= 3 && len(data) >= 3+int(data[2]) {
+					s.ALPN = string(data[3 : 3+int(data[2])])
+				}
+			case tlsExtensionQuicTransportParams, tlsExtensionQuicTransportParamsDraft:
+				handler := NewTLSTransportParameterHandler(nil)
+				if handler.ReceiveExtensionData(data) == nil {
+					s.TransportParameters = handler.ReceivedParameters.ToJSON
+				}
+			}
+		}
+		return
+	}
+}
@@ -0,0 +1,306 @@
+// Package hosts reads the inventory of the hosts against which the test suite is run.
+//
+// The inventory is a YAML or JSON document, either a list of hosts or an object with a hosts list, e.g.
+//
+//	hosts:
+//	  - name: quic.example.com
+//	    hq_port: 4433
+//	    h3_port: 443
+//	    ipv4: [192.0.2.1]
+//	    alpns: [hq]
+//	    versions: [ff00001d]
+//	    paths: [/index.html]
+//	    content_hashes: {/index.html: "sha256:…"}
+//	    tags: [ietf]
+//	    skip: [connection_migration*]
+//	    overrides:
+//	      http3_get: {path: /large.bin, timeout: 30, retries: 2}
+//
+// The tab-separated files listing a host and port, a path, an h3 port and an ALPN on each line, such as
+// ietf_quic_hosts.txt, are also accepted.
+package hosts
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Host describes a server against which scenarios are run and how to reach it.
+type Host struct {
+	Name          string              `yaml:"name" json:"name"`
+	SNI           string              `yaml:"sni,omitempty" json:"sni,omitempty"`                       // The server name to use instead of Name
+	IPv4          []string            `yaml:"ipv4,omitempty" json:"ipv4,omitempty"`                     // The addresses to connect to instead of resolving Name
+	IPv6          []string            `yaml:"ipv6,omitempty" json:"ipv6,omitempty"`                     // Their counterparts for the scenarios that use IPv6
+	HQPort        int                 `yaml:"hq_port,omitempty" json:"hq_port,omitempty"`               // 443 by default
+	H3Port        int                 `yaml:"h3_port,omitempty" json:"h3_port,omitempty"`               // HQPort by default
+	ALPNs         []string            `yaml:"alpns,omitempty" json:"alpns,omitempty"`                   // The ALPN prefixes supported, the first one is used for the non-HTTP/3 scenarios
+	Versions      []string            `yaml:"versions,omitempty" json:"versions,omitempty"`             // The hexadecimal QUIC versions supported, the first one is proposed
+	Paths         []string            `yaml:"paths,omitempty" json:"paths,omitempty"`                   // The paths to request, the first one is used by default
+	ContentHashes map[string]string   `yaml:"content_hashes,omitempty" json:"content_hashes,omitempty"` // The expected hash of the content of each path, e.g. sha256:<hex>
+	Tags          []string            `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Skip          []string            `yaml:"skip,omitempty" json:"skip,omitempty"`           // The names of the scenarios not to run against the host, globs are accepted
+	Overrides     map[string]Override `yaml:"overrides,omitempty" json:"overrides,omitempty"` // Settings that apply to a particular scenario, indexed by name
+}
+
+// An Override changes the settings of a host for a particular scenario.
+type Override struct {
+	Path    string `yaml:"path,omitempty" json:"path,omitempty"`
+	ALPN    string `yaml:"alpn,omitempty" json:"alpn,omitempty"`
+	Port    int    `yaml:"port,omitempty" json:"port,omitempty"`
+	Version string `yaml:"version,omitempty" json:"version,omitempty"`
+	Timeout int    `yaml:"timeout,omitempty" json:"timeout,omitempty"` // In seconds
+	Retries *int   `yaml:"retries,omitempty" json:"retries,omitempty"` // The number of times the scenario is run again when it fails
+	Skip    bool   `yaml:"skip,omitempty" json:"skip,omitempty"`
+}
+
+// A Target describes how to run a particular scenario against a host.
+type Target struct {
+	Host        string        // The host and port, as recorded in the trace
+	Address     string        // The address to connect to, if it is not resolved from Host
+	ServerName  string        // The SNI
+	Path        string        // The path to request
+	ALPN        string        // The ALPN prefix to use when HTTP/3 is not negotiated
+	Version     uint32        // The version to propose, or 0 for the default one
+	Timeout     time.Duration // The time spent completing the test, or 0 for the default one
+	Retries     int           // The number of times the scenario is run again when it fails, or -1 for the default one
+	ContentHash string        // The expected hash of the content of the path, e.g. sha256:<hex>, if known
+}
+
+type inventory struct {
+	Hosts []*Host `yaml:"hosts" json:"hosts"`
+}
+
+// Load reads a hosts file, either in YAML, in JSON or tab-separated.
+func Load(filename string) ([]*Host, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(content)
+}
+
+// Parse reads the content of a hosts file. The format is recognised from its content.
+func Parse(content []byte) ([]*Host, error) {
+	var hosts []*Host
+	var i inventory
+	var err error
+	line := firstLine(content)
+	switch {
+	case strings.HasPrefix(line, "["):
+		err = decodeJSON(content, &hosts)
+	case strings.HasPrefix(line, "{"):
+		err = decodeJSON(content, &i)
+		hosts = i.Hosts
+	case strings.Contains(line, "\t"):
+		hosts, err = parseTabSeparated(content)
+	case strings.HasPrefix(line, "-"):
+		err = yaml.UnmarshalStrict(content, &hosts)
+	default:
+		err = yaml.UnmarshalStrict(content, &i)
+		hosts = i.Hosts
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range hosts {
+		if err := h.check(); err != nil {
+			return nil, fmt.Errorf("host %d: %s", i+1, err.Error())
+		}
+	}
+	return hosts, nil
+}
+
+// firstLine returns the first line of the content that is neither empty nor a comment, without its indentation.
+func firstLine(content []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+	}
+	return ""
+}
+
+func decodeJSON(content []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// parseTabSeparated reads the lines of host and port, path, h3 port and ALPN of the legacy hosts files.
+func parseTabSeparated(content []byte) ([]*Host, error) {
+	var hosts []*Host
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		columns := strings.Split(line, "\t")
+		if len(columns) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 tab-separated columns, found %d", n, len(columns))
+		}
+		name, port, err := net.SplitHostPort(columns[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err.Error())
+		}
+		hqPort, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid port %s", n, port)
+		}
+		h3Port, err := strconv.Atoi(columns[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid h3 port %s", n, columns[2])
+		}
+		hosts = append(hosts, &Host{Name: name, HQPort: hqPort, H3Port: h3Port, Paths: []string{columns[1]}, ALPNs: []string{columns[3]}})
+	}
+	return hosts, scanner.Err()
+}
+
+func (h *Host) check() error {
+	if h.Name == "" {
+		return errors.New("the name is missing")
+	}
+	if h.HQPort == 0 {
+		h.HQPort = 443
+	}
+	if h.H3Port == 0 {
+		h.H3Port = h.HQPort
+	}
+	for _, port := range []int{h.HQPort, h.H3Port} {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+	}
+	for _, a := range append(append([]string{}, h.IPv4...), h.IPv6...) {
+		if net.ParseIP(a) == nil {
+			return fmt.Errorf("invalid address %s", a)
+		}
+	}
+	for _, v := range h.Versions {
+		if _, err := ParseVersion(v); err != nil {
+			return err
+		}
+	}
+	for name, o := range h.Overrides {
+		if o.Port < 0 || o.Port > 65535 {
+			return fmt.Errorf("%s: invalid port %d", name, o.Port)
+		}
+		if o.Retries != nil && *o.Retries < 0 {
+			return fmt.Errorf("%s: invalid number of retries %d", name, *o.Retries)
+		}
+		if o.Version != "" {
+			if _, err := ParseVersion(o.Version); err != nil {
+				return fmt.Errorf("%s: %s", name, err.Error())
+			}
+		}
+	}
+	for p, hash := range h.ContentHashes {
+		if digest := strings.TrimPrefix(hash, "sha256:"); digest == hash || len(digest) != 64 || strings.Trim(strings.ToLower(digest), "0123456789abcdef") != "" {
+			return fmt.Errorf("%s: invalid content hash %s, expected sha256:<hex>", p, hash)
+		}
+	}
+	for _, pattern := range h.Skip {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid skip pattern %s", pattern)
+		}
+	}
+	return nil
+}
+
+// ParseVersion reads a QUIC version written in hexadecimal, with or without the 0x prefix.
+func ParseVersion(v string) (uint32, error) {
+	version, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(v), "0x"), 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %s", v)
+	}
+	return uint32(version), nil
+}
+
+// HasTag reports whether the host has one of the given tags.
+func (h *Host) HasTag(tags ...string) bool {
+	for _, t := range h.Tags {
+		for _, tag := range tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Skips reports whether the given scenario should not be run against the host.
+func (h *Host) Skips(scenario string) bool {
+	for _, pattern := range h.Skip {
+		if matched, _ := path.Match(pattern, scenario); matched {
+			return true
+		}
+	}
+	return h.Overrides[scenario].Skip
+}
+
+// ContentHash returns the expected hash of the content of the given path, if known.
+func (h *Host) ContentHash(p string) string {
+	return h.ContentHashes[p]
+}
+
+// Target returns how to run the given scenario against the host. The h3 port is used for the HTTP/3 scenarios and
+// the IPv6 addresses for the IPv6 scenarios.
+func (h *Host) Target(scenario string, http3 bool, ipv6 bool) Target {
+	o := h.Overrides[scenario]
+	port := h.HQPort
+	if http3 {
+		port = h.H3Port
+	}
+	if o.Port != 0 {
+		port = o.Port
+	}
+
+	t := Target{Host: net.JoinHostPort(h.Name, strconv.Itoa(port)), ServerName: h.Name, Path: "/index.html", ALPN: "hq"}
+	if h.SNI != "" {
+		t.ServerName = h.SNI
+	}
+	addresses := h.IPv4
+	if ipv6 {
+		addresses = h.IPv6
+	}
+	if len(addresses) > 0 {
+		t.Address = net.JoinHostPort(addresses[0], strconv.Itoa(port))
+	}
+	if len(h.Paths) > 0 {
+		t.Path = h.Paths[0]
+	}
+	if o.Path != "" {
+		t.Path = o.Path
+	}
+	if len(h.ALPNs) > 0 {
+		t.ALPN = h.ALPNs[0]
+	}
+	if o.ALPN != "" {
+		t.ALPN = o.ALPN
+	}
+	if len(h.Versions) > 0 {
+		t.Version, _ = ParseVersion(h.Versions[0])
+	}
+	if o.Version != "" {
+		t.Version, _ = ParseVersion(o.Version)
+	}
+	t.ContentHash = h.ContentHash(t.Path)
+	t.Timeout = time.Duration(o.Timeout) * time.Second
+	t.Retries = -1
+	if o.Retries != nil {
+		t.Retries = *o.Retries
+	}
+	return t
+}
@@ -0,0 +1,102 @@
+package hosts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTabSeparated(t *testing.T) {
+	hosts, err := Load("../ietf_quic_hosts.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) == 0 {
+		t.Fatal("no hosts were read")
+	}
+
+	hosts, err = Parse([]byte("quic.example.com:4433\t/index.html\t443\thq\n\n# A comment\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 {
+		t.Fatalf("expected 1 host, got %d", len(hosts))
+	}
+	if target := hosts[0].Target("http3_get", true, false); target.Host != "quic.example.com:443" || target.Path != "/index.html" {
+		t.Errorf("unexpected target %+v", target)
+	}
+	if target := hosts[0].Target("handshake", false, false); target.Host != "quic.example.com:4433" || target.ALPN != "hq" {
+		t.Errorf("unexpected target %+v", target)
+	}
+
+	if _, err := Parse([]byte("quic.example.com:4433\t/index.html\t443\n")); err == nil {
+		t.Error("a missing column was not reported")
+	}
+}
+
+func TestParseInventory(t *testing.T) {
+	yaml := `
+hosts:
+  - name: quic.example.com
+    sni: example.com
+    hq_port: 4433
+    ipv4: [192.0.2.1]
+    ipv6: ["2001:db8::1"]
+    versions: [ff00001d]
+    tags: [ietf]
+    skip: [connection_migration*]
+    overrides:
+      http3_get: {path: /large.bin, port: 8443, timeout: 30}
+  - name: other.example.com
+`
+	json := `{"hosts": [{"name": "quic.example.com", "sni": "example.com", "hq_port": 4433, "ipv4": ["192.0.2.1"], "ipv6": ["2001:db8::1"],
+		"versions": ["ff00001d"], "tags": ["ietf"], "skip": ["connection_migration*"],
+		"overrides": {"http3_get": {"path": "/large.bin", "port": 8443, "timeout": 30}}}, {"name": "other.example.com"}]}`
+
+	for _, content := range []string{yaml, json} {
+		hosts, err := Parse([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hosts) != 2 {
+			t.Fatalf("expected 2 hosts, got %d", len(hosts))
+		}
+		h := hosts[0]
+		if !h.HasTag("ietf") || hosts[1].HasTag("ietf") || !h.Skips("connection_migration_v4_v6") || h.Skips("handshake") {
+			t.Errorf("unexpected tags or skips %+v", h)
+		}
+		target := h.Target("http3_get", true, false)
+		if target.Host != "quic.example.com:8443" || target.Address != "192.0.2.1:8443" || target.ServerName != "example.com" || target.Path != "/large.bin" || target.Version != 0xff00001d || target.Timeout != 30*time.Second {
+			t.Errorf("unexpected target %+v", target)
+		}
+		if target := h.Target("handshake_v6", false, true); target.Address != "[2001:db8::1]:4433" || target.Path != "/index.html" {
+			t.Errorf("unexpected target %+v", target)
+		}
+		if target := hosts[1].Target("handshake", false, false); target.Host != "other.example.com:443" || target.Address != "" {
+			t.Errorf("unexpected target %+v", target)
+		}
+	}
+
+	if _, err := Parse([]byte("hosts:\n  - name: a\n    unknown: 1\n")); err == nil {
+		t.Error("an unknown field was not reported")
+	}
+}
+
+func TestParseContentHashes(t *testing.T) {
+	const hash = "sha256:315f5bdb76d078c43b8ac0064e4a0164612b1fce77c869345bfc94c75894edd3"
+	hosts, err := Parse([]byte("hosts:\n  - name: quic.example.com\n    paths: [/index.html]\n    content_hashes: {/index.html: \"" + hash + "\"}\n    overrides:\n      http3_get: {path: /large.bin}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target := hosts[0].Target("http_get_and_wait", false, false); target.ContentHash != hash {
+		t.Errorf("unexpected content hash %q", target.ContentHash)
+	}
+	if target := hosts[0].Target("http3_get", true, false); target.ContentHash != "" {
+		t.Errorf("the hash of another path was used for %s", target.Path)
+	}
+
+	for _, invalid := range []string{"md5:d41d8cd98f00b204e9800998ecf8427e", "sha256:315f", "sha256:" + hash[7:70] + "z"} {
+		if _, err := Parse([]byte("hosts:\n  - name: quic.example.com\n    content_hashes: {/index.html: \"" + invalid + "\"}\n")); err == nil {
+			t.Errorf("content hash %s was accepted", invalid)
+		}
+	}
+}
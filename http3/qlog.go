@@ -0,0 +1,76 @@
+package http3
+
+import (
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
+)
+
+var qlogFrameType = map[uint64]string{
+	FrameTypeDATA:         "data",
+	FrameTypeHEADERS:      "headers",
+	FrameTypePRIORITY:     "priority",
+	FrameTypeCANCEL_PUSH:  "cancel_push",
+	FrameTypeSETTINGS:     "settings",
+	FrameTypePUSH_PROMISE: "push_promise",
+	FrameTypeGOAWAY:       "goaway",
+	FrameTypeMAX_PUSH_ID:  "max_push_id",
+}
+
+// QLogFrame converts an HTTP/3 frame to its qlog representation. The header blocks are reported by the qpack
+// events.
+func QLogFrame(frame HTTPFrame) qlog.H3Frame {
+	j := qlog.H3Frame{FrameType: "reserved"}
+	if name, ok := qlogFrameType[frame.FrameType()]; ok {
+		j.FrameType = name
+	}
+	switch f := frame.(type) {
+	case *SETTINGS:
+		j.Settings = []qlog.H3Setting{}
+		for _, s := range f.Settings {
+			j.Settings = append(j.Settings, qlog.H3Setting{Name: s.Identifier.Value, Value: s.Value.Value})
+		}
+	case *PRIORITY:
+		j.PrioritizedElementID = &f.PrioritizedElementID.Value
+		j.ElementDependencyID = &f.ElementDependencyID.Value
+		j.Weight = &f.Weight
+		j.Exclusive = f.Exclusive
+	case *CANCEL_PUSH:
+		j.PushID = &f.PushID.Value
+	case *PUSH_PROMISE:
+		j.PushID = &f.PushID.Value
+	case *GOAWAY:
+		j.StreamID = &f.StreamID.Value
+	case *MAX_PUSH_ID:
+		j.PushID = &f.PushID.Value
+	case *UnknownFrame:
+		j.UnknownFrameType = &f.Type.Value
+	}
+	return j
+}
+
+// QLogFrameEvent returns the data of a frame_created or frame_parsed event for the given frame.
+func QLogFrameEvent(frame HTTPFrame, streamID uint64) *qlog.H3FrameCreated {
+	var length uint64
+	if h, ok := frame.(interface{ PayloadLength() uint64 }); ok {
+		length = h.PayloadLength()
+	}
+	return &qlog.H3FrameCreated{StreamID: streamID, Length: length, Frame: QLogFrame(frame), Raw: qlog.RawInfo{Length: int(frame.WireLength()), PayloadLength: int(length)}}
+}
+
+// QLogSettings returns the data of a parameters_set event for the given SETTINGS frame.
+func QLogSettings(f *SETTINGS, owner string) *qlog.H3ParametersSet {
+	j := &qlog.H3ParametersSet{Owner: owner}
+	for _, s := range f.Settings {
+		value := s.Value.Value
+		switch s.Identifier.Value {
+		case SETTINGS_HEADER_TABLE_SIZE:
+			j.MaxTableCapacity = &value
+		case SETTINGS_MAX_HEADER_LIST_SIZE:
+			j.MaxHeaderListSize = &value
+		case SETTINGS_QPACK_BLOCKED_STREAMS:
+			j.BlockedStreamsCount = &value
+		default:
+			j.Unknown = append(j.Unknown, qlog.H3Setting{Name: s.Identifier.Value, Value: value})
+		}
+	}
+	return j
+}
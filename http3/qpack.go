@@ -0,0 +1,236 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
+	"io"
+)
+
+// A QPACKInstruction is an instruction sent on a QPACK encoder or decoder stream, see
+// https://www.rfc-editor.org/rfc/rfc9204#section-4.3. Only the fields relevant to its type are set.
+type QPACKInstruction struct {
+	Type string // One of the qlog.QPACK* instruction types
+
+	Capacity     uint64
+	DynamicTable bool // Whether the name reference points to the dynamic table
+	NameIndex    uint64
+	HuffmanName  bool
+	Name         []byte
+	HuffmanValue bool
+	Value        []byte
+	Index        uint64
+	StreamID     uint64
+	Increment    uint64
+}
+
+var errQPACKIntegerOverflow = errors.New("QPACK integer overflows 62 bits")
+
+// readQPACKInteger reads an integer whose first byte has already been read and uses the n last bits as prefix, see
+// https://www.rfc-editor.org/rfc/rfc7541#section-5.1
+func readQPACKInteger(first byte, n uint, buffer io.ByteReader) (uint64, error) {
+	max := uint64(1)<<n - 1
+	value := uint64(first) & max
+	if value < max {
+		return value, nil
+	}
+	for shift := uint(0); ; shift += 7 {
+		if shift > 56 {
+			return 0, errQPACKIntegerOverflow
+		}
+		b, err := buffer.ReadByte()
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		value += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+}
+
+// readQPACKString reads a string literal whose length uses the n last bits of its first byte as prefix, the bit
+// before the prefix being the Huffman flag.
+func readQPACKString(first byte, n uint, buffer *bytes.Reader) ([]byte, bool, error) {
+	huffman := first&(1<<n) != 0
+	length, err := readQPACKInteger(first, n, buffer)
+	if err != nil {
+		return nil, huffman, err
+	}
+	if uint64(buffer.Len()) < length {
+		return nil, huffman, io.ErrUnexpectedEOF
+	}
+	s := make([]byte, length)
+	buffer.Read(s)
+	return s, huffman, nil
+}
+
+// ReadQPACKEncoderInstruction reads an instruction from an encoder stream. io.ErrUnexpectedEOF is returned when
+// the buffer does not hold a complete instruction.
+func ReadQPACKEncoderInstruction(buffer *bytes.Reader) (*QPACKInstruction, error) {
+	first, err := buffer.ReadByte()
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	i := &QPACKInstruction{}
+	switch {
+	case first&0x80 != 0:
+		i.Type = qlog.QPACKInsertWithNameReference
+		i.DynamicTable = first&0x40 == 0
+		if i.NameIndex, err = readQPACKInteger(first, 6, buffer); err != nil {
+			return nil, err
+		}
+		if first, err = buffer.ReadByte(); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		i.Value, i.HuffmanValue, err = readQPACKString(first, 7, buffer)
+	case first&0x40 != 0:
+		i.Type = qlog.QPACKInsertWithoutNameReference
+		if i.Name, i.HuffmanName, err = readQPACKString(first, 5, buffer); err != nil {
+			return nil, err
+		}
+		if first, err = buffer.ReadByte(); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		i.Value, i.HuffmanValue, err = readQPACKString(first, 7, buffer)
+	case first&0x20 != 0:
+		i.Type = qlog.QPACKSetDynamicTableCapacity
+		i.Capacity, err = readQPACKInteger(first, 5, buffer)
+	default:
+		i.Type = qlog.QPACKDuplicate
+		i.Index, err = readQPACKInteger(first, 5, buffer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// ReadQPACKDecoderInstruction reads an instruction from a decoder stream. io.ErrUnexpectedEOF is returned when
+// the buffer does not hold a complete instruction.
+func ReadQPACKDecoderInstruction(buffer *bytes.Reader) (*QPACKInstruction, error) {
+	first, err := buffer.ReadByte()
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	i := &QPACKInstruction{}
+	switch {
+	case first&0x80 != 0:
+		i.Type = qlog.QPACKSectionAcknowledgement
+		i.StreamID, err = readQPACKInteger(first, 7, buffer)
+	case first&0x40 != 0:
+		i.Type = qlog.QPACKStreamCancellation
+		i.StreamID, err = readQPACKInteger(first, 6, buffer)
+	default:
+		i.Type = qlog.QPACKInsertCountIncrement
+		i.Increment, err = readQPACKInteger(first, 6, buffer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// ReadQPACKInstructions reads all the complete instructions of a buffer filled from an encoder or a decoder stream.
+// It returns them along with their wire lengths and the number of bytes consumed, a trailing incomplete instruction
+// being left for later.
+func ReadQPACKInstructions(data []byte, encoderStream bool) ([]*QPACKInstruction, []int, int, error) {
+	var instructions []*QPACKInstruction
+	var lengths []int
+	consumed := 0
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		var i *QPACKInstruction
+		var err error
+		if encoderStream {
+			i, err = ReadQPACKEncoderInstruction(r)
+		} else {
+			i, err = ReadQPACKDecoderInstruction(r)
+		}
+		if err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return instructions, lengths, consumed, err
+		}
+		instructions = append(instructions, i)
+		lengths = append(lengths, len(data)-r.Len()-consumed)
+		consumed = len(data) - r.Len()
+	}
+	return instructions, lengths, consumed, nil
+}
+
+func (i *QPACKInstruction) QLog() qlog.QPACKInstruction {
+	q := qlog.QPACKInstruction{InstructionType: i.Type}
+	switch i.Type {
+	case qlog.QPACKSetDynamicTableCapacity:
+		q.Capacity = &i.Capacity
+	case qlog.QPACKInsertWithNameReference, qlog.QPACKInsertWithoutNameReference:
+		if i.Type == qlog.QPACKInsertWithNameReference {
+			q.TableType = "static"
+			if i.DynamicTable {
+				q.TableType = "dynamic"
+			}
+			q.NameIndex = &i.NameIndex
+		} else {
+			nameLength := uint64(len(i.Name))
+			q.HuffmanEncodedName = i.HuffmanName
+			q.NameLength = &nameLength
+			if !i.HuffmanName {
+				q.Name = string(i.Name)
+			}
+		}
+		valueLength := uint64(len(i.Value))
+		q.HuffmanEncodedValue = i.HuffmanValue
+		q.ValueLength = &valueLength
+		if !i.HuffmanValue {
+			q.Value = string(i.Value)
+		}
+	case qlog.QPACKDuplicate:
+		q.Index = &i.Index
+	case qlog.QPACKSectionAcknowledgement, qlog.QPACKStreamCancellation:
+		q.StreamID = &i.StreamID
+	case qlog.QPACKInsertCountIncrement:
+		q.Increment = &i.Increment
+	}
+	return q
+}
+
+// ReadQPACKHeaderBlockPrefix reads the prefix of an encoded field section, see
+// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.1
+func ReadQPACKHeaderBlockPrefix(block []byte) (*qlog.QPACKHeaderBlockPrefix, error) {
+	r := bytes.NewReader(block)
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	p := &qlog.QPACKHeaderBlockPrefix{}
+	if p.RequiredInsertCount, err = readQPACKInteger(first, 8, r); err != nil {
+		return nil, err
+	}
+	if first, err = r.ReadByte(); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	p.SignBit = first&0x80 != 0
+	if p.DeltaBase, err = readQPACKInteger(first, 7, r); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DecodeRequiredInsertCount recovers the Required Insert Count of a field section from its encoded value, given the
+// maximum capacity of the dynamic table and the number of insertions made so far, see
+// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.1.1
+func DecodeRequiredInsertCount(encoded, maxTableCapacity, totalInserts uint64) uint64 {
+	maxEntries := maxTableCapacity / 32
+	if encoded == 0 || maxEntries == 0 {
+		return 0
+	}
+	fullRange := 2 * maxEntries
+	maxValue := totalInserts + maxEntries
+	maxWrapped := (maxValue / fullRange) * fullRange
+	count := maxWrapped + encoded - 1
+	if count > maxValue && count > fullRange {
+		count -= fullRange
+	}
+	return count
+}
@@ -0,0 +1,118 @@
+package quictracker
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/mpiraux/pigotls"
+	"io"
+	"os"
+)
+
+// The labels of the TLS secrets in the NSS key log format, as consumed by Wireshark. See
+// https://developer.mozilla.org/en-US/docs/Mozilla/Projects/NSS/Key_Log_Format
+const (
+	KeyLogClientEarlyTrafficSecret     = "CLIENT_EARLY_TRAFFIC_SECRET"
+	KeyLogClientHandshakeTrafficSecret = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
+	KeyLogServerHandshakeTrafficSecret = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+	KeyLogClientTrafficSecret0         = "CLIENT_TRAFFIC_SECRET_0"
+	KeyLogServerTrafficSecret0         = "SERVER_TRAFFIC_SECRET_0"
+)
+
+// KeyLogLine returns a line of an NSS key log file for the given secret.
+func KeyLogLine(label string, clientRandom []byte, secret []byte) string {
+	return fmt.Sprintf("%s %s %s\n", label, hex.EncodeToString(clientRandom), hex.EncodeToString(secret))
+}
+
+// KeyLog returns the secrets of the trace in the NSS key log format.
+func (t *Trace) KeyLog() []byte {
+	buffer := new(bytes.Buffer)
+	if len(t.ClientRandom) == 0 {
+		return nil
+	}
+	writeLine := func(label string, secret []byte) {
+		if len(secret) > 0 {
+			buffer.WriteString(KeyLogLine(label, t.ClientRandom, secret))
+		}
+	}
+	if s, ok := t.Secrets[pigotls.Epoch0RTT]; ok {
+		writeLine(KeyLogClientEarlyTrafficSecret, s.Write)
+	}
+	if s, ok := t.Secrets[pigotls.EpochHandshake]; ok {
+		writeLine(KeyLogClientHandshakeTrafficSecret, s.Write)
+		writeLine(KeyLogServerHandshakeTrafficSecret, s.Read)
+	}
+	if s, ok := t.Secrets[pigotls.Epoch1RTT]; ok {
+		writeLine(KeyLogClientTrafficSecret0, s.Write)
+		writeLine(KeyLogServerTrafficSecret0, s.Read)
+	}
+	return buffer.Bytes()
+}
+
+// WriteKeyLog writes the secrets of the trace in the NSS key log format.
+func (t *Trace) WriteKeyLog(w io.Writer) error {
+	_, err := w.Write(t.KeyLog())
+	return err
+}
+
+// AppendKeyLog appends the given key log lines to a file, creating it if needed. The content is written at once, so
+// that several connections can share the same file.
+func AppendKeyLog(filename string, content []byte) error {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// LogSecret reports the given secret of the connection to its key log handler and appends it to its key log file, if
+// any.
+func (c *Connection) LogSecret(label string, secret []byte) {
+	if len(secret) == 0 {
+		return
+	}
+	line := []byte(KeyLogLine(label, c.Tls.ClientRandom(), secret))
+	if c.KeyLogHandler != nil {
+		c.KeyLogHandler(line)
+	}
+	if c.KeyLogFile == "" {
+		return
+	}
+	if err := AppendKeyLog(c.KeyLogFile, line); err != nil {
+		c.Logger.Printf("Could not write %s to key log file %s: %s\n", label, c.KeyLogFile, err.Error())
+	}
+}
+
+// A KeyLog holds the secrets read from an NSS key log file, indexed by client random then by label.
+type KeyLog map[string]map[string][]byte
+
+// ParseKeyLog reads the secrets of an NSS key log file. Comments and malformed lines are ignored.
+func ParseKeyLog(content []byte) KeyLog {
+	keyLog := make(KeyLog)
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) != 3 || bytes.HasPrefix(fields[0], []byte("#")) {
+			continue
+		}
+		clientRandom, err1 := hex.DecodeString(string(fields[1]))
+		secret, err2 := hex.DecodeString(string(fields[2]))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		key := hex.EncodeToString(clientRandom)
+		if keyLog[key] == nil {
+			keyLog[key] = make(map[string][]byte)
+		}
+		keyLog[key][string(fields[0])] = secret
+	}
+	return keyLog
+}
+
+// Secrets returns the secrets of the connection with the given client random, indexed by label.
+func (k KeyLog) Secrets(clientRandom []byte) map[string][]byte {
+	return k[hex.EncodeToString(clientRandom)]
+}
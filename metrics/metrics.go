@@ -0,0 +1,324 @@
+// Package metrics exposes statistics about the scenarios run and the connections established in the Prometheus text
+// format, so that continuous runs of the test suite can be monitored.
+//
+// The metrics are registered when they are created and are exposed by Handler, which long-running tools serve on
+// /metrics.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      []collector
+)
+
+func register(c collector) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	for _, r := range registry {
+		if r.name() == c.name() {
+			panic("metric " + c.name() + " is already registered")
+		}
+	}
+	registry = append(registry, c)
+}
+
+// Write writes all the metrics in the Prometheus text format.
+func Write(w io.Writer) error {
+	registryMutex.Lock()
+	collectors := append([]collector{}, registry...)
+	registryMutex.Unlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	buffer := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buffer)
+	}
+	return buffer.Flush()
+}
+
+// Handler returns an HTTP handler exposing the metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w)
+	})
+}
+
+// Serve serves the metrics on /metrics at the given address in the background. Errors are reported on the returned
+// channel.
+func Serve(address string) <-chan error {
+	errors := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	go func() {
+		errors <- http.ListenAndServe(address, mux)
+	}()
+	return errors
+}
+
+// vec holds the values of a metric for each combination of the values of its labels.
+type vec struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+	mutex      sync.Mutex
+	values     map[string]interface{}
+	keys       map[string][]string
+}
+
+func newVec(name, help, kind string, labels []string) vec {
+	return vec{metricName: name, help: help, kind: kind, labels: labels, values: make(map[string]interface{}), keys: make(map[string][]string)}
+}
+
+func (v *vec) name() string {
+	return v.metricName
+}
+
+// get returns the value of the given label values, creating it if needed.
+func (v *vec) get(labelValues []string, create func() interface{}) interface{} {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, %d values were given", v.metricName, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	value, ok := v.values[key]
+	if !ok {
+		value = create()
+		v.values[key] = value
+		v.keys[key] = append([]string{}, labelValues...)
+	}
+	return value
+}
+
+// each calls f with the labels of each value, sorted.
+func (v *vec) each(f func(labels string, value interface{})) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var keys []string
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f(formatLabels(v.labels, v.keys[k]), v.values[k])
+	}
+}
+
+func (v *vec) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.metricName, strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(v.help), v.metricName, v.kind)
+}
+
+var labelValueEscaper = strings.NewReplacer("\\", `\\`, "\"", `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i := range names {
+		pairs[i] = names[i] + "=\"" + labelValueEscaper.Replace(values[i]) + "\""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel adds a label to labels formatted by formatLabels.
+func withLabel(labels, name, value string) string {
+	pair := name + "=\"" + value + "\""
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// A Counter is a value that only increases.
+type Counter struct {
+	mutex sync.Mutex
+	value float64
+}
+
+// Inc increments the counter.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds a positive amount to the counter.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.mutex.Lock()
+	c.value += v
+	c.mutex.Unlock()
+}
+
+// A CounterVec is a counter for each combination of the values of its labels.
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec creates and registers a counter with the given labels.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels)}
+	register(c)
+	return c
+}
+
+// With returns the counter of the given label values.
+func (c *CounterVec) With(labelValues ...string) *Counter {
+	return c.get(labelValues, func() interface{} { return new(Counter) }).(*Counter)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeHeader(w)
+	c.each(func(labels string, value interface{}) {
+		counter := value.(*Counter)
+		counter.mutex.Lock()
+		defer counter.mutex.Unlock()
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, labels, formatFloat(counter.value))
+	})
+}
+
+// A Gauge is a value that can go up and down.
+type Gauge struct {
+	mutex sync.Mutex
+	value float64
+}
+
+// Set sets the value of the gauge.
+func (g *Gauge) Set(v float64) {
+	g.mutex.Lock()
+	g.value = v
+	g.mutex.Unlock()
+}
+
+// A GaugeVec is a gauge for each combination of the values of its labels.
+type GaugeVec struct {
+	vec
+}
+
+// NewGaugeVec creates and registers a gauge with the given labels.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels)}
+	register(g)
+	return g
+}
+
+// With returns the gauge of the given label values.
+func (g *GaugeVec) With(labelValues ...string) *Gauge {
+	return g.get(labelValues, func() interface{} { return new(Gauge) }).(*Gauge)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.writeHeader(w)
+	g.each(func(labels string, value interface{}) {
+		gauge := value.(*Gauge)
+		gauge.mutex.Lock()
+		defer gauge.mutex.Unlock()
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, labels, formatFloat(gauge.value))
+	})
+}
+
+// A Histogram counts observations in buckets.
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// Observe adds an observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, upperBound := range h.buckets {
+		if v <= upperBound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// A HistogramVec is a histogram for each combination of the values of its labels.
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+// NewHistogramVec creates and registers a histogram with the given upper bounds of its buckets and labels.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{newVec(name, help, "histogram", labels), buckets}
+	register(h)
+	return h
+}
+
+// With returns the histogram of the given label values.
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	return h.get(labelValues, func() interface{} {
+		return &Histogram{buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+	}).(*Histogram)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.writeHeader(w)
+	h.each(func(labels string, value interface{}) {
+		histogram := value.(*Histogram)
+		histogram.mutex.Lock()
+		defer histogram.mutex.Unlock()
+		for i, upperBound := range histogram.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, withLabel(labels, "le", formatFloat(upperBound)), histogram.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, withLabel(labels, "le", "+Inf"), histogram.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, labels, formatFloat(histogram.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, labels, histogram.count)
+	})
+}
+
+// A CounterFunc is a counter whose value is returned by a function.
+type CounterFunc struct {
+	vec
+	value func() float64
+}
+
+// NewCounterFunc creates and registers a counter whose value is returned by the given function.
+func NewCounterFunc(name, help string, value func() float64) *CounterFunc {
+	c := &CounterFunc{newVec(name, help, "counter", nil), value}
+	register(c)
+	return c
+}
+
+func (c *CounterFunc) write(w io.Writer) {
+	c.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", c.metricName, formatFloat(c.value()))
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	counter := NewCounterVec("test_counter_total", "A counter.", "host")
+	counter.With("quic.example.com:443").Add(2)
+	counter.With("say \"hi\"").Inc()
+	NewGaugeVec("test_gauge", "A gauge.", "host", "estimate").With("quic.example.com", "min").Set(0.025)
+	histogram := NewHistogramVec("test_histogram_seconds", "A histogram.", []float64{1, 0.1}, "host")
+	histogram.With("quic.example.com").Observe(0.05)
+	histogram.With("quic.example.com").Observe(0.5)
+	histogram.With("quic.example.com").Observe(2)
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"# HELP test_counter_total A counter.\n# TYPE test_counter_total counter\n",
+		"test_counter_total{host=\"quic.example.com:443\"} 2\n",
+		"test_counter_total{host=\"say \\\"hi\\\"\"} 1\n",
+		"# TYPE test_gauge gauge\ntest_gauge{host=\"quic.example.com\",estimate=\"min\"} 0.025\n",
+		"test_histogram_seconds_bucket{host=\"quic.example.com\",le=\"0.1\"} 1\n" +
+			"test_histogram_seconds_bucket{host=\"quic.example.com\",le=\"1\"} 2\n" +
+			"test_histogram_seconds_bucket{host=\"quic.example.com\",le=\"+Inf\"} 3\n" +
+			"test_histogram_seconds_sum{host=\"quic.example.com\"} 2.55\n" +
+			"test_histogram_seconds_count{host=\"quic.example.com\"} 3\n",
+		"# TYPE quictracker_broadcaster_dropped_events_total counter\nquictracker_broadcaster_dropped_events_total 0\n",
+	} {
+		if !strings.Contains(buffer.String(), expected) {
+			t.Errorf("%q is missing from\n%s", expected, buffer.String())
+		}
+	}
+}
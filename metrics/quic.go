@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/results"
+)
+
+var (
+	// Scenarios counts the scenarios run, by scenario, host and outcome.
+	Scenarios = NewCounterVec("quictracker_scenarios_total", "The number of scenarios run, by scenario, host and outcome.", "scenario", "host", "outcome")
+	// HandshakeDuration observes the time taken to complete the handshakes, by server name.
+	HandshakeDuration = NewHistogramVec("quictracker_handshake_duration_seconds", "The time taken to complete the handshakes, by host.",
+		[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}, "host")
+	// RTT holds the latest RTT estimates of the connections, in seconds, by server name and estimate.
+	RTT = NewGaugeVec("quictracker_rtt_seconds", "The latest RTT estimates of the connections, by host and estimate: latest, min, smoothed or variance.", "host", "estimate")
+	// Retransmissions counts the packets whose frames were retransmitted, by server name.
+	Retransmissions = NewCounterVec("quictracker_retransmissions_total", "The number of packets considered lost whose frames were retransmitted, by host.", "host")
+
+	_ = NewCounterFunc("quictracker_broadcaster_dropped_events_total", "The number of events submitted to broadcasters after they were closed, which were dropped.",
+		func() float64 { return float64(qt.DroppedBroadcasterEvents()) })
+)
+
+// ObserveTrace records the outcome of the scenario run that produced the trace.
+func ObserveTrace(t *qt.Trace) {
+	Scenarios.With(t.Scenario, t.Host, results.OutcomeOf(t)).Inc()
+}
@@ -359,6 +359,21 @@ type ZeroRTTProtectedPacket struct {
 }
 func (p *ZeroRTTProtectedPacket) PNSpace() PNSpace { return PNSpaceAppData }
 func (p *ZeroRTTProtectedPacket) EncryptionLevel() EncryptionLevel { return EncryptionLevel0RTT }
+func ReadZeroRTTProtectedPacket(buffer *bytes.Reader, conn *Connection) (*ZeroRTTProtectedPacket, error) {
+	p := new(ZeroRTTProtectedPacket)
+	p.header = ReadLongHeader(buffer, conn)
+	for {
+		frame, err := NewFrame(buffer, conn)
+		if err != nil {
+			return nil, err
+		}
+		if frame == nil {
+			break
+		}
+		p.Frames = append(p.Frames, frame)
+	}
+	return p, nil
+}
 func NewZeroRTTProtectedPacket(conn *Connection) *ZeroRTTProtectedPacket {
 	p := new(ZeroRTTProtectedPacket)
 	p.header = NewLongHeader(ZeroRTTProtected, conn, PNSpaceAppData)
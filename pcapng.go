@@ -0,0 +1,199 @@
+package quictracker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// The pcapng format is described in https://tools.ietf.org/html/draft-tuexen-opsawg-pcapng
+const (
+	pcapngSectionHeaderBlockType      = 0x0A0D0D0A
+	pcapngInterfaceDescriptionType    = 0x00000001
+	pcapngEnhancedPacketBlockType     = 0x00000006
+	pcapngDecryptionSecretsBlockType  = 0x0000000A
+	pcapngByteOrderMagic              = 0x1A2B3C4D
+	pcapngTLSKeyLogSecretsType        = 0x544c534b
+	pcapngLinkTypeRaw                 = 101
+	pcapngOptionEnd                   = 0
+	pcapngOptionUserApplication       = 4
+	pcapngOptionTimestampResolution   = 9
+	pcapngTimestampResolutionMicrosec = 6
+)
+
+// A PcapngCapture records the UDP datagrams exchanged by a Connection, without relying on external tools. As the
+// payloads are captured from the socket, the IP and UDP headers are reconstructed when producing the capture.
+type PcapngCapture struct {
+	lock      sync.Mutex
+	datagrams []CapturedDatagram
+	keyLog    []byte
+	stopped   bool
+}
+
+// StartPcapngCapture hooks a capture to the given connection. The secrets logged by the connection are embedded in
+// the capture, so that it can be decrypted without additional files.
+func StartPcapngCapture(conn *Connection) *PcapngCapture {
+	c := new(PcapngCapture)
+	c.Attach(conn)
+	return c
+}
+
+// Attach adds the datagrams and secrets of another connection to the capture.
+func (c *PcapngCapture) Attach(conn *Connection) {
+	conn.ReceivedDatagramHandler = c.add
+	conn.SentDatagramHandler = c.add
+	conn.KeyLogHandler = func(line []byte) {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.keyLog = append(c.keyLog, line...)
+	}
+}
+
+func (c *PcapngCapture) add(payload []byte, source, destination net.Addr) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	src, srcOk := source.(*net.UDPAddr)
+	dst, dstOk := destination.(*net.UDPAddr)
+	if c.stopped || !srcOk || !dstOk {
+		return
+	}
+	d := CapturedDatagram{time.Now(), src, dst, make([]byte, len(payload))}
+	copy(d.Payload, payload)
+	c.datagrams = append(c.datagrams, d)
+}
+
+// Stop ends the capture and returns its content in the pcapng format.
+func (c *PcapngCapture) Stop() []byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stopped = true
+
+	buffer := new(bytes.Buffer)
+
+	shb := new(bytes.Buffer)
+	binary.Write(shb, binary.LittleEndian, uint32(pcapngByteOrderMagic))
+	binary.Write(shb, binary.LittleEndian, uint16(1))
+	binary.Write(shb, binary.LittleEndian, uint16(0))
+	binary.Write(shb, binary.LittleEndian, int64(-1)) // The section length is not specified
+	writePcapngOption(shb, pcapngOptionUserApplication, []byte("QUIC-Tracker"))
+	writePcapngOption(shb, pcapngOptionEnd, nil)
+	writePcapngBlock(buffer, pcapngSectionHeaderBlockType, shb.Bytes())
+
+	idb := new(bytes.Buffer)
+	binary.Write(idb, binary.LittleEndian, uint16(pcapngLinkTypeRaw))
+	binary.Write(idb, binary.LittleEndian, uint16(0))
+	binary.Write(idb, binary.LittleEndian, uint32(0))
+	writePcapngOption(idb, pcapngOptionTimestampResolution, []byte{pcapngTimestampResolutionMicrosec})
+	writePcapngOption(idb, pcapngOptionEnd, nil)
+	writePcapngBlock(buffer, pcapngInterfaceDescriptionType, idb.Bytes())
+
+	if len(c.keyLog) > 0 {
+		dsb := new(bytes.Buffer)
+		binary.Write(dsb, binary.LittleEndian, uint32(pcapngTLSKeyLogSecretsType))
+		binary.Write(dsb, binary.LittleEndian, uint32(len(c.keyLog)))
+		dsb.Write(c.keyLog)
+		padPcapng(dsb)
+		writePcapngBlock(buffer, pcapngDecryptionSecretsBlockType, dsb.Bytes())
+	}
+
+	for _, d := range c.datagrams {
+		packet := encapsulateUDP(d.Payload, d.Source, d.Destination)
+		timestamp := uint64(d.Timestamp.UnixNano() / int64(time.Microsecond))
+		epb := new(bytes.Buffer)
+		binary.Write(epb, binary.LittleEndian, uint32(0))
+		binary.Write(epb, binary.LittleEndian, uint32(timestamp>>32))
+		binary.Write(epb, binary.LittleEndian, uint32(timestamp))
+		binary.Write(epb, binary.LittleEndian, uint32(len(packet)))
+		binary.Write(epb, binary.LittleEndian, uint32(len(packet)))
+		epb.Write(packet)
+		padPcapng(epb)
+		writePcapngBlock(buffer, pcapngEnhancedPacketBlockType, epb.Bytes())
+	}
+
+	return buffer.Bytes()
+}
+
+func writePcapngBlock(buffer *bytes.Buffer, blockType uint32, body []byte) {
+	length := uint32(12 + len(body))
+	binary.Write(buffer, binary.LittleEndian, blockType)
+	binary.Write(buffer, binary.LittleEndian, length)
+	buffer.Write(body)
+	binary.Write(buffer, binary.LittleEndian, length)
+}
+
+func writePcapngOption(buffer *bytes.Buffer, code uint16, value []byte) {
+	binary.Write(buffer, binary.LittleEndian, code)
+	binary.Write(buffer, binary.LittleEndian, uint16(len(value)))
+	buffer.Write(value)
+	padPcapng(buffer)
+}
+
+func padPcapng(buffer *bytes.Buffer) {
+	for buffer.Len()%4 != 0 {
+		buffer.WriteByte(0)
+	}
+}
+
+// Builds the IP packet carrying the given UDP payload, as it would have been seen on the wire.
+func encapsulateUDP(payload []byte, source, destination *net.UDPAddr) []byte {
+	udp := new(bytes.Buffer)
+	binary.Write(udp, binary.BigEndian, uint16(source.Port))
+	binary.Write(udp, binary.BigEndian, uint16(destination.Port))
+	binary.Write(udp, binary.BigEndian, uint16(8+len(payload)))
+	binary.Write(udp, binary.BigEndian, uint16(0))
+	udp.Write(payload)
+	segment := udp.Bytes()
+
+	ip := new(bytes.Buffer)
+	pseudoHeader := new(bytes.Buffer)
+	if src, dst := source.IP.To4(), destination.IP.To4(); src != nil && dst != nil {
+		binary.Write(ip, binary.BigEndian, uint16(0x4500))
+		binary.Write(ip, binary.BigEndian, uint16(20+len(segment)))
+		binary.Write(ip, binary.BigEndian, uint32(0x00004000)) // Don't fragment
+		ip.Write([]byte{64, 17, 0, 0})
+		ip.Write(src)
+		ip.Write(dst)
+		header := ip.Bytes()
+		binary.BigEndian.PutUint16(header[10:], internetChecksum(header))
+
+		pseudoHeader.Write(src)
+		pseudoHeader.Write(dst)
+		binary.Write(pseudoHeader, binary.BigEndian, uint16(17))
+		binary.Write(pseudoHeader, binary.BigEndian, uint16(len(segment)))
+	} else {
+		binary.Write(ip, binary.BigEndian, uint32(0x60000000))
+		binary.Write(ip, binary.BigEndian, uint16(len(segment)))
+		ip.Write([]byte{17, 64})
+		ip.Write(source.IP.To16())
+		ip.Write(destination.IP.To16())
+
+		pseudoHeader.Write(source.IP.To16())
+		pseudoHeader.Write(destination.IP.To16())
+		binary.Write(pseudoHeader, binary.BigEndian, uint32(len(segment)))
+		binary.Write(pseudoHeader, binary.BigEndian, uint32(17))
+	}
+	pseudoHeader.Write(segment)
+	checksum := internetChecksum(pseudoHeader.Bytes())
+	if checksum == 0 {
+		checksum = 0xffff
+	}
+	binary.BigEndian.PutUint16(segment[6:], checksum)
+
+	return append(ip.Bytes(), segment...)
+}
+
+func internetChecksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,91 @@
+package quictracker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPcapngCapture_Stop(t *testing.T) {
+	client := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51000}
+	server := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}
+	c := new(PcapngCapture)
+	c.add([]byte{0xc0, 1, 2, 3}, client, &net.UDPAddr{IP: net.ParseIP("192.0.2.2"), Port: 443})
+	c.add([]byte{0x40, 1, 2}, server, &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 51000})
+	c.keyLog = []byte(KeyLogLine(KeyLogClientTrafficSecret0, []byte{1}, []byte{2}))
+	content := c.Stop()
+
+	var types []uint32
+	for len(content) > 0 {
+		blockType := binary.LittleEndian.Uint32(content)
+		length := binary.LittleEndian.Uint32(content[4:])
+		if length%4 != 0 || int(length) > len(content) || binary.LittleEndian.Uint32(content[length-4:]) != length {
+			t.Fatal("Malformed block of type", blockType)
+		}
+		if blockType == pcapngEnhancedPacketBlockType {
+			packet := content[28 : 28+binary.LittleEndian.Uint32(content[20:])]
+			var pseudoHeader []byte
+			var segment []byte
+			if packet[0]>>4 == 4 {
+				if internetChecksum(packet[:20]) != 0 {
+					t.Error("Wrong IPv4 header checksum")
+				}
+				segment = packet[20:]
+				pseudoHeader = append(append(append([]byte{}, packet[12:20]...), 0, 17), segment[4:6]...)
+			} else {
+				segment = packet[40:]
+				pseudoHeader = append(append([]byte{}, packet[8:40]...), 0, 0, segment[4], segment[5], 0, 0, 0, 17)
+			}
+			if internetChecksum(append(pseudoHeader, segment...)) != 0 {
+				t.Error("Wrong UDP checksum")
+			}
+		}
+		types = append(types, blockType)
+		content = content[length:]
+	}
+
+	expected := []uint32{pcapngSectionHeaderBlockType, pcapngInterfaceDescriptionType, pcapngDecryptionSecretsBlockType, pcapngEnhancedPacketBlockType, pcapngEnhancedPacketBlockType}
+	if !bytes.Equal(blockTypesBytes(types), blockTypesBytes(expected)) {
+		t.Error("Expected blocks", expected, "got", types)
+	}
+}
+
+func blockTypesBytes(types []uint32) []byte {
+	buffer := new(bytes.Buffer)
+	binary.Write(buffer, binary.BigEndian, types)
+	return buffer.Bytes()
+}
+
+func TestReadCapture(t *testing.T) {
+	client := &net.UDPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 51000}
+	server := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}
+	c := new(PcapngCapture)
+	c.add([]byte{0xc0, 1, 2, 3}, client, &net.UDPAddr{IP: net.ParseIP("192.0.2.2").To4(), Port: 443})
+	c.add([]byte{0x40, 1, 2}, server, &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 51000})
+	keyLogLine := KeyLogLine(KeyLogClientTrafficSecret0, []byte{1}, []byte{2})
+	c.keyLog = []byte(keyLogLine)
+
+	datagrams, keyLog, err := ReadCapture(bytes.NewReader(c.Stop()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(keyLog) != keyLogLine {
+		t.Errorf("Expected key log %q, got %q", keyLogLine, keyLog)
+	}
+	if len(datagrams) != 2 {
+		t.Fatal("Expected 2 datagrams, got", len(datagrams))
+	}
+	for i, d := range datagrams {
+		if !udpAddrEqual(d.Source, c.datagrams[i].Source) || !udpAddrEqual(d.Destination, c.datagrams[i].Destination) || !bytes.Equal(d.Payload, c.datagrams[i].Payload) {
+			t.Errorf("Datagram %d differs: %v -> %v %x", i, d.Source, d.Destination, d.Payload)
+		}
+		if d.Timestamp.Sub(c.datagrams[i].Timestamp) > time.Microsecond || c.datagrams[i].Timestamp.Sub(d.Timestamp) > time.Microsecond {
+			t.Errorf("Datagram %d has timestamp %s instead of %s", i, d.Timestamp, c.datagrams[i].Timestamp)
+		}
+	}
+	if secrets := ParseKeyLog(keyLog).Secrets([]byte{1}); !bytes.Equal(secrets[KeyLogClientTrafficSecret0], []byte{2}) {
+		t.Error("Could not parse the key log, got", secrets)
+	}
+}
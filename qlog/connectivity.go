@@ -0,0 +1,15 @@
+package qlog
+
+type ConnectionIDUpdated struct {
+	Owner string `json:"owner"` // The endpoint that chose the connection ID, local or remote
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new"`
+}
+
+type ConnectionClosed struct {
+	Owner           string  `json:"owner"` // The endpoint that closed the connection, local or remote
+	ConnectionCode  *uint64 `json:"connection_code,omitempty"`
+	ApplicationCode *uint64 `json:"application_code,omitempty"`
+	Reason          string  `json:"reason,omitempty"`
+	Trigger         string  `json:"trigger,omitempty"`
+}
@@ -6,7 +6,7 @@ type PingFrame struct {
 
 type AckFrame struct {
 	FrameType   string     `json:"frame_type"`
-	ACKDelay    uint64     `json:"ack_delay,string"`
+	ACKDelay    uint64     `json:"ack_delay"`
 	ACKedRanges [][]uint64 `json:"acked_ranges"`
 
 	ECT1 uint64 `json:"ect1,omitempty"`
@@ -16,90 +16,93 @@ type AckFrame struct {
 
 type StreamFrame struct {
 	FrameType string `json:"frame_type"`
-	StreamID  uint64 `json:"stream_id,string"`
-	Offset    uint64 `json:"offset,string"`
-	Length    uint64 `json:"length,string"`
+	StreamID  uint64 `json:"stream_id"`
+	Offset    uint64 `json:"offset"`
+	Length    uint64 `json:"length"`
 	Fin       bool   `json:"fin,omitempty"`
 }
 
 type ResetStreamFrame struct {
-	FrameType   string `json:"frame_type"`
-	StreamID    uint64 `json:"stream_id,string"`
-	ErrorCode   uint64 `json:"error_code,string"`
-	FinalOffset uint64 `json:"final_offset,string"`
+	FrameType string `json:"frame_type"`
+	StreamID  uint64 `json:"stream_id"`
+	ErrorCode uint64 `json:"error_code"`
+	FinalSize uint64 `json:"final_size"`
 }
 
 type StopSendingFrame struct {
 	FrameType string `json:"frame_type"`
-	StreamID  uint64 `json:"stream_id,string"`
-	ErrorCode uint64 `json:"error_code,string"`
+	StreamID  uint64 `json:"stream_id"`
+	ErrorCode uint64 `json:"error_code"`
 }
 
 type CryptoFrame struct {
 	FrameType string `json:"frame_type"`
-	Offset    uint64 `json:"offset,string"`
-	Length    uint64 `json:"length,string"`
+	Offset    uint64 `json:"offset"`
+	Length    uint64 `json:"length"`
+}
+
+type Token struct {
+	Raw RawInfo `json:"raw"`
 }
 
 type NewTokenFrame struct {
 	FrameType string `json:"frame_type"`
-	Length    uint64 `json:"length,string"`
-	Token     string `json:"token"`
+	Token     Token  `json:"token"`
 }
 
 type ConnectionCloseFrame struct {
 	FrameType  string `json:"frame_type"`
 	ErrorSpace string `json:"error_space"`
-	ErrorCode  uint64 `json:"error_code,string"`
+	ErrorCode  uint64 `json:"error_code"`
 	Reason     string `json:"reason"`
 }
 
 type MaxDataFrame struct {
 	FrameType string `json:"frame_type"`
-	Maximum   uint64 `json:"maximum,string"`
+	Maximum   uint64 `json:"maximum"`
 }
 
 type MaxStreamDataFrame struct {
 	FrameType string `json:"frame_type"`
-	StreamID  uint64 `json:"stream_id,string"`
-	Maximum   uint64 `json:"maximum,string"`
+	StreamID  uint64 `json:"stream_id"`
+	Maximum   uint64 `json:"maximum"`
 }
 
 type MaxStreamsFrame struct {
 	FrameType  string `json:"frame_type"`
 	StreamType `json:"stream_type"`
-	Maximum    uint64 `json:"maximum,string"`
+	Maximum    uint64 `json:"maximum"`
 }
 
 type DataBlockedFrame struct {
 	FrameType string `json:"frame_type"`
-	Limit     uint64 `json:"limit,string"`
+	Limit     uint64 `json:"limit"`
 }
 
 type StreamDataBlockedFrame struct {
 	FrameType string `json:"frame_type"`
-	StreamID  uint64 `json:"stream_id,string"`
-	Limit     uint64 `json:"limit,string"`
+	StreamID  uint64 `json:"stream_id"`
+	Limit     uint64 `json:"limit"`
 }
 
 type StreamsBlockedFrame struct {
 	FrameType  string `json:"frame_type"`
 	StreamType `json:"stream_type"`
-	Limit      uint64 `json:"limit,string"`
+	Limit      uint64 `json:"limit"`
 }
 
 type NewConnectionIDFrame struct {
-	FrameType      string `json:"frame_type"`
-	SequenceNumber uint64 `json:"sequence_number,string"`
-	RetirePriorTo  uint64 `json:"retire_prior_to,string"`
-	Length         uint8  `json:"length"`
-	ConnectionID   string `json:"connection_id"`
-	ResetToken     string `json:"reset_token"`
+	FrameType          string `json:"frame_type"`
+	SequenceNumber     uint64 `json:"sequence_number"`
+	RetirePriorTo      uint64 `json:"retire_prior_to"`
+	ConnectionIDLength uint8  `json:"connection_id_length"`
+	ConnectionID       string `json:"connection_id"`
+	ResetToken         string `json:"stateless_reset_token"`
 }
 
 type RetireConnectionIDFrame struct {
 	FrameType      string `json:"frame_type"`
-	SequenceNumber uint64 `json:"sequence_number,string"`
+	SequenceNumber uint64 `json:"sequence_number"`
 }
 
 type PathChallengeFrame struct {
@@ -118,5 +121,157 @@ type HandshakeDoneFrame struct {
 
 type UnknownFrame struct {
 	FrameType    string `json:"frame_type"`
-	RawFrameType uint64 `json:"raw_frame_type,string"`
+	RawFrameType uint64 `json:"raw_frame_type"`
+}
+
+// The frames whose layout differs in the legacy format implement LegacyData. Its numbers are written as strings.
+
+func (f *AckFrame) LegacyData() interface{} {
+	return struct {
+		FrameType   string     `json:"frame_type"`
+		ACKDelay    uint64     `json:"ack_delay,string"`
+		ACKedRanges [][]uint64 `json:"acked_ranges"`
+
+		ECT1 uint64 `json:"ect1,omitempty"`
+		ECT0 uint64 `json:"ect0,omitempty"`
+		CE   uint64 `json:"ce,omitempty"`
+	}{f.FrameType, f.ACKDelay, f.ACKedRanges, f.ECT1, f.ECT0, f.CE}
+}
+
+func (f *StreamFrame) LegacyData() interface{} {
+	return struct {
+		FrameType string `json:"frame_type"`
+		StreamID  uint64 `json:"stream_id,string"`
+		Offset    uint64 `json:"offset,string"`
+		Length    uint64 `json:"length,string"`
+		Fin       bool   `json:"fin,omitempty"`
+	}{f.FrameType, f.StreamID, f.Offset, f.Length, f.Fin}
+}
+
+func (f *ResetStreamFrame) LegacyData() interface{} {
+	return struct {
+		FrameType   string `json:"frame_type"`
+		StreamID    uint64 `json:"stream_id,string"`
+		ErrorCode   uint64 `json:"error_code,string"`
+		FinalOffset uint64 `json:"final_offset,string"`
+	}{f.FrameType, f.StreamID, f.ErrorCode, f.FinalSize}
+}
+
+func (f *StopSendingFrame) LegacyData() interface{} {
+	return struct {
+		FrameType string `json:"frame_type"`
+		StreamID  uint64 `json:"stream_id,string"`
+		ErrorCode uint64 `json:"error_code,string"`
+	}{f.FrameType, f.StreamID, f.ErrorCode}
+}
+
+func (f *CryptoFrame) LegacyData() interface{} {
+	return struct {
+		FrameType string `json:"frame_type"`
+		Offset    uint64 `json:"offset,string"`
+		Length    uint64 `json:"length,string"`
+	}{f.FrameType, f.Offset, f.Length}
+}
+
+func (f *NewTokenFrame) LegacyData() interface{} {
+	return struct {
+		FrameType string `json:"frame_type"`
+		Length    uint64 `json:"length,string"`
+		Token     string `json:"token"`
+	}{f.FrameType, uint64(f.Token.Raw.Length), f.Token.Raw.Data}
+}
+
+func (f *ConnectionCloseFrame) LegacyData() interface{} {
+	return struct {
+		FrameType  string `json:"frame_type"`
+		ErrorSpace string `json:"error_space"`
+		ErrorCode  uint64 `json:"error_code,string"`
+		Reason     string `json:"reason"`
+	}{f.FrameType, f.ErrorSpace, f.ErrorCode, f.Reason}
+}
+
+func (f *MaxDataFrame) LegacyData() interface{} {
+	return struct {
+		FrameType string `json:"frame_type"`
+		Maximum   uint64 `json:"maximum,string"`
+	}{f.FrameType, f.Maximum}
+}
+
+func (f *MaxStreamDataFrame) LegacyData() interface{} {
+	return struct {
+		FrameType string `json:"frame_type"`
+		StreamID  uint64 `json:"stream_id,string"`
+		Maximum   uint64 `json:"maximum,string"`
+	}{f.FrameType, f.StreamID, f.Maximum}
+}
+
+func (f *MaxStreamsFrame) LegacyData() interface{} {
+	return struct {
+		FrameType  string     `json:"frame_type"`
+		StreamType StreamType `json:"stream_type"`
+		Maximum    uint64     `json:"maximum,string"`
+	}{f.FrameType, f.StreamType, f.Maximum}
+}
+
+func (f *DataBlockedFrame) LegacyData() interface{} {
+	return struct {
+		FrameType string `json:"frame_type"`
+		Limit     uint64 `json:"limit,string"`
+	}{f.FrameType, f.Limit}
+}
+
+func (f *StreamDataBlockedFrame) LegacyData() interface{} {
+	return struct {
+		FrameType string `json:"frame_type"`
+		StreamID  uint64 `json:"stream_id,string"`
+		Limit     uint64 `json:"limit,string"`
+	}{f.FrameType, f.StreamID, f.Limit}
+}
+
+func (f *StreamsBlockedFrame) LegacyData() interface{} {
+	return struct {
+		FrameType  string     `json:"frame_type"`
+		StreamType StreamType `json:"stream_type"`
+		Limit      uint64     `json:"limit,string"`
+	}{f.FrameType, f.StreamType, f.Limit}
+}
+
+func (f *NewConnectionIDFrame) LegacyData() interface{} {
+	return struct {
+		FrameType      string `json:"frame_type"`
+		SequenceNumber uint64 `json:"sequence_number,string"`
+		RetirePriorTo  uint64 `json:"retire_prior_to,string"`
+		Length         uint8  `json:"length"`
+		ConnectionID   string `json:"connection_id"`
+		ResetToken     string `json:"reset_token"`
+	}{f.FrameType, f.SequenceNumber, f.RetirePriorTo, f.ConnectionIDLength, f.ConnectionID, f.ResetToken}
+}
+
+func (f *RetireConnectionIDFrame) LegacyData() interface{} {
+	return struct {
+		FrameType      string `json:"frame_type"`
+		SequenceNumber uint64 `json:"sequence_number,string"`
+	}{f.FrameType, f.SequenceNumber}
+}
+
+func (f *UnknownFrame) LegacyData() interface{} {
+	return struct {
+		FrameType    string `json:"frame_type"`
+		RawFrameType uint64 `json:"raw_frame_type,string"`
+	}{f.FrameType, f.RawFrameType}
+}
+
+// legacyFrames returns the frames in their layout of the legacy format.
+func legacyFrames(frames []interface{}) []interface{} {
+	if frames == nil {
+		return nil
+	}
+	legacy := make([]interface{}, len(frames))
+	for i, f := range frames {
+		if l, ok := f.(LegacyData); ok {
+			f = l.LegacyData()
+		}
+		legacy[i] = f
+	}
+	return legacy
 }
@@ -0,0 +1,64 @@
+package qlog
+
+// The types of the HTTP/3 and QPACK unidirectional streams reported in stream_type_set events.
+const (
+	H3StreamTypeControl      = "control"
+	H3StreamTypePush         = "push"
+	H3StreamTypeRequest      = "request"
+	H3StreamTypeQPACKEncoder = "qpack_encode"
+	H3StreamTypeQPACKDecoder = "qpack_decode"
+	H3StreamTypeUnknown      = "unknown"
+)
+
+type H3Setting struct {
+	Name  uint64 `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+type H3HTTPField struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+type H3Frame struct {
+	FrameType string `json:"frame_type"` // e.g. data, headers, settings or reserved
+
+	Headers  []H3HTTPField `json:"headers,omitempty"`
+	Settings []H3Setting   `json:"settings,omitempty"`
+
+	PushID   *uint64 `json:"push_id,omitempty"`
+	StreamID *uint64 `json:"stream_id,omitempty"` // The last stream ID of a GOAWAY frame
+
+	PrioritizedElementID *uint64 `json:"prioritized_element_id,omitempty"`
+	ElementDependencyID  *uint64 `json:"element_dependency_id,omitempty"`
+	Weight               *uint8  `json:"weight,omitempty"`
+	Exclusive            bool    `json:"exclusive,omitempty"`
+
+	UnknownFrameType *uint64 `json:"unknown_frame_type_value,omitempty"`
+}
+
+type H3FrameCreated struct {
+	StreamID uint64  `json:"stream_id"`
+	Length   uint64  `json:"length"` // The length of the frame payload
+	Frame    H3Frame `json:"frame"`
+	Raw      RawInfo `json:"raw"`
+}
+
+type H3FrameParsed H3FrameCreated
+
+type H3ParametersSet struct {
+	Owner string `json:"owner"` // The endpoint that sent the SETTINGS frame, local or remote
+
+	MaxHeaderListSize   *uint64 `json:"max_field_section_size,omitempty"`
+	MaxTableCapacity    *uint64 `json:"max_table_capacity,omitempty"`
+	BlockedStreamsCount *uint64 `json:"blocked_streams_count,omitempty"`
+
+	Unknown []H3Setting `json:"unknown,omitempty"` // The settings that QUIC-Tracker does not interpret
+}
+
+type H3StreamTypeSet struct {
+	Owner       string  `json:"owner,omitempty"` // The endpoint that opened the stream, local or remote
+	StreamID    uint64  `json:"stream_id"`
+	StreamType  string  `json:"stream_type"`
+	UnknownType *uint64 `json:"stream_type_value,omitempty"`
+}
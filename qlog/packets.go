@@ -1,5 +1,7 @@
 package qlog
 
+import "strconv"
+
 type PacketTrigger string
 
 const (
@@ -11,6 +13,32 @@ const (
 )
 
 type PacketHeader struct {
+	PacketType   string  `json:"packet_type"`
+	PacketNumber *uint64 `json:"packet_number,omitempty"` // Absent for packets without a packet number
+
+	Version string `json:"version,omitempty"`
+	SCIL    int    `json:"scil,omitempty"`
+	DCIL    int    `json:"dcil,omitempty"`
+	SCID    string `json:"scid,omitempty"`
+	DCID    string `json:"dcid,omitempty"`
+}
+
+type RawInfo struct {
+	Length        int    `json:"length,omitempty"`
+	PayloadLength int    `json:"payload_length,omitempty"`
+	Data          string `json:"data,omitempty"`
+}
+
+type Packet struct {
+	Header PacketHeader  `json:"header"`
+	Raw    RawInfo       `json:"raw"`
+	Frames []interface{} `json:"frames,omitempty"`
+
+	IsCoalesced bool   `json:"is_coalesced,omitempty"`
+	Trigger     string `json:"trigger,omitempty"`
+}
+
+type legacyPacketHeader struct {
 	PacketNumber  uint64 `json:"packet_number,string"`
 	PacketSize    int    `json:"packet_size,omitempty"`
 	PayloadLength int    `json:"payload_length,omitempty"`
@@ -22,23 +50,56 @@ type PacketHeader struct {
 	DCID    string `json:"dcid,omitempty"`
 }
 
-type Packet struct {
-	PacketType string        `json:"packet_type"`
-	Header     PacketHeader  `json:"header"`
-	Frames     []interface{} `json:"frames,omitempty"`
+func (h *PacketHeader) legacy() legacyPacketHeader {
+	l := legacyPacketHeader{Version: h.Version, SCID: h.SCID, DCID: h.DCID}
+	if h.PacketNumber != nil {
+		l.PacketNumber = *h.PacketNumber
+	}
+	if h.SCIL > 0 || h.SCID != "" {
+		l.SCIL = strconv.Itoa(h.SCIL)
+	}
+	if h.DCIL > 0 || h.DCID != "" {
+		l.DCIL = strconv.Itoa(h.DCIL)
+	}
+	return l
+}
 
-	IsCoalesced bool   `json:"is_coalesced,omitempty"`
-	Trigger     string `json:"trigger,omitempty"`
+func (p *Packet) LegacyData() interface{} {
+	header := p.Header.legacy()
+	header.PacketSize = p.Raw.Length
+	header.PayloadLength = p.Raw.PayloadLength
+	return struct {
+		PacketType  string             `json:"packet_type"`
+		Header      legacyPacketHeader `json:"header"`
+		Frames      []interface{}      `json:"frames,omitempty"`
+		IsCoalesced bool               `json:"is_coalesced,omitempty"`
+		Trigger     string             `json:"trigger,omitempty"`
+	}{p.Header.PacketType, header, legacyFrames(p.Frames), p.IsCoalesced, p.Trigger}
 }
 
 type PacketLost struct {
-	PacketType   string        `json:"packet_type"`
-	PacketNumber uint64        `json:"packet_number,string"`
-	Frames       []interface{} `json:"frames"`
-	Trigger      string        `json:"trigger"`
+	Header  PacketHeader  `json:"header"`
+	Frames  []interface{} `json:"frames"`
+	Trigger string        `json:"trigger"`
+}
+
+func (p *PacketLost) LegacyData() interface{} {
+	return struct {
+		PacketType   string        `json:"packet_type"`
+		PacketNumber uint64        `json:"packet_number,string"`
+		Frames       []interface{} `json:"frames"`
+		Trigger      string        `json:"trigger"`
+	}{p.Header.PacketType, p.Header.legacy().PacketNumber, legacyFrames(p.Frames), p.Trigger}
 }
 
 type PacketBuffered struct {
-	PacketType string `json:"packet_type"`
-	Trigger    string `json:"trigger"`
+	Header  PacketHeader `json:"header"`
+	Trigger string       `json:"trigger"`
+}
+
+func (p *PacketBuffered) LegacyData() interface{} {
+	return struct {
+		PacketType string `json:"packet_type"`
+		Trigger    string `json:"trigger"`
+	}{p.Header.PacketType, p.Trigger}
 }
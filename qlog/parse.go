@@ -0,0 +1,465 @@
+package qlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The categories of the events of the modern schema, indexed by their names, e.g. quic:packet_sent.
+var eventCategories = func() map[string]string {
+	m := make(map[string]string)
+	v := reflect.ValueOf(Categories)
+	for i := 0; i < v.NumField(); i++ {
+		group := v.Field(i)
+		category := group.Field(0).String()
+		for j := 1; j < group.NumField(); j++ {
+			e := Event{Category: category, Event: group.Field(j).String()}
+			m[e.Name()] = category
+		}
+	}
+	return m
+}()
+
+// The namespaces used by previous versions of the schema and of the legacy format that differ from the categories.
+var legacyNamespaces = map[string]string{
+	"http": Categories.H3.Category,
+}
+
+// The types the event data are decoded into, indexed by category and event.
+var eventDataTypes = func() map[string]func() interface{} {
+	t, r, c, s, h, q := Categories.Transport, Categories.Recovery, Categories.Connectivity, Categories.Security, Categories.H3, Categories.QPACK
+	return map[string]func() interface{}{
+		t.Category + ":" + t.PacketSent:          func() interface{} { return new(Packet) },
+		t.Category + ":" + t.PacketReceived:      func() interface{} { return new(Packet) },
+		t.Category + ":" + t.PacketDropped:       func() interface{} { return new(Packet) },
+		t.Category + ":" + t.PacketBuffered:      func() interface{} { return new(PacketBuffered) },
+		t.Category + ":" + t.StreamStateUpdated:  func() interface{} { return new(StreamStateUpdated) },
+		t.Category + ":" + t.ParametersSet:       func() interface{} { return new(ParametersSet) },
+		t.Category + ":" + t.FlowControlUpdated:  func() interface{} { return new(FlowControlUpdated) },
+		r.Category + ":" + r.MetricsUpdated:      func() interface{} { return new(MetricUpdate) },
+		r.Category + ":" + r.PacketLost:          func() interface{} { return new(PacketLost) },
+		c.Category + ":" + c.ConnectionIDUpdated: func() interface{} { return new(ConnectionIDUpdated) },
+		c.Category + ":" + c.ConnectionClosed:    func() interface{} { return new(ConnectionClosed) },
+		s.Category + ":" + s.KeyUpdated:          func() interface{} { return new(KeyUpdated) },
+		s.Category + ":" + s.KeyDiscarded:        func() interface{} { return new(KeyDiscarded) },
+		h.Category + ":" + h.ParametersSet:       func() interface{} { return new(H3ParametersSet) },
+		h.Category + ":" + h.StreamTypeSet:       func() interface{} { return new(H3StreamTypeSet) },
+		h.Category + ":" + h.FrameCreated:        func() interface{} { return new(H3FrameCreated) },
+		h.Category + ":" + h.FrameParsed:         func() interface{} { return new(H3FrameParsed) },
+		q.Category + ":" + q.StateUpdated:        func() interface{} { return new(QPACKStateUpdated) },
+		q.Category + ":" + q.HeadersEncoded:      func() interface{} { return new(QPACKHeadersEncoded) },
+		q.Category + ":" + q.HeadersDecoded:      func() interface{} { return new(QPACKHeadersDecoded) },
+		q.Category + ":" + q.InstructionCreated:  func() interface{} { return new(QPACKInstructionCreated) },
+		q.Category + ":" + q.InstructionParsed:   func() interface{} { return new(QPACKInstructionParsed) },
+	}
+}()
+
+// Parse reads a qlog file in the JSON serialisation of the current schema or of the legacy draft formats, or in the
+// JSON-SEQ serialisation. The data of the events known to QUIC-Tracker are decoded into the types of this package,
+// the others are kept as generic JSON values. An error is returned when the file cannot be read as qlog at all, the
+// other deviations from the schema are reported by Validate.
+func Parse(r io.Reader) (*QLog, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		return nil, errors.New("the qlog file is empty")
+	}
+	if content[0] == recordSeparator {
+		return parseSeq(content)
+	}
+
+	var file struct {
+		Version     string                 `json:"qlog_version"`
+		Format      string                 `json:"qlog_format"`
+		Title       string                 `json:"title"`
+		Description string                 `json:"description"`
+		Summary     map[string]interface{} `json:"summary"`
+		Traces      []json.RawMessage      `json:"traces"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+	q := &QLog{Title: file.Title, Description: file.Description, Summary: file.Summary, Version: file.Version, Legacy: isLegacyVersion(file.Version)}
+	q.checkVersion(file.Format, "JSON")
+	if file.Traces == nil {
+		q.addIssue(-1, -1, "traces is missing")
+	}
+	for _, raw := range file.Traces {
+		q.parseTrace(raw)
+	}
+	return q, nil
+}
+
+func parseSeq(content []byte) (*QLog, error) {
+	records := bytes.Split(content, []byte{recordSeparator})
+	var header struct {
+		Version     string          `json:"qlog_version"`
+		Format      string          `json:"qlog_format"`
+		Title       string          `json:"title"`
+		Description string          `json:"description"`
+		Trace       json.RawMessage `json:"trace"`
+	}
+	if err := json.Unmarshal(records[1], &header); err != nil {
+		return nil, err
+	}
+	q := &QLog{Title: header.Title, Description: header.Description, Version: header.Version, Legacy: isLegacyVersion(header.Version)}
+	q.checkVersion(header.Format, "JSON-SEQ")
+	if header.Trace == nil {
+		q.addIssue(-1, -1, "trace is missing from the header of the sequence")
+		header.Trace = json.RawMessage("{}")
+	}
+	var events []json.RawMessage
+	for _, record := range records[2:] {
+		if record = bytes.TrimSpace(record); len(record) > 0 {
+			events = append(events, record)
+		}
+	}
+	t := q.parseTrace(header.Trace)
+	if t != nil {
+		q.parseEvents(len(q.Traces)-1, t, events, nil)
+	}
+	return q, nil
+}
+
+func isLegacyVersion(version string) bool {
+	return strings.HasPrefix(version, "draft-")
+}
+
+// The versions of the schema that Parse understands.
+var knownVersions = map[string]bool{
+	LegacyVersion: true,
+	"draft-00":    true,
+	"draft-02":    true,
+	"0.3":         true,
+	Version:       true,
+}
+
+func (q *QLog) checkVersion(format, expectedFormat string) {
+	if q.Version == "" {
+		q.addIssue(-1, -1, "qlog_version is missing")
+	} else if !knownVersions[q.Version] {
+		q.addIssue(-1, -1, fmt.Sprintf("unknown qlog_version %q", q.Version))
+	}
+	if format != "" && format != expectedFormat {
+		q.addIssue(-1, -1, fmt.Sprintf("qlog_format is %q in a %s file", format, expectedFormat))
+	}
+}
+
+func (q *QLog) addIssue(trace, event int, message string) {
+	q.issues = append(q.issues, ValidationError{trace, event, message})
+}
+
+// The layout of a trace in every format. The events are parsed separately.
+type parsedTrace struct {
+	VantagePoint     *VantagePoint          `json:"vantage_point"`
+	Title            string                 `json:"title"`
+	Description      string                 `json:"description"`
+	CommonFields     map[string]interface{} `json:"common_fields"`
+	Configuration    map[string]interface{} `json:"configuration"`
+	EventFields      []string               `json:"event_fields"`
+	Events           []json.RawMessage      `json:"events"`
+	ErrorDescription string                 `json:"error_description"`
+}
+
+// parseTrace adds the trace to the qlog. The events contained in the trace are parsed as well.
+func (q *QLog) parseTrace(raw json.RawMessage) *parsedTrace {
+	index := len(q.Traces)
+	var p parsedTrace
+	if err := json.Unmarshal(raw, &p); err != nil {
+		q.addIssue(index, -1, "invalid trace: "+err.Error())
+		return nil
+	}
+	if p.ErrorDescription != "" && p.Events == nil {
+		q.addIssue(index, -1, "the trace could not be produced: "+p.ErrorDescription)
+		return nil
+	}
+	t := &Trace{Title: p.Title, Description: p.Description, CommonFields: p.CommonFields}
+	if p.VantagePoint != nil {
+		t.VantagePoint = *p.VantagePoint
+	} else {
+		q.addIssue(index, -1, "vantage_point is missing")
+	}
+	if t.CommonFields == nil {
+		t.CommonFields = make(map[string]interface{})
+	}
+	q.Traces = append(q.Traces, t)
+	if p.Events != nil {
+		q.parseEvents(index, &p, p.Events, p.EventFields)
+	}
+	return &p
+}
+
+// A clock converts the times of the events of a trace to times relative to its reference time.
+type clock struct {
+	unit      float64 // The duration of a unit of time, in TimeUnits
+	reference float64 // The reference time, in units
+	offset    float64 // The offset added to the times of the legacy format, in units
+	format    string  // absolute, relative or delta
+	last      float64 // The time of the previous event, in units
+	known     bool    // Whether the reference time is known
+}
+
+func newClock(q *QLog, p *parsedTrace) *clock {
+	c := &clock{unit: float64(time.Millisecond / TimeUnits), format: "absolute"}
+	if q.Legacy {
+		// The kind of times of the legacy format is given by the event fields
+		c.format = "relative"
+		if units, _ := p.Configuration["time_units"].(string); units == TimeUnitsString {
+			c.unit = 1
+		}
+		c.offset, _ = jsonNumber(p.Configuration["time_offset"])
+	}
+	if format, ok := p.CommonFields["time_format"].(string); ok {
+		c.format = format
+	}
+	switch reference := p.CommonFields["reference_time"].(type) {
+	case map[string]interface{}:
+		// The reference time of the main schema indicates an epoch, the times relative to it are absolute
+		if epoch, _ := reference["epoch"].(string); epoch == "" || strings.HasPrefix(epoch, "1970-01-01T00:00:00") {
+			c.format = "absolute"
+		}
+	default:
+		if value, err := jsonNumber(reference); err == nil {
+			c.reference = value
+			c.known = true
+		}
+	}
+	if c.format == "relative_to_epoch" {
+		c.format = "absolute"
+	}
+	delete(p.CommonFields, "time_format")
+	delete(p.CommonFields, "reference_time")
+	delete(p.CommonFields, "protocol_type")
+	return c
+}
+
+// relativeTime converts a time of an event to TimeUnits since the reference time.
+func (c *clock) relativeTime(value float64) uint64 {
+	switch c.format {
+	case "relative":
+		value += c.offset
+	case "delta":
+		value += c.last
+	case "absolute":
+		if !c.known {
+			c.reference = value
+			c.known = true
+		}
+		value -= c.reference
+	}
+	c.last = value
+	if value < 0 {
+		return 0
+	}
+	return uint64(value * c.unit)
+}
+
+func (c *clock) referenceTime() time.Time {
+	if !c.known {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(c.reference*c.unit)*int64(TimeUnits))
+}
+
+func (q *QLog) parseEvents(traceIndex int, p *parsedTrace, events []json.RawMessage, eventFields []string) {
+	t := q.Traces[traceIndex]
+	c := newClock(q, p)
+	if q.Legacy && eventFields == nil {
+		q.addIssue(traceIndex, -1, "event_fields is missing")
+		return
+	}
+	for i, raw := range events {
+		e, err := q.parseEvent(raw, eventFields, c)
+		if e == nil {
+			q.addIssue(traceIndex, i, err.Error())
+			continue
+		}
+		if err != nil {
+			q.addIssue(traceIndex, i, fmt.Sprintf("%s: %s", e.Name(), err.Error()))
+		}
+		t.Add(e)
+	}
+	t.ReferenceTime = c.referenceTime()
+}
+
+// parseEvent returns the event, and an error when it deviates from the schema. The event is nil when it could not
+// be parsed at all.
+func (q *QLog) parseEvent(raw json.RawMessage, eventFields []string, c *clock) (*Event, error) {
+	var timeValue interface{}
+	var name, category, eventType string
+	var data json.RawMessage
+
+	if eventFields != nil {
+		var fields []json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, errors.New("invalid event: " + err.Error())
+		}
+		if len(fields) != len(eventFields) {
+			return nil, fmt.Errorf("the event has %d fields instead of %d", len(fields), len(eventFields))
+		}
+		for i, field := range eventFields {
+			switch field {
+			case "relative_time", "time", "delta_time":
+				json.Unmarshal(fields[i], &timeValue)
+				if field == "delta_time" {
+					c.format = "delta"
+				} else if field == "time" {
+					c.format = "absolute"
+				}
+			case "category":
+				json.Unmarshal(fields[i], &category)
+			case "event", "event_type":
+				json.Unmarshal(fields[i], &eventType)
+			case "data":
+				data = fields[i]
+			}
+		}
+		if n, ok := legacyNamespaces[category]; ok {
+			category = n
+		}
+	} else {
+		var fields struct {
+			Time interface{}     `json:"time"`
+			Name string          `json:"name"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, errors.New("invalid event: " + err.Error())
+		}
+		timeValue, name, data = fields.Time, fields.Name, fields.Data
+		category, eventType = resolveName(name)
+	}
+
+	if category == "" || eventType == "" {
+		return nil, fmt.Errorf("the event has no valid name")
+	}
+	e := &Event{Category: category, Event: eventType}
+	if data == nil {
+		e.Data = map[string]interface{}{}
+		return e, errors.New("data is missing")
+	}
+	var err error
+	e.Data, err = decodeData(category, eventType, data, q.Legacy)
+	value, timeErr := jsonNumber(timeValue)
+	if timeErr != nil {
+		err = errors.New("time is missing or invalid")
+	}
+	e.RelativeTime = c.relativeTime(value)
+	return e, err
+}
+
+// resolveName returns the category and the event type of a name of the modern schema.
+func resolveName(name string) (string, string) {
+	separator := strings.Index(name, ":")
+	if separator < 0 {
+		return "", ""
+	}
+	namespace, eventType := name[:separator], name[separator+1:]
+	if category, ok := eventCategories[name]; ok {
+		return category, eventType
+	}
+	if category, ok := legacyNamespaces[namespace]; ok {
+		namespace = category
+	}
+	// Previous versions of the schema used the categories as namespaces
+	return namespace, eventType
+}
+
+func decodeData(category, eventType string, data json.RawMessage, legacy bool) (interface{}, error) {
+	constructor, ok := eventDataTypes[category+":"+eventType]
+	if legacy && ok {
+		switch constructor().(type) {
+		case *Packet, *PacketLost, *PacketBuffered:
+			return decodeLegacyPacket(category, eventType, data)
+		}
+	}
+	if ok {
+		v := constructor()
+		if err := json.Unmarshal(data, v); err == nil {
+			return v, nil
+		} else if !legacy {
+			var generic interface{}
+			json.Unmarshal(data, &generic)
+			return generic, err
+		}
+	}
+	var generic interface{}
+	return generic, json.Unmarshal(data, &generic)
+}
+
+// A legacyNumber is a number of the legacy format, in which they are often written as strings.
+type legacyNumber float64
+
+func (n *legacyNumber) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	f, err := jsonNumber(v)
+	*n = legacyNumber(f)
+	return err
+}
+
+func decodeLegacyPacket(category, eventType string, data json.RawMessage) (interface{}, error) {
+	var l struct {
+		PacketType   string        `json:"packet_type"`
+		PacketNumber *legacyNumber `json:"packet_number"`
+		Header       struct {
+			PacketNumber  *legacyNumber `json:"packet_number"`
+			PacketSize    legacyNumber  `json:"packet_size"`
+			PayloadLength legacyNumber  `json:"payload_length"`
+			Version       string        `json:"version"`
+			SCIL          legacyNumber  `json:"scil"`
+			DCIL          legacyNumber  `json:"dcil"`
+			SCID          string        `json:"scid"`
+			DCID          string        `json:"dcid"`
+		} `json:"header"`
+		Frames      []interface{} `json:"frames"`
+		IsCoalesced bool          `json:"is_coalesced"`
+		Trigger     string        `json:"trigger"`
+	}
+	if err := json.Unmarshal(data, &l); err != nil {
+		var generic interface{}
+		json.Unmarshal(data, &generic)
+		return generic, err
+	}
+	h := PacketHeader{PacketType: l.PacketType, Version: l.Header.Version, SCIL: int(l.Header.SCIL), DCIL: int(l.Header.DCIL), SCID: l.Header.SCID, DCID: l.Header.DCID}
+	if l.Header.PacketNumber != nil {
+		l.PacketNumber = l.Header.PacketNumber
+	}
+	if l.PacketNumber != nil {
+		pn := uint64(*l.PacketNumber)
+		h.PacketNumber = &pn
+	}
+	switch eventType {
+	case Categories.Recovery.PacketLost:
+		return &PacketLost{Header: h, Frames: l.Frames, Trigger: l.Trigger}, nil
+	case Categories.Transport.PacketBuffered:
+		return &PacketBuffered{Header: h, Trigger: l.Trigger}, nil
+	}
+	return &Packet{Header: h, Raw: RawInfo{Length: int(l.Header.PacketSize), PayloadLength: int(l.Header.PayloadLength)}, Frames: l.Frames, IsCoalesced: l.IsCoalesced, Trigger: l.Trigger}, nil
+}
+
+// jsonNumber returns the value of a number decoded from JSON, possibly written as a string.
+func jsonNumber(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case string:
+		return strconv.ParseFloat(n, 64)
+	case json.Number:
+		return n.Float64()
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
@@ -0,0 +1,119 @@
+package qlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testQLog() *QLog {
+	t := &Trace{VantagePoint: VantagePoint{Name: "test", Type: "client"}, CommonFields: map[string]interface{}{"ODCID": "0102"}}
+	t.ReferenceTime = time.Unix(1600000000, 0)
+	pn := func(n uint64) *uint64 { return &n }
+	t.Add(&Event{0, Categories.Transport.Category, Categories.Transport.PacketSent, &Packet{Header: PacketHeader{PacketType: "initial", PacketNumber: pn(0)}, Raw: RawInfo{Length: 1252}, Frames: []interface{}{&CryptoFrame{"crypto", 0, 300}}}})
+	t.Add(&Event{1500, Categories.Transport.Category, Categories.Transport.PacketSent, &Packet{Header: PacketHeader{PacketType: "initial", PacketNumber: pn(1)}, Raw: RawInfo{Length: 1252}, Frames: []interface{}{&CryptoFrame{"crypto", 0, 300}}}})
+	t.Add(&Event{30000, Categories.Transport.Category, Categories.Transport.PacketReceived, &Packet{Header: PacketHeader{PacketType: "handshake", PacketNumber: pn(0)}, Raw: RawInfo{Length: 1000}}})
+	t.Add(&Event{30001, Categories.Recovery.Category, Categories.Recovery.MetricsUpdated, MetricUpdate{MinRTT: 28.5, SmoothedRTT: 28.5, LatestRTT: 28.5}})
+	t.Add(&Event{30002, Categories.Security.Category, Categories.Security.KeyUpdated, &KeyUpdated{KeyType: KeyTypeClientHandshake, Trigger: "tls"}})
+	return &QLog{Title: "test", Traces: []*Trace{t}}
+}
+
+func checkParsedQLog(t *testing.T, q *QLog, smoothedRTT float64) {
+	if errs := q.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	if len(q.Traces) != 1 || len(q.Traces[0].Events) != 5 {
+		t.Fatalf("unexpected traces: %+v", q.Traces)
+	}
+	trace := q.Traces[0]
+	if !trace.ReferenceTime.Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("unexpected reference time %s", trace.ReferenceTime)
+	}
+	if e := trace.Events[2]; e.RelativeTime != 30000 || e.Name() != "quic:packet_received" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if p, ok := trace.Events[1].Data.(*Packet); !ok || *p.Header.PacketNumber != 1 || len(p.Frames) != 1 {
+		t.Errorf("unexpected packet %+v", trace.Events[1].Data)
+	}
+
+	s := trace.Statistics()
+	if s.PacketsSent["initial"] != 2 || s.PacketsReceived["handshake"] != 1 || s.BytesSent != 2504 || s.Retransmissions != 1 || s.RTTSamples != 1 || s.SmoothedRTT != smoothedRTT || s.Duration != 30.002 {
+		t.Errorf("unexpected statistics %s", s)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		q := testQLog()
+		q.Legacy = legacy
+		content, err := json.Marshal(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame := `{"frame_type":"crypto","offset":0,"length":300}`
+		if legacy {
+			frame = `{"frame_type":"crypto","offset":"0","length":"300"}`
+		}
+		if !strings.Contains(string(content), frame) {
+			t.Errorf("the frames are not in the expected format: %s", content)
+		}
+		parsed, err := Parse(bytes.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Legacy != legacy {
+			t.Errorf("the legacy format was not recognised")
+		}
+		smoothedRTT := 28.5
+		if legacy { // The legacy format has whole milliseconds
+			smoothedRTT = 28
+		}
+		checkParsedQLog(t, parsed, smoothedRTT)
+	}
+}
+
+func TestParseSeq(t *testing.T) {
+	q := testQLog()
+	buffer := new(bytes.Buffer)
+	w, err := NewSeqWriter(buffer, q, q.Traces[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range q.Traces[0].Events {
+		w.WriteEvent(e)
+	}
+	parsed, err := Parse(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkParsedQLog(t, parsed, 28.5)
+}
+
+func TestValidate(t *testing.T) {
+	content := `{"qlog_version": "0.3", "traces": [{"vantage_point": {"type": "server"}, "common_fields": {"reference_time": 1000},
+		"events": [{"time": 1010, "name": "transport:packet_received", "data": {"header": {"packet_type": "initial", "packet_number": 0}}},
+		{"time": 1020, "name": "transport:packet_sent", "data": {"header": {"packet_type": "1RTT"}}},
+		{"name": "security:key_updated", "data": {"key_type": "client_2rtt_secret"}}]}]}`
+	q, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := q.Traces[0].Events[0]; e.RelativeTime != 10000 || e.Category != Categories.Transport.Category {
+		t.Errorf("unexpected event %+v", e)
+	}
+	errs := q.Validate()
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 validation errors, got %v", errs)
+	}
+	if errs[0].Event != 2 || errs[1].Event != 1 || errs[2].Event != 2 {
+		t.Errorf("unexpected validation errors %v", errs)
+	}
+
+	local := testQLog().Traces[0]
+	c := CompareTraces(local, q.Traces[0])
+	if c.Consistent() || len(c.NotReceivedByRemote) != 1 || len(c.NotSentByLocal) != 0 || len(c.NotSentByRemote) != 1 {
+		t.Errorf("unexpected cross-check %+v", c)
+	}
+}
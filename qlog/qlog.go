@@ -6,8 +6,14 @@ import (
 	"time"
 )
 
+// The qlog versions emitted, see https://datatracker.ietf.org/doc/draft-ietf-quic-qlog-main-schema/
 const (
-	TimeUnits       = time.Microsecond
+	Version       = "0.4"
+	LegacyVersion = "draft-01"
+)
+
+const (
+	TimeUnits       = time.Microsecond // The unit of the relative time of the events, and of the legacy format
 	TimeUnitsString = "us"
 )
 
@@ -27,6 +33,7 @@ var Categories = struct {
 		SpinBitUpdated         string
 		ConnectionRetried      string
 		ConnectionStateUpdated string
+		ConnectionClosed       string
 	}
 	Transport struct {
 		Category           string
@@ -35,6 +42,8 @@ var Categories = struct {
 		PacketDropped      string
 		PacketBuffered     string
 		StreamStateUpdated string
+		ParametersSet      string
+		FlowControlUpdated string
 	}
 	Recovery struct {
 		Category               string
@@ -45,6 +54,26 @@ var Categories = struct {
 		PacketLost             string
 		MarkedForRetransmit    string
 	}
+	Security struct {
+		Category     string
+		KeyUpdated   string
+		KeyDiscarded string
+	}
+	H3 struct {
+		Category      string
+		ParametersSet string
+		StreamTypeSet string
+		FrameCreated  string
+		FrameParsed   string
+	}
+	QPACK struct {
+		Category           string
+		StateUpdated       string
+		HeadersEncoded     string
+		HeadersDecoded     string
+		InstructionCreated string
+		InstructionParsed  string
+	}
 }{
 	struct {
 		Category               string
@@ -54,7 +83,8 @@ var Categories = struct {
 		SpinBitUpdated         string
 		ConnectionRetried      string
 		ConnectionStateUpdated string
-	}{"connectivity", "server_listening", "connection_started", "connection_id_updated", "spin_bit_updated", "connection_retried", "connection_state_updated"},
+		ConnectionClosed       string
+	}{"connectivity", "server_listening", "connection_started", "connection_id_updated", "spin_bit_updated", "connection_retried", "connection_state_updated", "connection_closed"},
 	struct {
 		Category           string
 		PacketSent         string
@@ -62,7 +92,9 @@ var Categories = struct {
 		PacketDropped      string
 		PacketBuffered     string
 		StreamStateUpdated string
-	}{"transport", "packet_sent", "packet_received", "packet_dropped", "packet_buffered", "stream_state_updated"},
+		ParametersSet      string
+		FlowControlUpdated string
+	}{"transport", "packet_sent", "packet_received", "packet_dropped", "packet_buffered", "stream_state_updated", "parameters_set", "flow_control_updated"},
 	struct {
 		Category               string
 		MetricsUpdated         string
@@ -72,36 +104,88 @@ var Categories = struct {
 		PacketLost             string
 		MarkedForRetransmit    string
 	}{"recovery", "metrics_updated", "congestion_state_updated", "loss_timer_set", "loss_timer_fired", "packet_lost", "marked_for_retransmit"},
+	struct {
+		Category     string
+		KeyUpdated   string
+		KeyDiscarded string
+	}{"security", "key_updated", "key_discarded"},
+	struct {
+		Category      string
+		ParametersSet string
+		StreamTypeSet string
+		FrameCreated  string
+		FrameParsed   string
+	}{"h3", "parameters_set", "stream_type_set", "frame_created", "frame_parsed"},
+	struct {
+		Category           string
+		StateUpdated       string
+		HeadersEncoded     string
+		HeadersDecoded     string
+		InstructionCreated string
+		InstructionParsed  string
+	}{"qpack", "state_updated", "headers_encoded", "headers_decoded", "instruction_created", "instruction_parsed"},
+}
+
+// The modern schema prefixes the event names with the protocol they belong to instead of their category.
+var categoryNamespaces = map[string]string{
+	"connectivity": "quic",
+	"transport":    "quic",
+	"recovery":     "quic",
+	"security":     "quic",
+}
+
+// A LegacyData is implemented by the event data whose layout differs in the legacy format.
+type LegacyData interface {
+	LegacyData() interface{}
 }
 
 type Event struct {
-	RelativeTime uint64
+	RelativeTime uint64 // The time since the reference time of the trace, in TimeUnits
 	Category     string
 	Event        string
 	Data         interface{}
 }
 
+// Name returns the name of the event in the modern schema, e.g. quic:packet_sent.
+func (e *Event) Name() string {
+	namespace, ok := categoryNamespaces[e.Category]
+	if !ok {
+		namespace = e.Category
+	}
+	return namespace + ":" + e.Event
+}
+
+// Time returns the time of the event relative to the reference time of the trace, in milliseconds.
+func (e *Event) Time() float64 {
+	return float64(time.Duration(e.RelativeTime)*TimeUnits) / float64(time.Millisecond)
+}
+
 func (e *Event) MarshalJSON() ([]byte, error) {
-	return json.Marshal([]interface{}{e.RelativeTime, e.Category, e.Event, e.Data})
+	return json.Marshal(struct {
+		Time float64     `json:"time"`
+		Name string      `json:"name"`
+		Data interface{} `json:"data"`
+	}{e.Time(), e.Name(), e.Data})
 }
 
-func DefaultEventFields() []string {
-	return []string{"relative_time", "category", "event", "data"}
+func (e *Event) legacyFields() []interface{} {
+	data := e.Data
+	if l, ok := data.(LegacyData); ok {
+		data = l.LegacyData()
+	}
+	return []interface{}{e.RelativeTime, e.Category, e.Event, data}
+}
+
+type VantagePoint struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
 }
 
 type Trace struct {
-	VantagePoint struct {
-		Name string `json:"name"`
-		Type string `json:"type"`
-	} `json:"vantage_point"`
-	Title         string `json:"title"`
-	Description   string `json:"description"`
-	Configuration struct {
-		TimeOffset uint64 `json:"time_offset,string"`
-		TimeUnits  string `json:"time_units"`
-	} `json:"configuration"`
-	CommonFields map[string]interface{} `json:"common_fields"`
-	EventFields  []string               `json:"event_fields"`
+	VantagePoint VantagePoint           `json:"vantage_point"`
+	Title        string                 `json:"title,omitempty"`
+	Description  string                 `json:"description,omitempty"`
+	CommonFields map[string]interface{} `json:"common_fields"` // The reference time and time format are added when marshalling
 	Events       []*Event               `json:"events"`
 
 	ReferenceTime time.Time `json:"-"`
@@ -126,10 +210,89 @@ func (t *Trace) Sort() {
 	})
 }
 
+func (t *Trace) MarshalJSON() ([]byte, error) {
+	type trace Trace
+	copied := trace(*t)
+	copied.CommonFields = t.modernCommonFields()
+	if copied.Events == nil {
+		copied.Events = []*Event{}
+	}
+	return json.Marshal(copied)
+}
+
+// Returns the common fields of the trace, completed with the time fields of the modern schema.
+func (t *Trace) modernCommonFields() map[string]interface{} {
+	fields := t.commonFields()
+	fields["reference_time"] = float64(t.ReferenceTime.UnixNano()) / float64(time.Millisecond)
+	fields["time_format"] = "relative"
+	fields["protocol_type"] = []string{"QUIC"}
+	return fields
+}
+
+func (t *Trace) commonFields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	for k, v := range t.CommonFields {
+		fields[k] = v
+	}
+	return fields
+}
+
+// The layout of a trace in the draft-01 format, in which the fields of the events are listed in event_fields.
+type legacyTrace struct {
+	VantagePoint  VantagePoint `json:"vantage_point"`
+	Title         string       `json:"title"`
+	Description   string       `json:"description"`
+	Configuration struct {
+		TimeOffset uint64 `json:"time_offset,string"`
+		TimeUnits  string `json:"time_units"`
+	} `json:"configuration"`
+	CommonFields map[string]interface{} `json:"common_fields"`
+	EventFields  []string               `json:"event_fields"`
+	Events       [][]interface{}        `json:"events"`
+}
+
+func (t *Trace) legacy() *legacyTrace {
+	l := &legacyTrace{VantagePoint: t.VantagePoint, Title: t.Title, Description: t.Description}
+	l.Configuration.TimeUnits = TimeUnitsString
+	l.CommonFields = t.commonFields()
+	l.CommonFields["reference_time"] = t.ReferenceTime.UnixNano() / int64(TimeUnits)
+	l.EventFields = []string{"relative_time", "category", "event", "data"}
+	for _, e := range t.Events {
+		l.Events = append(l.Events, e.legacyFields())
+	}
+	return l
+}
+
 type QLog struct {
-	Version     string                 `json:"qlog_version"`
 	Title       string                 `json:"title"`
 	Description string                 `json:"description"`
-	Summary     map[string]interface{} `json:"summary"`
+	Summary     map[string]interface{} `json:"summary,omitempty"`
 	Traces      []*Trace               `json:"traces"`
+
+	Legacy  bool   `json:"-"` // Emits the draft-01 format instead of the current schema
+	Version string `json:"-"` // The version of the schema of a parsed qlog
+
+	issues []ValidationError // The deviations from the schema found when parsing
+}
+
+func (q QLog) MarshalJSON() ([]byte, error) {
+	if q.Legacy {
+		l := struct {
+			Version     string                 `json:"qlog_version"`
+			Title       string                 `json:"title"`
+			Description string                 `json:"description"`
+			Summary     map[string]interface{} `json:"summary"`
+			Traces      []*legacyTrace         `json:"traces"`
+		}{Version: LegacyVersion, Title: q.Title, Description: q.Description, Summary: q.Summary}
+		for _, t := range q.Traces {
+			l.Traces = append(l.Traces, t.legacy())
+		}
+		return json.Marshal(l)
+	}
+	type qlog QLog
+	return json.Marshal(struct {
+		Version string `json:"qlog_version"`
+		Format  string `json:"qlog_format"`
+		qlog
+	}{Version, "JSON", qlog(q)})
 }
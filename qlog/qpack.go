@@ -0,0 +1,65 @@
+package qlog
+
+// The QPACK instructions, see https://www.rfc-editor.org/rfc/rfc9204#section-4.3
+const (
+	QPACKSetDynamicTableCapacity    = "set_dynamic_table_capacity"
+	QPACKInsertWithNameReference    = "insert_with_name_reference"
+	QPACKInsertWithoutNameReference = "insert_without_name_reference"
+	QPACKDuplicate                  = "duplicate"
+	QPACKSectionAcknowledgement     = "section_acknowledgement"
+	QPACKStreamCancellation         = "stream_cancellation"
+	QPACKInsertCountIncrement       = "insert_count_increment"
+)
+
+// A QPACKInstruction is an instruction sent on a QPACK encoder or decoder stream. The names and values of the
+// entries inserted are only reported when they are not Huffman-encoded.
+type QPACKInstruction struct {
+	InstructionType string `json:"instruction_type"`
+
+	Capacity *uint64 `json:"capacity,omitempty"`
+
+	TableType           string  `json:"table_type,omitempty"` // static or dynamic
+	NameIndex           *uint64 `json:"name_index,omitempty"`
+	HuffmanEncodedName  bool    `json:"huffman_encoded_name,omitempty"`
+	NameLength          *uint64 `json:"name_length,omitempty"`
+	Name                string  `json:"name,omitempty"`
+	HuffmanEncodedValue bool    `json:"huffman_encoded_value,omitempty"`
+	ValueLength         *uint64 `json:"value_length,omitempty"`
+	Value               string  `json:"value,omitempty"`
+
+	Index     *uint64 `json:"index,omitempty"`
+	StreamID  *uint64 `json:"stream_id,omitempty"`
+	Increment *uint64 `json:"increment,omitempty"`
+}
+
+type QPACKInstructionCreated struct {
+	Instruction QPACKInstruction `json:"instruction"`
+	Raw         RawInfo          `json:"raw"`
+}
+
+type QPACKInstructionParsed QPACKInstructionCreated
+
+type QPACKHeaderBlockPrefix struct {
+	RequiredInsertCount uint64 `json:"required_insert_count"` // The encoded value of the field
+	SignBit             bool   `json:"sign_bit"`
+	DeltaBase           uint64 `json:"delta_base"`
+}
+
+type QPACKHeadersEncoded struct {
+	StreamID    uint64                  `json:"stream_id"`
+	Headers     []H3HTTPField           `json:"headers,omitempty"`
+	BlockPrefix *QPACKHeaderBlockPrefix `json:"block_prefix,omitempty"`
+	Length      uint64                  `json:"length"`
+	Raw         RawInfo                 `json:"raw"`
+}
+
+type QPACKHeadersDecoded QPACKHeadersEncoded
+
+// A QPACKStateUpdated reports the state of the dynamic table of an encoder, as derived from the instructions
+// exchanged on the QPACK streams.
+type QPACKStateUpdated struct {
+	Owner                string  `json:"owner"` // The endpoint owning the encoder, local or remote
+	DynamicTableCapacity *uint64 `json:"dynamic_table_capacity,omitempty"`
+	KnownReceivedCount   *uint64 `json:"known_received_count,omitempty"`
+	CurrentInsertCount   *uint64 `json:"current_insert_count,omitempty"`
+}
@@ -3,8 +3,8 @@ package qt2qlog
 import (
 	"encoding/hex"
 	. "github.com/QUIC-Tracker/quic-tracker"
+	"fmt"
 	"github.com/QUIC-Tracker/quic-tracker/qlog"
-	"strconv"
 )
 
 var qlogPacketType = map[PacketType]string{
@@ -20,30 +20,34 @@ func ConvertPacket(p Packet) *qlog.Packet {
 	j := &qlog.Packet{}
 	switch p.(type) {
 	case *InitialPacket, *HandshakePacket, *ZeroRTTProtectedPacket, *ProtectedPacket:
-		j.PacketType = qlogPacketType[p.Header().PacketType()]
+		j.Header.PacketType = qlogPacketType[p.Header().PacketType()]
 	case *RetryPacket:
-		j.PacketType = qlogPacketType[Retry]
+		j.Header.PacketType = qlogPacketType[Retry]
 	case *VersionNegotiationPacket:
-		j.PacketType = qlogPacketType[VersionNegotiation]
+		j.Header.PacketType = qlogPacketType[VersionNegotiation]
+	case *StatelessResetPacket:
+		j.Header.PacketType = "stateless_reset"
 	default:
-		j.PacketType = "unknown"
+		j.Header.PacketType = "unknown"
 	}
 	// TODO handle PacketSize computation here
 	switch p.(type) {
 	case *VersionNegotiationPacket, *RetryPacket, *StatelessResetPacket:
 	default:
-		j.Header.PacketNumber = uint64(p.Header().PacketNumber())
+		pn := uint64(p.Header().PacketNumber())
+		j.Header.PacketNumber = &pn
 	}
 
 	switch h := p.Header().(type) {
 		case *ShortHeader:
-			j.Header.DCIL = strconv.Itoa(int(h.DestinationCID.CIDL()))
+			j.Header.DCIL = int(h.DestinationCID.CIDL())
 			j.Header.DCID = h.DestinationCID.String()
 		case *LongHeader:
-			j.Header.PayloadLength = int(h.Length.Value)
-			j.Header.SCIL = strconv.Itoa(int(h.SourceCID.CIDL()))
+			j.Raw.PayloadLength = int(h.Length.Value)
+			j.Header.Version = fmt.Sprintf("%08x", h.Version)
+			j.Header.SCIL = int(h.SourceCID.CIDL())
 			j.Header.SCID = h.SourceCID.String()
-			j.Header.DCIL = strconv.Itoa(int(h.DestinationCID.CIDL()))
+			j.Header.DCIL = int(h.DestinationCID.CIDL())
 			j.Header.DCID = h.DestinationCID.String()
 	}
 
@@ -81,7 +85,7 @@ func convertFrames(frames []Frame) []interface{} {
 				FrameType: "reset_stream",
 				StreamID: ft.StreamId,
 				ErrorCode: ft.ApplicationErrorCode,
-				FinalOffset: ft.FinalSize,
+				FinalSize: ft.FinalSize,
 			}
 		case *StopSendingFrame:
 			qf = &qlog.StopSendingFrame{
@@ -98,8 +102,7 @@ func convertFrames(frames []Frame) []interface{} {
 		case *NewTokenFrame:
 			qf = &qlog.NewTokenFrame{
 				FrameType: "new_token",
-				Length: uint64(len(ft.Token)),
-				Token: hex.EncodeToString(ft.Token),
+				Token: qlog.Token{Raw: qlog.RawInfo{Length: len(ft.Token), Data: hex.EncodeToString(ft.Token)}},
 			}
 		case *ConnectionCloseFrame:
 			qf = &qlog.ConnectionCloseFrame{FrameType: "connection_close",
@@ -132,7 +135,7 @@ func convertFrames(frames []Frame) []interface{} {
 				FrameType:      "new_connection_id",
 				SequenceNumber: ft.Sequence,
 				RetirePriorTo:  ft.RetirePriorTo,
-				Length:         uint8(len(ft.ConnectionId)),
+				ConnectionIDLength: uint8(len(ft.ConnectionId)),
 				ConnectionID:   hex.EncodeToString(ft.ConnectionId),
 				ResetToken:     hex.EncodeToString(ft.StatelessResetToken[:]),
 			}
@@ -204,11 +207,12 @@ func unknownFrameToQLog(u Frame) *qlog.UnknownFrame {
 func ConvertPacketLost(packetType PacketType, number PacketNumber, frames []Frame, trigger string) *qlog.PacketLost {
 	j := &qlog.PacketLost{Frames: convertFrames(frames), Trigger: trigger}
 	if pType, ok := qlogPacketType[packetType]; ok {
-		j.PacketType = pType
+		j.Header.PacketType = pType
 	} else {
-		j.PacketType = "unknown"
+		j.Header.PacketType = "unknown"
 	}
-	j.PacketNumber = uint64(number)
+	pn := uint64(number)
+	j.Header.PacketNumber = &pn
 	return j
 }
 
@@ -219,5 +223,25 @@ func ConvertPacketBuffered(packetType PacketType, trigger string) *qlog.PacketBu
 	} else {
 		typeStr = "unknown"
 	}
-	return &qlog.PacketBuffered{PacketType: typeStr, Trigger: trigger}
-}
\ No newline at end of file
+	return &qlog.PacketBuffered{Header: qlog.PacketHeader{PacketType: typeStr}, Trigger: trigger}
+}
+func ConvertStreamState(streamId uint64, side string, state string) *qlog.StreamStateUpdated {
+	sType := qlog.StreamTypeBidi
+	if IsUni(streamId) {
+		sType = qlog.StreamTypeUni
+	}
+	return &qlog.StreamStateUpdated{StreamID: streamId, StreamType: sType, New: state, StreamSide: side}
+}
+
+func ConvertConnectionClose(owner string, errorCode uint64, application bool, reason string) *qlog.ConnectionClosed {
+	j := &qlog.ConnectionClosed{Owner: owner, Reason: reason, Trigger: "error"}
+	if application {
+		j.ApplicationCode = &errorCode
+	} else {
+		j.ConnectionCode = &errorCode
+	}
+	if errorCode == 0 {
+		j.Trigger = "clean"
+	}
+	return j
+}
@@ -0,0 +1,50 @@
+package qt2qlog
+
+import (
+	"encoding/hex"
+	"fmt"
+	. "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
+)
+
+// ConvertTrace builds a qlog from packets decoded from a trace. Its reference time is the time of the first packet.
+func ConvertTrace(trace *Trace, packets []DecodedPacket) qlog.QLog {
+	var q qlog.QLog
+	q.Title = "QUIC-Tracker scenario " + trace.Scenario
+	q.Description = "QUIC-Tracker trace_tool"
+	if trace.Commit != "" {
+		q.Description += ", trace produced by commit " + trace.Commit
+	}
+
+	t := &qlog.Trace{}
+	q.Traces = append(q.Traces, t)
+	t.VantagePoint.Name = "QUIC-Tracker"
+	t.VantagePoint.Type = "client"
+	t.Description = fmt.Sprintf("Connection to %s (%s), regenerated from a trace", trace.Host, trace.Ip)
+	t.CommonFields = make(map[string]interface{})
+
+	for _, p := range packets {
+		if p.Packet == nil {
+			continue
+		}
+		if t.ReferenceTime.IsZero() {
+			t.ReferenceTime = p.Timestamp
+		}
+		if h, ok := p.Packet.Header().(*LongHeader); ok && p.Direction == ToServer && h.PacketType() == Initial && t.CommonFields["ODCID"] == nil {
+			t.CommonFields["ODCID"] = hex.EncodeToString(h.DestinationCID)
+			t.CommonFields["group_id"] = t.CommonFields["ODCID"]
+		}
+
+		jp := ConvertPacket(p.Packet)
+		jp.Raw.Length = p.Length
+		eventType := qlog.Categories.Transport.PacketReceived
+		if p.Direction == ToServer {
+			eventType = qlog.Categories.Transport.PacketSent
+		}
+		e := t.NewEvent(qlog.Categories.Transport.Category, eventType, jp)
+		e.RelativeTime = uint64(p.Timestamp.Sub(t.ReferenceTime) / qlog.TimeUnits)
+		t.Add(e)
+	}
+	t.Sort()
+	return q
+}
@@ -1,13 +1,29 @@
 package qlog
 
+// The RTT metrics are expressed in milliseconds.
 type MetricUpdate struct {
-	CongestionWindow uint64 `json:"congestion_window,omitempty"`
-	BytesInFlight    uint64 `json:"bytes_in_flight,omitempty"`
-	MinRTT           uint64 `json:"min_rtt,omitempty"`
-	SmoothedRTT      uint64 `json:"smoothed_rtt,omitempty"`
-	LatestRTT        uint64 `json:"latest_rtt,omitempty"`
-	MaxAckDelay      uint64 `json:"max_ack_delay,omitempty"`
-	RTTVariance      uint64 `json:"rtt_variance,omitempty"`
-	SSThresh         uint64 `json:"ssthresh,omitempty"`
-	PacingRate       uint64 `json:"pacing_rate,omitempty"`
+	CongestionWindow uint64  `json:"congestion_window,omitempty"`
+	BytesInFlight    uint64  `json:"bytes_in_flight,omitempty"`
+	MinRTT           float64 `json:"min_rtt,omitempty"`
+	SmoothedRTT      float64 `json:"smoothed_rtt,omitempty"`
+	LatestRTT        float64 `json:"latest_rtt,omitempty"`
+	MaxAckDelay      float64 `json:"max_ack_delay,omitempty"`
+	RTTVariance      float64 `json:"rtt_variance,omitempty"`
+	SSThresh         uint64  `json:"ssthresh,omitempty"`
+	PacingRate       uint64  `json:"pacing_rate,omitempty"`
+}
+
+// LegacyData returns the metrics in the legacy format, in which the RTT metrics are whole milliseconds.
+func (m MetricUpdate) LegacyData() interface{} {
+	return struct {
+		CongestionWindow uint64 `json:"congestion_window,omitempty"`
+		BytesInFlight    uint64 `json:"bytes_in_flight,omitempty"`
+		MinRTT           uint64 `json:"min_rtt,omitempty"`
+		SmoothedRTT      uint64 `json:"smoothed_rtt,omitempty"`
+		LatestRTT        uint64 `json:"latest_rtt,omitempty"`
+		MaxAckDelay      uint64 `json:"max_ack_delay,omitempty"`
+		RTTVariance      uint64 `json:"rtt_variance,omitempty"`
+		SSThresh         uint64 `json:"ssthresh,omitempty"`
+		PacingRate       uint64 `json:"pacing_rate,omitempty"`
+	}{m.CongestionWindow, m.BytesInFlight, uint64(m.MinRTT), uint64(m.SmoothedRTT), uint64(m.LatestRTT), uint64(m.MaxAckDelay), uint64(m.RTTVariance), m.SSThresh, m.PacingRate}
 }
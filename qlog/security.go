@@ -0,0 +1,26 @@
+package qlog
+
+// The types of keys reported in the security events.
+const (
+	KeyTypeServerInitial   = "server_initial_secret"
+	KeyTypeClientInitial   = "client_initial_secret"
+	KeyTypeServerHandshake = "server_handshake_secret"
+	KeyTypeClientHandshake = "client_handshake_secret"
+	KeyTypeServer0RTT      = "server_0rtt_secret"
+	KeyTypeClient0RTT      = "client_0rtt_secret"
+	KeyTypeServer1RTT      = "server_1rtt_secret"
+	KeyTypeClient1RTT      = "client_1rtt_secret"
+)
+
+type KeyUpdated struct {
+	KeyType    string `json:"key_type"`
+	New        string `json:"new,omitempty"`
+	Generation uint64 `json:"generation,omitempty"` // The key phase of 1-RTT keys
+	Trigger    string `json:"trigger,omitempty"`    // One of tls, remote_update or local_update
+}
+
+type KeyDiscarded struct {
+	KeyType    string `json:"key_type"`
+	Generation uint64 `json:"generation,omitempty"`
+	Trigger    string `json:"trigger,omitempty"`
+}
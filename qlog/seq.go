@@ -0,0 +1,111 @@
+package qlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The record separator that starts each JSON text of a sequence, see https://tools.ietf.org/html/rfc7464
+const recordSeparator = 0x1E
+
+// A SeqWriter streams the events of a trace in the JSON-SEQ serialisation of qlog, usually stored in .sqlog files.
+// Each event is written as soon as it is added, so that the events produced before a crash or a hang are kept.
+type SeqWriter struct {
+	lock   sync.Mutex
+	w      io.Writer
+	closed bool
+}
+
+// The header of a sequence, which describes the trace its events belong to.
+type seqHeader struct {
+	Version     string `json:"qlog_version"`
+	Format      string `json:"qlog_format"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Trace       struct {
+		VantagePoint VantagePoint           `json:"vantage_point"`
+		Title        string                 `json:"title,omitempty"`
+		Description  string                 `json:"description,omitempty"`
+		CommonFields map[string]interface{} `json:"common_fields"`
+	} `json:"trace"`
+}
+
+// NewSeqWriter writes the header of the sequence, describing the given trace of the qlog, and returns a writer for
+// its events.
+func NewSeqWriter(w io.Writer, q *QLog, t *Trace) (*SeqWriter, error) {
+	header := seqHeader{Version: Version, Format: "JSON-SEQ", Title: q.Title, Description: q.Description}
+	header.Trace.VantagePoint = t.VantagePoint
+	header.Trace.Title = t.Title
+	header.Trace.Description = t.Description
+	header.Trace.CommonFields = t.modernCommonFields()
+
+	s := &SeqWriter{w: w}
+	return s, s.writeRecord(header)
+}
+
+// WriteEvent appends an event to the sequence. Events written after Close are ignored.
+func (s *SeqWriter) WriteEvent(e *Event) error {
+	return s.writeRecord(e)
+}
+
+func (s *SeqWriter) writeRecord(v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	_, err = s.w.Write(append(append([]byte{recordSeparator}, content...), '\n'))
+	return err
+}
+
+// Close stops the sequence and closes the underlying writer if it is an io.Closer.
+func (s *SeqWriter) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// WriteSeqFiles writes each trace of the qlog in the JSON-SEQ serialisation to a file of the given directory, named
+// after the ODCID common field of the trace.
+func (q *QLog) WriteSeqFiles(directory string) error {
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return err
+	}
+	for i, t := range q.Traces {
+		name, ok := t.CommonFields["ODCID"].(string)
+		if !ok || name == "" {
+			name = fmt.Sprintf("trace_%d", i)
+		}
+		file, err := os.Create(filepath.Join(directory, name+".sqlog"))
+		if err != nil {
+			return err
+		}
+		s, err := NewSeqWriter(file, q, t)
+		for _, e := range t.Events {
+			if err != nil {
+				break
+			}
+			err = s.WriteEvent(e)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package qlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Statistics summarises the events of a trace.
+type Statistics struct {
+	PacketsSent     map[string]int // The number of packets sent, indexed by packet type
+	PacketsReceived map[string]int
+	BytesSent       int // The sum of the lengths of the packets sent, when reported
+	BytesReceived   int
+	PacketsLost     int
+	PacketsDropped  int
+	PacketsBuffered int
+	Retransmissions int // The number of packets sent that retransmit STREAM or CRYPTO data or are triggered by a retransmission
+
+	RTTSamples  int     // The number of metrics_updated events reporting RTT values
+	MinRTT      float64 // The last minimum RTT reported, in milliseconds
+	SmoothedRTT float64 // The last smoothed RTT reported, in milliseconds
+	LatestRTT   float64 // The last RTT sample reported, in milliseconds
+
+	Duration float64 // The time between the first and the last events, in milliseconds
+}
+
+func (s *Statistics) String() string {
+	return fmt.Sprintf("sent %v (%d bytes), received %v (%d bytes), %d retransmission(s), %d lost, %d dropped, %d buffered, min/smoothed/latest RTT %.3f/%.3f/%.3f ms over %d sample(s), %.3f ms long",
+		s.PacketsSent, s.BytesSent, s.PacketsReceived, s.BytesReceived, s.Retransmissions, s.PacketsLost, s.PacketsDropped, s.PacketsBuffered, s.MinRTT, s.SmoothedRTT, s.LatestRTT, s.RTTSamples, s.Duration)
+}
+
+// Statistics computes the statistics of the trace.
+func (t *Trace) Statistics() *Statistics {
+	s := &Statistics{PacketsSent: make(map[string]int), PacketsReceived: make(map[string]int)}
+	sentData := make(map[string]bool)
+
+	for i, e := range t.Events {
+		if i == len(t.Events)-1 {
+			s.Duration = e.Time() - t.Events[0].Time()
+		}
+		var metrics *MetricUpdate
+		switch d := e.Data.(type) {
+		case *Packet:
+			switch e.Event {
+			case Categories.Transport.PacketSent:
+				s.PacketsSent[d.Header.PacketType]++
+				s.BytesSent += d.Raw.Length
+				retransmission := strings.HasPrefix(d.Trigger, "retransmit")
+				for _, f := range d.Frames {
+					if key := dataKey(d.Header.PacketType, f); key != "" {
+						retransmission = retransmission || sentData[key]
+						sentData[key] = true
+					}
+				}
+				if retransmission {
+					s.Retransmissions++
+				}
+			case Categories.Transport.PacketReceived:
+				s.PacketsReceived[d.Header.PacketType]++
+				s.BytesReceived += d.Raw.Length
+			case Categories.Transport.PacketDropped:
+				s.PacketsDropped++
+			}
+		case *PacketLost:
+			s.PacketsLost++
+		case *PacketBuffered:
+			s.PacketsBuffered++
+		case *MetricUpdate:
+			metrics = d
+		case MetricUpdate:
+			metrics = &d
+		}
+		if metrics != nil && (metrics.MinRTT > 0 || metrics.SmoothedRTT > 0 || metrics.LatestRTT > 0) {
+			s.RTTSamples++
+			if metrics.MinRTT > 0 {
+				s.MinRTT = metrics.MinRTT
+			}
+			if metrics.SmoothedRTT > 0 {
+				s.SmoothedRTT = metrics.SmoothedRTT
+			}
+			if metrics.LatestRTT > 0 {
+				s.LatestRTT = metrics.LatestRTT
+			}
+		}
+	}
+	return s
+}
+
+// frameFields returns the fields of a frame, given as one of the types of this package or as generic JSON.
+func frameFields(f interface{}) map[string]interface{} {
+	if m, ok := f.(map[string]interface{}); ok {
+		return m
+	}
+	var m map[string]interface{}
+	if content, err := json.Marshal(f); err == nil {
+		json.Unmarshal(content, &m)
+	}
+	return m
+}
+
+// dataKey identifies the data carried by a STREAM or CRYPTO frame, so that it can be recognised when retransmitted.
+// It is empty for the other frames.
+func dataKey(packetType string, f interface{}) string {
+	fields := frameFields(f)
+	offset, err := jsonNumber(fields["offset"])
+	if err != nil {
+		offset = 0
+	}
+	switch frameType(fields) {
+	case "crypto":
+		return fmt.Sprintf("crypto/%s/%.0f", packetNumberSpace(packetType), offset)
+	case "stream":
+		length, _ := jsonNumber(fields["length"])
+		fin, _ := fields["fin"].(bool)
+		if length == 0 && !fin {
+			return ""
+		}
+		streamID, _ := jsonNumber(fields["stream_id"])
+		return fmt.Sprintf("stream/%.0f/%.0f", streamID, offset)
+	}
+	return ""
+}
+
+func packetNumberSpace(packetType string) string {
+	switch packetType {
+	case "initial", "handshake":
+		return packetType
+	case "0RTT", "1RTT":
+		return "application_data"
+	}
+	return ""
+}
+
+// A PacketID identifies a packet of a connection by its packet number space and its packet number.
+type PacketID struct {
+	Space  string // initial, handshake or application_data
+	Number uint64
+}
+
+func (p PacketID) String() string {
+	return fmt.Sprintf("%s #%d", p.Space, p.Number)
+}
+
+// A CrossCheck lists the packets on which the traces of both endpoints of a connection disagree. The packets sent
+// but not received can have been lost, those received but never sent reveal an inconsistency of one of the traces.
+type CrossCheck struct {
+	NotReceivedByRemote []PacketID // Sent by the local endpoint, absent from the packets received by the remote one
+	NotSentByLocal      []PacketID // Received by the remote endpoint, absent from the packets sent by the local one
+	NotReceivedByLocal  []PacketID // Sent by the remote endpoint, absent from the packets received by the local one
+	NotSentByRemote     []PacketID // Received by the local endpoint, absent from the packets sent by the remote one
+}
+
+// Consistent reports whether every packet received by an endpoint was sent by the other one.
+func (c *CrossCheck) Consistent() bool {
+	return len(c.NotSentByLocal) == 0 && len(c.NotSentByRemote) == 0
+}
+
+// CompareTraces cross-checks the packets of the local and remote traces of a connection. Packets reported as dropped
+// count as received.
+func CompareTraces(local, remote *Trace) *CrossCheck {
+	localSent, localReceived := local.packetIDs()
+	remoteSent, remoteReceived := remote.packetIDs()
+	return &CrossCheck{
+		NotReceivedByRemote: missingPackets(localSent, remoteReceived),
+		NotSentByLocal:      missingPackets(remoteReceived, localSent),
+		NotReceivedByLocal:  missingPackets(remoteSent, localReceived),
+		NotSentByRemote:     missingPackets(localReceived, remoteSent),
+	}
+}
+
+// packetIDs returns the packets sent and received in the trace, in the order of their events.
+func (t *Trace) packetIDs() (sent []PacketID, received []PacketID) {
+	for _, e := range t.Events {
+		p, ok := e.Data.(*Packet)
+		if !ok || p.Header.PacketNumber == nil || packetNumberSpace(p.Header.PacketType) == "" {
+			continue
+		}
+		id := PacketID{packetNumberSpace(p.Header.PacketType), *p.Header.PacketNumber}
+		switch e.Event {
+		case Categories.Transport.PacketSent:
+			sent = append(sent, id)
+		case Categories.Transport.PacketReceived, Categories.Transport.PacketDropped:
+			received = append(received, id)
+		}
+	}
+	return
+}
+
+// missingPackets returns the packets of a that are not in b.
+func missingPackets(a, b []PacketID) []PacketID {
+	set := make(map[PacketID]bool)
+	for _, id := range b {
+		set[id] = true
+	}
+	var missing []PacketID
+	for _, id := range a {
+		if !set[id] {
+			missing = append(missing, id)
+			set[id] = true
+		}
+	}
+	return missing
+}
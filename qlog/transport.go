@@ -0,0 +1,55 @@
+package qlog
+
+type ParametersSet struct {
+	Owner string `json:"owner"` // The endpoint that sent the parameters, local or remote
+
+	OriginalDestinationConnectionID string `json:"original_destination_connection_id,omitempty"`
+	InitialSourceConnectionID       string `json:"initial_source_connection_id,omitempty"`
+	RetrySourceConnectionID         string `json:"retry_source_connection_id,omitempty"`
+	StatelessResetToken             string `json:"stateless_reset_token,omitempty"`
+	DisableActiveMigration          bool   `json:"disable_active_migration,omitempty"`
+
+	MaxIdleTimeout          uint64 `json:"max_idle_timeout,omitempty"`
+	MaxUDPPayloadSize       uint64 `json:"max_udp_payload_size,omitempty"`
+	AckDelayExponent        uint64 `json:"ack_delay_exponent,omitempty"`
+	MaxAckDelay             uint64 `json:"max_ack_delay,omitempty"`
+	ActiveConnectionIDLimit uint64 `json:"active_connection_id_limit,omitempty"`
+
+	InitialMaxData                 uint64 `json:"initial_max_data"`
+	InitialMaxStreamDataBidiLocal  uint64 `json:"initial_max_stream_data_bidi_local"`
+	InitialMaxStreamDataBidiRemote uint64 `json:"initial_max_stream_data_bidi_remote"`
+	InitialMaxStreamDataUni        uint64 `json:"initial_max_stream_data_uni"`
+	InitialMaxStreamsBidi          uint64 `json:"initial_max_streams_bidi"`
+	InitialMaxStreamsUni           uint64 `json:"initial_max_streams_uni"`
+
+	PreferredAddress string `json:"preferred_address,omitempty"`
+}
+
+// The sides of a stream reported in stream_state_updated events.
+const (
+	StreamSideSending   = "sending"
+	StreamSideReceiving = "receiving"
+)
+
+type StreamStateUpdated struct {
+	StreamID   uint64     `json:"stream_id"`
+	StreamType StreamType `json:"stream_type"`
+	New        string     `json:"new"`
+	StreamSide string     `json:"stream_side,omitempty"`
+}
+
+// The flow-control credits reported in flow_control_updated events.
+const (
+	FlowControlConnection = "connection"
+	FlowControlStream     = "stream"
+	FlowControlBidiStream = "bidirectional_streams"
+	FlowControlUniStream  = "unidirectional_streams"
+)
+
+// A FlowControlUpdated reports a change of the credit granted by an endpoint. It is not part of the qlog schema.
+type FlowControlUpdated struct {
+	Owner    string  `json:"owner"` // The endpoint that granted the credit, local or remote
+	Type     string  `json:"type"`
+	StreamID *uint64 `json:"stream_id,omitempty"`
+	Limit    uint64  `json:"limit"`
+}
@@ -0,0 +1,124 @@
+package qlog
+
+import (
+	"fmt"
+)
+
+// A ValidationError describes a deviation of a qlog from its schema.
+type ValidationError struct {
+	Trace   int // The index of the trace concerned, or -1 when it concerns the whole file
+	Event   int // The index of the event concerned in its trace, or -1 when it concerns the whole trace
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Trace < 0 {
+		return e.Message
+	} else if e.Event < 0 {
+		return fmt.Sprintf("trace %d: %s", e.Trace, e.Message)
+	}
+	return fmt.Sprintf("trace %d, event %d: %s", e.Trace, e.Event, e.Message)
+}
+
+var validVantagePoints = stringSet("client", "server", "network", "unknown")
+var validPacketTypes = stringSet("initial", "handshake", "0RTT", "1RTT", "retry", "version_negotiation", "stateless_reset", "unknown")
+var validOwners = stringSet("local", "remote")
+var validKeyTypes = stringSet(KeyTypeServerInitial, KeyTypeClientInitial, KeyTypeServerHandshake, KeyTypeClientHandshake, KeyTypeServer0RTT, KeyTypeClient0RTT, KeyTypeServer1RTT, KeyTypeClient1RTT)
+var validH3StreamTypes = stringSet(H3StreamTypeControl, H3StreamTypePush, H3StreamTypeRequest, H3StreamTypeQPACKEncoder, H3StreamTypeQPACKDecoder, H3StreamTypeUnknown, "reserved")
+var validQPACKInstructions = stringSet(QPACKSetDynamicTableCapacity, QPACKInsertWithNameReference, QPACKInsertWithoutNameReference, QPACKDuplicate, QPACKSectionAcknowledgement, QPACKStreamCancellation, QPACKInsertCountIncrement)
+
+func stringSet(values ...string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// Validate checks the qlog against its schema. It returns the deviations found when the qlog was parsed and those
+// found in the data of the events known to QUIC-Tracker.
+func (q *QLog) Validate() []ValidationError {
+	errs := append([]ValidationError{}, q.issues...)
+	if len(q.Traces) == 0 {
+		errs = append(errs, ValidationError{-1, -1, "the qlog contains no trace"})
+	}
+	for i, t := range q.Traces {
+		if !validVantagePoints[t.VantagePoint.Type] {
+			errs = append(errs, ValidationError{i, -1, fmt.Sprintf("invalid vantage_point type %q", t.VantagePoint.Type)})
+		}
+		for j, e := range t.Events {
+			for _, message := range validateEvent(e) {
+				errs = append(errs, ValidationError{i, j, e.Name() + ": " + message})
+			}
+		}
+	}
+	return errs
+}
+
+func validateEvent(e *Event) []string {
+	var messages []string
+	check := func(valid bool, format string, args ...interface{}) {
+		if !valid {
+			messages = append(messages, fmt.Sprintf(format, args...))
+		}
+	}
+	checkHeader := func(h *PacketHeader) {
+		check(validPacketTypes[h.PacketType], "invalid packet_type %q", h.PacketType)
+		switch h.PacketType {
+		case "retry", "version_negotiation", "stateless_reset":
+		default:
+			check(h.PacketNumber != nil, "packet_number is missing")
+		}
+	}
+
+	switch d := e.Data.(type) {
+	case *Packet:
+		checkHeader(&d.Header)
+		for _, f := range d.Frames {
+			check(frameType(f) != "", "a frame has no frame_type")
+		}
+	case *PacketLost:
+		checkHeader(&d.Header)
+	case *PacketBuffered:
+		check(d.Header.PacketType == "" || validPacketTypes[d.Header.PacketType], "invalid packet_type %q", d.Header.PacketType)
+	case *ParametersSet:
+		check(validOwners[d.Owner], "invalid owner %q", d.Owner)
+	case *StreamStateUpdated:
+		check(d.New != "", "new is missing")
+	case *ConnectionIDUpdated:
+		check(validOwners[d.Owner], "invalid owner %q", d.Owner)
+		check(d.New != "", "new is missing")
+	case *ConnectionClosed:
+		check(d.Owner == "" || validOwners[d.Owner], "invalid owner %q", d.Owner)
+	case *KeyUpdated:
+		check(validKeyTypes[d.KeyType], "invalid key_type %q", d.KeyType)
+	case *KeyDiscarded:
+		check(validKeyTypes[d.KeyType], "invalid key_type %q", d.KeyType)
+	case *H3ParametersSet:
+		check(validOwners[d.Owner], "invalid owner %q", d.Owner)
+	case *H3StreamTypeSet:
+		check(validH3StreamTypes[d.StreamType], "invalid stream_type %q", d.StreamType)
+	case *H3FrameCreated:
+		check(d.Frame.FrameType != "", "frame_type is missing")
+	case *H3FrameParsed:
+		check(d.Frame.FrameType != "", "frame_type is missing")
+	case *QPACKStateUpdated:
+		check(validOwners[d.Owner], "invalid owner %q", d.Owner)
+	case *QPACKInstructionCreated:
+		check(validQPACKInstructions[d.Instruction.InstructionType], "invalid instruction_type %q", d.Instruction.InstructionType)
+	case *QPACKInstructionParsed:
+		check(validQPACKInstructions[d.Instruction.InstructionType], "invalid instruction_type %q", d.Instruction.InstructionType)
+	case map[string]interface{}:
+	default:
+		if _, known := eventDataTypes[e.Category+":"+e.Event]; !known {
+			check(false, "data is not an object")
+		}
+	}
+	return messages
+}
+
+// frameType returns the type of a frame, given as one of the types of this package or as generic JSON.
+func frameType(f interface{}) string {
+	t, _ := frameFields(f)["frame_type"].(string)
+	return t
+}
@@ -0,0 +1,250 @@
+package results
+
+import (
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// The statuses of the traces of a Diff.
+const (
+	StatusAdded   = "added"   // The scenario was not run against the host in the old results
+	StatusRemoved = "removed" // The scenario was not run against the host in the new results
+	StatusChanged = "changed"
+)
+
+// The transport parameters that differ in every connection, and are not compared.
+var volatileTransportParameters = map[string]bool{
+	"original_destination_connection_id": true,
+	"initial_source_connection_id":       true,
+	"retry_source_connection_id":         true,
+	"stateless_reset_token":              true,
+	"preferred_address":                  true,
+}
+
+// A Change reports a difference between the old and new traces of a scenario run against a host. An absent value is
+// reported as nil.
+type Change struct {
+	Field      string      `json:"field"` // e.g. error_code, checks.host_migrated, results.error, transport_parameters.initial_max_data or alpn
+	Old        interface{} `json:"old"`
+	New        interface{} `json:"new"`
+	Regression bool        `json:"regression"`
+}
+
+type TraceDiff struct {
+	Key
+	Status     string   `json:"status"`
+	Changes    []Change `json:"changes,omitempty"`
+	Regression bool     `json:"regression"`
+}
+
+type DiffOptions struct {
+	ResultValues      bool    // Reports the changes of the values of the results, not only the results added or removed
+	TimingThreshold   float64 // The relative change of the handshake duration above which it is reported, e.g. 0.5
+	TimingRegressions bool    // Reports the handshakes that got slower than the threshold as regressions
+}
+
+// A Diff lists the differences between two results files, for each host and scenario.
+type Diff struct {
+	Traces      []*TraceDiff `json:"traces"`
+	Unchanged   int          `json:"unchanged"`
+	Regressions int          `json:"regressions"` // The number of traces that regressed
+}
+
+// Compare computes the differences between two results. The attempts of a scenario run against a host are compared as
+// a whole, using their aggregated outcome and the trace that determines their verdict. A scenario that used to succeed
+// regresses when it fails or is flaky, when it is no longer run or when its handshake no longer completes.
+func Compare(old, new []*qt.Trace, options DiffOptions) *Diff {
+	d := &Diff{Traces: []*TraceDiff{}}
+	oldIndex, newIndex := Aggregate(old), Aggregate(new)
+
+	var keys []Key
+	for k := range oldIndex {
+		keys = append(keys, k)
+	}
+	for k := range newIndex {
+		if _, ok := oldIndex[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Host < keys[j].Host || keys[i].Host == keys[j].Host && keys[i].Scenario < keys[j].Scenario
+	})
+
+	for _, k := range keys {
+		o, n := oldIndex[k], newIndex[k]
+		var td *TraceDiff
+		switch {
+		case o == nil:
+			td = &TraceDiff{Key: k, Status: StatusAdded}
+		case n == nil:
+			td = &TraceDiff{Key: k, Status: StatusRemoved, Regression: o.Outcome == OutcomePassed}
+		default:
+			td = &TraceDiff{Key: k, Status: StatusChanged, Changes: append(compareStability(o, n), compareTraces(o.Verdict(), n.Verdict(), options)...)}
+			if len(td.Changes) == 0 {
+				d.Unchanged++
+				continue
+			}
+			for _, c := range td.Changes {
+				td.Regression = td.Regression || c.Regression
+			}
+		}
+		if td.Regression {
+			d.Regressions++
+		}
+		d.Traces = append(d.Traces, td)
+	}
+	return d
+}
+
+// compareStability reports the changes of the outcome of the attempts, and of their pass ratio when they are flaky.
+func compareStability(o, n *Stability) []Change {
+	if o.Outcome != n.Outcome {
+		return []Change{{"outcome", o.Outcome, n.Outcome, o.Outcome == OutcomePassed}}
+	}
+	if o.Outcome == OutcomeFlaky && o.PassRatio != n.PassRatio {
+		return []Change{{"pass_ratio", o.PassRatio, n.PassRatio, false}}
+	}
+	return nil
+}
+
+func compareTraces(o, n *qt.Trace, options DiffOptions) []Change {
+	var changes []Change
+	add := func(field string, old, new interface{}, regression bool) {
+		changes = append(changes, Change{field, old, new, regression})
+	}
+
+	if o.ErrorCode != n.ErrorCode {
+		add("error_code", o.ErrorCode, n.ErrorCode, o.ErrorCode == 0)
+	}
+	compareChecks(o.Checks, n.Checks, add)
+	compareMaps("results.", o.Results, n.Results, nil, options.ResultValues, add)
+
+	oh, nh := qt.SummarizeHandshake(o), qt.SummarizeHandshake(n)
+	if oh.NegotiatedVersion != nh.NegotiatedVersion {
+		add("negotiated_version", nilIfEmpty(oh.NegotiatedVersion), nilIfEmpty(nh.NegotiatedVersion), false)
+	}
+	if oh.ClientVersion != nh.ClientVersion {
+		add("client_version", nilIfEmpty(oh.ClientVersion), nilIfEmpty(nh.ClientVersion), false)
+	}
+	if oh.ALPN != nh.ALPN {
+		add("alpn", nilIfEmpty(oh.ALPN), nilIfEmpty(nh.ALPN), false)
+	}
+	compareMaps("transport_parameters.", oh.TransportParameters, nh.TransportParameters, volatileTransportParameters, true, add)
+
+	switch {
+	case oh.HandshakeDuration >= 0 && nh.HandshakeDuration < 0:
+		add("handshake_duration", oh.HandshakeDuration, nil, true)
+	case oh.HandshakeDuration < 0 && nh.HandshakeDuration >= 0:
+		add("handshake_duration", nil, nh.HandshakeDuration, false)
+	case oh.HandshakeDuration >= 0 && options.TimingThreshold > 0:
+		base := oh.HandshakeDuration
+		if base == 0 {
+			base = 1
+		}
+		delta := float64(nh.HandshakeDuration-oh.HandshakeDuration) / float64(base)
+		if delta > options.TimingThreshold || -delta > options.TimingThreshold {
+			add("handshake_duration", oh.HandshakeDuration, nh.HandshakeDuration, delta > 0 && options.TimingRegressions)
+		}
+	}
+	return changes
+}
+
+// compareMaps reports the keys added to or removed from a map, and the values that changed if requested.
+func compareMaps(prefix string, old, new map[string]interface{}, ignored map[string]bool, values bool, add func(string, interface{}, interface{}, bool)) {
+	var keys []string
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if ignored[k] {
+			continue
+		}
+		o, inOld := old[k]
+		n, inNew := new[k]
+		if inOld != inNew || values && !reflect.DeepEqual(o, n) {
+			add(prefix+k, o, n, false)
+		}
+	}
+}
+
+func nilIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// WriteText writes a human-readable description of the differences.
+func (d *Diff) WriteText(w io.Writer) {
+	for _, td := range d.Traces {
+		marker := ""
+		if td.Regression {
+			marker = " (regression)"
+		}
+		fmt.Fprintf(w, "%s: %s%s\n", td.Key, td.Status, marker)
+		for _, c := range td.Changes {
+			marker = ""
+			if c.Regression {
+				marker = " (regression)"
+			}
+			fmt.Fprintf(w, "  %s: %s -> %s%s\n", c.Field, formatValue(c.Old), formatValue(c.New), marker)
+		}
+	}
+	fmt.Fprintf(w, "%d trace(s) unchanged, %d with differences, %d regression(s)\n", d.Unchanged, len(d.Traces), d.Regressions)
+}
+
+func formatValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "<absent>"
+	case string:
+		return fmt.Sprintf("%q", value)
+	case []byte:
+		return fmt.Sprintf("%x", value)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// compareChecks reports the checks whose status changed as checks.<name>. A check that used to pass regresses when it
+// fails.
+func compareChecks(old, new []qt.Check, add func(field string, old, new interface{}, regression bool)) {
+	statuses := func(checks []qt.Check) map[string]qt.CheckStatus {
+		m := make(map[string]qt.CheckStatus)
+		for _, c := range checks {
+			m[c.Name] = c.Status
+		}
+		return m
+	}
+	o, n := statuses(old), statuses(new)
+	var names []string
+	for name := range o {
+		names = append(names, name)
+	}
+	for name := range n {
+		if _, ok := o[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		oStatus, oOk := o[name]
+		nStatus, nOk := n[name]
+		switch {
+		case !oOk:
+			add("checks."+name, nil, nStatus, false)
+		case !nOk:
+			add("checks."+name, oStatus, nil, false)
+		case oStatus != nStatus:
+			add("checks."+name, oStatus, nStatus, oStatus == qt.CheckPassed && nStatus == qt.CheckFailed)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package results
+
+import (
+	"encoding/xml"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"io"
+	"sort"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr,omitempty"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the traces as a JUnit XML report, with a test suite per scenario and a test case per host. A
+// scenario failing is reported as a failure and a scenario that could not be run as an error. Their message is the
+// verdict returned by describe and their body the error reported in the results of the trace. When a scenario was
+// attempted several times against a host, the test case aggregates its attempts and a flaky scenario passes, its
+// attempts being listed in the output of the test case. The checks recorded by the trace are also listed in it.
+func WriteJUnit(w io.Writer, name string, traces []*qt.Trace, describe func(scenario string, errorCode uint8) string) error {
+	index := Aggregate(traces)
+	var keys []Key
+	for k := range index {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Scenario < keys[j].Scenario || keys[i].Scenario == keys[j].Scenario && keys[i].Host < keys[j].Host
+	})
+
+	report := junitTestSuites{Name: name}
+	for _, k := range keys {
+		s := index[k]
+		t := s.Verdict()
+		if len(report.Suites) == 0 || report.Suites[len(report.Suites)-1].Name != k.Scenario {
+			report.Suites = append(report.Suites, junitTestSuite{Name: k.Scenario, Timestamp: time.Unix(t.StartedAt, 0).UTC().Format("2006-01-02T15:04:05")})
+		}
+		suite := &report.Suites[len(report.Suites)-1]
+
+		tc := junitTestCase{Name: k.Host, ClassName: k.Scenario}
+		for _, a := range s.Attempts {
+			tc.Time += float64(a.Duration) / 1000
+		}
+		problem := &junitProblem{Message: describe(t.Scenario, t.ErrorCode), Type: fmt.Sprintf("error code %d", t.ErrorCode), Body: traceError(t)}
+		if len(s.Attempts) > 1 {
+			tc.SystemOut = fmt.Sprintf("%s, passed %d/%d attempts\n", s.Outcome, s.Passed, len(s.Attempts))
+			for i, a := range s.Attempts {
+				tc.SystemOut += fmt.Sprintf("attempt %d: %s\n", i+1, describe(a.Scenario, a.ErrorCode))
+			}
+		}
+		for _, c := range t.Checks {
+			tc.SystemOut += fmt.Sprintf("check %s: %s", c.Name, c.Status)
+			if c.Message != "" {
+				tc.SystemOut += ", " + c.Message
+			}
+			tc.SystemOut += "\n"
+		}
+		switch s.Outcome {
+		case OutcomeFailed:
+			tc.Failure = problem
+			suite.Failures++
+			report.Failures++
+		case OutcomeError:
+			tc.Error = problem
+			suite.Errors++
+			report.Errors++
+		}
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+		suite.Time += tc.Time
+		report.Tests++
+		report.Time += tc.Time
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// traceError returns the error reported in the results of a trace, if any, or the reason of its crash.
+func traceError(t *qt.Trace) string {
+	for _, key := range []string{"error", "udp_error", "crash"} {
+		if message, ok := t.Results[key]; ok {
+			return fmt.Sprint(message)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,23 @@
+package results
+
+import (
+	"bytes"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"strings"
+	"testing"
+)
+
+func TestWriteJUnit_Crash(t *testing.T) {
+	trace := qt.NewTrace("zero_rtt", 1, "a.example")
+	trace.ErrorCode = 254
+	trace.Results["crash"] = "HTTP3Agent panicked: index out of range"
+	describe := func(scenario string, errorCode uint8) string { return "The scenario crashed" }
+
+	buffer := new(bytes.Buffer)
+	if err := WriteJUnit(buffer, "test", []*qt.Trace{trace}, describe); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), "HTTP3Agent panicked: index out of range</error>") {
+		t.Errorf("the reason of the crash is missing from the error: %s", buffer.String())
+	}
+}
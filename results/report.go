@@ -0,0 +1,338 @@
+package results
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The outcomes of a trace.
+const (
+	OutcomePassed = "passed"
+	OutcomeFailed = "failed" // The scenario reported a failure of the host
+	OutcomeError  = "error"  // The scenario could not be run, because it crashed or the host could not be reached
+)
+
+// OutcomeOf returns the outcome of a trace. The error codes above 253 are reserved to the test suite.
+func OutcomeOf(t *qt.Trace) string {
+	switch {
+	case t.ErrorCode == 0:
+		return OutcomePassed
+	case t.ErrorCode >= 254:
+		return OutcomeError
+	}
+	return OutcomeFailed
+}
+
+// A Cell of a Report holds the verdict of a scenario run against a host, over one or several attempts.
+type Cell struct {
+	*Stability
+	Trace   *qt.Trace // The trace that determines the verdict
+	Verdict string    // A human-readable description of its error code
+	Links   []string  // The location of the trace of each attempt, if known
+}
+
+// ErrorCodeCounts returns the number of attempts that ended with each error code when there were several of them.
+func (c *Cell) ErrorCodeCounts() string {
+	if len(c.Attempts) < 2 {
+		return ""
+	}
+	var codes []int
+	for code := range c.ErrorCodes {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	var counts []string
+	for _, code := range codes {
+		counts = append(counts, fmt.Sprintf("%d×%d", code, c.ErrorCodes[uint8(code)]))
+	}
+	return strings.Join(counts, ", ")
+}
+
+// PassedAttempts returns a description of the attempts that passed when there were several of them.
+func (c *Cell) PassedAttempts() string {
+	if len(c.Attempts) < 2 {
+		return ""
+	}
+	return fmt.Sprintf("passed %d/%d", c.Passed, len(c.Attempts))
+}
+
+// Error returns the error message reported in the results of the trace, if any.
+func (c *Cell) Error() string {
+	return traceError(c.Trace)
+}
+
+// CheckSummary returns the number of checks of the trace that passed, if it recorded checks.
+func (c *Cell) CheckSummary() string {
+	if len(c.Trace.Checks) == 0 {
+		return ""
+	}
+	counts := make(map[qt.CheckStatus]int)
+	for _, check := range c.Trace.Checks {
+		counts[check.Status]++
+	}
+	summary := fmt.Sprintf("%d/%d checks passed", counts[qt.CheckPassed], len(c.Trace.Checks))
+	if counts[qt.CheckSkipped] > 0 {
+		summary += fmt.Sprintf(", %d skipped", counts[qt.CheckSkipped])
+	}
+	return summary
+}
+
+// A CheckRow is a check recorded by the trace of a cell.
+type CheckRow struct {
+	Host     string
+	Scenario string
+	qt.Check
+	Link string // The location of the trace, if known
+}
+
+var checkClasses = map[qt.CheckStatus]string{qt.CheckPassed: OutcomePassed, qt.CheckFailed: OutcomeFailed, qt.CheckSkipped: "skipped"}
+var checkSymbols = map[qt.CheckStatus]string{qt.CheckPassed: "✓", qt.CheckFailed: "✗", qt.CheckSkipped: "-"}
+
+// Class returns the CSS class of the status of the check.
+func (r CheckRow) Class() string {
+	return checkClasses[r.Status]
+}
+
+// A Report arranges the traces of a results file in a matrix of hosts and scenarios.
+type Report struct {
+	Title     string
+	Hosts     []string
+	Scenarios []string
+	Cells     map[Key]*Cell
+}
+
+// NewReport builds the report of the given traces, aggregating the attempts of each scenario against each host.
+// describe returns the verdict corresponding to an error code of a scenario, link returns the location of a trace, and
+// can be nil.
+func NewReport(title string, traces []*qt.Trace, describe func(scenario string, errorCode uint8) string, link func(*qt.Trace) string) *Report {
+	r := &Report{Title: title, Cells: make(map[Key]*Cell)}
+	for k, s := range Aggregate(traces) {
+		t := s.Verdict()
+		cell := &Cell{Stability: s, Trace: t, Verdict: describe(t.Scenario, t.ErrorCode)}
+		for _, a := range s.Attempts {
+			if link != nil && link(a) != "" {
+				cell.Links = append(cell.Links, link(a))
+			}
+		}
+		r.Cells[k] = cell
+	}
+
+	hosts, scenarios := make(map[string]bool), make(map[string]bool)
+	for k := range r.Cells {
+		if !hosts[k.Host] {
+			hosts[k.Host] = true
+			r.Hosts = append(r.Hosts, k.Host)
+		}
+		if !scenarios[k.Scenario] {
+			scenarios[k.Scenario] = true
+			r.Scenarios = append(r.Scenarios, k.Scenario)
+		}
+	}
+	sort.Strings(r.Hosts)
+	sort.Strings(r.Scenarios)
+	return r
+}
+
+// Cell returns the cell of the given host and scenario, or nil if the scenario was not run against the host.
+func (r *Report) Cell(host, scenario string) *Cell {
+	return r.Cells[Key{host, scenario}]
+}
+
+// CheckRows returns the checks recorded by the traces of the cells, by host and scenario.
+func (r *Report) CheckRows() []CheckRow {
+	var rows []CheckRow
+	for _, h := range r.Hosts {
+		for _, s := range r.Scenarios {
+			c := r.Cell(h, s)
+			if c == nil {
+				continue
+			}
+			var link string
+			if len(c.Links) == 1 {
+				link = c.Links[0]
+			}
+			for _, check := range c.Trace.Checks {
+				rows = append(rows, CheckRow{h, s, check, link})
+			}
+		}
+	}
+	return rows
+}
+
+// Counts returns the number of cells of each outcome.
+func (r *Report) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, c := range r.Cells {
+		counts[c.Outcome]++
+	}
+	return counts
+}
+
+var outcomeSymbols = map[string]string{OutcomePassed: "✓", OutcomeFlaky: "~", OutcomeFailed: "✗", OutcomeError: "⚠"}
+
+// WriteMarkdown writes the report as a Markdown table, with a row per host and a column per scenario, followed by a
+// table of the checks recorded by the traces.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	escape := strings.NewReplacer("|", `\|`, "[", `\[`, "]", `\]`, "\n", " ")
+	escapeLink := strings.NewReplacer(" ", "%20", "|", "%7C", "(", "%28", ")", "%29")
+	if r.Title != "" {
+		fmt.Fprintf(w, "# %s\n\n", escape.Replace(r.Title))
+	}
+	counts := r.Counts()
+	fmt.Fprintf(w, "%d passed, %d flaky, %d failed, %d error(s)\n\n", counts[OutcomePassed], counts[OutcomeFlaky], counts[OutcomeFailed], counts[OutcomeError])
+
+	fmt.Fprint(w, "| Host |")
+	for _, s := range r.Scenarios {
+		fmt.Fprintf(w, " %s |", escape.Replace(s))
+	}
+	fmt.Fprint(w, "\n|---|")
+	for range r.Scenarios {
+		fmt.Fprint(w, "---|")
+	}
+	fmt.Fprintln(w)
+	for _, h := range r.Hosts {
+		fmt.Fprintf(w, "| %s |", escape.Replace(h))
+		for _, s := range r.Scenarios {
+			c := r.Cell(h, s)
+			if c == nil {
+				fmt.Fprint(w, " |")
+				continue
+			}
+			text := outcomeSymbols[c.Outcome] + " " + escape.Replace(c.Verdict)
+			if len(c.Links) == 1 {
+				text = fmt.Sprintf("[%s](%s)", text, escapeLink.Replace(c.Links[0]))
+			}
+			if c.PassedAttempts() != "" {
+				text += " (" + c.PassedAttempts() + ")"
+			}
+			if len(c.Links) > 1 {
+				for i, l := range c.Links {
+					text += fmt.Sprintf(" [#%d](%s)", i+1, escapeLink.Replace(l))
+				}
+			}
+			fmt.Fprintf(w, " %s |", text)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if rows := r.CheckRows(); len(rows) > 0 {
+		fmt.Fprint(w, "\n## Checks\n\n| Host | Scenario | Check | Status | Message |\n|---|---|---|---|---|\n")
+		for _, row := range rows {
+			scenario := escape.Replace(row.Scenario)
+			if row.Link != "" {
+				scenario = fmt.Sprintf("[%s](%s)", scenario, escapeLink.Replace(row.Link))
+			}
+			fmt.Fprintf(w, "| %s | %s | %s | %s %s | %s |\n", escape.Replace(row.Host), scenario, escape.Replace(row.Name), checkSymbols[row.Status], row.Status, escape.Replace(row.Message))
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the report as CSV, with a row per host and a column per scenario. Each cell contains the error code
+// and the verdict of the trace, followed by the attempts that passed when there were several of them. The checks
+// recorded by the traces follow after an empty line, with a row per check, so the file has records of different lengths.
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write(append([]string{"host"}, r.Scenarios...))
+	for _, h := range r.Hosts {
+		record := []string{h}
+		for _, s := range r.Scenarios {
+			if c := r.Cell(h, s); c != nil {
+				text := fmt.Sprintf("%d: %s", c.Trace.ErrorCode, c.Verdict)
+				if c.PassedAttempts() != "" {
+					text += fmt.Sprintf(" (%s, %s)", c.Outcome, c.PassedAttempts())
+				}
+				record = append(record, text)
+			} else {
+				record = append(record, "")
+			}
+		}
+		writer.Write(record)
+	}
+
+	if rows := r.CheckRows(); len(rows) > 0 {
+		writer.Write(nil)
+		writer.Write([]string{"host", "scenario", "check", "status", "message"})
+		for _, row := range rows {
+			writer.Write([]string{row.Host, row.Scenario, row.Name, string(row.Status), row.Message})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{"inc": func(i int) int { return i + 1 }}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px; font-size: small; }
+th.scenario { writing-mode: vertical-rl; transform: rotate(180deg); }
+td.passed { background: #c8e6c9; }
+td.flaky { background: #fff9c4; }
+td.failed { background: #ffcdd2; }
+td.error { background: #ffe0b2; }
+td.skipped { background: #eeeeee; }
+</style>
+</head>
+<body>
+{{if .Title}}<h1>{{.Title}}</h1>{{end}}
+{{with .Counts}}<p>{{index . "passed"}} passed, {{index . "flaky"}} flaky, {{index . "failed"}} failed, {{index . "error"}} error(s)</p>{{end}}
+<table>
+<tr><th>Host</th>{{range .Scenarios}}<th class="scenario">{{.}}</th>{{end}}</tr>
+{{range $host := .Hosts}}<tr><th>{{$host}}</th>{{range $scenario := $.Scenarios}}{{with $.Cell $host $scenario}}<td class="{{.Outcome}}" title="{{.Trace.ErrorCode}}: {{.Verdict}}{{with .Error}} ({{.}}){{end}}{{with .ErrorCodeCounts}}, error codes {{.}}{{end}}{{with .CheckSummary}}, {{.}}{{end}}">{{if eq (len .Links) 1}}<a href="{{index .Links 0}}">{{.Verdict}}</a>{{else}}{{.Verdict}}{{end}}{{with .PassedAttempts}} ({{.}}){{end}}{{if gt (len .Links) 1}}{{range $i, $l := .Links}} <a href="{{$l}}">#{{inc $i}}</a>{{end}}{{end}}</td>{{else}}<td></td>{{end}}{{end}}</tr>
+{{end}}</table>
+{{with .CheckRows}}<h2>Checks</h2>
+<table>
+<tr><th>Host</th><th>Scenario</th><th>Check</th><th>Status</th><th>Message</th></tr>
+{{range .}}<tr><td>{{.Host}}</td><td>{{if .Link}}<a href="{{.Link}}">{{.Scenario}}</a>{{else}}{{.Scenario}}{{end}}</td><td>{{.Name}}</td><td class="{{.Class}}">{{.Status}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the report as a static HTML page, with a row per host and a column per scenario. Each cell links
+// to its trace when its location is known. The checks recorded by the traces are listed below.
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlReport.Execute(w, r)
+}
+
+var unsafeFilenameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// SaveTraces writes each trace to its own file in the given directory, so that a report can link to them. It returns
+// the path of the file of each trace.
+func SaveTraces(dir string, traces []*qt.Trace) (map[*qt.Trace]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	paths := make(map[*qt.Trace]string)
+	for _, t := range traces {
+		content, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		name := unsafeFilenameCharacters.ReplaceAllString(t.Host, "_") + "_" + t.Scenario
+		if t.Attempt > 1 {
+			name += fmt.Sprintf("_%d", t.Attempt)
+		}
+		path := filepath.Join(dir, name+".json")
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			return nil, err
+		}
+		paths[t] = path
+	}
+	return paths, nil
+}
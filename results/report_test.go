@@ -0,0 +1,38 @@
+package results
+
+import (
+	"bytes"
+	"encoding/csv"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"reflect"
+	"testing"
+)
+
+func TestReport_WriteCSV(t *testing.T) {
+	trace := qt.NewTrace("connection_migration", 2, "a.example")
+	trace.Pass("host_migrated", "")
+	trace.Fail("host_used_new_cid", 6, "the host kept using the connection ID of the original path")
+	describe := func(scenario string, errorCode uint8) string { return "verdict" }
+	report := NewReport("", []*qt.Trace{trace}, describe, nil)
+
+	buffer := new(bytes.Buffer)
+	if err := report.WriteCSV(buffer); err != nil {
+		t.Fatal(err)
+	}
+	reader := csv.NewReader(buffer)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"host", "connection_migration"},
+		{"a.example", "6: verdict"},
+		{"host", "scenario", "check", "status", "message"},
+		{"a.example", "connection_migration", "host_migrated", "pass", ""},
+		{"a.example", "connection_migration", "host_used_new_cid", "fail", "the host kept using the connection ID of the original path"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected %q, got %q", expected, records)
+	}
+}
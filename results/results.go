@@ -0,0 +1,49 @@
+// Package results reads the results files produced by the test suite and compares and reports them.
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"io/ioutil"
+)
+
+// A Key identifies the trace of a scenario run against a host in a results file.
+type Key struct {
+	Host     string `json:"host"`
+	Scenario string `json:"scenario"`
+}
+
+func (k Key) String() string {
+	return k.Host + " × " + k.Scenario
+}
+
+// KeyOf returns the key of a trace.
+func KeyOf(t *qt.Trace) Key {
+	return Key{t.Host, t.Scenario}
+}
+
+// Load reads a results file, which contains either a single trace or a list of traces.
+func Load(filename string) ([]*qt.Trace, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(content)
+}
+
+// Parse reads the content of a results file.
+func Parse(content []byte) ([]*qt.Trace, error) {
+	var traces []*qt.Trace
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(content, &traces); err != nil {
+			return nil, err
+		}
+		return traces, nil
+	}
+	trace := new(qt.Trace)
+	if err := json.Unmarshal(content, trace); err != nil {
+		return nil, err
+	}
+	return append(traces, trace), nil
+}
@@ -0,0 +1,68 @@
+package results
+
+import (
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"sort"
+)
+
+// OutcomeFlaky is the outcome of a scenario that both passed and did not pass against a host over several attempts.
+const OutcomeFlaky = "flaky"
+
+// A Stability aggregates the attempts of a scenario run against a host into a stable verdict.
+type Stability struct {
+	Key
+	Attempts   []*qt.Trace   `json:"-"` // The traces of the attempts, in order
+	Passed     int           `json:"passed"`
+	PassRatio  float64       `json:"pass_ratio"`
+	ErrorCodes map[uint8]int `json:"error_codes"` // The number of attempts that ended with each error code
+	Outcome    string        `json:"outcome"`
+}
+
+// Aggregate groups the traces of each scenario run against each host and computes their stability.
+func Aggregate(traces []*qt.Trace) map[Key]*Stability {
+	aggregate := make(map[Key]*Stability)
+	for _, t := range traces {
+		s, ok := aggregate[KeyOf(t)]
+		if !ok {
+			s = &Stability{Key: KeyOf(t), ErrorCodes: make(map[uint8]int)}
+			aggregate[s.Key] = s
+		}
+		s.Attempts = append(s.Attempts, t)
+	}
+	for _, s := range aggregate {
+		sort.SliceStable(s.Attempts, func(i, j int) bool { return s.Attempts[i].Attempt < s.Attempts[j].Attempt })
+		errors := 0
+		for _, t := range s.Attempts {
+			s.ErrorCodes[t.ErrorCode]++
+			switch OutcomeOf(t) {
+			case OutcomePassed:
+				s.Passed++
+			case OutcomeError:
+				errors++
+			}
+		}
+		s.PassRatio = float64(s.Passed) / float64(len(s.Attempts))
+		switch {
+		case s.Passed == len(s.Attempts):
+			s.Outcome = OutcomePassed
+		case s.Passed > 0:
+			s.Outcome = OutcomeFlaky
+		case errors == len(s.Attempts):
+			s.Outcome = OutcomeError
+		default:
+			s.Outcome = OutcomeFailed
+		}
+	}
+	return aggregate
+}
+
+// Verdict returns the trace that determines the verdict, i.e. the last attempt that did not pass, or the last one when
+// they all passed.
+func (s *Stability) Verdict() *qt.Trace {
+	for i := len(s.Attempts) - 1; i >= 0; i-- {
+		if s.Attempts[i].ErrorCode != 0 {
+			return s.Attempts[i]
+		}
+	}
+	return s.Attempts[len(s.Attempts)-1]
+}
@@ -0,0 +1,69 @@
+package results
+
+import (
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"testing"
+)
+
+// attempts returns the traces of successive attempts of a scenario ending with the given error codes.
+func attempts(host, scenario string, errorCodes ...uint8) []*qt.Trace {
+	var traces []*qt.Trace
+	for i, code := range errorCodes {
+		t := qt.NewTrace(scenario, 1, host)
+		t.Attempt = i + 1
+		t.ErrorCode = code
+		traces = append(traces, t)
+	}
+	return traces
+}
+
+func TestAggregate(t *testing.T) {
+	var traces []*qt.Trace
+	traces = append(traces, attempts("a.example", "handshake", 0, 0)...)
+	traces = append(traces, attempts("a.example", "zero_rtt", 2, 0, 2)...)
+	traces = append(traces, attempts("b.example", "handshake", 3, 3)...)
+	traces = append(traces, attempts("b.example", "zero_rtt", 254)...)
+	aggregate := Aggregate(traces)
+
+	for _, c := range []struct {
+		key       Key
+		outcome   string
+		passed    int
+		errorCode uint8
+	}{
+		{Key{"a.example", "handshake"}, OutcomePassed, 2, 0},
+		{Key{"a.example", "zero_rtt"}, OutcomeFlaky, 1, 2},
+		{Key{"b.example", "handshake"}, OutcomeFailed, 0, 3},
+		{Key{"b.example", "zero_rtt"}, OutcomeError, 0, 254},
+	} {
+		s := aggregate[c.key]
+		if s == nil {
+			t.Errorf("%v was not aggregated", c.key)
+			continue
+		}
+		if s.Outcome != c.outcome || s.Passed != c.passed || s.Verdict().ErrorCode != c.errorCode {
+			t.Errorf("%v: outcome %s, %d passed and verdict %d, expected %s, %d and %d", c.key, s.Outcome, s.Passed, s.Verdict().ErrorCode, c.outcome, c.passed, c.errorCode)
+		}
+	}
+	if s := aggregate[Key{"a.example", "zero_rtt"}]; s.ErrorCodes[2] != 2 || s.PassRatio != 1.0/3 {
+		t.Errorf("unexpected error codes %v and pass ratio %f", s.ErrorCodes, s.PassRatio)
+	}
+}
+
+func TestCompareAttempts(t *testing.T) {
+	old := append(attempts("a.example", "handshake", 0), attempts("a.example", "zero_rtt", 2)...)
+	new := append(attempts("a.example", "handshake", 3, 0), attempts("a.example", "zero_rtt", 2, 0)...)
+	d := Compare(old, new, DiffOptions{})
+
+	if len(d.Traces) != 2 || d.Regressions != 1 {
+		t.Fatalf("unexpected diff %+v", d)
+	}
+	// A scenario passing only after a retry is flaky, which is a regression of a passing scenario
+	if td := d.Traces[0]; td.Scenario != "handshake" || !td.Regression || td.Changes[0] != (Change{"outcome", OutcomePassed, OutcomeFlaky, true}) {
+		t.Errorf("unexpected diff of handshake %+v", td)
+	}
+	// and not a fix of a failing one
+	if td := d.Traces[1]; td.Scenario != "zero_rtt" || td.Regression || len(td.Changes) != 1 || td.Changes[0] != (Change{"outcome", OutcomeFailed, OutcomeFlaky, false}) {
+		t.Errorf("unexpected diff of zero_rtt %+v", td)
+	}
+}
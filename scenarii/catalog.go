@@ -0,0 +1,188 @@
+package scenarii
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Metadata describes a scenario in the catalog of the test suite.
+type Metadata struct {
+	Name        string           `json:"name"`
+	Version     int              `json:"version"`
+	Description string           `json:"description"`
+	RFCSections []string         `json:"rfc_sections"` // The sections of the specifications the scenario covers, e.g. RFC 9000 §8.1
+	Tags        []string         `json:"tags"`
+	ErrorCodes  map[uint8]string `json:"error_codes"` // A description of each error code the scenario can report
+}
+
+type catalogEntry struct {
+	description string
+	rfcSections []string
+	tags        []string
+}
+
+// The description, specifications and tags of each scenario, indexed by scenario name. The http3 and ipv6 tags are
+// derived from the scenarios themselves.
+var catalog = map[string]catalogEntry{
+	"ack_ecn": {"Checks that the host marks its packets with ECN and reports the ECN counts of the packets received in its ACK frames.",
+		[]string{"RFC 9000 §13.4", "RFC 9000 §19.3.2"}, []string{"ecn", "recovery"}},
+	"ack_only": {"Checks that the host does not acknowledge packets containing only ACK frames.",
+		[]string{"RFC 9000 §13.2.1"}, []string{"recovery"}},
+	"address_validation": {"Checks that the host limits the amount of data it sends before the address of the client is validated.",
+		[]string{"RFC 9000 §8.1"}, []string{"handshake", "security", "slow"}},
+	"closed_connection": {"Checks that the host does not answer packets sent after the connection was closed.",
+		[]string{"RFC 9000 §10.2"}, []string{"closing", "slow"}},
+	"connection_migration": {"Migrates the connection to a new UDP port and checks that the host validates the new path and continues the connection on it.",
+		[]string{"RFC 9000 §8.2", "RFC 9000 §9"}, []string{"migration", "slow"}},
+	"connection_migration_v4_v6": {"Migrates the connection from IPv4 to IPv6 and checks that the host validates the new path and continues the connection on it.",
+		[]string{"RFC 9000 §8.2", "RFC 9000 §9"}, []string{"migration", "connection_ids", "slow"}},
+	"flow_control": {"Requests a resource larger than the flow control limits and checks that the host respects them and resumes sending when they are raised.",
+		[]string{"RFC 9000 §4"}, []string{"flow_control", "hq"}},
+	"handshake": {"Completes a handshake with the host.",
+		[]string{"RFC 9000 §7", "RFC 9001 §4"}, []string{"handshake"}},
+	"handshake_v6": {"Completes a handshake with the host over IPv6.",
+		[]string{"RFC 9000 §7", "RFC 9001 §4"}, []string{"handshake"}},
+	"http3_encoder_stream": {"Performs an HTTP/3 request whose headers are inserted in the QPACK dynamic table.",
+		[]string{"RFC 9114 §6.2", "RFC 9204 §4.2"}, []string{"qpack"}},
+	"http3_data_before_headers": {"Sends a DATA frame before the HEADERS frame of an HTTP/3 request and checks that the host closes the connection with an H3_FRAME_UNEXPECTED.",
+		[]string{"RFC 9114 §4.1", "RFC 9114 §7.2.1"}, nil},
+	"http3_get": {"Performs an HTTP/3 request.",
+		[]string{"RFC 9114 §4.1"}, nil},
+	"http3_post": {"Performs an HTTP/3 POST request with a body and trailers and checks that the host answers it.",
+		[]string{"RFC 9114 §4.1"}, []string{"upload"}},
+	"http3_reserved_frames": {"Performs an HTTP/3 request preceded by frames of reserved types on the request stream, which the host must ignore.",
+		[]string{"RFC 9114 §7.2.8", "RFC 9114 §9"}, []string{"extensibility"}},
+	"http3_reserved_streams": {"Performs an HTTP/3 request after opening unidirectional streams of reserved types, which the host must ignore.",
+		[]string{"RFC 9114 §6.2.3", "RFC 9114 §9"}, []string{"extensibility"}},
+	"http3_uni_streams_limits": {"Allows a single unidirectional stream and checks that the host does not open more streams than allowed.",
+		[]string{"RFC 9114 §6.2", "RFC 9000 §4.6"}, []string{"streams"}},
+	"http3_upload_flow_control": {"Uploads a body larger than the flow control credit of the host in an HTTP/3 request and checks that the host extends its credit.",
+		[]string{"RFC 9000 §4.1", "RFC 9000 §4.2"}, []string{"flow_control", "upload"}},
+	"http_get_and_wait": {"Performs an HTTP/0.9 request and checks the STREAM frames received and that the host closes the connection.",
+		[]string{"RFC 9000 §2", "RFC 9000 §19.8"}, []string{"streams", "hq", "slow"}},
+	"http_get_on_uni_stream": {"Performs an HTTP/0.9 request on a unidirectional stream and checks that the host does not answer on it.",
+		[]string{"RFC 9000 §2.1", "RFC 9000 §19.8"}, []string{"streams", "hq"}},
+	"key_update": {"Updates the 1-RTT keys and checks that the host continues the connection using the new keys.",
+		[]string{"RFC 9001 §6"}, []string{"tls"}},
+	"multi_packet_client_hello": {"Sends a ClientHello split in two Initial packets in the reverse order.",
+		[]string{"RFC 9000 §14.1", "RFC 9001 §4.3"}, []string{"handshake", "slow"}},
+	"multi_stream": {"Performs several HTTP/0.9 requests on concurrent streams and checks that the host answers all of them.",
+		[]string{"RFC 9000 §2", "RFC 9000 §4.6"}, []string{"streams", "hq"}},
+	"new_connection_id": {"Checks that the host provides new connection IDs and uses the ones provided by the client.",
+		[]string{"RFC 9000 §5.1", "RFC 9000 §19.15"}, []string{"connection_ids"}},
+	"padding": {"Sends an Initial packet containing only PADDING frames and checks that the host does not answer it.",
+		[]string{"RFC 9000 §14.1", "RFC 9000 §19.1"}, []string{"handshake"}},
+	"retire_connection_id": {"Retires the connection IDs provided by the host and checks that it provides new ones.",
+		[]string{"RFC 9000 §5.1.2", "RFC 9000 §19.16"}, []string{"connection_ids"}},
+	"server_flow_control": {"Sends more data than allowed by the host and checks that it closes the connection with a FLOW_CONTROL_ERROR.",
+		[]string{"RFC 9000 §4.1"}, []string{"flow_control"}},
+	"spin_bit": {"Performs requests and checks that the host spins the latency spin bit.",
+		[]string{"RFC 9000 §17.4"}, []string{"slow"}},
+	"stop_sending_frame_on_receive_stream": {"Sends a STOP_SENDING frame on a receive-only stream and checks that the host closes the connection with a STREAM_STATE_ERROR.",
+		[]string{"RFC 9000 §19.5"}, []string{"streams"}},
+	"stream_opening_reordering": {"Sends the end of an HTTP/0.9 request before its beginning and checks that the host answers it.",
+		[]string{"RFC 9000 §2.2"}, []string{"streams", "hq"}},
+	"transport_parameters": {"Checks that the host sends its transport parameters and records them.",
+		[]string{"RFC 9000 §7.4", "RFC 9000 §18"}, []string{"handshake"}},
+	"unsupported_tls_version": {"Proposes only an unsupported TLS version and checks that the host closes the connection with the protocol_version alert.",
+		[]string{"RFC 9001 §4.2"}, []string{"handshake", "tls"}},
+	"version_negotiation": {"Proposes a reserved version and checks the Version Negotiation packets sent by the host.",
+		[]string{"RFC 9000 §6", "RFC 9000 §17.2.1"}, []string{"handshake", "version_negotiation"}},
+	"zero_length_cid": {"Uses a zero-length connection ID and checks that the host answers a request.",
+		[]string{"RFC 9000 §5.1"}, []string{"connection_ids", "slow"}},
+	"zero_rtt": {"Resumes a connection with the ticket of a previous one and performs a request using 0-RTT.",
+		[]string{"RFC 9001 §4.6", "RFC 9000 §7.4.1"}, []string{"handshake", "0rtt", "slow"}},
+}
+
+// Metadata returns the description of the scenario in the catalog.
+func (s *AbstractScenario) Metadata() Metadata {
+	registry.RLock()
+	defer registry.RUnlock()
+	entry := catalog[s.name]
+	m := Metadata{Name: s.name, Version: s.version, Description: entry.description, RFCSections: entry.rfcSections, ErrorCodes: make(map[uint8]string)}
+	m.Tags = append(m.Tags, entry.tags...)
+	if s.http3 {
+		m.Tags = append(m.Tags, "http3")
+	}
+	if s.ipv6 {
+		m.Tags = append(m.Tags, "ipv6")
+	}
+	sort.Strings(m.Tags)
+	for code, description := range errorCodeDescriptions[s.name] {
+		m.ErrorCodes[code] = description
+	}
+	return m
+}
+
+// HasTag reports whether the scenario has the given tag.
+func (m Metadata) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Catalog returns the metadata of all the scenarios, sorted by name.
+func Catalog() []Metadata {
+	var catalog []Metadata
+	for _, s := range GetAllScenarii() {
+		catalog = append(catalog, s.Metadata())
+	}
+	sort.Slice(catalog, func(i, j int) bool { return catalog[i].Name < catalog[j].Name })
+	return catalog
+}
+
+// Select returns the names of the scenarios that match a selection expression, sorted. The expression is a
+// comma-separated list of terms. A term is either tag:<tag> or a name, in which * and ? can be used, and which also
+// matches a tag of the same name. A term prefixed with ! excludes the scenarios it matches. The scenarios selected are
+// those that match one of the terms that are not exclusions, or all of them when there are none, and no exclusion.
+func Select(expression string) ([]string, error) {
+	var included, excluded []string
+	for _, term := range strings.Split(expression, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		if strings.HasPrefix(term, "!") {
+			excluded = append(excluded, strings.TrimSpace(term[1:]))
+		} else {
+			included = append(included, term)
+		}
+	}
+	for _, term := range append(append([]string{}, included...), excluded...) {
+		if term == "" || term == "tag:" {
+			return nil, errors.New("empty term in scenario selection " + expression)
+		}
+		if _, err := path.Match(term, ""); err != nil {
+			return nil, fmt.Errorf("invalid term %s in scenario selection", term)
+		}
+	}
+
+	var names []string
+	for _, m := range Catalog() {
+		selected := len(included) == 0
+		for _, term := range included {
+			selected = selected || m.matches(term)
+		}
+		for _, term := range excluded {
+			selected = selected && !m.matches(term)
+		}
+		if selected {
+			names = append(names, m.Name)
+		}
+	}
+	return names, nil
+}
+
+func (m Metadata) matches(term string) bool {
+	if strings.HasPrefix(term, "tag:") {
+		return m.HasTag(strings.TrimPrefix(term, "tag:"))
+	}
+	matched, _ := path.Match(term, m.Name)
+	return matched || m.HasTag(term)
+}
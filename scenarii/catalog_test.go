@@ -0,0 +1,46 @@
+package scenarii
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	for _, m := range Catalog() {
+		if m.Description == "" || len(m.RFCSections) == 0 {
+			t.Errorf("%s is missing from the catalog", m.Name)
+		}
+		if len(m.ErrorCodes) == 0 {
+			t.Errorf("%s has no error codes described", m.Name)
+		}
+	}
+	for name := range catalog {
+		if GetScenario(name) == nil {
+			t.Errorf("%s is not a scenario", name)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	for expression, expected := range map[string][]string{
+		"handshake":                  {"address_validation", "handshake", "handshake_v6", "multi_packet_client_hello", "padding", "transport_parameters", "unsupported_tls_version", "version_negotiation", "zero_rtt"},
+		"handshake*,!tag:ipv6":       {"handshake"},
+		"tag:http3,!http3_reserved*": {"http3_data_before_headers", "http3_encoder_stream", "http3_get", "http3_post", "http3_uni_streams_limits", "http3_upload_flow_control"},
+		"tag:migration,!slow":        nil,
+	} {
+		names, err := Select(expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("%s selected %v instead of %v", expression, names, expected)
+		}
+	}
+
+	if all, _ := Select(""); len(all) != len(GetAllScenarii()) {
+		t.Errorf("an empty selection selected %d scenarios", len(all))
+	}
+	if _, err := Select("tag:"); err == nil {
+		t.Error("an empty tag was accepted")
+	}
+}
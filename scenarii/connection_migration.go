@@ -2,6 +2,7 @@ package scenarii
 
 import (
 	"bytes"
+	"fmt"
 	qt "github.com/QUIC-Tracker/quic-tracker"
 	"math/rand"
 
@@ -14,6 +15,7 @@ const (
 	CM_HostDidNotMigrate         = 3
 	CM_HostDidNotValidateNewPath = 4
 	CM_TooManyCIDs			 	 = 5
+	CM_HostDidNotUseNewCID       = 6
 )
 
 type ConnectionMigrationScenario struct {
@@ -21,7 +23,7 @@ type ConnectionMigrationScenario struct {
 }
 
 func NewConnectionMigrationScenario() *ConnectionMigrationScenario {
-	return &ConnectionMigrationScenario{AbstractScenario{name: "connection_migration", version: 1}}
+	return &ConnectionMigrationScenario{AbstractScenario{name: "connection_migration", version: 2}}
 }
 func (s *ConnectionMigrationScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool) {
 	connAgents := s.CompleteHandshake(conn, trace, CM_TLSHandshakeFailed)
@@ -40,6 +42,7 @@ func (s *ConnectionMigrationScenario) Run(conn *qt.Connection, trace *qt.Trace,
 	conn.FrameQueue.Submit(qt.QueuedFrame{&qt.NewConnectionIdFrame{1, 0, uint8(len(scid)), scid, resetToken}, qt.EncryptionLevelBest})
 
 	var ncid []byte
+	var ncidPacket qt.Packet
 wait:
 	for {
 		select {
@@ -48,10 +51,12 @@ wait:
 			if fp, ok := p.(qt.Framer); ok && fp.Header().PacketType() == qt.ShortHeaderPacket && fp.Contains(qt.NewConnectionIdType) {
 				ncids := fp.GetAll(qt.NewConnectionIdType)
 				if len(ncids) > int(conn.TLSTPHandler.ActiveConnectionIdLimit) {
-					trace.MarkError(CM_TooManyCIDs, "", p)
+					trace.Fail("host_respected_connection_id_limit", CM_TooManyCIDs, fmt.Sprintf("the host provided %d connection IDs, the limit is %d", len(ncids), conn.TLSTPHandler.ActiveConnectionIdLimit), p)
+					skipChecks(trace, "the host provided too many connection IDs", "host_migrated", "host_validated_new_path", "host_used_new_cid")
 					return
 				}
 				ncid = ncids[0].(*qt.NewConnectionIdFrame).ConnectionId
+				ncidPacket = p
 			}
 		case <-t.C:
 			conn.IncomingPackets.Unregister(incPackets)
@@ -59,12 +64,18 @@ wait:
 			break wait
 		}
 	}
+	if ncidPacket != nil {
+		trace.Pass("host_respected_connection_id_limit", "", ncidPacket)
+	} else {
+		trace.Skip("host_respected_connection_id_limit", "no NEW_CONNECTION_ID frames were received")
+	}
 
 	connAgents.Stop("SocketAgent", "SendingAgent")
 
 	newUdpConn, err := qt.EstablishUDPConnection(conn.Host)
 	if err != nil {
-		trace.ErrorCode = CM_UDPConnectionFailed
+		trace.MarkError(CM_UDPConnectionFailed, err.Error(), nil)
+		skipChecks(trace, "the new UDP connection could not be established", "host_migrated", "host_validated_new_path", "host_used_new_cid")
 		return
 	}
 
@@ -78,22 +89,44 @@ wait:
 	incPackets = conn.IncomingPackets.RegisterNewChan(1000)
 
 	responseChan := connAgents.AddHTTPAgent().SendRequest(preferredPath, "GET", trace.Host, nil)
-	trace.ErrorCode = CM_HostDidNotMigrate // Assume it until proven wrong
+
+	var firstPacket, pathChallenge, newCIDPacket qt.Packet
+	defer func() {
+		if firstPacket == nil {
+			trace.Fail("host_migrated", CM_HostDidNotMigrate, "no packets were received on the new path")
+			skipChecks(trace, "the host did not migrate", "host_validated_new_path", "host_used_new_cid")
+			return
+		}
+		trace.Pass("host_migrated", "", firstPacket)
+		if pathChallenge != nil {
+			trace.Pass("host_validated_new_path", "", pathChallenge)
+		} else {
+			trace.Fail("host_validated_new_path", CM_HostDidNotValidateNewPath, "no PATH_CHALLENGE frames were received on the new path")
+		}
+		if newCIDPacket != nil {
+			trace.Pass("host_used_new_cid", "", newCIDPacket)
+		} else {
+			trace.Fail("host_used_new_cid", CM_HostDidNotUseNewCID, "the host kept using the connection ID of the original path", firstPacket)
+		}
+	}()
 
 	for {
 		select {
 		case i := <-incPackets:
 			p := i.(qt.Packet)
-			if trace.ErrorCode == CM_HostDidNotMigrate {
-				trace.ErrorCode = CM_HostDidNotValidateNewPath
+			if firstPacket == nil {
+				firstPacket = p
 				if bytes.Equal(p.Header().DestinationConnectionID(), scid) && ncid != nil {
 					conn.SourceCID = scid
 					conn.DestinationCID = ncid
 				}
 			}
+			if newCIDPacket == nil && bytes.Equal(p.Header().DestinationConnectionID(), scid) {
+				newCIDPacket = p
+			}
 
-			if fp, ok := p.(qt.Framer); ok && fp.Contains(qt.PathChallengeType) {
-				trace.ErrorCode = 0
+			if fp, ok := p.(qt.Framer); ok && fp.Contains(qt.PathChallengeType) && pathChallenge == nil {
+				pathChallenge = p
 			}
 		case <-responseChan:
 			s.Finished()
@@ -0,0 +1,888 @@
+package scenarii
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/agents"
+	"github.com/QUIC-Tracker/quic-tracker/scenarii/expect"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// A ScenarioSpec describes a scenario as a list of steps, so that it can be written in YAML or JSON rather than in Go.
+// The first step completes the handshake, the following ones are executed in order. The scenario fails with the error
+// code of the first step that fails, and succeeds when all of them succeed.
+//
+//	name: handshake_done_from_client
+//	version: 1
+//	description: Sends a HANDSHAKE_DONE frame and checks that the host closes the connection with a PROTOCOL_VIOLATION.
+//	rfc_sections: [RFC 9000 §19.20]
+//	error_codes:
+//	  1: The TLS handshake failed
+//	  2: The host did not close the connection
+//	  3: The host closed the connection with the wrong error
+//	steps:
+//	  - handshake: {error: 1}
+//	  - send_frame: {type: handshake_done}
+//	  - expect_close: {error_codes: [PROTOCOL_VIOLATION], within: 3s, error: 2, wrong_code_error: 3}
+type ScenarioSpec struct {
+	Name        string           `yaml:"name" json:"name"`
+	Version     int              `yaml:"version" json:"version"`
+	Description string           `yaml:"description" json:"description"`
+	RFCSections []string         `yaml:"rfc_sections,omitempty" json:"rfc_sections,omitempty"`
+	Tags        []string         `yaml:"tags,omitempty" json:"tags,omitempty"`
+	HTTP3       bool             `yaml:"http3,omitempty" json:"http3,omitempty"`
+	IPv6        bool             `yaml:"ipv6,omitempty" json:"ipv6,omitempty"`
+	ErrorCodes  map[uint8]string `yaml:"error_codes" json:"error_codes"` // A description of each error code the steps can report
+	Steps       []Step           `yaml:"steps" json:"steps"`
+}
+
+// A Step is one of the actions of a ScenarioSpec. Exactly one of its fields must be set. The steps that expect something
+// from the host can name the check they perform, in which case they record it in the trace, see qt.Check.
+type Step struct {
+	Handshake   *HandshakeStep   `yaml:"handshake,omitempty" json:"handshake,omitempty"`
+	SendFrame   *FrameSpec       `yaml:"send_frame,omitempty" json:"send_frame,omitempty"`
+	SendPacket  *SendPacketStep  `yaml:"send_packet,omitempty" json:"send_packet,omitempty"`
+	ExpectFrame *ExpectFrameStep `yaml:"expect_frame,omitempty" json:"expect_frame,omitempty"`
+	ExpectClose *ExpectCloseStep `yaml:"expect_close,omitempty" json:"expect_close,omitempty"`
+	Wait        *WaitStep        `yaml:"wait,omitempty" json:"wait,omitempty"`
+	HTTPRequest *HTTPRequestStep `yaml:"http_request,omitempty" json:"http_request,omitempty"`
+}
+
+// HandshakeStep completes the handshake. The agents listed are stopped once it is completed, e.g. AckAgent.
+type HandshakeStep struct {
+	Error      uint8    `yaml:"error" json:"error"`
+	StopAgents []string `yaml:"stop_agents,omitempty" json:"stop_agents,omitempty"`
+}
+
+// A FrameSpec describes a frame by its type, e.g. stop_sending, and the values of its fields, named after the fields
+// of the corresponding Go structure in snake case, e.g. stream_id. Integers can be given in hexadecimal and error codes
+// by their name. Byte strings are given as text, except fixed-size ones, which are given in hexadecimal. Send steps
+// queue the frame at the given encryption level, 1rtt by default.
+type FrameSpec struct {
+	Type   string                 `yaml:"type" json:"type"`
+	Level  string                 `yaml:"level,omitempty" json:"level,omitempty"`
+	Fields map[string]interface{} `yaml:"fields,omitempty" json:"fields,omitempty"`
+}
+
+// SendPacketStep sends a packet of the given encryption level containing the frames, bypassing the frame queue.
+type SendPacketStep struct {
+	Level  string      `yaml:"level" json:"level"`
+	Frames []FrameSpec `yaml:"frames" json:"frames"`
+}
+
+// ExpectFrameStep waits for a frame of the given type whose fields have the values given, optionally in a packet of
+// the given encryption level. Within limits the time waited, the scenario timeout being the limit otherwise.
+type ExpectFrameStep struct {
+	FrameSpec `yaml:",inline"`
+	Within    string `yaml:"within,omitempty" json:"within,omitempty"`
+	Error     uint8  `yaml:"error" json:"error"`
+	Check     string `yaml:"check,omitempty" json:"check,omitempty"`
+}
+
+// ExpectCloseStep waits for the host to close the connection. When error codes are listed, closing it with another
+// one fails the step with the wrong code error, or with its error if not set.
+type ExpectCloseStep struct {
+	ErrorCodes     []interface{} `yaml:"error_codes,omitempty" json:"error_codes,omitempty"`
+	Within         string        `yaml:"within,omitempty" json:"within,omitempty"`
+	Error          uint8         `yaml:"error" json:"error"`
+	WrongCodeError uint8         `yaml:"wrong_code_error,omitempty" json:"wrong_code_error,omitempty"`
+	Check          string        `yaml:"check,omitempty" json:"check,omitempty"`
+}
+
+// WaitStep waits for the given duration.
+type WaitStep struct {
+	Duration string `yaml:"duration" json:"duration"`
+}
+
+// HTTPRequestStep performs a request using HTTP/3 or HTTP/0.9 depending on the ALPN negotiated, and waits for its
+// response. The preferred path of the host is requested if no path is given.
+type HTTPRequestStep struct {
+	Path    string            `yaml:"path,omitempty" json:"path,omitempty"`
+	Method  string            `yaml:"method,omitempty" json:"method,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Within  string            `yaml:"within,omitempty" json:"within,omitempty"`
+	Error   uint8             `yaml:"error" json:"error"`
+	Check   string            `yaml:"check,omitempty" json:"check,omitempty"`
+}
+
+// The transport error codes that can be given by name, see RFC 9000 §20.1.
+var transportErrorCodes = map[string]uint64{
+	"NO_ERROR":                  0x00,
+	"INTERNAL_ERROR":            0x01,
+	"CONNECTION_REFUSED":        0x02,
+	"FLOW_CONTROL_ERROR":        0x03,
+	"STREAM_LIMIT_ERROR":        0x04,
+	"STREAM_STATE_ERROR":        0x05,
+	"FINAL_SIZE_ERROR":          0x06,
+	"FRAME_ENCODING_ERROR":      0x07,
+	"TRANSPORT_PARAMETER_ERROR": 0x08,
+	"CONNECTION_ID_LIMIT_ERROR": 0x09,
+	"PROTOCOL_VIOLATION":        0x0a,
+	"INVALID_TOKEN":             0x0b,
+	"APPLICATION_ERROR":         0x0c,
+	"CRYPTO_BUFFER_EXCEEDED":    0x0d,
+	"KEY_UPDATE_ERROR":          0x0e,
+	"AEAD_LIMIT_REACHED":        0x0f,
+	"NO_VIABLE_PATH":            0x10,
+}
+
+// The frames that can be described, indexed by the name of their type in lower case.
+var frameConstructors = map[string]func() qt.Frame{
+	"padding":              func() qt.Frame { return new(qt.PaddingFrame) },
+	"ping":                 func() qt.Frame { return new(qt.PingFrame) },
+	"ack":                  func() qt.Frame { return new(qt.AckFrame) },
+	"ack_ecn":              func() qt.Frame { return new(qt.AckECNFrame) },
+	"reset_stream":         func() qt.Frame { return new(qt.ResetStream) },
+	"stop_sending":         func() qt.Frame { return new(qt.StopSendingFrame) },
+	"crypto":               func() qt.Frame { return new(qt.CryptoFrame) },
+	"new_token":            func() qt.Frame { return new(qt.NewTokenFrame) },
+	"stream":               func() qt.Frame { return new(qt.StreamFrame) },
+	"max_data":             func() qt.Frame { return new(qt.MaxDataFrame) },
+	"max_stream_data":      func() qt.Frame { return new(qt.MaxStreamDataFrame) },
+	"max_streams":          func() qt.Frame { return new(qt.MaxStreamsFrame) },
+	"data_blocked":         func() qt.Frame { return new(qt.DataBlockedFrame) },
+	"stream_data_blocked":  func() qt.Frame { return new(qt.StreamDataBlockedFrame) },
+	"streams_blocked":      func() qt.Frame { return new(qt.StreamsBlockedFrame) },
+	"new_connection_id":    func() qt.Frame { return new(qt.NewConnectionIdFrame) },
+	"retire_connection_id": func() qt.Frame { return new(qt.RetireConnectionId) },
+	"path_challenge":       func() qt.Frame { return new(qt.PathChallenge) },
+	"path_response":        func() qt.Frame { return new(qt.PathResponse) },
+	"connection_close":     func() qt.Frame { return new(qt.ConnectionCloseFrame) },
+	"application_close":    func() qt.Frame { return new(qt.ApplicationCloseFrame) },
+	"handshake_done":       func() qt.Frame { return new(qt.HandshakeDoneFrame) },
+}
+
+var scenarioNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// The scenarios registered using RegisterScenarioSpec, indexed by name.
+var declaredScenarios = make(map[string]*ScenarioSpec)
+
+// Guards declaredScenarios, catalog and errorCodeDescriptions, as scenarios can be registered while others are listed or
+// run, e.g. by qt_server.
+var registry sync.RWMutex
+
+// ParseScenarioSpec parses and checks a scenario described in YAML, or in JSON when it starts with {.
+func ParseScenarioSpec(content []byte) (*ScenarioSpec, error) {
+	spec := new(ScenarioSpec)
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		decoder.UseNumber()
+		if err := decoder.Decode(spec); err != nil {
+			return nil, err
+		}
+	} else if err := yaml.UnmarshalStrict(content, spec); err != nil {
+		return nil, err
+	}
+	if err := spec.check(); err != nil {
+		if spec.Name != "" {
+			return nil, fmt.Errorf("scenario %s: %s", spec.Name, err.Error())
+		}
+		return nil, err
+	}
+	return spec, nil
+}
+
+func (spec *ScenarioSpec) check() error {
+	if !scenarioNamePattern.MatchString(spec.Name) {
+		return fmt.Errorf("invalid scenario name %q", spec.Name)
+	}
+	if spec.Version < 1 {
+		return errors.New("the version must be positive")
+	}
+	if spec.Description == "" {
+		return errors.New("the description is missing")
+	}
+	for code := range spec.ErrorCodes {
+		if code == SucceededErrorCode || code >= CrashedErrorCode {
+			return fmt.Errorf("error code %d is reserved", code)
+		}
+	}
+	if len(spec.Steps) == 0 || spec.Steps[0].Handshake == nil {
+		return errors.New("the first step must be a handshake")
+	}
+	checks := make(map[string]bool)
+	for i, step := range spec.Steps {
+		if err := spec.checkStep(i, step); err != nil {
+			return fmt.Errorf("step %d: %s", i+1, err.Error())
+		}
+		if c := step.check(); c != "" {
+			if checks[c] {
+				return fmt.Errorf("step %d: check %s is performed twice", i+1, c)
+			}
+			checks[c] = true
+		}
+	}
+	return nil
+}
+
+func (spec *ScenarioSpec) checkStep(i int, step Step) error {
+	if n := step.count(); n != 1 {
+		return fmt.Errorf("a step must have exactly one action, %d were given", n)
+	}
+	switch {
+	case step.Handshake != nil:
+		if i > 0 {
+			return errors.New("the handshake must be the first step")
+		}
+		return spec.checkErrorCode(step.Handshake.Error, true)
+	case step.SendFrame != nil:
+		_, err := step.SendFrame.build()
+		return err
+	case step.SendPacket != nil:
+		if _, err := newPacket(nil, step.SendPacket.Level); err != nil {
+			return err
+		}
+		if len(step.SendPacket.Frames) == 0 {
+			return errors.New("the packet has no frames")
+		}
+		for _, f := range step.SendPacket.Frames {
+			if _, err := f.build(); err != nil {
+				return err
+			}
+		}
+	case step.ExpectFrame != nil:
+		if _, err := step.ExpectFrame.matcher(); err != nil {
+			return err
+		}
+		if _, err := parseWithin(step.ExpectFrame.Within); err != nil {
+			return err
+		}
+		return spec.checkErrorCode(step.ExpectFrame.Error, true)
+	case step.ExpectClose != nil:
+		if _, err := step.ExpectClose.errorCodes(); err != nil {
+			return err
+		}
+		if _, err := parseWithin(step.ExpectClose.Within); err != nil {
+			return err
+		}
+		if err := spec.checkErrorCode(step.ExpectClose.WrongCodeError, false); err != nil {
+			return err
+		}
+		return spec.checkErrorCode(step.ExpectClose.Error, true)
+	case step.Wait != nil:
+		if d, err := time.ParseDuration(step.Wait.Duration); err != nil || d <= 0 {
+			return fmt.Errorf("invalid duration %q", step.Wait.Duration)
+		}
+	case step.HTTPRequest != nil:
+		if _, err := parseWithin(step.HTTPRequest.Within); err != nil {
+			return err
+		}
+		return spec.checkErrorCode(step.HTTPRequest.Error, true)
+	}
+	return nil
+}
+
+func (spec *ScenarioSpec) checkErrorCode(code uint8, required bool) error {
+	if code == 0 {
+		if required {
+			return errors.New("the error code is missing")
+		}
+		return nil
+	}
+	if _, ok := spec.ErrorCodes[code]; !ok {
+		return fmt.Errorf("error code %d is not described in error_codes", code)
+	}
+	return nil
+}
+
+func (step Step) count() int {
+	n := 0
+	for _, set := range []bool{step.Handshake != nil, step.SendFrame != nil, step.SendPacket != nil, step.ExpectFrame != nil,
+		step.ExpectClose != nil, step.Wait != nil, step.HTTPRequest != nil} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// errorCode returns the error code reported when the step cannot be completed, or 0 if it cannot fail.
+func (step Step) errorCode() uint8 {
+	switch {
+	case step.Handshake != nil:
+		return step.Handshake.Error
+	case step.ExpectFrame != nil:
+		return step.ExpectFrame.Error
+	case step.ExpectClose != nil:
+		return step.ExpectClose.Error
+	case step.HTTPRequest != nil:
+		return step.HTTPRequest.Error
+	}
+	return 0
+}
+
+// check returns the name of the check the step performs, if any.
+func (step Step) check() string {
+	switch {
+	case step.ExpectFrame != nil:
+		return step.ExpectFrame.Check
+	case step.ExpectClose != nil:
+		return step.ExpectClose.Check
+	case step.HTTPRequest != nil:
+		return step.HTTPRequest.Check
+	}
+	return ""
+}
+
+func (step Step) String() string {
+	switch {
+	case step.Handshake != nil:
+		return "handshake"
+	case step.SendFrame != nil:
+		return "send_frame " + step.SendFrame.Type
+	case step.SendPacket != nil:
+		return "send_packet " + step.SendPacket.Level
+	case step.ExpectFrame != nil:
+		return "expect_frame " + step.ExpectFrame.Type
+	case step.ExpectClose != nil:
+		return "expect_close"
+	case step.Wait != nil:
+		return "wait " + step.Wait.Duration
+	case step.HTTPRequest != nil:
+		return "http_request"
+	}
+	return "empty step"
+}
+
+func parseWithin(within string) (time.Duration, error) {
+	if within == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(within)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", within)
+	}
+	return d, nil
+}
+
+func parseLevel(level string) (qt.EncryptionLevel, error) {
+	if level == "" {
+		return qt.EncryptionLevel1RTT, nil
+	}
+	for l := qt.EncryptionLevelInitial; l <= qt.EncryptionLevelBestAppData; l++ {
+		if strings.ToLower(l.String()) == strings.ToLower(level) {
+			return l, nil
+		}
+	}
+	return qt.EncryptionLevelNone, fmt.Errorf("unknown encryption level %q", level)
+}
+
+// newPacket returns an empty packet of the given encryption level. The connection can be nil to check the level only.
+func newPacket(conn *qt.Connection, level string) (qt.Framer, error) {
+	l, err := parseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	if conn == nil {
+		if l == qt.EncryptionLevelBest || l == qt.EncryptionLevelBestAppData {
+			return nil, fmt.Errorf("packets cannot be sent at the %s level", level)
+		}
+		return nil, nil
+	}
+	switch l {
+	case qt.EncryptionLevelInitial:
+		return qt.NewInitialPacket(conn), nil
+	case qt.EncryptionLevelHandshake:
+		return qt.NewHandshakePacket(conn), nil
+	case qt.EncryptionLevel0RTT:
+		return qt.NewZeroRTTProtectedPacket(conn), nil
+	}
+	return qt.NewProtectedPacket(conn), nil
+}
+
+// build returns the frame described.
+func (f *FrameSpec) build() (qt.Frame, error) {
+	constructor, ok := frameConstructors[f.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown frame type %q", f.Type)
+	}
+	if _, err := parseLevel(f.Level); err != nil {
+		return nil, err
+	}
+	frame := constructor()
+	for name, value := range f.Fields {
+		field, err := frameField(frame, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := assign(field, value); err != nil {
+			return nil, fmt.Errorf("field %s of %s: %s", name, f.Type, err.Error())
+		}
+	}
+
+	given := func(name string) bool { _, ok := f.Fields[name]; return ok }
+	switch frame := frame.(type) {
+	case *qt.StreamFrame:
+		frame.LenBit = true
+		frame.OffBit = frame.Offset > 0
+		if !given("length") {
+			frame.Length = uint64(len(frame.StreamData))
+		}
+	case *qt.CryptoFrame:
+		if !given("length") {
+			frame.Length = uint64(len(frame.CryptoData))
+		}
+	case *qt.NewConnectionIdFrame:
+		if !given("length") {
+			frame.Length = uint8(len(frame.ConnectionId))
+		}
+	case *qt.ConnectionCloseFrame:
+		if !given("reason_phrase_length") {
+			frame.ReasonPhraseLength = uint64(len(frame.ReasonPhrase))
+		}
+	case *qt.ApplicationCloseFrame:
+		if !given("reason_phrase_length") {
+			frame.ReasonPhraseLength = uint64(len(frame.ReasonPhrase))
+		}
+	}
+	return frame, nil
+}
+
+// matcher returns a function reporting whether a packet matches the frame described.
+func (e *ExpectFrameStep) matcher() (func(p qt.Packet) (bool, qt.Frame), error) {
+	if _, err := e.build(); err != nil {
+		return nil, err
+	}
+	var level qt.EncryptionLevel
+	if e.Level != "" {
+		level, _ = parseLevel(e.Level)
+	}
+	return func(p qt.Packet) (bool, qt.Frame) {
+		framer, ok := p.(qt.Framer)
+		if !ok || (e.Level != "" && p.EncryptionLevel() != level) {
+			return false, nil
+		}
+		for _, frame := range framer.GetFrames() {
+			if strings.ToLower(frame.FrameType().String()) == e.Type && e.matches(frame) {
+				return true, frame
+			}
+		}
+		return false, nil
+	}, nil
+}
+
+func (e *ExpectFrameStep) matches(frame qt.Frame) bool {
+	for name, value := range e.Fields {
+		field, err := frameField(frame, name)
+		if err != nil {
+			return false
+		}
+		expected := reflect.New(field.Type()).Elem()
+		if assign(expected, value) != nil || !reflect.DeepEqual(field.Interface(), expected.Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *ExpectCloseStep) errorCodes() ([]uint64, error) {
+	var codes []uint64
+	for _, value := range c.ErrorCodes {
+		code, err := toUint64(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid error code %v", value)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// frameField returns the field of the frame with the given snake case name.
+func frameField(frame qt.Frame, name string) (reflect.Value, error) {
+	v := reflect.ValueOf(frame).Elem()
+	if v.Kind() == reflect.Struct {
+		var names []string
+		if field, ok := findField(v, name, &names); ok {
+			return field, nil
+		}
+		sort.Strings(names)
+		return reflect.Value{}, fmt.Errorf("unknown field %s, the fields are %s", name, strings.Join(names, ", "))
+	}
+	return reflect.Value{}, fmt.Errorf("unknown field %s, the frame has no fields", name)
+}
+
+func findField(v reflect.Value, name string, names *[]string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if f, ok := findField(v.Field(i), name, names); ok {
+				return f, true
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldName := toSnakeCase(field.Name)
+		if fieldName == name {
+			return v.Field(i), true
+		}
+		*names = append(*names, fieldName)
+	}
+	return reflect.Value{}, false
+}
+
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// assign sets a field of a frame to a value decoded from YAML or JSON.
+func assign(field reflect.Value, value interface{}) error {
+	switch field.Kind() {
+	case reflect.Bool:
+		if field.Type() == reflect.TypeOf(qt.BidiStreams) {
+			switch value {
+			case "bidi":
+				value = bool(qt.BidiStreams)
+			case "uni":
+				value = bool(qt.UniStreams)
+			}
+		}
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("%v is not a boolean", value)
+		}
+		field.SetBool(b)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := toUint64(value)
+		if err != nil {
+			return err
+		}
+		if field.OverflowUint(u) {
+			return fmt.Errorf("%d is too large", u)
+		}
+		field.SetUint(u)
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%v is not a string", value)
+		}
+		field.SetString(s)
+	case reflect.Slice, reflect.Array:
+		s, ok := value.(string)
+		if !ok || field.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("%v cannot be assigned to a field of type %s", value, field.Type())
+		}
+		if field.Kind() == reflect.Slice {
+			field.SetBytes([]byte(s))
+			return nil
+		}
+		b, err := hex.DecodeString(s)
+		if err != nil || len(b) != field.Len() {
+			return fmt.Errorf("%s is not %d hexadecimal bytes", s, field.Len())
+		}
+		reflect.Copy(field, reflect.ValueOf(b))
+	default:
+		return fmt.Errorf("fields of type %s cannot be described", field.Type())
+	}
+	return nil
+}
+
+func toUint64(value interface{}) (uint64, error) {
+	switch v := value.(type) {
+	case int:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+	case int64:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+	case uint64:
+		return v, nil
+	case float64:
+		if v >= 0 && v == float64(uint64(v)) {
+			return uint64(v), nil
+		}
+	case json.Number:
+		return strconv.ParseUint(v.String(), 10, 64)
+	case string:
+		if code, ok := transportErrorCodes[strings.ToUpper(v)]; ok {
+			return code, nil
+		}
+		return strconv.ParseUint(v, 0, 64)
+	}
+	return 0, fmt.Errorf("%v is not a positive integer", value)
+}
+
+// RegisterScenarioSpec adds the scenario described to the scenarios of the test suite and to the catalog. It can be
+// called while scenarios are listed or run.
+func RegisterScenarioSpec(spec *ScenarioSpec) error {
+	if GetScenario(spec.Name) != nil {
+		return fmt.Errorf("scenario %s already exists", spec.Name)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, exists := catalog[spec.Name]; exists {
+		return fmt.Errorf("scenario %s already exists", spec.Name)
+	}
+	declaredScenarios[spec.Name] = spec
+	catalog[spec.Name] = catalogEntry{spec.Description, spec.RFCSections, append([]string{"declarative"}, spec.Tags...)}
+	errorCodeDescriptions[spec.Name] = spec.ErrorCodes
+	return nil
+}
+
+// LoadScenarioFiles parses and registers the scenarios described in the given files. The YAML and JSON files of a
+// directory are loaded.
+func LoadScenarioFiles(paths ...string) error {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+			matches, _ := filepath.Glob(filepath.Join(path, pattern))
+			files = append(files, matches...)
+		}
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		spec, err := ParseScenarioSpec(content)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error())
+		}
+		if err := RegisterScenarioSpec(spec); err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error())
+		}
+	}
+	return nil
+}
+
+// DeclarativeScenario runs a scenario described by a ScenarioSpec.
+type DeclarativeScenario struct {
+	AbstractScenario
+	spec *ScenarioSpec
+}
+
+func NewDeclarativeScenario(spec *ScenarioSpec) *DeclarativeScenario {
+	return &DeclarativeScenario{AbstractScenario{name: spec.Name, version: spec.Version, ipv6: spec.IPv6, http3: spec.HTTP3}, spec}
+}
+
+func (s *DeclarativeScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool) {
+	if s.http3 {
+		conn.TLSTPHandler.MaxUniStreams = 3
+	}
+
+	handshake := s.spec.Steps[0].Handshake
+	connAgents := s.CompleteHandshake(conn, trace, handshake.Error)
+	if connAgents == nil {
+		return
+	}
+	defer connAgents.CloseConnection(false, 0, "")
+	connAgents.Stop(handshake.StopAgents...)
+
+	r := &stepRunner{scenario: s, conn: conn, trace: trace, connAgents: connAgents, preferredPath: preferredPath}
+	r.waiter = expect.NewWaiter(conn, trace, s.Timeout())
+	defer r.waiter.Close()
+
+	for i, step := range s.spec.Steps[1:] {
+		if !r.run(step) {
+			if trace.ErrorCode == 0 { // The scenario timed out during the step
+				message := fmt.Sprintf("step %d (%s) could not be completed before the scenario timed out", i+2, step)
+				if c := step.check(); c != "" {
+					trace.Fail(c, step.errorCode(), message)
+				} else if code := s.pendingErrorCode(i + 1); code != 0 {
+					trace.MarkError(code, message, nil)
+				}
+			}
+			for _, following := range s.spec.Steps[i+2:] {
+				if c := following.check(); c != "" {
+					trace.Skip(c, fmt.Sprintf("step %d (%s) failed", i+2, step))
+				}
+			}
+			return
+		}
+	}
+
+	s.Finished()
+	select {
+	case <-conn.ConnectionClosed:
+	case <-s.Timeout():
+	}
+}
+
+// pendingErrorCode returns the error code of the first step that can fail from the given one.
+func (s *DeclarativeScenario) pendingErrorCode(from int) uint8 {
+	for _, step := range s.spec.Steps[from:] {
+		if code := step.errorCode(); code != 0 {
+			return code
+		}
+	}
+	return SucceededErrorCode
+}
+
+type stepRunner struct {
+	scenario      *DeclarativeScenario
+	conn          *qt.Connection
+	trace         *qt.Trace
+	connAgents    *agents.ConnectionAgents
+	http          agents.HTTPAgent
+	preferredPath string
+	waiter        *expect.Waiter
+}
+
+// run executes a step and reports whether the scenario can continue. When it cannot, the trace is marked with an error
+// unless the scenario timed out.
+func (r *stepRunner) run(step Step) bool {
+	switch {
+	case step.SendFrame != nil:
+		frame, _ := step.SendFrame.build()
+		level, _ := parseLevel(step.SendFrame.Level)
+		r.conn.FrameQueue.Submit(qt.QueuedFrame{Frame: frame, EncryptionLevel: level})
+	case step.SendPacket != nil:
+		packet, _ := newPacket(r.conn, step.SendPacket.Level)
+		for _, f := range step.SendPacket.Frames {
+			frame, _ := f.build()
+			packet.AddFrame(frame)
+		}
+		r.conn.DoSendPacket(packet, packet.EncryptionLevel())
+	case step.ExpectFrame != nil:
+		e := step.ExpectFrame
+		match, _ := e.matcher()
+		within, _ := parseWithin(e.Within)
+		m, err := r.waiter.Wait(expect.ExpectPacket(e.Type+" frame", func(p qt.Packet) bool { ok, _ := match(p); return ok }), within)
+		if err != nil {
+			return r.fail(e.Check, e.Error, fmt.Sprintf("no %s frame matching %v was received: %s", e.Type, e.Fields, err.Error()), err)
+		}
+		r.pass(e.Check, m.Packet)
+	case step.ExpectClose != nil:
+		return r.expectClose(step.ExpectClose)
+	case step.Wait != nil:
+		d, _ := time.ParseDuration(step.Wait.Duration)
+		select {
+		case <-time.After(d):
+		case <-r.scenario.Timeout():
+			return false
+		}
+	case step.HTTPRequest != nil:
+		return r.httpRequest(step.HTTPRequest)
+	}
+	return true
+}
+
+// pass records that the check of a step passed, if it has one.
+func (r *stepRunner) pass(check string, evidence qt.Packet) {
+	if check == "" {
+		return
+	}
+	if evidence != nil {
+		r.trace.Pass(check, "", evidence)
+	} else {
+		r.trace.Pass(check, "")
+	}
+}
+
+// fail marks the trace with the error code, or records that the check of the step failed, unless the step failed
+// because the scenario timed out, which is reported by the caller.
+func (r *stepRunner) fail(check string, errorCode uint8, message string, err error) bool {
+	if err == expect.ErrScenarioTimeout {
+		return false
+	}
+	var packet qt.Packet
+	if cErr, ok := err.(*expect.CloseError); ok {
+		packet = cErr.Packet
+	}
+	if check == "" {
+		r.trace.MarkError(errorCode, message, packet)
+	} else if packet != nil {
+		r.trace.Fail(check, errorCode, message, packet)
+	} else {
+		r.trace.Fail(check, errorCode, message)
+	}
+	return false
+}
+
+func (r *stepRunner) expectClose(c *ExpectCloseStep) bool {
+	within, _ := parseWithin(c.Within)
+	expected, _ := c.errorCodes()
+	m, err := r.waiter.Wait(expect.AnyOf(expect.ExpectClose(expected...), expect.ExpectApplicationClose(expected...)), within)
+	cErr, wrongCode := err.(*expect.CloseError)
+	if err != nil && !wrongCode {
+		return r.fail(c.Check, c.Error, "the host did not close the connection: "+err.Error(), err)
+	}
+
+	if wrongCode {
+		r.trace.Results["connection_closed_error_code"] = fmt.Sprintf("0x%x", cErr.ErrorCode)
+		var formatted []string
+		for _, e := range expected {
+			formatted = append(formatted, fmt.Sprintf("0x%02x", e))
+		}
+		errorCode := c.WrongCodeError
+		if errorCode == 0 {
+			errorCode = c.Error
+		}
+		return r.fail(c.Check, errorCode, fmt.Sprintf("Expected %s, got 0x%02x", strings.Join(formatted, " or "), cErr.ErrorCode), cErr)
+	}
+	r.pass(c.Check, m.Packet)
+	switch f := m.Frame.(type) {
+	case *qt.ConnectionCloseFrame:
+		r.trace.Results["connection_closed_error_code"] = fmt.Sprintf("0x%x", f.ErrorCode)
+	case *qt.ApplicationCloseFrame:
+		r.trace.Results["connection_closed_error_code"] = fmt.Sprintf("0x%x", f.ErrorCode)
+	}
+	return true
+}
+
+func (r *stepRunner) httpRequest(h *HTTPRequestStep) bool {
+	if r.http == nil {
+		r.http = r.connAgents.AddHTTPAgent()
+	}
+	path, method := h.Path, h.Method
+	if path == "" {
+		path = r.preferredPath
+	}
+	if method == "" {
+		method = "GET"
+	}
+	responseReceived := r.http.SendRequest(path, method, r.trace.Host, h.Headers)
+
+	var deadline <-chan time.Time
+	within, _ := parseWithin(h.Within)
+	if within > 0 {
+		deadline = time.After(within)
+	}
+	select {
+	case <-responseReceived:
+		r.pass(h.Check, nil)
+		return true
+	case <-r.conn.ConnectionClosed:
+		return r.fail(h.Check, h.Error, fmt.Sprintf("the connection was closed before the response to %s %s was received", method, path), expect.ErrConnectionClosed)
+	case <-deadline:
+		return r.fail(h.Check, h.Error, fmt.Sprintf("the response to %s %s was not received within %s", method, path, within), expect.ErrTimeout)
+	case <-r.scenario.Timeout():
+		return false
+	}
+}
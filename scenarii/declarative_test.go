@@ -0,0 +1,105 @@
+package scenarii
+
+import (
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScenarioSpecs(t *testing.T) {
+	files, _ := filepath.Glob("specs/*")
+	if len(files) == 0 {
+		t.Fatal("no scenario files found")
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec, err := ParseScenarioSpec(content)
+		if err != nil {
+			t.Errorf("%s: %s", file, err.Error())
+			continue
+		}
+		if name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)); spec.Name != name {
+			t.Errorf("%s describes scenario %s", file, spec.Name)
+		}
+	}
+
+	spec, err := ParseScenarioSpec([]byte("name: handshake\nversion: 1\ndescription: A duplicate.\nerror_codes: {1: The TLS handshake failed}\nsteps:\n  - handshake: {error: 1}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if RegisterScenarioSpec(spec) == nil {
+		t.Error("a scenario replaced a built-in one")
+	}
+
+	for _, invalid := range []string{
+		"steps:\n  - handshake: {error: 1}\n    wait: {duration: 1s}\n",
+		"steps:\n  - handshake: {error: 1}\n  - wait: {duration: 1s}\n  - handshake: {error: 1}\n",
+		"steps:\n  - handshake: {error: 2}\n",
+		"steps:\n  - handshake: {error: 1}\n  - send_frame: {type: unknown}\n",
+		"steps:\n  - handshake: {error: 1}\n  - send_frame: {type: stop_sending, fields: {stream: 2}}\n",
+		"steps:\n  - handshake: {error: 1}\n  - send_frame: {type: max_data, fields: {maximum_data: -1}}\n",
+		"steps:\n  - handshake: {error: 1}\n  - send_packet: {level: best, frames: [{type: ping}]}\n",
+		"steps:\n  - handshake: {error: 1}\n  - expect_frame: {type: ping, within: soon, error: 1}\n",
+		"steps:\n  - handshake: {error: 1}\n  - expect_close: {error_codes: [UNKNOWN_ERROR], error: 1}\n",
+		"steps:\n  - handshake: {error: 1}\n  - http_request: {path: /}\n",
+		"steps:\n  - handshake: {error: 1}\n  - expect_frame: {type: ping, error: 1, check: pong}\n  - expect_close: {error: 1, check: pong}\n",
+		"unknown: 1\nsteps:\n  - handshake: {error: 1}\n",
+	} {
+		if _, err := ParseScenarioSpec([]byte("name: invalid\nversion: 1\ndescription: An invalid scenario.\nerror_codes: {1: An error}\n" + invalid)); err == nil {
+			t.Errorf("%q was accepted", invalid)
+		}
+	}
+}
+
+func TestFrameSpec(t *testing.T) {
+	frame, err := (&FrameSpec{Type: "stream", Fields: map[string]interface{}{"stream_id": 4, "offset": "0x10", "stream_data": "GET /\r\n", "fin_bit": true}}).build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := frame.(*qt.StreamFrame)
+	if stream.StreamId != 4 || stream.Offset != 16 || !stream.OffBit || !stream.LenBit || stream.Length != 7 || !stream.FinBit {
+		t.Errorf("unexpected frame %+v", stream)
+	}
+
+	e := &ExpectFrameStep{FrameSpec: FrameSpec{Type: "max_streams", Fields: map[string]interface{}{"streams_type": "uni", "maximum_streams": 3}}}
+	match, err := e.matcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := new(qt.ProtectedPacket)
+	packet.AddFrame(&qt.MaxStreamsFrame{StreamsType: qt.BidiStreams, MaximumStreams: 3})
+	if ok, _ := match(packet); ok {
+		t.Error("a frame of the wrong stream type matched")
+	}
+	packet.AddFrame(&qt.MaxStreamsFrame{StreamsType: qt.UniStreams, MaximumStreams: 3})
+	if ok, f := match(packet); !ok || !f.(*qt.MaxStreamsFrame).IsUni() {
+		t.Error("the frame did not match")
+	}
+}
+
+func TestRegisterScenarioSpec_Concurrent(t *testing.T) {
+	spec, err := ParseScenarioSpec([]byte("name: registered_concurrently\nversion: 1\ndescription: A scenario registered while others are listed.\nrfc_sections: [RFC 9000 §7]\nerror_codes: {1: The TLS handshake failed}\nsteps:\n  - handshake: {error: 1}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(chan bool)
+	go func() {
+		defer close(listed)
+		for i := 0; i < 10; i++ {
+			Catalog()
+			ErrorCodeDescription("registered_concurrently", 1)
+		}
+	}()
+	if err := RegisterScenarioSpec(spec); err != nil {
+		t.Fatal(err)
+	}
+	<-listed
+	if GetScenario("registered_concurrently") == nil {
+		t.Error("the scenario was not registered")
+	}
+}
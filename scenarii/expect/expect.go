@@ -0,0 +1,323 @@
+// Package expect provides waiters for the packets a scenario expects to receive, instead of a select loop over the
+// incoming packets, the closing of the connection and the timeout of the scenario in each scenario.
+//
+// A Waiter waits for a packet fulfilling an Expectation:
+//
+//	w := expect.NewWaiter(conn, trace, s.Timeout())
+//	conn.FrameQueue.Submit(qt.QueuedFrame{&qt.StopSendingFrame{2, 0}, qt.EncryptionLevel1RTT})
+//	match, err := w.Wait(expect.ExpectClose(qt.ERR_STREAM_STATE_ERROR), 3*time.Second)
+//
+// The packets fulfilling the expectations are marked as of interest in the trace. The ones closing the connection
+// while another packet is expected are reported as a CloseError, and are also marked.
+package expect
+
+import (
+	"errors"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTimeout          = errors.New("the packet expected was not received in time")
+	ErrScenarioTimeout  = errors.New("the scenario timed out")
+	ErrConnectionClosed = errors.New("the connection was closed")
+)
+
+// A CloseError reports that the host closed the connection while another packet was expected, e.g. a close with
+// another error code.
+type CloseError struct {
+	Packet       qt.Packet
+	Application  bool // Whether the connection was closed with an APPLICATION_CLOSE frame
+	ErrorCode    uint64
+	ReasonPhrase string
+}
+
+func (e *CloseError) Error() string {
+	kind := "CONNECTION_CLOSE"
+	if e.Application {
+		kind = "APPLICATION_CLOSE"
+	}
+	if e.ReasonPhrase != "" {
+		return fmt.Sprintf("the host closed the connection with a %s of error code 0x%02x: %s", kind, e.ErrorCode, e.ReasonPhrase)
+	}
+	return fmt.Sprintf("the host closed the connection with a %s of error code 0x%02x", kind, e.ErrorCode)
+}
+
+// closeError returns the CloseError of a packet that closes the connection, or nil.
+func closeError(p qt.Packet) *CloseError {
+	framer, ok := p.(qt.Framer)
+	if !ok {
+		return nil
+	}
+	for _, f := range framer.GetFrames() {
+		switch f := f.(type) {
+		case *qt.ConnectionCloseFrame:
+			return &CloseError{Packet: p, ErrorCode: f.ErrorCode, ReasonPhrase: f.ReasonPhrase}
+		case *qt.ApplicationCloseFrame:
+			return &CloseError{Packet: p, Application: true, ErrorCode: f.ErrorCode, ReasonPhrase: f.ReasonPhrase}
+		}
+	}
+	return nil
+}
+
+// A Match is a packet that fulfilled an expectation.
+type Match struct {
+	Packet qt.Packet
+	Frame  qt.Frame // The frame that fulfilled the expectation, if any
+}
+
+// An Expectation describes a packet expected.
+type Expectation struct {
+	Description string
+	match       func(p qt.Packet) *Match
+}
+
+// Match returns the match of the packet if it fulfils the expectation, nil otherwise.
+func (e Expectation) Match(p qt.Packet) *Match {
+	return e.match(p)
+}
+
+func (e Expectation) String() string {
+	return e.Description
+}
+
+// ExpectPacket expects a packet for which the predicate is true.
+func ExpectPacket(description string, predicate func(p qt.Packet) bool) Expectation {
+	return Expectation{description, func(p qt.Packet) *Match {
+		if predicate(p) {
+			return &Match{Packet: p}
+		}
+		return nil
+	}}
+}
+
+// ExpectFrame expects a frame of the given type in a packet of the given encryption level, or of any level if
+// EncryptionLevelNone is given, for which the predicate is true. The predicate can be nil.
+func ExpectFrame(frameType qt.FrameType, level qt.EncryptionLevel, predicate func(f qt.Frame) bool) Expectation {
+	description := frameType.String() + " frame"
+	if level != qt.EncryptionLevelNone {
+		description += " at the " + level.String() + " level"
+	}
+	return Expectation{description, func(p qt.Packet) *Match {
+		framer, ok := p.(qt.Framer)
+		if !ok || (level != qt.EncryptionLevelNone && p.EncryptionLevel() != level) {
+			return nil
+		}
+		for _, f := range framer.GetAll(frameType) {
+			if predicate == nil || predicate(f) {
+				return &Match{Packet: p, Frame: f}
+			}
+		}
+		return nil
+	}}
+}
+
+// ExpectClose expects the host to close the connection with a CONNECTION_CLOSE frame of one of the given error codes,
+// or of any error code if none are given.
+func ExpectClose(errorCodes ...uint64) Expectation {
+	return expectClose(qt.ConnectionCloseType, errorCodes)
+}
+
+// ExpectApplicationClose expects the host to close the connection with an APPLICATION_CLOSE frame of one of the given
+// error codes, or of any error code if none are given.
+func ExpectApplicationClose(errorCodes ...uint64) Expectation {
+	return expectClose(qt.ApplicationCloseType, errorCodes)
+}
+
+func expectClose(frameType qt.FrameType, errorCodes []uint64) Expectation {
+	description := frameType.String() + " frame"
+	if len(errorCodes) > 0 {
+		var codes []string
+		for _, c := range errorCodes {
+			codes = append(codes, fmt.Sprintf("0x%02x", c))
+		}
+		description += " of error code " + strings.Join(codes, " or ")
+	}
+	return Expectation{description, func(p qt.Packet) *Match {
+		framer, ok := p.(qt.Framer)
+		if !ok {
+			return nil
+		}
+		f := framer.GetFirst(frameType)
+		if f == nil {
+			return nil
+		}
+		var errorCode uint64
+		switch f := f.(type) {
+		case *qt.ConnectionCloseFrame:
+			errorCode = f.ErrorCode
+		case *qt.ApplicationCloseFrame:
+			errorCode = f.ErrorCode
+		}
+		for _, c := range errorCodes {
+			if c == errorCode {
+				return &Match{Packet: p, Frame: f}
+			}
+		}
+		if len(errorCodes) == 0 {
+			return &Match{Packet: p, Frame: f}
+		}
+		return nil
+	}}
+}
+
+// ExpectAcked expects an ACK frame acknowledging the given packet number of the given packet number space.
+func ExpectAcked(space qt.PNSpace, pn qt.PacketNumber) Expectation {
+	return Expectation{fmt.Sprintf("acknowledgement of packet %d", pn), func(p qt.Packet) *Match {
+		framer, ok := p.(qt.Framer)
+		if !ok || p.PNSpace() != space {
+			return nil
+		}
+		for _, f := range framer.GetFrames() {
+			var ack *qt.AckFrame
+			switch f := f.(type) {
+			case *qt.AckFrame:
+				ack = f
+			case *qt.AckECNFrame:
+				ack = &f.AckFrame
+			}
+			if ack != nil && acknowledges(ack, pn) {
+				return &Match{Packet: p, Frame: f}
+			}
+		}
+		return nil
+	}}
+}
+
+// acknowledges reports whether the packet number is in one of the ranges of the ACK frame, see RFC 9000 §19.3.1.
+func acknowledges(ack *qt.AckFrame, pn qt.PacketNumber) bool {
+	largest := uint64(ack.LargestAcknowledged)
+	for i, r := range ack.AckRanges {
+		if i > 0 {
+			if largest < r.Gap+2 {
+				return false
+			}
+			largest -= r.Gap + 2
+		}
+		if r.AckRange > largest {
+			return uint64(pn) <= largest
+		}
+		smallest := largest - r.AckRange
+		if uint64(pn) <= largest && uint64(pn) >= smallest {
+			return true
+		}
+		largest = smallest
+	}
+	return false
+}
+
+// AnyOf expects a packet fulfilling one of the expectations.
+func AnyOf(expectations ...Expectation) Expectation {
+	var descriptions []string
+	for _, e := range expectations {
+		descriptions = append(descriptions, e.Description)
+	}
+	return Expectation{strings.Join(descriptions, " or "), func(p qt.Packet) *Match {
+		for _, e := range expectations {
+			if m := e.match(p); m != nil {
+				return m
+			}
+		}
+		return nil
+	}}
+}
+
+// A Waiter waits for the packets received on a connection. The packets received before it was created are not
+// considered, and each packet is considered by a single call to Wait.
+type Waiter struct {
+	conn            *qt.Connection
+	trace           *qt.Trace
+	incPackets      chan interface{}
+	scenarioTimeout <-chan time.Time
+	err             error // The error that ended the connection or the scenario, returned by all the calls that follow
+}
+
+// NewWaiter creates a waiter for the packets received on the connection, marking the packets of interest in the trace.
+// The scenario timeout ends all the waits.
+func NewWaiter(conn *qt.Connection, trace *qt.Trace, scenarioTimeout <-chan time.Time) *Waiter {
+	return &Waiter{conn: conn, trace: trace, incPackets: conn.IncomingPackets.RegisterNewChan(1000), scenarioTimeout: scenarioTimeout}
+}
+
+// Close stops receiving the packets of the connection. It must be called once the waiter is no longer used.
+func (w *Waiter) Close() {
+	if !w.conn.IncomingPackets.IsClosed() {
+		w.conn.IncomingPackets.Unregister(w.incPackets)
+	}
+}
+
+// Wait waits for a packet that fulfils the expectation for at most the given duration, or until the scenario times out
+// if it is zero. The packets received in the meantime are discarded. It returns ErrTimeout, ErrScenarioTimeout,
+// ErrConnectionClosed or a CloseError when no packet fulfilled it.
+func (w *Waiter) Wait(e Expectation, within time.Duration) (*Match, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	var deadline <-chan time.Time
+	if within > 0 {
+		timer := time.NewTimer(within)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		select {
+		case i, ok := <-w.incPackets:
+			if !ok {
+				w.err = ErrConnectionClosed
+				return nil, w.err
+			}
+			if m, err := w.consider(e, i); m != nil || err != nil {
+				return m, err
+			}
+		case <-w.conn.ConnectionClosed:
+			w.err = ErrConnectionClosed
+			return w.drain(e)
+		case <-deadline:
+			return nil, ErrTimeout
+		case <-w.scenarioTimeout:
+			w.err = ErrScenarioTimeout
+			return nil, w.err
+		}
+	}
+}
+
+// drain considers the packets received before the connection was closed.
+func (w *Waiter) drain(e Expectation) (*Match, error) {
+	for {
+		select {
+		case i, ok := <-w.incPackets:
+			if !ok {
+				return nil, w.err
+			}
+			if m, err := w.consider(e, i); m != nil || err != nil {
+				return m, err
+			}
+		default:
+			return nil, w.err
+		}
+	}
+}
+
+// consider returns the match of a packet received, or the CloseError of a packet that closed the connection instead.
+func (w *Waiter) consider(e Expectation, i interface{}) (*Match, error) {
+	p, ok := i.(qt.Packet)
+	if !ok {
+		return nil, nil
+	}
+	if m := e.match(p); m != nil {
+		w.trace.MarkPacketOfInterest(p)
+		return m, nil
+	}
+	if err := closeError(p); err != nil {
+		w.trace.MarkPacketOfInterest(p)
+		w.err = err
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Err returns the error that ended the connection or the scenario, if any.
+func (w *Waiter) Err() error {
+	return w.err
+}
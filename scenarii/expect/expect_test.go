@@ -0,0 +1,57 @@
+package expect
+
+import (
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"testing"
+	"time"
+)
+
+func TestAcknowledges(t *testing.T) {
+	// Acknowledges 10 to 8 and 5 to 4
+	ack := &qt.AckFrame{LargestAcknowledged: 10, AckRanges: []qt.AckRange{{Gap: 0, AckRange: 2}, {Gap: 1, AckRange: 1}}}
+	for pn, expected := range map[qt.PacketNumber]bool{11: false, 10: true, 8: true, 7: false, 6: false, 5: true, 4: true, 3: false} {
+		if acknowledges(ack, pn) != expected {
+			t.Errorf("packet %d acknowledged: %t", pn, !expected)
+		}
+	}
+}
+
+func TestWaiter(t *testing.T) {
+	conn := &qt.Connection{IncomingPackets: qt.NewBroadcaster(10), ConnectionClosed: make(chan bool, 1)}
+	trace := qt.NewTrace("test", 1, "quic.example.com")
+	w := NewWaiter(conn, trace, nil)
+
+	ping, closePacket := new(qt.ProtectedPacket), new(qt.ProtectedPacket)
+	ping.AddFrame(new(qt.PingFrame))
+	closePacket.AddFrame(&qt.ConnectionCloseFrame{ErrorCode: qt.ERR_PROTOCOL_VIOLATION})
+	trace.Stream = []qt.TracePacket{{Pointer: ping.Pointer()}, {Pointer: closePacket.Pointer()}}
+
+	conn.IncomingPackets.Submit(ping)
+	if m, err := w.Wait(ExpectFrame(qt.PingType, qt.EncryptionLevelNone, nil), time.Second); err != nil || m.Packet != ping {
+		t.Fatalf("unexpected match %v %v", m, err)
+	}
+	if _, err := w.Wait(ExpectClose(), 10*time.Millisecond); err != ErrTimeout {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	conn.IncomingPackets.Submit(closePacket)
+	_, err := w.Wait(ExpectClose(qt.ERR_STREAM_STATE_ERROR), time.Second)
+	if cErr, ok := err.(*CloseError); !ok || cErr.ErrorCode != qt.ERR_PROTOCOL_VIOLATION || cErr.Packet != closePacket {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := w.Wait(ExpectFrame(qt.PingType, qt.EncryptionLevelNone, nil), time.Second); err == nil {
+		t.Error("a wait succeeded after the connection was closed")
+	}
+	if !trace.Stream[0].IsOfInterest || !trace.Stream[1].IsOfInterest {
+		t.Error("the packets were not marked as of interest")
+	}
+
+	// The packets are no longer buffered for the waiter once it is closed
+	w.Close()
+	conn.IncomingPackets.Submit(ping)
+	select {
+	case <-w.incPackets:
+		t.Error("the waiter still receives packets after being closed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
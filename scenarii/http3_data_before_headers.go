@@ -0,0 +1,56 @@
+package scenarii
+
+import (
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/agents"
+	"github.com/QUIC-Tracker/quic-tracker/http3"
+	"github.com/QUIC-Tracker/quic-tracker/scenarii/expect"
+)
+
+const (
+	H3DBH_TLSHandshakeFailed               = 1
+	H3DBH_NotEnoughStreamsAvailable        = 2
+	H3DBH_DidNotCloseTheConnection         = 3
+	H3DBH_CloseTheConnectionWithWrongError = 4
+)
+
+type HTTP3DataBeforeHeadersScenario struct {
+	AbstractScenario
+}
+
+func NewHTTP3DataBeforeHeadersScenario() *HTTP3DataBeforeHeadersScenario {
+	return &HTTP3DataBeforeHeadersScenario{AbstractScenario{name: "http3_data_before_headers", version: 1, http3: true}}
+}
+func (s *HTTP3DataBeforeHeadersScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool) {
+	conn.TLSTPHandler.MaxUniStreams = 3
+
+	http := agents.HTTP3Agent{}
+	connAgents := s.CompleteHandshake(conn, trace, H3DBH_TLSHandshakeFailed, &http)
+	if connAgents == nil {
+		return
+	}
+	defer connAgents.CloseConnection(false, 0, "")
+
+	if conn.TLSTPHandler.ReceivedParameters.MaxUniStreams < 3 || conn.TLSTPHandler.ReceivedParameters.MaxBidiStreams == 0 {
+		trace.ErrorCode = H3DBH_NotEnoughStreamsAvailable
+		trace.Results["max_uni_streams"] = conn.TLSTPHandler.ReceivedParameters.MaxUniStreams
+		trace.Results["max_bidi_streams"] = conn.TLSTPHandler.ReceivedParameters.MaxBidiStreams
+		return
+	}
+
+	w := expect.NewWaiter(conn, trace, s.Timeout())
+	defer w.Close()
+	http.SendHTTP3Request(&agents.HTTP3Request{Method: "POST", Authority: trace.Host, Path: preferredPath, Body: []byte("Hello, world!"), DataBeforeHeaders: true})
+
+	m, err := w.Wait(expect.ExpectApplicationClose(http3.H3_FRAME_UNEXPECTED), 0)
+	switch err := err.(type) {
+	case nil:
+		trace.Pass("host_rejected_data_before_headers", "", m.Packet)
+	case *expect.CloseError:
+		trace.Fail("host_rejected_data_before_headers", H3DBH_CloseTheConnectionWithWrongError, fmt.Sprintf("Expected 0x%02x, got 0x%02x", http3.H3_FRAME_UNEXPECTED, err.ErrorCode), err.Packet)
+		trace.Results["connection_closed_error_code"] = fmt.Sprintf("0x%x", err.ErrorCode)
+	default:
+		trace.Fail("host_rejected_data_before_headers", H3DBH_DidNotCloseTheConnection, err.Error())
+	}
+}
@@ -9,6 +9,7 @@ const (
 	H3G_TLSHandshakeFailed = 1
 	H3G_RequestTimeout     = 2
 	H3G_NotEnoughStreamsAvailable = 3
+	H3G_ContentHashMismatch = 4
 )
 
 type HTTP3GETScenario struct {
@@ -39,8 +40,9 @@ func (s *HTTP3GETScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPa
 
 	trace.ErrorCode = H3G_RequestTimeout
 	select {
-	case <-responseReceived:
+	case r := <-responseReceived:
 		trace.ErrorCode = 0
+		s.checkContentHash(trace, r.Body(), H3G_ContentHashMismatch)
 		s.Finished()
 		<-s.Timeout()
 	case <-conn.ConnectionClosed:
@@ -0,0 +1,63 @@
+package scenarii
+
+import (
+	"bytes"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/agents"
+)
+
+const (
+	H3P_TLSHandshakeFailed        = 1
+	H3P_RequestTimeout            = 2
+	H3P_NotEnoughStreamsAvailable = 3
+)
+
+type HTTP3POSTScenario struct {
+	AbstractScenario
+}
+
+func NewHTTP3POSTScenario() *HTTP3POSTScenario {
+	return &HTTP3POSTScenario{AbstractScenario{name: "http3_post", version: 1, http3: true}}
+}
+func (s *HTTP3POSTScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool) {
+	conn.TLSTPHandler.MaxUniStreams = 3
+
+	http := agents.HTTP3Agent{}
+	connAgents := s.CompleteHandshake(conn, trace, H3P_TLSHandshakeFailed, &http)
+	if connAgents == nil {
+		return
+	}
+	defer connAgents.CloseConnection(false, 0, "")
+
+	if conn.TLSTPHandler.ReceivedParameters.MaxUniStreams < 3 || conn.TLSTPHandler.ReceivedParameters.MaxBidiStreams == 0 {
+		trace.ErrorCode = H3P_NotEnoughStreamsAvailable
+		trace.Results["max_uni_streams"] = conn.TLSTPHandler.ReceivedParameters.MaxUniStreams
+		trace.Results["max_bidi_streams"] = conn.TLSTPHandler.ReceivedParameters.MaxBidiStreams
+		return
+	}
+
+	body := bytes.Repeat([]byte("QUIC-Tracker "), 512)
+	_, responseReceived := http.SendHTTP3Request(&agents.HTTP3Request{
+		Method:    "POST",
+		Authority: trace.Host,
+		Path:      preferredPath,
+		Headers:   []agents.HTTPHeader{{Name: "content-type", Value: "text/plain"}, {Name: "content-length", Value: fmt.Sprint(len(body))}},
+		Body:      body,
+		Trailers:  []agents.HTTPHeader{{Name: "x-quic-tracker", Value: "trailer"}},
+	})
+
+	select {
+	case r := <-responseReceived:
+		response := r.(*agents.HTTP3Response)
+		trace.Results["status"] = response.Status()
+		trace.Results["interim_responses"] = len(response.InterimResponses())
+		trace.Pass("host_answered_upload", fmt.Sprintf("the host answered with status %s", response.Status()))
+		s.Finished()
+		<-s.Timeout()
+	case <-conn.ConnectionClosed:
+		trace.Fail("host_answered_upload", H3P_RequestTimeout, "the connection was closed before the response was received")
+	case <-s.Timeout():
+		trace.Fail("host_answered_upload", H3P_RequestTimeout, "the response was not received before the scenario timed out")
+	}
+}
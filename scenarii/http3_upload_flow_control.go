@@ -0,0 +1,129 @@
+package scenarii
+
+import (
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/agents"
+	"io"
+)
+
+const (
+	H3UFC_TLSHandshakeFailed        = 1
+	H3UFC_NotEnoughStreamsAvailable = 2
+	H3UFC_HostDidNotExtendCredit    = 3
+	H3UFC_RequestTimeout            = 4
+)
+
+// The largest body uploaded, which bounds the flow control credit that can be exhausted.
+const h3ufcMaxUploadSize = 16 * 1024 * 1024
+
+type HTTP3UploadFlowControlScenario struct {
+	AbstractScenario
+}
+
+func NewHTTP3UploadFlowControlScenario() *HTTP3UploadFlowControlScenario {
+	return &HTTP3UploadFlowControlScenario{AbstractScenario{name: "http3_upload_flow_control", version: 1, http3: true}}
+}
+func (s *HTTP3UploadFlowControlScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool) {
+	conn.TLSTPHandler.MaxUniStreams = 3
+
+	http := agents.HTTP3Agent{}
+	connAgents := s.CompleteHandshake(conn, trace, H3UFC_TLSHandshakeFailed, &http)
+	if connAgents == nil {
+		return
+	}
+	defer connAgents.CloseConnection(false, 0, "")
+
+	params := conn.TLSTPHandler.ReceivedParameters
+	if params.MaxUniStreams < 3 || params.MaxBidiStreams == 0 {
+		trace.ErrorCode = H3UFC_NotEnoughStreamsAvailable
+		trace.Results["max_uni_streams"] = params.MaxUniStreams
+		trace.Results["max_bidi_streams"] = params.MaxBidiStreams
+		return
+	}
+
+	credit := params.MaxStreamDataBidiRemote
+	if params.MaxData < credit {
+		credit = params.MaxData
+	}
+	size := 2*credit + 1
+	if size > h3ufcMaxUploadSize {
+		size = h3ufcMaxUploadSize
+	}
+	trace.Results["initial_max_stream_data_bidi_remote"] = params.MaxStreamDataBidiRemote
+	trace.Results["initial_max_data"] = params.MaxData
+	trace.Results["upload_size"] = size
+
+	incPackets := conn.IncomingPackets.RegisterNewChan(1000)
+	streamID, responseReceived := http.SendHTTP3Request(&agents.HTTP3Request{
+		Method:     "POST",
+		Authority:  trace.Host,
+		Path:       preferredPath,
+		Headers:    []agents.HTTPHeader{{Name: "content-length", Value: fmt.Sprint(size)}},
+		BodyReader: io.LimitReader(zeroReader{}, int64(size)),
+	})
+
+	var creditPacket qt.Packet
+	for {
+		select {
+		case i := <-incPackets:
+			if p, ok := i.(qt.Framer); ok && creditPacket == nil && extendsRequestCredit(p, streamID) {
+				creditPacket = i.(qt.Packet)
+			}
+		case r := <-responseReceived:
+			trace.Pass("host_answered_upload", fmt.Sprintf("the host answered with status %s", r.(*agents.HTTP3Response).Status()))
+			if creditPacket != nil {
+				trace.Pass("host_extended_credit", "", creditPacket)
+			} else if size <= credit {
+				trace.Skip("host_extended_credit", "the credit of the host is larger than the upload")
+			} else { // The whole body cannot have been received without more credit
+				trace.Skip("host_extended_credit", "the host answered before receiving the whole body")
+			}
+			s.Finished()
+			<-s.Timeout()
+			return
+		case <-conn.ConnectionClosed:
+			s.failUpload(trace, creditPacket, size <= credit, "the connection was closed before the response was received")
+			return
+		case <-s.Timeout():
+			s.failUpload(trace, creditPacket, size <= credit, "the response was not received before the scenario timed out")
+			return
+		}
+	}
+}
+
+// failUpload records that the upload did not complete, because the host did not extend its credit if it had to.
+func (s *HTTP3UploadFlowControlScenario) failUpload(trace *qt.Trace, creditPacket qt.Packet, creditSufficed bool, message string) {
+	if creditPacket != nil {
+		trace.Pass("host_extended_credit", "", creditPacket)
+	} else if creditSufficed {
+		trace.Skip("host_extended_credit", "the credit of the host is larger than the upload")
+	} else {
+		trace.Fail("host_extended_credit", H3UFC_HostDidNotExtendCredit, "the host did not extend its flow control credit: "+message)
+	}
+	trace.Fail("host_answered_upload", H3UFC_RequestTimeout, message)
+}
+
+// extendsRequestCredit reports whether the packet raises the flow control limits of the connection or of the given
+// request stream.
+func extendsRequestCredit(p qt.Framer, streamID uint64) bool {
+	if p.Contains(qt.MaxDataType) {
+		return true
+	}
+	for _, f := range p.GetAll(qt.MaxStreamDataType) {
+		if f.(*qt.MaxStreamDataFrame).StreamId == streamID {
+			return true
+		}
+	}
+	return false
+}
+
+// zeroReader reads an infinite sequence of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
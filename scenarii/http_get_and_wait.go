@@ -2,6 +2,7 @@ package scenarii
 
 import (
 	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/agents"
 	"strings"
 
 	"fmt"
@@ -19,6 +20,7 @@ const (
 	SGW_DidntReceiveTheRequestedData    = 9
 	SGW_AnsweredOnUnannouncedStream     = 10
 	SGW_EndpointDoesNotSupportHQ		= 11
+	SGW_ContentHashMismatch             = 12
 )
 
 type SimpleGetAndWaitScenario struct {
@@ -54,6 +56,7 @@ func (s *SimpleGetAndWaitScenario) Run(conn *qt.Connection, trace *qt.Trace, pre
 	responseChan := connAgents.AddHTTPAgent().SendRequest(preferredPath, "GET", trace.Host, nil)
 
 	var connectionCloseReceived bool
+	var response agents.HTTPResponse
 
 forLoop:
 	for {
@@ -78,7 +81,7 @@ forLoop:
 					}
 				}
 			}
-		case <-responseChan:
+		case response = <-responseChan:
 			break forLoop
 		case <-conn.ConnectionClosed:
 			break forLoop
@@ -97,6 +100,9 @@ forLoop:
 		errors[SGW_DidntReceiveTheRequestedData] = "the response to the request was not complete"
 	}
 
+	if response != nil { // The errors found take precedence over the check
+		s.checkContentHash(trace, response.Body(), SGW_ContentHashMismatch)
+	}
 	if len(errors) == 1 {
 		for e, s := range errors {
 			trace.ErrorCode = e
@@ -2,7 +2,6 @@ package scenarii
 
 import (
 	qt "github.com/QUIC-Tracker/quic-tracker"
-	"github.com/mpiraux/pigotls"
 )
 
 const (
@@ -46,18 +45,7 @@ forLoop1:
 		}
 	}
 
-	// TODO: Move this to crypto.go
-	readSecret := conn.Tls.HkdfExpandLabel(conn.Tls.ProtectedReadSecret(), "ku", nil, conn.Tls.HashDigestSize(), pigotls.QuicBaseLabel)
-	writeSecret := conn.Tls.HkdfExpandLabel(conn.Tls.ProtectedWriteSecret(), "ku", nil, conn.Tls.HashDigestSize(), pigotls.QuicBaseLabel)
-
-	conn.CryptoStateLock.Lock()
-	oldState := conn.CryptoStates[qt.EncryptionLevel1RTT]
-
-	conn.CryptoStates[qt.EncryptionLevel1RTT] = qt.NewProtectedCryptoState(conn.Tls, readSecret, writeSecret)
-	conn.CryptoStates[qt.EncryptionLevel1RTT].HeaderRead = oldState.HeaderRead
-	conn.CryptoStates[qt.EncryptionLevel1RTT].HeaderWrite = oldState.HeaderWrite
-	conn.KeyPhaseIndex++
-	conn.CryptoStateLock.Unlock()
+	conn.UpdateKeys()
 
 	responseChan := connAgents.AddHTTPAgent().SendRequest(preferredPath, "GET", trace.Host, nil)
 
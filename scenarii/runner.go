@@ -0,0 +1,167 @@
+package scenarii
+
+import (
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"io"
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// RunOptions configures a run of a scenario against a host.
+type RunOptions struct {
+	Address       string        // The address to connect to, the host is resolved when empty
+	ServerName    string        // The SNI, the name of the host when empty
+	Path          string        // The path to request when the scenario needs data to be sent
+	ContentHash   string        // The expected hash of the content of the path, e.g. sha256:<hex>, checked when not empty
+	ALPN          string        // The ALPN prefix to use when HTTP/3 is not negotiated
+	Version       uint32        // The version to propose, the default one when 0
+	Timeout       time.Duration // The time spent completing the test
+	Debug         bool
+	QLogDirectory string    // The directory to stream the qlog events of the connection to, if any
+	QLogLegacy    bool      // Emits the qlog in the legacy draft-01 format
+	NoPcap        bool      // Disables the capture of packets
+	Interface     string    // When set, tcpdump captures the packets on this interface instead of the in-process capture
+	LogOutput     io.Writer // The writer of the logs of the run, os.Stderr when nil
+}
+
+// NewCrashTrace returns the trace of a run of a scenario that crashed.
+func NewCrashTrace(scenario Scenario, host string) *qt.Trace {
+	trace := qt.NewTrace(scenario.Name(), scenario.Version(), host)
+	trace.ErrorCode = CrashedErrorCode
+	return trace
+}
+
+// Run runs the scenario against the host in the current process and returns its trace. A panic of the scenario or of
+// one of the agents of its connection is recovered into a crash trace. A scenario instance must not be used by several
+// runs at the same time, GetAllScenarii() returns new instances.
+func Run(scenario Scenario, host string, options RunOptions) (trace *qt.Trace) {
+	logOutput := options.LogOutput
+	if logOutput == nil {
+		logOutput = os.Stderr
+	}
+	trace = qt.NewTrace(scenario.Name(), scenario.Version(), host)
+
+	address, serverName := host, options.ServerName
+	if options.Address != "" {
+		address = options.Address
+	}
+	if serverName == "" {
+		serverName = strings.Split(host, ":")[0] // Raw IPv6 are not handled correctly
+	}
+	conn, err := qt.NewDefaultConnection(address, serverName, nil, scenario.IPv6(), options.ALPN, scenario.HTTP3())
+	if err != nil {
+		trace.ErrorCode = UDPErrorCode
+		trace.Results["udp_error"] = err.Error()
+		return
+	}
+	if options.Version != 0 && options.Version != conn.Version {
+		tlsTP := conn.TLSTPHandler
+		conn.TransitionTo(options.Version, fmt.Sprintf("%s-%02d", strings.Split(conn.ALPN, "-")[0], options.Version&0xff))
+		conn.TLSTPHandler = tlsTP
+	}
+	conn.SetLogOutput(logOutput)
+	conn.QLog.Title = "QUIC-Tracker scenario " + scenario.Name()
+	conn.QLog.Legacy = options.QLogLegacy
+	if options.QLogDirectory != "" {
+		if err := conn.StreamQLog(options.QLogDirectory); err != nil {
+			trace.Results["qlog_error"] = err.Error()
+		}
+	}
+
+	var pcap *exec.Cmd
+	var pcapng *qt.PcapngCapture
+	if !options.NoPcap && options.Interface != "" {
+		pcap, err = qt.StartPcapCapture(conn, options.Interface)
+		if err != nil {
+			trace.Results["pcap_start_error"] = err.Error()
+		}
+	} else if !options.NoPcap {
+		pcapng = qt.StartPcapngCapture(conn)
+	}
+
+	trace.AttachTo(conn)
+
+	if s, ok := scenario.(interface{ SetContentHash(hash string) }); ok {
+		s.SetContentHash(options.ContentHash)
+	}
+	start := time.Now()
+	scenario.SetTimer(options.Timeout)
+	crashed := make(chan string, 1)
+	completed := make(chan bool)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Fprintf(logOutput, "%s crashed against %s: %v\n%s", scenario.Name(), host, r, debug.Stack())
+				crashed <- fmt.Sprint(r)
+			}
+		}()
+		scenario.Run(conn, trace, options.Path, options.Debug)
+		close(completed)
+	}()
+
+	select {
+	case <-completed:
+	case reason := <-crashed:
+		return crashTrace(scenario, host, conn, pcap, pcapng, start, reason)
+	case <-conn.Crashed: // The goroutine of the scenario is left to terminate with the connection
+		fmt.Fprintf(logOutput, "%s crashed against %s: %s\n", scenario.Name(), host, conn.CrashReason())
+		return crashTrace(scenario, host, conn, pcap, pcapng, start, conn.CrashReason())
+	}
+	trace.Duration = uint64(time.Now().Sub(start).Seconds() * 1000)
+	ip := strings.Replace(conn.ConnectedIp().String(), "[", "", -1)
+	trace.Ip = ip[:strings.LastIndex(ip, ":")]
+	trace.StartedAt = start.Unix()
+
+	trace.Complete(conn)
+	conn.Close()
+	if pcap != nil {
+		err = trace.AddPcap(conn, pcap)
+	} else if pcapng != nil {
+		trace.Pcap = pcapng.Stop()
+	}
+	if err != nil {
+		trace.Results["pcap_completed_error"] = err.Error()
+	}
+
+	conn.QLogTrace.Sort()
+	trace.QLog = conn.QLog
+	return
+}
+
+// crashTrace closes the connection of a run that crashed and returns its crash trace.
+func crashTrace(scenario Scenario, host string, conn *qt.Connection, pcap *exec.Cmd, pcapng *qt.PcapngCapture, start time.Time, reason string) *qt.Trace {
+	conn.Close()
+	if pcap != nil {
+		qt.StopPcapCapture(conn, pcap)
+	} else if pcapng != nil {
+		pcapng.Stop()
+	}
+	trace := NewCrashTrace(scenario, host)
+	trace.StartedAt = start.Unix()
+	trace.Duration = uint64(time.Now().Sub(start).Seconds() * 1000)
+	trace.Results["crash"] = reason
+	return trace
+}
+
+// RunAttempts runs the attempts of a scenario against a host. Each run is repeated the given number of times, and the
+// runs that fail are retried while retries are left. attempt returns the trace of the attempt of the given number,
+// starting at 1, or nil to stop. Each trace is passed to record with its attempt number set.
+func RunAttempts(repeat, retries int, attempt func(n int) *qt.Trace, record func(trace *qt.Trace)) {
+	for n, runsLeft := 1, repeat; runsLeft > 0; n++ {
+		trace := attempt(n)
+		if trace == nil {
+			return
+		}
+		trace.Attempt = n
+		record(trace)
+		if trace.ErrorCode != 0 && retries > 0 {
+			retries--
+		} else {
+			runsLeft--
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package scenarii
+
+import (
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"reflect"
+	"testing"
+)
+
+func TestRunAttempts(t *testing.T) {
+	errorCodes := []uint8{1, 0, 1, 1, 0}
+	var attempts []uint8
+	RunAttempts(3, 1, func(n int) *qt.Trace {
+		trace := qt.NewTrace("test", 1, "host")
+		trace.ErrorCode = errorCodes[n-1]
+		return trace
+	}, func(trace *qt.Trace) {
+		attempts = append(attempts, trace.ErrorCode)
+		if trace.Attempt != len(attempts) {
+			t.Errorf("attempt %d is numbered %d", len(attempts), trace.Attempt)
+		}
+	})
+	// The first failure is retried, the next ones are counted as runs
+	if expected := []uint8{1, 0, 1, 1}; !reflect.DeepEqual(attempts, expected) {
+		t.Errorf("expected attempts %v, got %v", expected, attempts)
+	}
+
+	attempts = nil
+	RunAttempts(3, 0, func(n int) *qt.Trace {
+		if n == 2 {
+			return nil
+		}
+		return qt.NewTrace("test", 1, "host")
+	}, func(trace *qt.Trace) { attempts = append(attempts, trace.ErrorCode) })
+	if len(attempts) != 1 {
+		t.Errorf("expected the attempts to stop after the first one, got %d", len(attempts))
+	}
+}
+
+func TestCheckContentHash(t *testing.T) {
+	s := &AbstractScenario{}
+	trace := qt.NewTrace("http3_get", 1, "host")
+	s.checkContentHash(trace, []byte("Hello, world!"), H3G_ContentHashMismatch)
+	if len(trace.Checks) != 0 {
+		t.Error("the content was checked without an expected hash")
+	}
+
+	s.SetContentHash("sha256:315F5BDB76D078C43B8AC0064E4A0164612B1FCE77C869345BFC94C75894EDD3")
+	s.checkContentHash(trace, []byte("Hello, world!"), H3G_ContentHashMismatch)
+	s.checkContentHash(trace, []byte("Hello"), H3G_ContentHashMismatch)
+	if len(trace.Checks) != 2 || trace.Checks[0].Status != qt.CheckPassed || trace.Checks[1].Status != qt.CheckFailed {
+		t.Errorf("unexpected checks %+v", trace.Checks)
+	}
+	if trace.ErrorCode != H3G_ContentHashMismatch {
+		t.Errorf("unexpected error code %d", trace.ErrorCode)
+	}
+}
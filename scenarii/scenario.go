@@ -8,11 +8,18 @@
 // 	It must be registered in the GetAllScenarii() function.
 // 	It must define an upper bound on its completion time. It should use the Timeout() function to achieve this.
 //
+// The expect package provides waiters for the packets a scenario expects to receive.
+//
+// Scenarios can also be described as a list of steps in YAML or JSON files, see ScenarioSpec and LoadScenarioFiles.
 //
 package scenarii
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	qt "github.com/QUIC-Tracker/quic-tracker"
+	"strings"
 
 	"github.com/QUIC-Tracker/quic-tracker/agents"
 	"time"
@@ -23,6 +30,7 @@ type Scenario interface {
 	Version() int
 	IPv6() bool
 	HTTP3() bool
+	Metadata() Metadata
 	Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool)
 	SetTimer(d time.Duration)
 	Timeout() <-chan time.Time
@@ -37,6 +45,8 @@ type AbstractScenario struct {
 	http3    bool
 	duration time.Duration
 	timeout  *time.Timer
+
+	contentHash string // The expected hash of the content of the path requested, if known
 }
 
 func (s *AbstractScenario) Name() string {
@@ -61,6 +71,26 @@ func (s *AbstractScenario) SetTimer(d time.Duration) {
 func (s *AbstractScenario) Timeout() <-chan time.Time {
 	return s.timeout.C
 }
+// SetContentHash sets the expected hash of the content of the path requested, e.g. sha256:<hex>.
+func (s *AbstractScenario) SetContentHash(hash string) {
+	s.contentHash = hash
+}
+
+// checkContentHash records whether the body received matches the expected hash of the content of the path, when it is
+// known.
+func (s *AbstractScenario) checkContentHash(trace *qt.Trace, body []byte, errorCode uint8) {
+	if s.contentHash == "" {
+		return
+	}
+	digest := sha256.Sum256(body)
+	hash := "sha256:" + hex.EncodeToString(digest[:])
+	if strings.EqualFold(hash, s.contentHash) {
+		trace.Pass("content_matches_expected_hash", "")
+	} else {
+		trace.Fail("content_matches_expected_hash", errorCode, fmt.Sprintf("expected %s, got %s for %d bytes", s.contentHash, hash, len(body)))
+	}
+}
+
 func (s *AbstractScenario) Finished() {
 	if s.duration == 0 {
 		s.timeout.Reset(0)
@@ -99,7 +129,7 @@ func (s *AbstractScenario) CompleteHandshake(conn *qt.Connection, trace *qt.Trac
 }
 
 func GetAllScenarii() map[string]Scenario {
-	return map[string]Scenario{
+	scenarii := map[string]Scenario{
 		"zero_rtt":                   NewZeroRTTScenario(),
 		"connection_migration":       NewConnectionMigrationScenario(),
 		"unsupported_tls_version":    NewUnsupportedTLSVersionScenario(),
@@ -125,6 +155,9 @@ func GetAllScenarii() map[string]Scenario {
 		"http3_uni_streams_limits":   NewHTTP3UniStreamsLimitsScenario(),
 		"http3_reserved_frames":      NewHTTP3ReservedFramesScenario(),
 		"http3_reserved_streams":     NewHTTP3ReservedStreamsScenario(),
+		"http3_post":                 NewHTTP3POSTScenario(),
+		"http3_data_before_headers":  NewHTTP3DataBeforeHeadersScenario(),
+		"http3_upload_flow_control":  NewHTTP3UploadFlowControlScenario(),
 		"spin_bit":                   NewSpinBitScenario(),
 		"server_flow_control":        NewServerFlowControlScenario(),
 		"connection_migration_v4_v6": NewConnectionMigrationv4v6Scenario(),
@@ -132,4 +165,27 @@ func GetAllScenarii() map[string]Scenario {
 		"multi_packet_client_hello":  NewMultiPacketClientHello(),
 		"closed_connection":          NewClosedConnectionScenario(),
 	}
+	registry.RLock()
+	defer registry.RUnlock()
+	for name, spec := range declaredScenarios {
+		scenarii[name] = NewDeclarativeScenario(spec)
+	}
+	return scenarii
+}
+
+// GetScenario returns a new instance of the scenario with the given name, or nil if it does not exist.
+func GetScenario(name string) Scenario {
+	for id, s := range GetAllScenarii() {
+		if id == name || s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// skipChecks records that the checks could not be performed for the given reason.
+func skipChecks(trace *qt.Trace, reason string, checks ...string) {
+	for _, c := range checks {
+		trace.Skip(c, reason)
+	}
 }
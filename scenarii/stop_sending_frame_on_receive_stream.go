@@ -3,6 +3,7 @@ package scenarii
 import (
 	"fmt"
 	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/scenarii/expect"
 )
 
 const (
@@ -33,32 +34,18 @@ func (s *StopSendingOnReceiveStreamScenario) Run(conn *qt.Connection, trace *qt.
 		return
 	}
 
-	incPackets := conn.IncomingPackets.RegisterNewChan(1000)
+	w := expect.NewWaiter(conn, trace, s.Timeout())
+	defer w.Close()
 
 	conn.SendHTTP09GETRequest(preferredPath, 2)
 	conn.FrameQueue.Submit(qt.QueuedFrame{&qt.StopSendingFrame{2, 0}, qt.EncryptionLevel1RTT})
 
 	trace.ErrorCode = SSRS_DidNotCloseTheConnection
-	for {
-		select {
-		case i := <-incPackets:
-			switch p := i.(type) {
-			case qt.Framer:
-				if p.Contains(qt.ConnectionCloseType) {
-					cc := p.GetFirst(qt.ConnectionCloseType).(*qt.ConnectionCloseFrame)
-					if cc.ErrorCode != qt.ERR_STREAM_STATE_ERROR && cc.ErrorCode != qt.ERR_PROTOCOL_VIOLATION {
-						trace.MarkError(SSRS_CloseTheConnectionWithWrongError, fmt.Sprintf("Expected 0x%02x, got 0x%02x", qt.ERR_STREAM_STATE_ERROR, cc.ErrorCode), p)
-						trace.Results["connection_closed_error_code"] = fmt.Sprintf("0x%x", cc.ErrorCode)
-						return
-					}
-					trace.ErrorCode = 0
-					return
-				}
-			}
-		case <-conn.ConnectionClosed:
-			return
-		case <-s.Timeout():
-			return
-		}
+	_, err := w.Wait(expect.ExpectClose(qt.ERR_STREAM_STATE_ERROR, qt.ERR_PROTOCOL_VIOLATION), 0)
+	if cErr, ok := err.(*expect.CloseError); ok {
+		trace.MarkError(SSRS_CloseTheConnectionWithWrongError, fmt.Sprintf("Expected 0x%02x, got 0x%02x", qt.ERR_STREAM_STATE_ERROR, cErr.ErrorCode), cErr.Packet)
+		trace.Results["connection_closed_error_code"] = fmt.Sprintf("0x%x", cErr.ErrorCode)
+	} else if err == nil {
+		trace.ErrorCode = 0
 	}
 }
@@ -45,7 +45,7 @@ forLoop:
 				sendUnsupportedInitial(conn)
 			case *qt.RetryPacket:
 				conn.DestinationCID = p.Header().(*qt.LongHeader).SourceCID
-				conn.TransitionTo(qt.QuicVersion, qt.QuicALPNToken)
+				conn.TransitionTo(conn.Version, conn.ALPN)
 				conn.Token = p.RetryToken
 				sendUnsupportedInitial(conn)
 			case qt.Framer:
@@ -0,0 +1,241 @@
+package scenarii
+
+import "fmt"
+
+// The error codes that are not specific to a scenario.
+const (
+	SucceededErrorCode = 0
+	CrashedErrorCode   = 254 // The scenario did not produce a trace, e.g. it panicked or exceeded its time limit
+	UDPErrorCode       = 255 // The UDP connection to the host could not be established
+)
+
+// The human-readable descriptions of the error codes of each scenario, indexed by scenario name.
+var errorCodeDescriptions = map[string]map[uint8]string{
+	"ack_ecn": {
+		AE_TLSHandshakeFailed: "The TLS handshake failed",
+		AE_FailedToSetECN:     "ECN could not be enabled on the socket",
+		AE_NonECN:             "The host did not mark its packets with ECN",
+		AE_NoACKECNReceived:   "The host did not send ACK_ECN frames",
+		AE_NonECNButACKECN:    "The host sent ACK_ECN frames but did not mark its packets with ECN",
+	},
+	"ack_only": {
+		AO_TLSHandshakeFailed:   "The TLS handshake failed",
+		AO_SentAOInResponseOfAO: "The host acknowledged a packet containing only acknowledgements",
+	},
+	"address_validation": {
+		AV_TLSHandshakeFailed:       "The TLS handshake failed",
+		AV_SentMoreThan3Datagrams:   "The host sent more than 3 datagrams before validating the address",
+		AV_SentMoreThan3TimesAmount: "The host sent more than 3 times the amount of data received before validating the address",
+		AV_HostTimedOut:             "The host did not respond",
+	},
+	"closed_connection": {
+		CCS_TLSHandshakeFailed: "The TLS handshake failed",
+		CCS_NoPacketsReceived:  "No packets were received",
+		CSS_APacketWasReceived: "The host sent a packet after the connection was closed",
+	},
+	"connection_migration": {
+		CM_TLSHandshakeFailed:        "The TLS handshake failed",
+		CM_UDPConnectionFailed:       "The new UDP connection could not be established",
+		CM_HostDidNotMigrate:         "The host did not migrate to the new path",
+		CM_HostDidNotValidateNewPath: "The host did not validate the new path",
+		CM_TooManyCIDs:               "The host provided more connection IDs than allowed",
+		CM_HostDidNotUseNewCID:       "The host did not use a new connection ID on the new path",
+	},
+	"connection_migration_v4_v6": {
+		CM46_TLSHandshakeFailed:        "The TLS handshake failed",
+		CM46_UDPConnectionFailed:       "The new UDP connection could not be established",
+		CM46_HostDidNotMigrate:         "The host did not migrate to the new path",
+		CM46_HostDidNotValidateNewPath: "The host did not validate the new path",
+		CM46_NoNewCIDReceived:          "The host did not provide a new connection ID",
+		CM46_NoNewCIDUsed:              "The host did not use a new connection ID on the new path",
+		CM46_MigrationIsDisabled:       "The host disabled active migration",
+		CM46_NoCIDAllowed:              "The host does not allow additional connection IDs",
+	},
+	"flow_control": {
+		FC_TLSHandshakeFailed:          "The TLS handshake failed",
+		FC_HostSentMoreThanLimit:       "The host sent more data than allowed",
+		FC_HostDidNotResumeSending:     "The host did not resume sending after the limit was raised",
+		FC_NotEnoughDataAvailable:      "The resource requested is too small to test flow control",
+		FC_RespectedLimitsButNoBlocked: "The host respected the limits but did not signal it was blocked",
+		FC_EndpointDoesNotSupportHQ:    "The host does not support HTTP/0.9",
+	},
+	"handshake": {
+		H_ReceivedUnexpectedPacketType: "An unexpected type of packet was received",
+		H_TLSHandshakeFailed:           "The TLS handshake failed",
+		H_NoCompatibleVersionAvailable: "The host supports no compatible version",
+		H_Timeout:                      "The handshake timed out",
+	},
+	"handshake_v6": {
+		H_ReceivedUnexpectedPacketType: "An unexpected type of packet was received",
+		H_TLSHandshakeFailed:           "The TLS handshake failed",
+		H_NoCompatibleVersionAvailable: "The host supports no compatible version",
+		H_Timeout:                      "The handshake timed out",
+	},
+	"http3_encoder_stream": {
+		H3ES_TLSHandshakeFailed:        "The TLS handshake failed",
+		H3ES_RequestTimeout:            "The request timed out",
+		H3ES_NotEnoughStreamsAvailable: "The host did not allow enough streams",
+		H3ES_SETTINGSNotSent:           "The host did not send its SETTINGS",
+	},
+	"http3_data_before_headers": {
+		H3DBH_TLSHandshakeFailed:               "The TLS handshake failed",
+		H3DBH_NotEnoughStreamsAvailable:        "The host did not allow enough streams",
+		H3DBH_DidNotCloseTheConnection:         "The host did not close the connection",
+		H3DBH_CloseTheConnectionWithWrongError: "The host closed the connection with the wrong error",
+	},
+	"http3_get": {
+		H3G_TLSHandshakeFailed:        "The TLS handshake failed",
+		H3G_RequestTimeout:            "The request timed out",
+		H3G_NotEnoughStreamsAvailable: "The host did not allow enough streams",
+		H3G_ContentHashMismatch:       "The content received does not match its expected hash",
+	},
+	"http3_post": {
+		H3P_TLSHandshakeFailed:        "The TLS handshake failed",
+		H3P_RequestTimeout:            "The request timed out",
+		H3P_NotEnoughStreamsAvailable: "The host did not allow enough streams",
+	},
+	"http3_reserved_frames": {
+		H3RF_TLSHandshakeFailed:        "The TLS handshake failed",
+		H3RF_RequestTimeout:            "The request timed out",
+		H3RF_NotEnoughStreamsAvailable: "The host did not allow enough streams",
+	},
+	"http3_reserved_streams": {
+		H3RS_TLSHandshakeFailed:        "The TLS handshake failed",
+		H3RS_RequestTimeout:            "The request timed out",
+		H3RS_NotEnoughStreamsAvailable: "The host did not allow enough streams",
+	},
+	"http3_uni_streams_limits": {
+		H3USFC_TLSHandshakeFailed:        "The TLS handshake failed",
+		H3USFC_RequestTimeout:            "The request timed out",
+		H3USFC_NotEnoughStreamsAvailable: "The host did not allow enough streams",
+		H3USFC_StreamIDError:             "The host did not close the connection with STREAM_ID_ERROR",
+	},
+	"http3_upload_flow_control": {
+		H3UFC_TLSHandshakeFailed:        "The TLS handshake failed",
+		H3UFC_NotEnoughStreamsAvailable: "The host did not allow enough streams",
+		H3UFC_HostDidNotExtendCredit:    "The host did not extend its flow control credit",
+		H3UFC_RequestTimeout:            "The request timed out",
+	},
+	"http_get_and_wait": {
+		SGW_TLSHandshakeFailed:              "The TLS handshake failed",
+		SGW_EmptyStreamFrameNoFinBit:        "The host sent an empty STREAM frame without the FIN bit",
+		SGW_RetransmittedAck:                "The host retransmitted acknowledgements",
+		SGW_WrongStreamIDReceived:           "The host answered on another stream",
+		SGW_UnknownError:                    "An unknown error occurred",
+		SGW_DidNotCloseTheConnection:        "The host did not close the connection",
+		SGW_MultipleErrors:                  "Several errors occurred",
+		SGW_TooLowStreamIdBidiToSendRequest: "The host did not allow enough bidirectional streams",
+		SGW_DidntReceiveTheRequestedData:    "The requested data was not received",
+		SGW_AnsweredOnUnannouncedStream:     "The host answered on a stream that was not opened",
+		SGW_EndpointDoesNotSupportHQ:        "The host does not support HTTP/0.9",
+		SGW_ContentHashMismatch:             "The content received does not match its expected hash",
+	},
+	"http_get_on_uni_stream": {
+		GS2_TLSHandshakeFailed:                    "The TLS handshake failed",
+		GS2_TooLowStreamIdUniToSendRequest:        "The host did not allow enough unidirectional streams",
+		GS2_ReceivedDataOnStream2:                 "The host answered on the unidirectional stream",
+		GS2_ReceivedDataOnUnauthorizedStream:      "The host sent data on a stream it was not allowed to use",
+		GS2_AnswersToARequestOnAForbiddenStreamID: "The host answered a request sent on a forbidden stream",
+		GS2_DidNotCloseTheConnection:              "The host did not close the connection",
+		GS2_EndpointDoesNotSupportHQ:              "The host does not support HTTP/0.9",
+	},
+	"key_update": {
+		KU_TLSHandshakeFailed: "The TLS handshake failed",
+		KU_HostDidNotRespond:  "The host did not respond after the key update",
+	},
+	"multi_packet_client_hello": {
+		MPCH_TLSHandshakeFailed: "The TLS handshake failed",
+		MPCH_RequestFailed:      "The request failed",
+	},
+	"multi_stream": {
+		MS_TLSHandshakeFailed:      "The TLS handshake failed",
+		MS_NoTPReceived:            "No transport parameters were received",
+		MS_NotAllStreamsWereClosed: "Not all streams were closed by the host",
+	},
+	"new_connection_id": {
+		NCI_TLSHandshakeFailed:       "The TLS handshake failed",
+		NCI_HostDidNotProvideCID:     "The host did not provide a new connection ID",
+		NCI_HostDidNotAnswerToNewCID: "The host did not answer on the new connection ID",
+		NCI_HostDidNotAdaptCID:       "The host did not use the new connection ID",
+		NCI_HostSentInvalidCIDLength: "The host sent a connection ID of invalid length",
+		NCI_NoCIDAllowed:             "The host does not allow additional connection IDs",
+	},
+	"padding": {
+		P_VNDidNotComplete: "The version negotiation did not complete",
+		P_ReceivedSmth:     "The host answered a packet containing only padding",
+	},
+	"retire_connection_id": {
+		RCI_TLSHandshakeFailed:       "The TLS handshake failed",
+		RCI_HostDidNotProvideCID:     "The host did not provide a new connection ID",
+		RCI_HostDidNotProvideNewCID:  "The host did not replace the retired connection ID",
+		RCI_HostSentInvalidCIDLength: "The host sent a connection ID of invalid length",
+	},
+	"server_flow_control": {
+		SFC_TLSHandshakeFailed: "The TLS handshake failed",
+		SFC_DidNotClose:        "The host did not close the connection when its limits were exceeded",
+	},
+	"spin_bit": {
+		SB_TLSHandshakeFailed: "The TLS handshake failed",
+		SB_DoesNotSpin:        "The host does not spin the spin bit",
+	},
+	"stop_sending_frame_on_receive_stream": {
+		SSRS_TLSHandshakeFailed:               "The TLS handshake failed",
+		SSRS_DidNotCloseTheConnection:         "The host did not close the connection",
+		SSRS_CloseTheConnectionWithWrongError: "The host closed the connection with a wrong error code",
+		SSRS_MaxStreamUniTooLow:               "The host did not allow enough unidirectional streams",
+		SSRS_UnknownError:                     "An unknown error occurred",
+	},
+	"stream_opening_reordering": {
+		SOR_TLSHandshakeFailed:       "The TLS handshake failed",
+		SOR_HostDidNotRespond:        "The host did not respond",
+		SOR_EndpointDoesNotSupportHQ: "The host does not support HTTP/0.9",
+	},
+	"transport_parameters": {
+		TP_NoTPReceived:            "No transport parameters were received",
+		TP_TPResentAfterVN:         "The transport parameters were resent after version negotiation",
+		TP_HandshakeDidNotComplete: "The handshake did not complete",
+		TP_MissingParameters:       "Mandatory transport parameters are missing",
+	},
+	"unsupported_tls_version": {
+		UTS_NoConnectionCloseSent:        "The host did not close the connection",
+		UTS_WrongErrorCodeIsUsed:         "The host closed the connection with a wrong error code",
+		UTS_VNDidNotComplete:             "The version negotiation did not complete",
+		UTS_ReceivedUnexpectedPacketType: "An unexpected type of packet was received",
+	},
+	"version_negotiation": {
+		VN_NotAnsweringToVN:               "The host did not send a Version Negotiation packet",
+		VN_DidNotEchoVersion:              "The host did not echo the version proposed",
+		VN_LastTwoVersionsAreActuallySeal: "The Version Negotiation packet was sealed",
+		VN_Timeout:                        "The version negotiation timed out",
+		VN_UnusedFieldIsIdentical:         "The unused field of the Version Negotiation packets is not random",
+	},
+	"zero_length_cid": {
+		ZLCID_TLSHandshakeFailed: "The TLS handshake failed",
+		ZLCID_RequestFailed:      "The request failed",
+	},
+	"zero_rtt": {
+		ZR_TLSHandshakeFailed:           "The TLS handshake failed",
+		ZR_NoResumptionSecret:           "The host did not provide a resumption ticket",
+		ZR_ZeroRTTFailed:                "The 0-RTT handshake failed",
+		ZR_DidntReceiveTheRequestedData: "The requested data was not received in 0-RTT",
+	},
+}
+
+// ErrorCodeDescription returns a human-readable description of the error code of a trace produced by the given
+// scenario.
+func ErrorCodeDescription(scenario string, errorCode uint8) string {
+	switch errorCode {
+	case SucceededErrorCode:
+		return "Succeeded"
+	case CrashedErrorCode:
+		return "The scenario crashed"
+	case UDPErrorCode:
+		return "The UDP connection failed"
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	if description, ok := errorCodeDescriptions[scenario][errorCode]; ok {
+		return description
+	}
+	return fmt.Sprintf("Error code %d", errorCode)
+}
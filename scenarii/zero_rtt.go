@@ -57,16 +57,31 @@ func (s *ZeroRTTScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPat
 	<-time.NewTimer(3 * time.Second).C
 
 	rh, sh, token := conn.ReceivedPacketHandler, conn.SentPacketHandler, conn.Token
+	rdh, sdh, klh := conn.ReceivedDatagramHandler, conn.SentDatagramHandler, conn.KeyLogHandler
+	qlogDirectory, logOutput := conn.QLogDirectory, conn.LogOutput
+	version, alpn := conn.Version, conn.ALPN
 
 	var err error
 	conn, err = qt.NewDefaultConnection(conn.Host.String(), conn.ServerName, ticket, s.ipv6, "hq", strings.Contains(conn.ALPN, "h3"))
-	conn.ReceivedPacketHandler = rh
-	conn.SentPacketHandler = sh
-	conn.Token = token
 	if err != nil {
 		trace.MarkError(ZR_ZeroRTTFailed, err.Error(), nil)
 		return
 	}
+	conn.ReceivedPacketHandler = rh
+	conn.SentPacketHandler = sh
+	conn.ReceivedDatagramHandler, conn.SentDatagramHandler, conn.KeyLogHandler = rdh, sdh, klh
+	conn.Token = token
+	conn.SetLogOutput(logOutput)
+	if conn.Version != version { // The version negotiated or configured for the first connection is resumed
+		tlsTP := conn.TLSTPHandler
+		conn.TransitionTo(version, alpn)
+		conn.TLSTPHandler = tlsTP
+	}
+	if qlogDirectory != "" {
+		if err := conn.StreamQLog(qlogDirectory); err != nil {
+			conn.Logger.Printf("The qlog of the connection could not be streamed: %s\n", err.Error())
+		}
+	}
 
 	connAgents = agents.AttachAgentsToConnection(conn, agents.GetDefaultAgents()...)
 	connAgents.Stop("RecoveryAgent")
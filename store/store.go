@@ -0,0 +1,426 @@
+// Package store keeps the history of the results of the test suite in a directory, so that the behaviour of hosts
+// can be followed over time.
+//
+// The store indexes each trace by the commit that produced it, its host, scenario, start time and verdict in an
+// append-only index.jsonl file. The traces are written to the traces directory and their packet captures and qlog to
+// the blobs directory, so that the retention policy can discard them before the verdicts. A store should be written to
+// by a single process at a time.
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"github.com/QUIC-Tracker/quic-tracker/results"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const indexFilename = "index.jsonl"
+
+// An Entry of the index of a store describes a trace.
+type Entry struct {
+	ID              string `json:"id"`
+	Commit          string `json:"commit"`
+	Host            string `json:"host"`
+	Scenario        string `json:"scenario"`
+	ScenarioVersion int    `json:"scenario_version"`
+	StartedAt       int64  `json:"started_at"`
+	Duration        uint64 `json:"duration"`
+	ErrorCode       uint8  `json:"error_code"`
+	Attempt         int    `json:"attempt,omitempty"`
+	Outcome         string `json:"outcome"`
+	AddedAt         int64  `json:"added_at"`
+	Pcap            string `json:"pcap,omitempty"` // The file of the packet capture in the store, if kept
+	QLog            string `json:"qlog,omitempty"` // The file of the qlog in the store, if kept
+}
+
+// Key returns the host and scenario of the entry.
+func (e Entry) Key() results.Key {
+	return results.Key{Host: e.Host, Scenario: e.Scenario}
+}
+
+// Time returns the time at which the scenario started.
+func (e Entry) Time() time.Time {
+	return time.Unix(e.StartedAt, 0)
+}
+
+// A Store is a directory holding traces and their index.
+type Store struct {
+	dir     string
+	mutex   sync.Mutex
+	entries []Entry
+	ids     map[string]bool
+}
+
+// Open opens the store located in the given directory, creating it if needed.
+func Open(dir string) (*Store, error) {
+	for _, d := range []string{dir, filepath.Join(dir, "traces"), filepath.Join(dir, "blobs")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, err
+		}
+	}
+	s := &Store{dir: dir, ids: make(map[string]bool)}
+
+	file, err := os.Open(filepath.Join(dir, indexFilename))
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s line %d: %s", indexFilename, line, err.Error())
+		}
+		s.entries = append(s.entries, e)
+		s.ids[e.ID] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	s.sort()
+	return s, nil
+}
+
+// Add stores the given traces and returns the number of them that were not already in the store.
+func (s *Store) Add(traces []*qt.Trace) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	index, err := os.OpenFile(filepath.Join(s.dir, indexFilename), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer index.Close()
+
+	added := 0
+	for _, t := range traces {
+		id, err := TraceID(t)
+		if err != nil {
+			return added, err
+		}
+		if s.ids[id] {
+			continue
+		}
+
+		e := Entry{ID: id, Commit: t.Commit, Host: t.Host, Scenario: t.Scenario, ScenarioVersion: t.ScenarioVersion,
+			StartedAt: t.StartedAt, Duration: t.Duration, ErrorCode: t.ErrorCode, Attempt: t.Attempt,
+			Outcome: results.OutcomeOf(t), AddedAt: time.Now().Unix()}
+
+		if len(t.Pcap) > 0 {
+			e.Pcap = path.Join("blobs", id+".pcap")
+			if bytes.HasPrefix(t.Pcap, []byte{0x0a, 0x0d, 0x0d, 0x0a}) {
+				e.Pcap += "ng"
+			}
+			if err := ioutil.WriteFile(filepath.Join(s.dir, e.Pcap), t.Pcap, 0644); err != nil {
+				return added, err
+			}
+		}
+		if t.QLog != nil {
+			qlog, err := json.Marshal(t.QLog)
+			if err != nil {
+				return added, err
+			}
+			e.QLog = path.Join("blobs", id+".qlog")
+			if err := ioutil.WriteFile(filepath.Join(s.dir, e.QLog), qlog, 0644); err != nil {
+				return added, err
+			}
+		}
+
+		stripped := *t
+		stripped.Pcap, stripped.QLog = nil, nil
+		content, err := json.Marshal(stripped)
+		if err != nil {
+			return added, err
+		}
+		if err := ioutil.WriteFile(s.tracePath(id), content, 0644); err != nil {
+			return added, err
+		}
+
+		line, err := json.Marshal(e)
+		if err != nil {
+			return added, err
+		}
+		if _, err := index.Write(append(line, '\n')); err != nil {
+			return added, err
+		}
+		s.entries = append(s.entries, e)
+		s.ids[id] = true
+		added++
+	}
+	s.sort()
+	return added, nil
+}
+
+// TraceID returns the ID of a trace in a store, which is derived from its content.
+func TraceID(t *qt.Trace) (string, error) {
+	content, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// Trace reads the trace of an entry, along with its packet capture and qlog when they were kept.
+func (s *Store) Trace(e Entry) (*qt.Trace, error) {
+	content, err := ioutil.ReadFile(s.tracePath(e.ID))
+	if err != nil {
+		return nil, err
+	}
+	t := new(qt.Trace)
+	if err := json.Unmarshal(content, t); err != nil {
+		return nil, err
+	}
+	if e.Pcap != "" {
+		if t.Pcap, err = ioutil.ReadFile(filepath.Join(s.dir, e.Pcap)); err != nil {
+			return nil, err
+		}
+	}
+	if e.QLog != "" {
+		qlog, err := ioutil.ReadFile(filepath.Join(s.dir, e.QLog))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(qlog, &t.QLog); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Get returns the entry of the given ID, which can be abbreviated as long as it is not ambiguous.
+func (s *Store) Get(id string) (Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var found []Entry
+	for _, e := range s.entries {
+		if strings.HasPrefix(e.ID, id) {
+			found = append(found, e)
+		}
+	}
+	switch {
+	case id == "" || len(found) == 0:
+		return Entry{}, errors.New("no trace " + id + " in the store")
+	case len(found) > 1:
+		return Entry{}, errors.New("trace ID " + id + " is ambiguous")
+	}
+	return found[0], nil
+}
+
+// A Query selects entries of a store. Its zero value selects all of them.
+type Query struct {
+	Host       string    // The hosts selected, in which * and ? can be used
+	Scenario   string    // The scenarios selected, in which * and ? can be used
+	Commit     string    // A prefix of the commit selected
+	Outcome    string    // The outcome selected
+	ErrorCodes []uint8   // The error codes selected
+	Since      time.Time // The earliest start time selected
+	Until      time.Time // The start time before which entries are selected
+	Last       int       // The number of most recent entries kept for each host and scenario
+}
+
+func (q Query) matches(e Entry) bool {
+	if q.Host != "" {
+		if matched, _ := path.Match(q.Host, e.Host); !matched {
+			return false
+		}
+	}
+	if q.Scenario != "" {
+		if matched, _ := path.Match(q.Scenario, e.Scenario); !matched {
+			return false
+		}
+	}
+	if !strings.HasPrefix(e.Commit, q.Commit) || q.Outcome != "" && e.Outcome != q.Outcome {
+		return false
+	}
+	if len(q.ErrorCodes) > 0 {
+		found := false
+		for _, c := range q.ErrorCodes {
+			found = found || c == e.ErrorCode
+		}
+		if !found {
+			return false
+		}
+	}
+	return (q.Since.IsZero() || !e.Time().Before(q.Since)) && (q.Until.IsZero() || e.Time().Before(q.Until))
+}
+
+// Query returns the entries selected by the query, from the oldest to the most recent.
+func (s *Store) Query(q Query) []Entry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var selected []Entry
+	for _, e := range s.entries {
+		if q.matches(e) {
+			selected = append(selected, e)
+		}
+	}
+	if q.Last <= 0 {
+		return selected
+	}
+	kept := make(map[results.Key]int)
+	var last []Entry
+	for i := len(selected) - 1; i >= 0; i-- {
+		if kept[selected[i].Key()] < q.Last {
+			kept[selected[i].Key()]++
+			last = append(last, selected[i])
+		}
+	}
+	for i, j := 0, len(last)-1; i < j; i, j = i+1, j-1 {
+		last[i], last[j] = last[j], last[i]
+	}
+	return last
+}
+
+// A Transition reports a scenario that started failing against a host.
+type Transition struct {
+	results.Key
+	LastPassed  Entry `json:"last_passed"`  // The last attempt that passed
+	FirstFailed Entry `json:"first_failed"` // The first attempt that did not pass after it
+	Latest      Entry `json:"latest"`       // The most recent attempt, which did not pass either
+}
+
+// StartedFailing returns the scenarios that passed against a host, then started failing since the given time and have
+// not passed since. The hosts and scenarios are selected as in a Query.
+func (s *Store) StartedFailing(host, scenario string, since time.Time) []Transition {
+	history := make(map[results.Key][]Entry)
+	var keys []results.Key
+	for _, e := range s.Query(Query{Host: host, Scenario: scenario}) {
+		if _, ok := history[e.Key()]; !ok {
+			keys = append(keys, e.Key())
+		}
+		history[e.Key()] = append(history[e.Key()], e)
+	}
+
+	var transitions []Transition
+	for _, k := range keys {
+		entries := history[k]
+		i := len(entries) - 1
+		for i >= 0 && entries[i].Outcome != results.OutcomePassed {
+			i--
+		}
+		if i < 0 || i == len(entries)-1 || entries[i+1].Time().Before(since) {
+			continue
+		}
+		transitions = append(transitions, Transition{Key: k, LastPassed: entries[i], FirstFailed: entries[i+1], Latest: entries[len(entries)-1]})
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		return transitions[i].Scenario < transitions[j].Scenario || transitions[i].Scenario == transitions[j].Scenario && transitions[i].Host < transitions[j].Host
+	})
+	return transitions
+}
+
+// A Retention policy limits the size of a store.
+type Retention struct {
+	MaxAge     time.Duration // The age after which the entries are removed, unless kept by KeepLast
+	BlobMaxAge time.Duration // The age after which the packet captures and qlog of the traces are removed
+	KeepLast   int           // The number of most recent entries of each host and scenario that are never removed
+}
+
+// Prune applies the retention policy to the store and returns the number of entries removed.
+func (s *Store) Prune(r Retention) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	newer := make(map[results.Key]int)
+	var kept, removed []Entry
+	var expiredBlobs []string
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		e := s.entries[i]
+		newer[e.Key()]++
+		age := now.Sub(e.Time())
+		if r.MaxAge > 0 && age > r.MaxAge && newer[e.Key()] > r.KeepLast {
+			removed = append(removed, e)
+			continue
+		}
+		if r.BlobMaxAge > 0 && age > r.BlobMaxAge {
+			for _, blob := range []string{e.Pcap, e.QLog} {
+				if blob != "" {
+					expiredBlobs = append(expiredBlobs, filepath.Join(s.dir, blob))
+				}
+			}
+			e.Pcap, e.QLog = "", ""
+		}
+		kept = append(kept, e)
+	}
+
+	var buffer bytes.Buffer
+	for i := len(kept) - 1; i >= 0; i-- {
+		line, err := json.Marshal(kept[i])
+		if err != nil {
+			return 0, err
+		}
+		buffer.Write(append(line, '\n'))
+	}
+	tmp := filepath.Join(s.dir, indexFilename+".tmp")
+	if err := ioutil.WriteFile(tmp, buffer.Bytes(), 0644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, indexFilename)); err != nil {
+		return 0, err
+	}
+
+	// The files are only removed once the index no longer refers to them
+	s.entries = s.entries[:0]
+	for i := len(kept) - 1; i >= 0; i-- {
+		s.entries = append(s.entries, kept[i])
+	}
+	files := expiredBlobs
+	for _, e := range removed {
+		delete(s.ids, e.ID)
+		files = append(files, s.tracePath(e.ID))
+		for _, blob := range []string{e.Pcap, e.QLog} {
+			if blob != "" {
+				files = append(files, filepath.Join(s.dir, blob))
+			}
+		}
+	}
+	var err error
+	for _, file := range files {
+		if e := os.Remove(file); e != nil && !os.IsNotExist(e) && err == nil {
+			err = e
+		}
+	}
+	return len(removed), err
+}
+
+func (s *Store) tracePath(id string) string {
+	return filepath.Join(s.dir, "traces", id+".json")
+}
+
+// sort orders the entries by start time, then by host, scenario and attempt.
+func (s *Store) sort() {
+	sort.SliceStable(s.entries, func(i, j int) bool {
+		a, b := s.entries[i], s.entries[j]
+		if a.StartedAt != b.StartedAt {
+			return a.StartedAt < b.StartedAt
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Scenario != b.Scenario {
+			return a.Scenario < b.Scenario
+		}
+		return a.Attempt < b.Attempt
+	})
+}
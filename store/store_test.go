@@ -0,0 +1,105 @@
+package store
+
+import (
+	qt "github.com/QUIC-Tracker/quic-tracker"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTrace(host, scenario string, age time.Duration, errorCode uint8) *qt.Trace {
+	return &qt.Trace{Commit: "0123456789abcdef", Host: host, Scenario: scenario, StartedAt: time.Now().Add(-age).Unix(),
+		ErrorCode: errorCode, Results: make(map[string]interface{})}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quic_tracker_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	day := 24 * time.Hour
+	traces := []*qt.Trace{
+		newTrace("a:443", "zero_rtt", 20*day, 0),
+		newTrace("a:443", "zero_rtt", 10*day, 0),
+		newTrace("a:443", "zero_rtt", 3*day, 2),
+		newTrace("a:443", "zero_rtt", day, 2),
+		newTrace("b:443", "zero_rtt", 20*day, 0),
+		newTrace("b:443", "zero_rtt", 10*day, 1),
+		newTrace("b:443", "zero_rtt", day, 1),
+		newTrace("a:443", "key_update", day, 0),
+	}
+	traces[3].Pcap = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+	traces[3].QLog = map[string]interface{}{"qlog_version": "0.4"}
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added, err := s.Add(traces); err != nil || added != len(traces) {
+		t.Fatalf("added %d traces: %v", added, err)
+	}
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added, _ := s.Add(traces[:2]); added != 0 {
+		t.Errorf("%d traces were added twice", added)
+	}
+
+	last := s.Query(Query{Host: "a:443", Scenario: "zero_rtt", Last: 2})
+	if len(last) != 2 || last[0].StartedAt != traces[2].StartedAt || last[1].StartedAt != traces[3].StartedAt {
+		t.Errorf("unexpected last entries %+v", last)
+	}
+	if failed := s.Query(Query{Scenario: "*", Outcome: "failed", Since: time.Now().Add(-2 * day)}); len(failed) != 2 {
+		t.Errorf("unexpected failed entries %+v", failed)
+	}
+
+	transitions := s.StartedFailing("", "zero_rtt", time.Now().Add(-7*day))
+	if len(transitions) != 1 || transitions[0].Host != "a:443" || transitions[0].FirstFailed.StartedAt != traces[2].StartedAt {
+		t.Errorf("unexpected transitions %+v", transitions)
+	}
+
+	trace, err := s.Trace(last[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Pcap) != 4 || trace.QLog == nil || last[1].Pcap != "blobs/"+last[1].ID+".pcapng" {
+		t.Errorf("the blobs of %+v were not kept", last[1])
+	}
+
+	// A failure to write the index leaves the store unchanged
+	tmp := filepath.Join(dir, indexFilename+".tmp")
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Prune(Retention{MaxAge: 15 * day, BlobMaxAge: 12 * time.Hour, KeepLast: 3}); err == nil {
+		t.Errorf("no error when the index could not be written")
+	}
+	if trace, err := s.Trace(last[1]); err != nil || len(trace.Pcap) != 4 {
+		t.Errorf("the blobs were removed before the index was written: %v", err)
+	}
+	os.Remove(tmp)
+
+	removed, err := s.Prune(Retention{MaxAge: 15 * day, BlobMaxAge: 12 * time.Hour, KeepLast: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("%d traces removed instead of 1", removed)
+	}
+	if trace, err := s.Trace(s.Query(Query{Host: "a:443", Scenario: "zero_rtt", Last: 1})[0]); err != nil || trace.Pcap != nil || trace.QLog != nil {
+		t.Errorf("the blobs were not removed: %v", err)
+	}
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := s.Query(Query{}); len(entries) != len(traces)-1 {
+		t.Errorf("%d entries left after pruning", len(entries))
+	}
+}
@@ -2,6 +2,7 @@ package quictracker
 
 import (
 	"fmt"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
 	"math"
 	"sync"
 )
@@ -44,19 +45,35 @@ type StreamInput struct {
 	AppErrorCode uint64
 }
 
+// A StreamStateHandler is notified when a side of a stream changes state. The side is empty when the stream opens.
+type StreamStateHandler func(streamId uint64, side string, state string)
+
 type Streams struct {
-	streams map[uint64]*Stream
-	lock    *sync.Mutex
-	input   *Broadcaster
+	streams      map[uint64]*Stream
+	lock         *sync.Mutex
+	input        *Broadcaster
+	stateHandler *StreamStateHandler
 }
 
 func (s Streams) Get(streamId uint64) *Stream {
 	s.lock.Lock()
-	if s.streams[streamId] == nil {
-		s.streams[streamId] = NewStream()
+	stream, present := s.streams[streamId]
+	if !present {
+		stream = NewStream()
+		if handler := s.stateHandler; handler != nil {
+			stream.stateHandler = func(side string, state string) {
+				if *handler != nil {
+					(*handler)(streamId, side, state)
+				}
+			}
+		}
+		s.streams[streamId] = stream
 	}
 	s.lock.Unlock()
-	return s.streams[streamId]
+	if !present {
+		stream.UpdateState("", "open")
+	}
+	return stream
 }
 
 func (s Streams) GetAll() map[uint64]*Stream {
@@ -126,6 +143,7 @@ type Stream struct {
 	WriteCloseOffset uint64
 
 	readFeedback chan interface{}
+	stateHandler func(side string, state string)
 }
 
 func NewStream() *Stream {
@@ -141,6 +159,13 @@ func NewStream() *Stream {
 	return s
 }
 
+// UpdateState reports a new state of one side of the stream to the StreamStateHandler of its connection, if any.
+func (s *Stream) UpdateState(side string, state string) {
+	if s.stateHandler != nil {
+		s.stateHandler(side, state)
+	}
+}
+
 func (s *Stream) addToRead(f *StreamFrame) { // TODO: Flag implementations that retransmit different data for a given offset
 	if f.Offset > s.ReadCloseOffset {
 		// TODO: report this: write past fin bit
@@ -150,8 +175,9 @@ func (s *Stream) addToRead(f *StreamFrame) { // TODO: Flag implementations that
 		if s.ReadCloseOffset != math.MaxUint64 && s.ReadCloseOffset != f.Offset+f.Length {
 			// TODO: report this: new fin bit offset
 			return
-		} else {
+		} else if s.ReadCloseOffset == math.MaxUint64 {
 			s.ReadCloseOffset = f.Offset + f.Length
+			s.UpdateState(qlog.StreamSideReceiving, "size_known")
 		}
 	}
 
@@ -192,6 +218,7 @@ func (s *Stream) addToRead(f *StreamFrame) { // TODO: Flag implementations that
 	if s.ReadOffset == s.ReadCloseOffset && !s.ReadClosed {
 		s.ReadClosed = true
 		s.ReadChan.Close()
+		s.UpdateState(qlog.StreamSideReceiving, "data_received")
 	}
 }
 
@@ -19,6 +19,8 @@ type Trace struct {
 	StartedAt           int64                  `json:"started_at"` // The time at which the scenario started in epoch seconds
 	Duration            uint64                 `json:"duration"`   // Its duration in epoch milliseconds
 	ErrorCode           uint8                  `json:"error_code"` // A scenario-specific error code that reports its verdict
+	Checks              []Check                `json:"checks,omitempty"` // The properties of the host checked by the scenario
+	Attempt             int                    `json:"attempt,omitempty"` // The number of the run when the scenario is run several times against the host, starting at 1
 	Stream              []TracePacket          `json:"stream"`     // A clear-text copy of the packets that were sent and received
 	Pcap                []byte                 `json:"pcap"`       // The packet capture file associated with the trace
 	QLog                interface{}            `json:"qlog"`       // The QLog trace captured during the test run
@@ -59,15 +61,88 @@ func (t *Trace) MarkError(error uint8, message string, packet Packet) {
 	if message != "" {
 		t.Results["error"] = message
 	}
+	t.MarkPacketOfInterest(packet)
+}
+
+// MarkPacketOfInterest marks the packet as being of interest in the trace, e.g. because it is the cause of an error.
+func (t *Trace) MarkPacketOfInterest(packet Packet) {
+	if i := t.packetIndex(packet); i >= 0 {
+		t.Stream[i].IsOfInterest = true
+	}
+}
+
+// packetIndex returns the index of the packet in the stream of the trace, or -1.
+func (t *Trace) packetIndex(packet Packet) int {
 	if packet == nil {
-		return
+		return -1
+	}
+	for i := range t.Stream {
+		if t.Stream[i].Pointer == packet.Pointer() {
+			return i
+		}
+	}
+	return -1
+}
+
+// The status of a check.
+type CheckStatus string
+
+const (
+	CheckPassed  CheckStatus = "pass"
+	CheckFailed  CheckStatus = "fail"
+	CheckSkipped CheckStatus = "skip" // The property could not be checked, e.g. because another check failed
+)
+
+// A Check records whether the host has one of the properties tested by a scenario, e.g. that it validated a new path.
+type Check struct {
+	Name      string      `json:"name"`
+	Status    CheckStatus `json:"status"`
+	ErrorCode uint8       `json:"error_code,omitempty"` // The error code of the scenario corresponding to the failure of the check
+	Message   string      `json:"message,omitempty"`
+	Evidence  []int       `json:"evidence,omitempty"` // The indices in the stream of the packets that support the status
+}
+
+// Pass records that the host passed a check. The packets given as evidence are marked as of interest.
+func (t *Trace) Pass(name string, message string, evidence ...Packet) {
+	t.addCheck(Check{Name: name, Status: CheckPassed, Message: message}, evidence)
+}
+
+// Fail records that the host failed a check. The error code of the trace is the one of the first check that failed,
+// which replaces the error code the scenario may have set until then. The packets given as evidence are marked as of
+// interest.
+func (t *Trace) Fail(name string, errorCode uint8, message string, evidence ...Packet) {
+	if t.FailedCheck() == nil {
+		t.ErrorCode = errorCode
+		if message != "" {
+			t.Results["error"] = message
+		}
 	}
-	for _, tp := range t.Stream {
-		if tp.Pointer == packet.Pointer() {
-			tp.IsOfInterest = true
-			return
+	t.addCheck(Check{Name: name, Status: CheckFailed, ErrorCode: errorCode, Message: message}, evidence)
+}
+
+// Skip records that a check could not be performed.
+func (t *Trace) Skip(name string, message string) {
+	t.addCheck(Check{Name: name, Status: CheckSkipped, Message: message}, nil)
+}
+
+func (t *Trace) addCheck(c Check, evidence []Packet) {
+	for _, p := range evidence {
+		if i := t.packetIndex(p); i >= 0 {
+			t.Stream[i].IsOfInterest = true
+			c.Evidence = append(c.Evidence, i)
+		}
+	}
+	t.Checks = append(t.Checks, c)
+}
+
+// FailedCheck returns the first check that failed, or nil.
+func (t *Trace) FailedCheck() *Check {
+	for i := range t.Checks {
+		if t.Checks[i].Status == CheckFailed {
+			return &t.Checks[i]
 		}
 	}
+	return nil
 }
 
 func (t *Trace) AttachTo(conn *Connection) {
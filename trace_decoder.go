@@ -0,0 +1,249 @@
+package quictracker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A TraceDecoder rebuilds the packets and frames of a Trace from the clear-text copies stored in its stream, using the
+// same parsers as a live connection. It keeps one offline Connection per direction, so that the packet number and
+// stream states of each endpoint are reconstructed separately.
+type TraceDecoder struct {
+	toClient *Connection // Parses the packets sent by the server
+	toServer *Connection // Parses the packets sent by the client
+}
+
+// A DecodedPacket is the result of re-parsing a TracePacket.
+type DecodedPacket struct {
+	Index        int // The index of the packet in the stream of the trace
+	Direction    Direction
+	Timestamp    time.Time
+	Length       int
+	IsOfInterest bool
+	Packet       Packet // The parsed packet, nil when Error is set
+	Error        error
+}
+
+func NewTraceDecoder() *TraceDecoder {
+	return &TraceDecoder{toClient: newOfflineConnection(), toServer: newOfflineConnection()}
+}
+
+// Creates a Connection that is only suitable for parsing packets, it has no socket nor TLS state.
+func newOfflineConnection() *Connection {
+	c := new(Connection)
+	c.StreamInput = NewBroadcaster(1000)
+	c.PacketNumberLock = &sync.Mutex{}
+	c.PacketNumber = make(map[PNSpace]PacketNumber)
+	c.LargestPNsReceived = make(map[PNSpace]PacketNumber)
+	c.LargestPNsAcknowledged = make(map[PNSpace]PacketNumber)
+	c.CryptoStateLock = &sync.Mutex{}
+	c.CryptoStates = make(map[EncryptionLevel]*CryptoState)
+	c.CryptoStreams = make(map[PNSpace]*Stream)
+	c.Streams = Streams{streams: make(map[uint64]*Stream), lock: &sync.Mutex{}, input: &c.StreamInput}
+	return c
+}
+
+// ClientView returns the offline Connection used to parse the packets received by the client. Its streams hold the
+// data sent by the server.
+func (d *TraceDecoder) ClientView() *Connection { return d.toClient }
+
+// ServerView returns the offline Connection used to parse the packets sent by the client.
+func (d *TraceDecoder) ServerView() *Connection { return d.toServer }
+
+// Decode parses a single TracePacket. Packets must be decoded in the order of the trace, as each of them updates the
+// state used to parse the following ones.
+func (d *TraceDecoder) Decode(tp TracePacket) (packet Packet, err error) {
+	conn := d.toClient
+	if tp.Direction == ToServer {
+		conn = d.toServer
+	} else if tp.Direction != ToClient {
+		return nil, fmt.Errorf("unknown direction %s", tp.Direction)
+	}
+	if len(tp.Data) == 0 {
+		return nil, errors.New("empty packet")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if tp.Direction == ToClient && tp.Data[0]&0x80 == 0 && len(tp.Data) >= 21 {
+				// Only the stateless resets are stored without being decrypted
+				packet, err = ReadStatelessResetPacket(bytes.NewReader(tp.Data)), nil
+			} else {
+				packet, err = nil, fmt.Errorf("could not parse packet: %v", r)
+			}
+		}
+		if packet != nil {
+			ctx := PacketContext{Timestamp: time.Unix(0, tp.Timestamp*int64(time.Millisecond)), PacketSize: uint16(len(tp.Data)), DatagramSize: uint16(len(tp.Data))}
+			if tp.Direction == ToClient {
+				packet.SetReceiveContext(ctx)
+			} else {
+				packet.SetSendContext(ctx)
+			}
+		}
+	}()
+
+	buffer := bytes.NewReader(tp.Data)
+	if tp.Data[0]&0x80 == 0x80 && len(tp.Data) >= 5 && bytes.Equal(tp.Data[1:5], []byte{0, 0, 0, 0}) {
+		return ReadVersionNegotationPacket(buffer), nil
+	}
+
+	if tp.Data[0]&0x80 == 0x80 {
+		switch PacketType(tp.Data[0]-0xC0) >> 4 {
+		case Initial:
+			packet = ReadInitialPacket(buffer, conn)
+		case Handshake:
+			packet = ReadHandshakePacket(buffer, conn)
+		case ZeroRTTProtected:
+			var zeroRTTPacket *ZeroRTTProtectedPacket
+			if zeroRTTPacket, err = ReadZeroRTTProtectedPacket(buffer, conn); err != nil {
+				return nil, fmt.Errorf("could not parse packet: %s", err.Error())
+			}
+			packet = zeroRTTPacket
+		case Retry:
+			packet = ReadRetryPacket(buffer, conn)
+		}
+		d.learnConnectionIDs(tp.Direction, packet.Header().(*LongHeader))
+	} else {
+		packet = ReadProtectedPacket(buffer, conn)
+	}
+
+	if _, ok := packet.(Framer); ok && packet.Header().PacketNumber() > conn.LargestPNsReceived[packet.PNSpace()] {
+		conn.LargestPNsReceived[packet.PNSpace()] = packet.Header().PacketNumber()
+	}
+	return packet, nil
+}
+
+// Short headers do not carry the length of their connection ID, it is learned from the long headers.
+func (d *TraceDecoder) learnConnectionIDs(direction Direction, h *LongHeader) {
+	if direction == ToServer {
+		d.toClient.SourceCID = h.SourceCID
+		if h.PacketType() != ZeroRTTProtected {
+			d.toServer.SourceCID = h.DestinationCID
+		}
+	} else {
+		d.toServer.SourceCID = h.SourceCID
+		d.toClient.SourceCID = h.DestinationCID
+	}
+}
+
+// DecodeAll parses all the packets of the given trace in order.
+func (d *TraceDecoder) DecodeAll(trace *Trace) []DecodedPacket {
+	var packets []DecodedPacket
+	for i, tp := range trace.Stream {
+		p, err := d.Decode(tp)
+		packets = append(packets, DecodedPacket{
+			Index:        i,
+			Direction:    tp.Direction,
+			Timestamp:    time.Unix(0, tp.Timestamp*int64(time.Millisecond)),
+			Length:       len(tp.Data),
+			IsOfInterest: tp.IsOfInterest,
+			Packet:       p,
+			Error:        err,
+		})
+	}
+	return packets
+}
+
+// A Violation reports a protocol behaviour found in a decoded trace that does not conform to the specification.
+type Violation struct {
+	Index       int       `json:"index"` // The index of the offending packet in the stream of the trace
+	Direction   Direction `json:"direction"`
+	Description string    `json:"description"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("#%d (%s): %s", v.Index, v.Direction, v.Description)
+}
+
+var handshakeAllowedFrames = map[FrameType]bool{
+	PaddingFrameType:    true,
+	PingType:            true,
+	AckType:             true,
+	AckECNType:          true,
+	CryptoType:          true,
+	ConnectionCloseType: true,
+}
+
+// CheckViolations re-evaluates a set of protocol rules against the packets sent by the server. It reports the packets
+// that could not be parsed, frames that are not allowed in their packet type, reused packet numbers and
+// acknowledgements of packets that were never sent.
+func CheckViolations(packets []DecodedPacket) []Violation {
+	var violations []Violation
+	report := func(p DecodedPacket, format string, a ...interface{}) {
+		violations = append(violations, Violation{p.Index, p.Direction, fmt.Sprintf(format, a...)})
+	}
+
+	type spaceKey struct {
+		direction Direction
+		space     PNSpace
+	}
+	seen := make(map[spaceKey]map[PacketNumber]bool)
+	for _, d := range []Direction{ToServer, ToClient} {
+		for _, s := range []PNSpace{PNSpaceInitial, PNSpaceHandshake, PNSpaceAppData} {
+			seen[spaceKey{d, s}] = make(map[PacketNumber]bool)
+		}
+	}
+
+	for _, p := range packets {
+		if p.Error != nil {
+			report(p, "undecodable packet: %s", p.Error.Error())
+			continue
+		}
+		framer, ok := p.Packet.(Framer)
+		if !ok {
+			continue
+		}
+		space := p.Packet.PNSpace()
+		pn := p.Packet.Header().PacketNumber()
+		if p.Direction == ToServer {
+			seen[spaceKey{p.Direction, space}][pn] = true
+			continue
+		}
+		if seen[spaceKey{p.Direction, space}][pn] {
+			report(p, "packet number %d is reused in the %s space", pn, space.String())
+		}
+		seen[spaceKey{p.Direction, space}][pn] = true
+
+		if p.Packet.Header().PacketType() == ZeroRTTProtected {
+			report(p, "the server sent a 0-RTT packet")
+		}
+
+		for _, f := range framer.GetFrames() {
+			switch p.Packet.Header().PacketType() {
+			case Initial, Handshake:
+				if !handshakeAllowedFrames[f.FrameType()] {
+					report(p, "%s frame is not allowed in %s packets", f.FrameType().String(), p.Packet.Header().PacketType().String())
+				}
+			}
+			switch frame := f.(type) {
+			case *AckFrame:
+				checkAckedPackets(frame, seen[spaceKey{ToServer, space}], func(n PacketNumber) {
+					report(p, "ACK frame acknowledges packet %d in the %s space, which was never sent", n, space.String())
+				})
+			case *AckECNFrame:
+				checkAckedPackets(&frame.AckFrame, seen[spaceKey{ToServer, space}], func(n PacketNumber) {
+					report(p, "ACK frame acknowledges packet %d in the %s space, which was never sent", n, space.String())
+				})
+			case *StreamFrame:
+				if IsUniClient(frame.StreamId) {
+					report(p, "STREAM frame sent on client-initiated unidirectional stream %d", frame.StreamId)
+				}
+			}
+		}
+	}
+	return violations
+}
+
+func checkAckedPackets(frame *AckFrame, sent map[PacketNumber]bool, report func(PacketNumber)) {
+	if len(frame.AckRanges) == 0 {
+		return
+	}
+	for _, n := range frame.GetAckedPackets() {
+		if !sent[n] {
+			report(n)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package quictracker
+
+import "testing"
+
+func TestChecks(t *testing.T) {
+	trace := NewTrace("test", 1, "quic.example.com")
+	ping := new(ProtectedPacket)
+	ping.AddFrame(new(PingFrame))
+	trace.Stream = []TracePacket{{Pointer: new(ProtectedPacket).Pointer()}, {Pointer: ping.Pointer()}}
+
+	trace.Pass("first", "", ping)
+	if trace.ErrorCode != 0 || trace.FailedCheck() != nil {
+		t.Error("a check that passed failed the trace")
+	}
+	trace.Fail("second", 2, "the second check failed")
+	trace.Fail("third", 3, "the third check failed", ping)
+	trace.Skip("fourth", "the third check failed")
+
+	if trace.ErrorCode != 2 || trace.Results["error"] != "the second check failed" || trace.FailedCheck().Name != "second" {
+		t.Errorf("the trace has error code %d and error %v", trace.ErrorCode, trace.Results["error"])
+	}
+	if len(trace.Checks) != 4 || len(trace.Checks[2].Evidence) != 1 || trace.Checks[2].Evidence[0] != 1 || !trace.Stream[1].IsOfInterest {
+		t.Errorf("unexpected checks %+v", trace.Checks)
+	}
+}
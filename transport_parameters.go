@@ -2,9 +2,11 @@ package quictracker
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/QUIC-Tracker/quic-tracker/lib"
+	"github.com/QUIC-Tracker/quic-tracker/qlog"
 )
 
 type TransportParametersType uint64
@@ -51,6 +53,30 @@ type QuicTransportParameters struct {  // A set of QUIC transport parameters val
 	ToJSON                          map[string]interface{}
 }
 
+// QLog returns the data of the parameters_set qlog event describing these parameters, sent by the given owner.
+func (p *QuicTransportParameters) QLog(owner string) *qlog.ParametersSet {
+	return &qlog.ParametersSet{
+		Owner:                           owner,
+		OriginalDestinationConnectionID: p.OriginalDestinationConnectionId.String(),
+		InitialSourceConnectionID:       p.InitialSourceConnectionId.String(),
+		RetrySourceConnectionID:         p.RetrySourceConnectionId.String(),
+		StatelessResetToken:             hex.EncodeToString(p.StatelessResetToken),
+		DisableActiveMigration:          p.DisableMigration,
+		MaxIdleTimeout:                  p.IdleTimeout,
+		MaxUDPPayloadSize:               p.MaxPacketSize,
+		AckDelayExponent:                p.AckDelayExponent,
+		MaxAckDelay:                     p.MaxAckDelay,
+		ActiveConnectionIDLimit:         p.ActiveConnectionIdLimit,
+		InitialMaxData:                  p.MaxData,
+		InitialMaxStreamDataBidiLocal:   p.MaxStreamDataBidiLocal,
+		InitialMaxStreamDataBidiRemote:  p.MaxStreamDataBidiRemote,
+		InitialMaxStreamDataUni:         p.MaxStreamDataUni,
+		InitialMaxStreamsBidi:           p.MaxBidiStreams,
+		InitialMaxStreamsUni:            p.MaxUniStreams,
+		PreferredAddress:                hex.EncodeToString(p.PreferredAddress),
+	}
+}
+
 type TransportParameter struct {
 	ParameterType TransportParametersType
 	Value         []byte `tls:"head=2"`
@@ -1,11 +1,22 @@
 package quictracker
 
-import "github.com/dustin/go-broadcast"
+import (
+	"github.com/dustin/go-broadcast"
+	"sync/atomic"
+)
+
+var droppedEvents uint64
+
+// DroppedBroadcasterEvents returns the number of values submitted to broadcasters after they were closed, which were
+// dropped.
+func DroppedBroadcasterEvents() uint64 {
+	return atomic.LoadUint64(&droppedEvents)
+}
 
 type Broadcaster struct {
 	broadcast.Broadcaster
 	channels []chan interface{}
-	isClosed bool
+	isClosed uint32 // Accessed atomically, as values can be submitted while the broadcaster is closed
 }
 
 func NewBroadcaster(buflen int) Broadcaster {
@@ -19,16 +30,25 @@ func (b *Broadcaster) RegisterNewChan(size int) chan interface{} {
 	return c
 }
 
+// Submit broadcasts the value to the channels registered. Once the broadcaster is closed, the value is dropped instead
+// of blocking the caller.
+func (b *Broadcaster) Submit(m interface{}) {
+	if b.IsClosed() {
+		atomic.AddUint64(&droppedEvents, 1)
+		return
+	}
+	b.Broadcaster.Submit(m)
+}
+
 func (b *Broadcaster) Close() error {
-	if b.isClosed {
+	if !atomic.CompareAndSwapUint32(&b.isClosed, 0, 1) {
 		return nil
 	}
-	b.isClosed = true
 	for _, c := range b.channels {
 		close(c)
 	}
 	return b.Broadcaster.Close()
 }
 func (b *Broadcaster) IsClosed() bool {
-	return b.isClosed
+	return atomic.LoadUint32(&b.isClosed) == 1
 }
\ No newline at end of file
@@ -0,0 +1,33 @@
+package quictracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBroadcaster_SubmitAfterClose(t *testing.T) {
+	b := NewBroadcaster(0)
+	b.RegisterNewChan(0)
+	b.Close()
+	if !b.IsClosed() {
+		t.Error("the broadcaster should be closed")
+	}
+
+	dropped := DroppedBroadcasterEvents()
+	submitted := make(chan bool)
+	go func() {
+		b.Submit(true)
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Fatal("Submit blocked after Close")
+	}
+	if DroppedBroadcasterEvents() != dropped+1 {
+		t.Error("the value submitted after Close should be counted as dropped")
+	}
+	if b.Close() != nil {
+		t.Error("closing the broadcaster twice should not fail")
+	}
+}